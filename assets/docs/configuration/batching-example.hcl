@@ -0,0 +1,15 @@
+# Batching of messages between the source and target
+
+batching {
+  # Maximum number of messages to write to the target at once. Sources which write
+  # messages one at a time, such as kinesis and pubsub, are batched across their
+  # concurrent writes, so concurrent_writes should be at least this large.
+  # Setting to 1 disables batching (default: 1)
+  max_messages = 500
+
+  # Batches are written once they reach this many bytes of message data (default: 1048576)
+  max_bytes    = 5242880
+
+  # Maximum time (milliseconds) to wait for a batch to fill before writing it (default: 100)
+  max_wait_ms  = 250
+}
\ No newline at end of file
@@ -0,0 +1,22 @@
+# Health endpoints and profiling
+
+monitoring {
+  # Address to serve the health endpoints on (default: "", disabled):
+  #   /health/live  - responds 200 while the app is running
+  #   /health/ready - responds 200 while the target is open, writes to the target haven't been failing
+  #                   for longer than ready_write_failure_sec, and, if ready_source_idle_sec is set,
+  #                   a message has been pulled from the source within it. Otherwise it responds 503
+  #                   with the reason in the response body.
+  address                 = ":8081"
+
+  # Address to serve pprof on, under /debug/pprof/. It can be the same as address (default: "", disabled)
+  pprof_address           = "localhost:6060"
+
+  # Time (seconds) writes to the target can keep failing before the app is no longer ready (default: 60)
+  ready_write_failure_sec = 120
+
+  # Time (seconds) the source can go without a message being pulled before the app is no longer ready.
+  # Only set it for streams which always have data, and not for the HTTP source, which doesn't receive
+  # requests while it isn't ready (default: 0, disabled)
+  ready_source_idle_sec   = 300
+}
\ No newline at end of file
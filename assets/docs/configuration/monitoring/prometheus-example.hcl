@@ -0,0 +1,21 @@
+stats_receiver {
+  use "prometheus" {
+    # Address to serve the metrics on (default: ":9464")
+    address = "0.0.0.0:9464"
+
+    # Path to serve the metrics on (default: "/metrics")
+    path    = "/metrics"
+
+    # Prometheus metric namespace (default: "snowplow_snowbridge")
+    prefix  = "snowplow_snowbridge"
+
+    # Escaped JSON string with labels to add to every metric (default: "{}")
+    tags    = "{\"aKey\": \"aValue\"}"
+  }
+
+  # Time (seconds) the observer waits for new results (default: 1)
+  timeout_sec = 2
+
+  # Aggregation time window (seconds) for metrics being collected (default: 15)
+  buffer_sec  = 20
+}
\ No newline at end of file
@@ -0,0 +1,45 @@
+# Retry policies for writes to the target and failure target
+
+target {
+  use "kinesis" {
+    # Kinesis stream name to send data to
+    stream_name = "my-stream"
+
+    # AWS region of Kinesis stream
+    region      = "us-west-1"
+  }
+
+  retry {
+    # Number of attempts made before giving up on a write, which exits the app (default: 5)
+    max_attempts         = 10
+
+    # Delay (milliseconds) before the first retry, doubling for each retry after it (default: 1000)
+    base_delay_ms        = 500
+
+    # Maximum delay (milliseconds) between retries (default: 60000)
+    max_delay_ms         = 30000
+
+    # Whether to randomise each delay to between half and all of its value (default: true)
+    jitter               = true
+
+    # Whether to retry until the write succeeds, ignoring max_attempts (default: false)
+    infinite             = true
+
+    # Log an error, which is sent to Sentry if configured, every time this many
+    # consecutive attempts have failed (default: 10)
+    alert_after_attempts = 20
+  }
+}
+
+failure_target {
+  use "stdout" {}
+
+  retry {
+    max_attempts         = 10
+    base_delay_ms        = 500
+    max_delay_ms         = 30000
+    jitter               = true
+    infinite             = true
+    alert_after_attempts = 20
+  }
+}
\ No newline at end of file
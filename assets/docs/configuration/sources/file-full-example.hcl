@@ -0,0 +1,27 @@
+# Extended configuration for File as a source (all options)
+
+source {
+  use "file" {
+    # Directory to read every file from, or a glob matching the files to read.
+    # Files are read in lexical order, one message per line.
+    path              = "/data/enriched/*.tsv.gz"
+
+    # Compression of the files: "none", "gzip", "zstd", or "auto" to detect it
+    # from the file extension (default: "auto")
+    compression       = "gzip"
+
+    # Local file recording which files, and how far into them, have been acked.
+    # On restart, completed files are skipped and others resume from the acked offset
+    # (default: "snowbridge-file-source.checkpoint")
+    checkpoint_file   = "/data/checkpoint.json"
+
+    # Optional directory to move files to once every line has been acked
+    done_dir          = "/data/done"
+
+    # Maximum size of a single line in bytes (default: 10485760)
+    max_line_bytes    = 1048576
+
+    # Maximum concurrent goroutines (lightweight threads) for message processing (default: 50)
+    concurrent_writes = 20
+  }
+}
\ No newline at end of file
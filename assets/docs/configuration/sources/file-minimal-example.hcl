@@ -0,0 +1,8 @@
+# Minimal configuration for File as a source (only required options)
+
+source {
+  use "file" {
+    # Directory to read every file from, or a glob matching the files to read
+    path = "/data/enriched/*.tsv.gz"
+  }
+}
\ No newline at end of file
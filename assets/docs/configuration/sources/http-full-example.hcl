@@ -0,0 +1,22 @@
+# Extended configuration for HTTP as a source (all options)
+
+source {
+  use "http" {
+    # Address to listen on for requests (default: ":8081")
+    address             = "0.0.0.0:9090"
+
+    # Path to accept POST requests on (default: "/")
+    path                = "/webhook"
+
+    # Maximum size of a request body in bytes, larger requests are rejected with a 413 (default: 10485760)
+    # A body is read as a single message, unless sent with a newline-delimited
+    # Content-Type ("application/x-ndjson", "application/ndjson", "application/jsonl" or
+    # "application/x-jsonlines"), in which case each non-empty line is a message.
+    max_body_bytes      = 1048576
+
+    # Seconds to wait for every message in a request to be acked before responding
+    # with a 503, so that the caller retries (default: 30).
+    # It must be longer than targets which buffer messages, such as S3, may take to ack them.
+    ack_timeout_seconds = 60
+  }
+}
\ No newline at end of file
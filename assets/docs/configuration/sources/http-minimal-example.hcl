@@ -0,0 +1,5 @@
+# Minimal configuration for HTTP as a source (only required options)
+
+source {
+  use "http" {}
+}
\ No newline at end of file
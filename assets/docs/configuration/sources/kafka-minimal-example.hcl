@@ -0,0 +1,14 @@
+# Minimal configuration for Kafka as a source (only required options)
+
+source {
+  use "kafka" {
+    # Kafka broker connectinon string
+    brokers       = "my-kafka-connection-string"
+
+    # Kafka topic name
+    topic_name    = "snowplow-enriched-good"
+
+    # Kafka consumer group name
+    consumer_name = "snowbridge"
+  }
+}
\ No newline at end of file
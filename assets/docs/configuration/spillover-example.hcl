@@ -0,0 +1,17 @@
+# Spillover of messages to disk while the target is unavailable
+
+spillover {
+  # Directory to persist messages to once writes to the target have exhausted their retries.
+  # The messages are acked on the source once persisted, and drained back to the target in order
+  # once it is available again. New messages are spilled over too until the buffer is drained.
+  # Messages left in the directory are drained after a restart, so they are written at least once.
+  # Setting a path enables spillover (default: "")
+  path              = "/var/lib/snowbridge/spillover"
+
+  # Maximum size (bytes) of the messages on disk. Once full, failed writes exit the app as if
+  # spillover was disabled (default: 1073741824)
+  max_bytes         = 5368709120
+
+  # Time (milliseconds) to wait before retrying to drain messages to the target (default: 1000)
+  drain_interval_ms = 5000
+}
\ No newline at end of file
@@ -0,0 +1,59 @@
+# Extended configuration for Elasticsearch as a target (all options)
+
+target {
+  use "elasticsearch" {
+    # URL of the Elasticsearch or OpenSearch cluster. Documents are added with the _bulk API.
+    # Messages must be JSON objects, and any other messages are sent to the failure target.
+    url                        = "https://localhost:9200"
+
+    # Index to add documents to.
+    # It can be a Go text/template, rendered for every message against the message data in .Data
+    # and its partition key in .PartitionKey, eg. "events-{{ .Data.app_id }}"
+    index                      = "events-{{ .Data.app_id }}"
+
+    # Optional field of the message data to use as the document ID, with nested fields separated by dots.
+    # Messages without a string or number in the field are sent to the failure target.
+    # When it isn't set, document IDs are generated by the cluster (default: "").
+    document_id_field          = "event_id"
+
+    # Request timeout in seconds (default: 30)
+    request_timeout_in_seconds = 10
+
+    # Maximum number of documents sent in a single bulk request (default: 500)
+    batch_max_messages         = 1000
+
+    # Maximum combined size in bytes of the documents sent in a single bulk request (default: 5242880).
+    # Larger messages are sent to the failure target.
+    batch_byte_limit           = 10485760
+
+    # Optional basicauth username
+    basic_auth_username        = "myUsername"
+
+    # Optional basicauth password
+    # Even though you could just reference the password directly as a string,
+    # you could also reference an environment variable.
+    basic_auth_password        = env.MY_AUTH_PASSWORD
+
+    # Optional API key, as the base64 encoded value returned when creating it.
+    # Only one of basic auth or an API key can be used.
+    api_key                    = env.MY_API_KEY
+
+    # The optional certificate file for client authentication
+    cert_file                  = "myLocalhost.crt"
+
+    # The optional key file for client authentication
+    key_file                   = "MyLocalhost.key"
+
+    # The optional certificate authority file for TLS client authentication
+    ca_file                    = "myRootCA.crt"
+
+    # Whether to skip verifying ssl certificates chain (default: false)
+    # If tls_cert and tls_key are not provided, this setting is not applied.
+    skip_verify_tls            = true
+
+    # Documents are rejected by the cluster for different reasons, and each is handled separately:
+    #   - accepted documents are acked
+    #   - documents rejected with 429 or a 5xx status, eg. when the cluster is busy, are retried
+    #   - documents rejected with any other status, eg. when they don't match the index mapping, are sent to the failure target
+  }
+}
\ No newline at end of file
@@ -0,0 +1,11 @@
+# Minimal configuration for Elasticsearch as a target (only required options)
+
+target {
+  use "elasticsearch" {
+    # URL of the Elasticsearch or OpenSearch cluster
+    url   = "https://localhost:9200"
+
+    # Index to add documents to
+    index = "events"
+  }
+}
\ No newline at end of file
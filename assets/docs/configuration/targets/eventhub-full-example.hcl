@@ -29,5 +29,16 @@ target {
 
     # Sets the eventHub message partition key, which is used by the EventHub client's batching strategy
     set_eh_partition_key = true
+
+    # Optional partition ID to send every event to (default: "").
+    # When set, partition keys aren't set on events, regardless of set_eh_partition_key.
+    partition_id               = "1"
+
+    # Optional application properties to add to every event.
+    # It is provided as a JSON string of key-value pairs (default: "").
+    # Values can be Go text/templates, rendered for every message. The message data parsed as JSON is
+    # available as {{ .Data }} and the partition key as {{ .PartitionKey }}.
+    # Messages for which a property can't be rendered are treated as invalid.
+    properties                 = "{\"schema\":\"{{ .Data.event_name }}\",\"source\":\"snowbridge\"}"
   }
 }
@@ -0,0 +1,26 @@
+# Extended configuration for a file as a target (all options)
+
+target {
+  use "file" {
+    # Path of the files to write to. Messages are written one per line, and messages containing
+    # a newline are treated as invalid.
+    # It can contain date parts, which are replaced with the current UTC time when a file is opened:
+    # %Y (year), %m (month), %d (day), %H (hour), %M (minute) and %S (second). Use %% for a literal %.
+    # A new file is started whenever the rendered path changes. If a file already exists at the path,
+    # a counter is added before its extensions, eg. "events.1.ndjson.gz", so files are never appended to.
+    path                     = "/var/snowbridge/%Y/%m/%d/events-%H.ndjson.gz"
+
+    # Compression of the files: "none", "gzip" or "zstd" (default: "none")
+    compression              = "gzip"
+
+    # Start a new file once this many bytes of uncompressed data have been written to it (default: 0, no limit)
+    roll_size_bytes          = 104857600
+
+    # Start a new file once this many messages have been written to it (default: 0, no limit)
+    roll_messages            = 100000
+
+    # Close the file once it has been open for this many seconds, even without new messages, and start a new one
+    # on the next write (default: 0, no limit)
+    roll_interval_in_seconds = 3600
+  }
+}
\ No newline at end of file
@@ -0,0 +1,8 @@
+# Minimal configuration for a file as a target (only required options)
+
+target {
+  use "file" {
+    # Path of the files to write to
+    path = "/var/snowbridge/events.ndjson"
+  }
+}
\ No newline at end of file
@@ -2,7 +2,9 @@
 
 target {
   use "http" {
-    # URL endpoint
+    # URL endpoint.
+    # It can be a Go text/template, rendered for every message, eg. "https://acme.com/{{ .Data.app_id }}"
+    # (see body_template for what templates can use). Templated urls can't be combined with batching.
     url                        = "https://acme.com/x"
 
     # Byte limit for requests (default: 1048576)
@@ -16,6 +18,7 @@ target {
 
     # Optional headers to add to the request.
     # It is provided as a JSON string of key-value pairs (default: "").
+    # Header values can be templates, in the same way as the url.
     headers                    = "{\"Accept-Language\":\"en-US\"}"
 
     # Optional basicauth username
@@ -38,6 +41,62 @@ target {
     # Whether to skip verifying ssl certificates chain (default: false)
     # If tls_cert and tls_key are not provided, this setting is not applied.
     skip_verify_tls            = true
+
+    # Maximum number of messages sent in a single request (default: 1).
+    # When greater than 1, messages are combined into one request body
+    # in the format set by batch_format.
+    batch_max_messages         = 100
+
+    # Maximum combined size in bytes of the messages sent in a single request,
+    # when batching (default: 1048576)
+    batch_byte_limit           = 1048576
+
+    # Format of batched request bodies, either "json" for a JSON array of the
+    # messages, or "ndjson" for newline delimited messages (default: "json").
+    # Messages which are not valid JSON are sent to the failure target when using "json".
+    batch_format               = "json"
+
+    # Maximum number of requests made at the same time (default: 1)
+    max_concurrent_requests    = 10
+
+    # Maximum number of idle connections kept open for reuse (default: 100)
+    max_idle_connections       = 100
+
+    # How long an idle connection is kept open before it is closed (default: 90)
+    idle_connection_timeout_in_seconds = 90
+
+    # Optional OAuth2 client credentials. When set, a bearer token is requested from
+    # the token url and added to every request. Tokens are refreshed before they expire,
+    # and a request rejected with 401 Unauthorized is retried once with a new token.
+    oauth2_client_id           = "myClientId"
+    oauth2_client_secret       = env.MY_OAUTH2_CLIENT_SECRET
+    oauth2_token_url           = "https://auth.acme.com/oauth/token"
+
+    # Optional scopes requested for the OAuth2 token
+    oauth2_scopes              = ["events:write"]
+
+    # Optional Go text/template used to render the body of each message, instead of sending
+    # the message data as it is. Templates have access to:
+    #   .Data         - the message data parsed as JSON
+    #   .PartitionKey - the message partition key
+    # and the helper functions json, base64 and env. Messages which fail to render,
+    # eg. because they reference a missing field, are sent to the failure target.
+    body_template              = "{\"app\":\"{{ .Data.app_id }}\",\"event\":{{ json .Data.event }}}"
+
+    # Optional rules deciding how a response status code is handled, checked in order.
+    # Codes can be single codes or inclusive ranges, and the result is one of
+    # "success", "retry" or "invalid". Invalid messages are sent to the failure target
+    # along with the response body. When no rule matches, 2xx responses are a success
+    # and anything else is retried.
+    response_rule {
+      codes  = ["400", "409-422"]
+      result = "invalid"
+    }
+
+    response_rule {
+      codes  = ["404"]
+      result = "success"
+    }
   }
 }
 
@@ -5,8 +5,11 @@ target {
     # Kafka broker connectinon string
     brokers             = "my-kafka-connection-string"
 
-    # Kafka topic name
-    topic_name          = "snowplow-enriched-good"
+    # Kafka topic name.
+    # It can be a Go text/template, rendered for every message to route it to a topic.
+    # The message data parsed as JSON is available as {{ .Data }} and the partition key as {{ .PartitionKey }}.
+    # Messages for which the template can't be rendered are treated as invalid.
+    topic_name          = "snowplow-enriched-{{ .Data.app_id }}"
 
     # The Kafka version
     target_version      = "2.7.0"
@@ -17,8 +20,12 @@ target {
     # Kafka default byte limit is 1MB (default: 1048576)
     byte_limit          = 1048576
 
-    # Whether to compress data (default: false).
-    # Reduces network usage and increases latency.
+    # Compression codec for batches of records: "none", "gzip", "snappy", "lz4" or "zstd" (default: "none").
+    # Reduces network usage and increases latency. "zstd" requires a target_version of 2.1.0 or later.
+    compression_codec   = "zstd"
+
+    # Deprecated, use compression_codec = "snappy" instead.
+    # Compresses with snappy when compression_codec isn't set, and is ignored otherwise (default: false)
     compress            = true
 
     # Sets RequireAck s= WaitForAll, which waits for min.insync.replicas
@@ -65,5 +72,21 @@ target {
     # Best effort for how many bytes will trigger a flush (default: 0)
     # Setting to 0 means as fast as possible.
     flush_bytes         = 2
+
+    # Optional headers to add to every record, which requires a target_version of 0.11.0 or later.
+    # It is provided as a JSON string of key-value pairs (default: "").
+    # Header values can be templates, in the same way as the topic name.
+    headers             = "{\"schema\":\"{{ .Data.event_name }}\",\"collector_tstamp\":\"{{ .Data.collector_tstamp }}\"}"
+
+    # How records are assigned to partitions (default: "hash"):
+    #   "hash" - a hash of the partition key, used by default by sarama
+    #   "murmur2" - a murmur2 hash of the partition key, placing records the same way as the Java client's default partitioner
+    #   "round_robin" - records are spread evenly across partitions
+    #   "manual" - the partition is rendered from partition_template for every message
+    partitioner         = "manual"
+
+    # Template rendering the partition number for each message, used by the "manual" partitioner.
+    # Messages for which it doesn't render a partition which exists are treated as invalid.
+    partition_template  = "{{ .Data.partition }}"
   }
 }
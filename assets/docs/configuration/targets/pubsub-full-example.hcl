@@ -7,5 +7,33 @@ target {
 
     # Name of the topic to send data into
     topic_name = "some-acme-topic"
+
+    # Whether to publish messages with their partition key as the ordering key (default: false).
+    # Messages with the same ordering key are delivered in order to subscriptions with message ordering enabled.
+    # Ordering is only guaranteed for messages published in the same region.
+    enable_message_ordering = true
+
+    # Optional attributes to add to every message.
+    # It is provided as a JSON string of key-value pairs (default: "").
+    attributes = "{\"source\":\"snowbridge\"}"
+
+    # Messages are published in batches, which are sent when any of these thresholds is reached.
+    # Maximum size of a batch in bytes (default: 1000000)
+    publish_byte_threshold = 500000
+
+    # Maximum number of messages in a batch (default: 100)
+    publish_count_threshold = 50
+
+    # Maximum time to wait for a batch to fill up, in milliseconds (default: 10)
+    publish_delay_threshold_in_millis = 100
+
+    # Maximum number of messages waiting to be published (default: 1000)
+    flow_control_max_outstanding_messages = 500
+
+    # Maximum size of messages waiting to be published, where -1 is no limit (default: -1)
+    flow_control_max_outstanding_bytes = 100000000
+
+    # What to do when either flow control limit is exceeded, one of "ignore", "block" or "signal_error" (default: "ignore")
+    flow_control_limit_exceeded_behavior = "block"
   }
 }
@@ -0,0 +1,57 @@
+# Extended configuration for the router as a target (all options)
+
+target {
+  use "router" {
+    # Routes dispatch the messages which match all of their rules to their target, which is configured like any other target.
+    # A message which matches several routes is written to the first of them.
+    # Messages are only acked once the target they are dispatched to has accepted them.
+    # The router target can only be configured with HCL.
+    route {
+      # Optional atomic field of Snowplow enriched events to match against a regex.
+      # Messages which are not Snowplow enriched events are sent to the failure target.
+      atomic_field = "app_id"
+      regex        = "^web-"
+
+      target {
+        use "kinesis" {
+          stream_name = "web-events"
+          region      = "eu-west-1"
+        }
+      }
+    }
+
+    route {
+      # Optional regex to match the partition key of messages against
+      partition_key_regex = "^mobile-"
+
+      target {
+        use "kinesis" {
+          stream_name = "mobile-events"
+          region      = "eu-west-1"
+        }
+      }
+    }
+
+    route {
+      # Optional predicate, configured like a transformation. Messages which the transformation keeps match the route,
+      # and are written to its target unchanged. For a JavaScript or Lua script, messages are kept unless it sets FilterOut.
+      predicate {
+        use "js" {
+          script_path = "/tmp/route.js"
+        }
+      }
+
+      target {
+        use "pubsub" {
+          project_id = "acme-project"
+          topic_name = "page-views"
+        }
+      }
+    }
+
+    # Target for messages which match no route
+    default {
+      use "stdout" {}
+    }
+  }
+}
\ No newline at end of file
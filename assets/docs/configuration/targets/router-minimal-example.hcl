@@ -0,0 +1,10 @@
+# Minimal configuration for the router as a target (only required options)
+
+target {
+  use "router" {
+    # Messages which match no route are written to the target of the default route
+    default {
+      use "stdout" {}
+    }
+  }
+}
\ No newline at end of file
@@ -0,0 +1,36 @@
+# Extended configuration for S3 as a target (all options)
+
+target {
+  use "s3" {
+    # S3 bucket name to upload objects to
+    bucket_name = "my-bucket"
+
+    # AWS region of S3 bucket
+    region      = "us-west-1"
+
+    # Optional custom endpoint url to override aws endpoints,
+    # this is for use with local testing tools like localstack or MinIO - don't set for production use.
+    custom_aws_endpoint = "http://integration-localstack-1:4566"
+
+    # Role ARN to use on S3 bucket
+    role_arn    = "arn:aws:iam::123456789012:role/myrole"
+
+    # Optional template for the keys of objects (default: "{{ .Year }}/{{ .Month }}/{{ .Day }}/{{ .Hour }}/{{ .ID }}.ndjson").
+    # It can use the UTC date the object was started in .Year, .Month, .Day and .Hour, the partition key of
+    # the messages in .PartitionKey, and fields of the message data in .Data when it is JSON.
+    # Messages are grouped into objects by their rendered key, and .ID must be used to give each object a unique key.
+    # ".gz" or ".zst" is added to keys when objects are compressed.
+    key_template = "events/{{ .Data.app_id }}/{{ .Year }}-{{ .Month }}-{{ .Day }}/{{ .Hour }}/{{ .ID }}.ndjson"
+
+    # Compression of the objects: "none", "gzip" or "zstd" (default: "none")
+    compression = "gzip"
+
+    # Optional size in bytes of uncompressed data at which an object is uploaded (default: 16777216)
+    max_object_size_bytes = 67108864
+
+    # Optional number of seconds after which an object is uploaded, however much data it has (default: 60).
+    # Messages are only acked once their object has been uploaded, so with a source which only waits a limited
+    # time for acks, such as HTTP, it must be less than that source's ack timeout, or startup fails.
+    flush_interval_in_seconds = 300
+  }
+}
\ No newline at end of file
@@ -0,0 +1,11 @@
+# Minimal configuration for S3 as a target (only required options)
+
+target {
+  use "s3" {
+    # S3 bucket name to upload objects to
+    bucket_name = "my-bucket"
+
+    # AWS region of S3 bucket
+    region      = "us-west-1"
+  }
+}
\ No newline at end of file
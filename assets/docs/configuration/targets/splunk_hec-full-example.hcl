@@ -0,0 +1,58 @@
+# Extended configuration for Splunk HEC as a target (all options)
+
+target {
+  use "splunk_hec" {
+    # URL of the Splunk HTTP Event Collector, without the /services/collector path.
+    # Events are sent to its /services/collector/event endpoint.
+    url                            = "https://localhost:8088"
+
+    # HEC token to authenticate with
+    token                          = env.MY_HEC_TOKEN
+
+    # Optional sourcetype set on every event. When it isn't set, the default for the token is used.
+    sourcetype                     = "snowplow:enriched"
+
+    # Optional source set on every event. When it isn't set, the default for the token is used.
+    source                         = "snowbridge"
+
+    # Optional index to send events to. When it isn't set, the default for the token is used.
+    index                          = "snowplow"
+
+    # Request timeout in seconds (default: 5)
+    request_timeout_in_seconds     = 10
+
+    # Maximum number of events sent in a single request (default: 100)
+    batch_max_messages             = 500
+
+    # Maximum size in bytes of a single request, counting the event envelope of every message (default: 1048576).
+    # Messages whose event is larger are sent to the failure target.
+    batch_byte_limit               = 5242880
+
+    # The optional certificate file for client authentication
+    cert_file                      = "myLocalhost.crt"
+
+    # The optional key file for client authentication
+    key_file                       = "MyLocalhost.key"
+
+    # The optional certificate authority file for TLS client authentication
+    ca_file                        = "myRootCA.crt"
+
+    # Whether to skip verifying ssl certificates chain (default: false)
+    # If tls_cert and tls_key are not provided, this setting is not applied.
+    skip_verify_tls                = true
+
+    # Optional channel to request indexer acknowledgement on, which must be enabled for the token.
+    # When it is set, messages are only acked once HEC acknowledges that their events have been indexed.
+    indexer_ack_channel            = "11111111-1111-1111-1111-111111111111"
+
+    # How long to wait for HEC to acknowledge that the events of a request have been indexed,
+    # before they are retried (default: 60)
+    indexer_ack_timeout_in_seconds = 120
+
+    # Each message is sent as the event of a HEC event envelope, as JSON if it is valid JSON and as a string otherwise.
+    # The time of the event is the time the message was created.
+    # Requests rejected by HEC are handled depending on the response code:
+    #   - requests rejected because of a single event, eg. a blank event, send that event to the failure target and retry the rest
+    #   - any other rejected request, eg. when the server is busy, is retried
+  }
+}
\ No newline at end of file
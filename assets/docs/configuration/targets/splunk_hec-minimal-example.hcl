@@ -0,0 +1,11 @@
+# Minimal configuration for Splunk HEC as a target (only required options)
+
+target {
+  use "splunk_hec" {
+    # URL of the Splunk HTTP Event Collector, without the /services/collector path
+    url   = "https://localhost:8088"
+
+    # HEC token to authenticate with
+    token = env.MY_HEC_TOKEN
+  }
+}
\ No newline at end of file
@@ -14,5 +14,21 @@ target {
 
     # Role ARN to use on SQS queue
     role_arn   = "arn:aws:iam::123456789012:role/myrole"
+
+    # Optional number of seconds to delay delivery of each message by, between 0 and 900 (default: 0).
+    # Not supported by FIFO queues, which can have a delay set on the queue itself.
+    delay_seconds = 30
+
+    # Optional attributes to add to every message.
+    # It is provided as a JSON string of key-value pairs (default: "").
+    message_attributes = "{\"source\":\"snowbridge\"}"
+
+    # Queues with a name ending in ".fifo" are FIFO queues. Messages sent to them use their
+    # partition key as the message group ID, and messages without a partition key are invalid.
+    # Where to take the deduplication ID of messages sent to FIFO queues from (default: "content"):
+    #   "content" - a SHA-256 hash of the message data
+    #   "partition_key" - the partition key of the message
+    #   "none" - don't set one, the queue must have content-based deduplication enabled
+    deduplication_id_source = "partition_key"
   }
 }
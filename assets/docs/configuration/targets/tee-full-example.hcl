@@ -0,0 +1,34 @@
+# Extended configuration for the tee as a target (all options)
+
+target {
+  use "tee" {
+    # How messages are acked (default: "all"):
+    #   "all"     - once every target has accepted them. A message failed by some targets is retried only on those targets.
+    #   "primary" - once the first target has accepted them. The other targets are written to on a best-effort basis,
+    #               and their failures are only reported in the logs and metrics.
+    # Messages which a target they must be acked on rejects as oversized or invalid are sent to the failure target.
+    # The tee target can only be configured with HCL.
+    ack_mode = "primary"
+
+    # Every message is written to all the targets, each configured like any other target. The first target is the primary.
+    target {
+      use "kinesis" {
+        stream_name = "my-stream"
+        region      = "eu-west-1"
+      }
+    }
+
+    target {
+      use "s3" {
+        bucket_name = "my-archive-bucket"
+        region      = "eu-west-1"
+      }
+    }
+
+    target {
+      use "http" {
+        url = "https://acme.com/x"
+      }
+    }
+  }
+}
\ No newline at end of file
@@ -0,0 +1,21 @@
+# Minimal configuration for the tee as a target (only required options)
+
+target {
+  use "tee" {
+    # Every message is written to all the targets, each configured like any other target.
+    # At least two targets are required.
+    target {
+      use "kinesis" {
+        stream_name = "my-stream"
+        region      = "eu-west-1"
+      }
+    }
+
+    target {
+      use "s3" {
+        bucket_name = "my-archive-bucket"
+        region      = "eu-west-1"
+      }
+    }
+  }
+}
\ No newline at end of file
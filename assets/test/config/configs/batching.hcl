@@ -0,0 +1,6 @@
+# batching configuration
+
+batching {
+  max_messages = 500
+  max_wait_ms  = 250
+}
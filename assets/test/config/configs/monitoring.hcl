@@ -0,0 +1,7 @@
+# monitoring configuration
+
+monitoring {
+  address               = ":8081"
+  pprof_address         = "localhost:6060"
+  ready_source_idle_sec = 300
+}
@@ -0,0 +1,12 @@
+# stats receiver extended configuration for prometheus
+
+stats_receiver {
+  use "prometheus" {
+    address = "127.0.0.1:9090"
+    path    = "/test/metrics"
+    prefix  = "snowplow_test"
+    tags    = "{\"testKey\": \"testValue\"}"
+  }
+  timeout_sec = 2
+  buffer_sec  = 20
+}
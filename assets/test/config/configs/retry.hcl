@@ -0,0 +1,21 @@
+# retry configuration
+
+target {
+  use "stdout" {}
+
+  retry {
+    max_attempts  = 3
+    base_delay_ms = 500
+    jitter        = false
+  }
+}
+
+failure_target {
+  use "stdout" {}
+
+  retry {
+    infinite             = true
+    max_delay_ms         = 30000
+    alert_after_attempts = 20
+  }
+}
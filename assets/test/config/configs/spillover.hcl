@@ -0,0 +1,6 @@
+# spillover configuration
+
+spillover {
+  path      = "/tmp/snowbridge/spillover"
+  max_bytes = 5242880
+}
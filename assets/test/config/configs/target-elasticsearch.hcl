@@ -0,0 +1,10 @@
+# elasticsearch target configuration
+
+target {
+  use "elasticsearch" {
+    url               = "https://localhost:9200"
+    index             = "events-{{ .Data.app_id }}"
+    document_id_field = "event_id"
+    api_key           = "a2V5"
+  }
+}
@@ -11,5 +11,7 @@ target {
     context_timeout_in_seconds = 21
     batch_byte_limit           = 1000000
     set_eh_partition_key       = false
+    partition_id               = "1"
+    properties                 = "{\"source\":\"snowbridge\"}"
   }
 }
@@ -0,0 +1,11 @@
+# file target configuration
+
+target {
+  use "file" {
+    path                     = "/tmp/snowbridge/events-%Y%m%d.ndjson.gz"
+    compression              = "gzip"
+    roll_size_bytes          = 1048576
+    roll_messages            = 1000
+    roll_interval_in_seconds = 3600
+  }
+}
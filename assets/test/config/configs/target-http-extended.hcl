@@ -2,16 +2,37 @@
 
 target {
   use "http" {
-    url                        = "testUrl"
-    byte_limit                 = 1000000
-    request_timeout_in_seconds = 2
-    content_type               = "test/test"
-    headers                    = "{\"Accept-Language\":\"en-US\"}"
-    basic_auth_username        = "testUsername"
-    basic_auth_password        = "testPass"
-    cert_file                  = "myLocalhost.crt"
-    key_file                   = "MyLocalhost.key"
-    ca_file                    = "myRootCA.crt"
-    skip_verify_tls            = true
+    url                                = "testUrl"
+    byte_limit                         = 1000000
+    request_timeout_in_seconds         = 2
+    content_type                       = "test/test"
+    headers                            = "{\"Accept-Language\":\"en-US\"}"
+    basic_auth_username                = "testUsername"
+    basic_auth_password                = "testPass"
+    cert_file                          = "myLocalhost.crt"
+    key_file                           = "MyLocalhost.key"
+    ca_file                            = "myRootCA.crt"
+    skip_verify_tls                    = true
+    batch_max_messages                 = 100
+    batch_byte_limit                   = 500000
+    batch_format                       = "ndjson"
+    max_concurrent_requests            = 10
+    max_idle_connections               = 20
+    idle_connection_timeout_in_seconds = 30
+    oauth2_client_id                   = "testClientId"
+    oauth2_client_secret               = "testClientSecret"
+    oauth2_token_url                   = "https://oauth.example.com/token"
+    oauth2_scopes                      = ["read", "write"]
+    body_template                      = "{\"app\":\"{{ .Data.app_id }}\"}"
+
+    response_rule {
+      codes  = ["400", "409-422"]
+      result = "invalid"
+    }
+
+    response_rule {
+      codes  = ["503"]
+      result = "retry"
+    }
   }
 }
@@ -7,7 +7,7 @@ target {
     target_version      = "1.2.3"
     max_retries         = 11
     byte_limit          = 1000000
-    compress            = true
+    compression_codec   = "gzip"
     wait_for_all        = true
     idempotent          = true
     enable_sasl         = true
@@ -22,5 +22,8 @@ target {
     flush_frequency     = 2
     flush_messages      = 2
     flush_bytes         = 2
+    headers             = "{\"schema\":\"{{ .Data.event_schema }}\"}"
+    partitioner         = "manual"
+    partition_template  = "{{ .Data.partition }}"
   }
 }
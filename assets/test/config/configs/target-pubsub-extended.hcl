@@ -0,0 +1,16 @@
+# extended pubsub target configuration
+
+target {
+  use "pubsub" {
+    project_id                            = "testId"
+    topic_name                            = "testTopic"
+    enable_message_ordering               = true
+    attributes                            = "{\"source\":\"snowbridge\"}"
+    publish_byte_threshold                = 500000
+    publish_count_threshold               = 50
+    publish_delay_threshold_in_millis     = 100
+    flow_control_max_outstanding_messages = 500
+    flow_control_max_outstanding_bytes    = 100000000
+    flow_control_limit_exceeded_behavior  = "block"
+  }
+}
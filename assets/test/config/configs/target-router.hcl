@@ -0,0 +1,30 @@
+# router target configuration
+
+target {
+  use "router" {
+    route {
+      atomic_field = "app_id"
+      regex        = "^web-"
+
+      target {
+        use "http" {
+          url = "http://localhost:8080/web"
+        }
+      }
+    }
+
+    route {
+      partition_key_regex = "^mobile$"
+
+      target {
+        use "http" {
+          url = "http://localhost:8080/mobile"
+        }
+      }
+    }
+
+    default {
+      use "stdout" {}
+    }
+  }
+}
@@ -0,0 +1,10 @@
+# s3 target configuration
+
+target {
+  use "s3" {
+    bucket_name  = "testBucket"
+    region       = "eu-test-1"
+    key_template = "{{ .Year }}/{{ .Month }}/{{ .Day }}/{{ .PartitionKey }}/{{ .ID }}.ndjson"
+    compression  = "gzip"
+  }
+}
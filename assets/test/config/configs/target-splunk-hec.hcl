@@ -0,0 +1,9 @@
+# splunk_hec target configuration
+
+target {
+  use "splunk_hec" {
+    url        = "https://localhost:8088"
+    token      = "00000000-0000-0000-0000-000000000000"
+    sourcetype = "snowplow:enriched"
+  }
+}
@@ -0,0 +1,11 @@
+# extended config for sqs target
+
+target {
+  use "sqs" {
+    queue_name              = "testQueue.fifo"
+    region                  = "eu-test-1"
+    role_arn                = "xxx-test-role-arn"
+    message_attributes      = "{\"source\": \"snowbridge\"}"
+    deduplication_id_source = "partition_key"
+  }
+}
@@ -0,0 +1,17 @@
+# tee target configuration
+
+target {
+  use "tee" {
+    ack_mode = "primary"
+
+    target {
+      use "http" {
+        url = "http://localhost:8080/primary"
+      }
+    }
+
+    target {
+      use "stdout" {}
+    }
+  }
+}
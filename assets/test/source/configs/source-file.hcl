@@ -0,0 +1,12 @@
+# file source configuration
+
+source {
+  use "file" {
+    path              = "/data/enriched/*.tsv.gz"
+    compression       = "gzip"
+    checkpoint_file   = "/data/checkpoint.json"
+    done_dir          = "/data/done"
+    max_line_bytes    = 1048576
+    concurrent_writes = 20
+  }
+}
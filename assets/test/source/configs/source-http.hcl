@@ -0,0 +1,10 @@
+# http source configuration
+
+source {
+  use "http" {
+    address             = "0.0.0.0:9090"
+    path                = "/webhook"
+    max_body_bytes      = 2048
+    ack_timeout_seconds = 10
+  }
+}
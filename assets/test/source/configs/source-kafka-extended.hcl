@@ -0,0 +1,20 @@
+# kafka source extended configuration
+
+source {
+  use "kafka" {
+    brokers           = "testBrokers"
+    topic_name        = "testTopic"
+    consumer_name     = "testConsumer"
+    offsets_initial   = -1
+    target_version    = "2.7.0"
+    enable_sasl       = true
+    sasl_username     = "testUsername"
+    sasl_password     = "testPass"
+    sasl_algorithm    = "sha256"
+    cert_file         = "myLocalhost.crt"
+    key_file          = "MyLocalhost.key"
+    ca_file           = "myRootCA.crt"
+    skip_verify_tls   = true
+    concurrent_writes = 15
+  }
+}
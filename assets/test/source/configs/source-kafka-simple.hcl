@@ -0,0 +1,9 @@
+# kafka source simple configuration
+
+source {
+  use "kafka" {
+    brokers       = "testBrokers"
+    topic_name    = "testTopic"
+    consumer_name = "testConsumer"
+  }
+}
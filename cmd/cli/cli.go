@@ -8,27 +8,28 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	retry "github.com/snowplow-devops/go-retry"
 	"github.com/urfave/cli"
 
-	"net/http"
-	// pprof imported for the side effect of registering its HTTP handlers
-	_ "net/http/pprof"
-
 	"github.com/snowplow/snowbridge/cmd"
 	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/batcher"
 	"github.com/snowplow/snowbridge/pkg/failure/failureiface"
 	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/monitoring"
 	"github.com/snowplow/snowbridge/pkg/observer"
+	"github.com/snowplow/snowbridge/pkg/retry"
 	"github.com/snowplow/snowbridge/pkg/source/sourceconfig"
 	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+	"github.com/snowplow/snowbridge/pkg/spillover"
 	"github.com/snowplow/snowbridge/pkg/target/targetiface"
 	"github.com/snowplow/snowbridge/pkg/telemetry"
 	"github.com/snowplow/snowbridge/pkg/transform"
@@ -69,18 +70,11 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "profile, p",
-			Usage: "Enable application profiling endpoint on port 8080",
+			Usage: "Enable application profiling endpoint on port 8080, unless monitoring.pprof_address is set",
 		},
 	}
 
 	app.Action = func(c *cli.Context) error {
-		profile := c.Bool("profile")
-		if profile {
-			go func() {
-				http.ListenAndServe("localhost:8080", nil)
-			}()
-		}
-
 		s, err := sourceconfig.GetSource(cfg, supportedSources)
 		if err != nil {
 			return err
@@ -91,10 +85,15 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 			return err
 		}
 
+		cfg.SetRoutePredicateBuilder(transformconfig.RoutePredicateBuilder(cfg, supportedTransformations))
 		t, err := cfg.GetTarget()
 		if err != nil {
 			return err
 		}
+		err = checkAckDelay(s, t)
+		if err != nil {
+			return err
+		}
 		t.Open()
 
 		ft, err := cfg.GetFailureTarget(cmd.AppName, cmd.AppVersion)
@@ -113,6 +112,44 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 		}
 		o.Start()
 
+		// The target was opened above, and is closed on shutdown
+		o.TargetOpened()
+
+		// Serve the health of the app, and pprof, if enabled
+		monitoringCfg := cfg.Data.Monitoring
+		if c.Bool("profile") && monitoringCfg.PprofAddress == "" {
+			monitoringCfg.PprofAddress = "localhost:8080"
+		}
+		ms := monitoring.New(
+			monitoringCfg.Address,
+			monitoringCfg.PprofAddress,
+			time.Duration(monitoringCfg.ReadyWriteFailureSec)*time.Second,
+			time.Duration(monitoringCfg.ReadySourceIdleSec)*time.Second,
+			o,
+		)
+		err = ms.Start()
+		if err != nil {
+			return err
+		}
+
+		// Spill messages over to disk while the target is unavailable, if enabled
+		var sp *spillover.Buffer
+		if spilloverCfg := cfg.Data.Spillover; spilloverCfg.Path != "" {
+			sp, err = spillover.New(
+				spilloverCfg.Path,
+				spilloverCfg.MaxBytes,
+				time.Duration(spilloverCfg.DrainIntervalMs)*time.Millisecond,
+				o.SpilloverDepth,
+			)
+			if err != nil {
+				return err
+			}
+			drain := targetWriteFunc(t, ft, o, cfg.GetTargetRetryPolicy(), cfg.GetFailureTargetRetryPolicy(), nil)
+			sp.Start(func(messages []*models.Message) error {
+				return drain(messages, nil)
+			})
+		}
+
 		stopTelemetry := telemetry.InitTelemetryWithCollector(cfg)
 
 		// Handle SIGTERM
@@ -139,9 +176,14 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 			case <-time.After(5 * time.Second):
 				log.Error("source.Stop() took more than 5 seconds, forcing shutdown ...")
 
+				if sp != nil {
+					sp.Stop()
+				}
 				t.Close()
+				o.TargetClosed()
 				ft.Close()
 				o.Stop()
+				ms.Stop()
 				stopTelemetry()
 
 				if err != nil {
@@ -152,9 +194,18 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 			}
 		}()
 
+		// Batch messages from concurrent source writes before they reach the target
+		batching := cfg.Data.Batching
+		b := batcher.New(
+			sourceWriteFunc(t, ft, tr, o, cfg.GetTargetRetryPolicy(), cfg.GetFailureTargetRetryPolicy(), sp),
+			batching.MaxMessages,
+			batching.MaxBytes,
+			time.Duration(batching.MaxWaitMs)*time.Millisecond,
+		)
+
 		// Callback functions for the source to leverage when writing data
 		sf := sourceiface.SourceFunctions{
-			WriteToTarget: sourceWriteFunc(t, ft, tr, o),
+			WriteToTarget: b.Write,
 		}
 
 		// Read is a long running process and will only return when the source
@@ -164,9 +215,14 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 			return err
 		}
 
+		if sp != nil {
+			sp.Stop()
+		}
 		t.Close()
+		o.TargetClosed()
 		ft.Close()
 		o.Stop()
+		ms.Stop()
 		return nil
 	}
 
@@ -179,13 +235,12 @@ func RunCli(supportedSources []config.ConfigurationPair, supportedTransformation
 
 // sourceWriteFunc builds the function which wraps the different objects together to handle:
 //
-// 1. Sending messages to the target
-// 2. Observing results
-// 3. Sending oversized messages to the failure target
-// 4. Observing these results
-//
-// All with retry logic baked in to remove any of this handling from the implementations
-func sourceWriteFunc(t targetiface.Target, ft failureiface.Failure, tr transform.TransformationApplyFunction, o *observer.Observer) func(messages []*models.Message) error {
+// 1. Applying transformations
+// 2. Acking and observing filtered messages
+// 3. Writing the transformed messages with targetWriteFunc
+func sourceWriteFunc(t targetiface.Target, ft failureiface.Failure, tr transform.TransformationApplyFunction, o *observer.Observer, targetRetry *retry.Policy, failureTargetRetry *retry.Policy, sp *spillover.Buffer) func(messages []*models.Message) error {
+	write := targetWriteFunc(t, ft, o, targetRetry, failureTargetRetry, sp)
+
 	return func(messages []*models.Message) error {
 
 		// Apply transformations
@@ -203,25 +258,62 @@ func sourceWriteFunc(t targetiface.Target, ft failureiface.Failure, tr transform
 		filterRes := models.NewFilterResult(messagesToFilter)
 		o.Filtered(filterRes)
 
+		return write(transformed.Result, transformed.Invalid)
+	}
+}
+
+// targetWriteFunc builds the function which handles:
+//
+// 1. Sending messages to the target, or spilling them over if the target is unavailable
+// 2. Observing results
+// 3. Sending oversized and invalid messages to the failure target
+// 4. Observing these results
+//
+// All with retry logic baked in to remove any of this handling from the implementations.
+// Messages are only spilled over when sp is provided.
+func targetWriteFunc(t targetiface.Target, ft failureiface.Failure, o *observer.Observer, targetRetry *retry.Policy, failureTargetRetry *retry.Policy, sp *spillover.Buffer) func(messages []*models.Message, invalid []*models.Message) error {
+	return func(messages []*models.Message, transformInvalid []*models.Message) error {
+
 		// Send message buffer
-		messagesToSend := transformed.Result
+		messagesToSend := messages
 
-		res, err := retry.ExponentialWithInterface(5, time.Second, "target.Write", func() (interface{}, error) {
-			res, err := t.Write(messagesToSend)
+		// Oversized and invalid messages are collected across attempts, as each retry only resends the failures
+		var oversized []*models.Message
+		var invalid []*models.Message
 
-			o.TargetWrite(res)
-			messagesToSend = res.Failed
-			return res, err
-		})
-		if err != nil {
-			return err
+		if sp != nil && !sp.IsEmpty() {
+			// Messages join the back of the spillover buffer until it is drained, so that the target receives them in order
+			err := sp.Spill(messagesToSend)
+			if err != nil {
+				return err
+			}
+		} else {
+			err := targetRetry.Run("target.Write", func() error {
+				res, err := t.Write(messagesToSend)
+
+				o.TargetWrite(res)
+				messagesToSend = res.Failed
+				oversized = append(oversized, res.Oversized...)
+				invalid = append(invalid, res.Invalid...)
+				return err
+			}, o.TargetWriteRetry)
+			if err != nil {
+				if sp == nil {
+					return err
+				}
+
+				log.WithFields(log.Fields{"error": err}).Warnf("Spilling over %d messages the target failed to accept", len(messagesToSend))
+				err2 := sp.Spill(messagesToSend)
+				if err2 != nil {
+					return errors.Wrap(err2, "Error spilling over messages")
+				}
+			}
 		}
-		resCast := res.(*models.TargetWriteResult)
 
 		// Send oversized message buffer
-		messagesToSend = resCast.Oversized
+		messagesToSend = oversized
 		if len(messagesToSend) > 0 {
-			err2 := retry.Exponential(5, time.Second, "failureTarget.WriteOversized", func() error {
+			err2 := failureTargetRetry.Run("failureTarget.WriteOversized", func() error {
 				res, err := ft.WriteOversized(t.MaximumAllowedMessageSizeBytes(), messagesToSend)
 				if err != nil {
 					return err
@@ -233,16 +325,16 @@ func sourceWriteFunc(t targetiface.Target, ft failureiface.Failure, tr transform
 				o.TargetWriteOversized(res)
 				messagesToSend = res.Failed
 				return err
-			})
+			}, o.FailureTargetWriteRetry)
 			if err2 != nil {
 				return err2
 			}
 		}
 
 		// Send invalid message buffer
-		messagesToSend = append(resCast.Invalid, transformed.Invalid...)
+		messagesToSend = append(invalid, transformInvalid...)
 		if len(messagesToSend) > 0 {
-			err3 := retry.Exponential(5, time.Second, "failureTarget.WriteInvalid", func() error {
+			err3 := failureTargetRetry.Run("failureTarget.WriteInvalid", func() error {
 				res, err := ft.WriteInvalid(messagesToSend)
 				if err != nil {
 					return err
@@ -254,7 +346,7 @@ func sourceWriteFunc(t targetiface.Target, ft failureiface.Failure, tr transform
 				o.TargetWriteInvalid(res)
 				messagesToSend = res.Failed
 				return err
-			})
+			}, o.FailureTargetWriteRetry)
 			if err3 != nil {
 				return err3
 			}
@@ -264,6 +356,19 @@ func sourceWriteFunc(t targetiface.Target, ft failureiface.Failure, tr transform
 	}
 }
 
+// checkAckDelay returns an error if the target may take longer to ack messages than the source waits for
+// them to be acked, as the source would then fail every message buffered by the target
+func checkAckDelay(s sourceiface.Source, t targetiface.Target) error {
+	waiter, ok := s.(sourceiface.AckWaiter)
+	if !ok {
+		return nil
+	}
+	if delay := targetiface.MaximumAckDelay(t); delay >= waiter.AckTimeout() {
+		return errors.New(fmt.Sprintf("The target may take up to %v to ack messages, which must be less than the source ack timeout of %v", delay, waiter.AckTimeout()))
+	}
+	return nil
+}
+
 // exitWithError will ensure we log the error and leave time for Sentry to flush
 func exitWithError(err error, flushSentry bool) {
 	log.WithFields(log.Fields{"error": err}).Error(err)
@@ -10,6 +10,9 @@ package main
 import (
 	"github.com/snowplow/snowbridge/cmd/cli"
 	"github.com/snowplow/snowbridge/config"
+	filesource "github.com/snowplow/snowbridge/pkg/source/file"
+	httpsource "github.com/snowplow/snowbridge/pkg/source/http"
+	kafkasource "github.com/snowplow/snowbridge/pkg/source/kafka"
 	pubsubsource "github.com/snowplow/snowbridge/pkg/source/pubsub"
 	sqssource "github.com/snowplow/snowbridge/pkg/source/sqs"
 	stdinsource "github.com/snowplow/snowbridge/pkg/source/stdin"
@@ -18,7 +21,7 @@ import (
 
 func main() {
 	// Make a slice of SourceConfigPairs supported for this build
-	sourceConfigPairs := []config.ConfigurationPair{stdinsource.ConfigPair, sqssource.ConfigPair, pubsubsource.ConfigPair}
+	sourceConfigPairs := []config.ConfigurationPair{stdinsource.ConfigPair, sqssource.ConfigPair, pubsubsource.ConfigPair, kafkasource.ConfigPair, httpsource.ConfigPair, filesource.ConfigPair}
 
 	cli.RunCli(sourceConfigPairs, transformconfig.SupportedTransformations)
 }
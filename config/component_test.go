@@ -31,9 +31,21 @@ func TestCreateTargetComponentHCL(t *testing.T) {
 			File: "target-sqs.hcl",
 			Plug: testSQSTargetAdapter(testSQSTargetFunc),
 			Expected: &target.SQSTargetConfig{
-				QueueName: "testQueue",
-				Region:    "eu-test-1",
-				RoleARN:   "xxx-test-role-arn",
+				QueueName:             "testQueue",
+				Region:                "eu-test-1",
+				RoleARN:               "xxx-test-role-arn",
+				DeduplicationIDSource: "content",
+			},
+		},
+		{
+			File: "target-sqs-extended.hcl",
+			Plug: testSQSTargetAdapter(testSQSTargetFunc),
+			Expected: &target.SQSTargetConfig{
+				QueueName:             "testQueue.fifo",
+				Region:                "eu-test-1",
+				RoleARN:               "xxx-test-role-arn",
+				MessageAttributes:     "{\"source\": \"snowbridge\"}",
+				DeduplicationIDSource: "partition_key",
 			},
 		},
 		{
@@ -64,92 +76,119 @@ func TestCreateTargetComponentHCL(t *testing.T) {
 				ContextTimeoutInSeconds: 21,
 				BatchByteLimit:          1000000,
 				SetEHPartitionKey:       false,
+				PartitionID:             "1",
+				Properties:              "{\"source\":\"snowbridge\"}",
 			},
 		},
 		{
 			File: "target-http-simple.hcl",
 			Plug: testHTTPTargetAdapter(testHTTPTargetFunc),
 			Expected: &target.HTTPTargetConfig{
-				HTTPURL:                 "testUrl",
-				ByteLimit:               1048576,
-				RequestTimeoutInSeconds: 5,
-				ContentType:             "application/json",
-				Headers:                 "",
-				BasicAuthUsername:       "",
-				BasicAuthPassword:       "",
-				CertFile:                "",
-				KeyFile:                 "",
-				CaFile:                  "",
-				SkipVerifyTLS:           false,
+				HTTPURL:                        "testUrl",
+				ByteLimit:                      1048576,
+				RequestTimeoutInSeconds:        5,
+				ContentType:                    "application/json",
+				Headers:                        "",
+				BasicAuthUsername:              "",
+				BasicAuthPassword:              "",
+				CertFile:                       "",
+				KeyFile:                        "",
+				CaFile:                         "",
+				SkipVerifyTLS:                  false,
+				BatchMaxMessages:               1,
+				BatchByteLimit:                 1048576,
+				BatchFormat:                    "json",
+				MaxConcurrentRequests:          1,
+				MaxIdleConnections:             100,
+				IdleConnectionTimeoutInSeconds: 90,
 			},
 		},
 		{
 			File: "target-http-extended.hcl",
 			Plug: testHTTPTargetAdapter(testHTTPTargetFunc),
 			Expected: &target.HTTPTargetConfig{
-				HTTPURL:                 "testUrl",
-				ByteLimit:               1000000,
-				RequestTimeoutInSeconds: 2,
-				ContentType:             "test/test",
-				Headers:                 "{\"Accept-Language\":\"en-US\"}",
-				BasicAuthUsername:       "testUsername",
-				BasicAuthPassword:       "testPass",
-				CertFile:                "myLocalhost.crt",
-				KeyFile:                 "MyLocalhost.key",
-				CaFile:                  "myRootCA.crt",
-				SkipVerifyTLS:           true,
+				HTTPURL:                        "testUrl",
+				ByteLimit:                      1000000,
+				RequestTimeoutInSeconds:        2,
+				ContentType:                    "test/test",
+				Headers:                        "{\"Accept-Language\":\"en-US\"}",
+				BasicAuthUsername:              "testUsername",
+				BasicAuthPassword:              "testPass",
+				CertFile:                       "myLocalhost.crt",
+				KeyFile:                        "MyLocalhost.key",
+				CaFile:                         "myRootCA.crt",
+				SkipVerifyTLS:                  true,
+				BatchMaxMessages:               100,
+				BatchByteLimit:                 500000,
+				BatchFormat:                    "ndjson",
+				MaxConcurrentRequests:          10,
+				MaxIdleConnections:             20,
+				IdleConnectionTimeoutInSeconds: 30,
+				OAuth2ClientID:                 "testClientId",
+				OAuth2ClientSecret:             "testClientSecret",
+				OAuth2TokenURL:                 "https://oauth.example.com/token",
+				OAuth2Scopes:                   []string{"read", "write"},
+				BodyTemplate:                   "{\"app\":\"{{ .Data.app_id }}\"}",
+				ResponseRules: []*target.HTTPResponseRule{
+					{Codes: []string{"400", "409-422"}, Result: "invalid"},
+					{Codes: []string{"503"}, Result: "retry"},
+				},
 			},
 		},
 		{
 			File: "target-kafka-simple.hcl",
 			Plug: testKafkaTargetAdapter(testKafkaTargetFunc),
 			Expected: &target.KafkaConfig{
-				Brokers:        "testBrokers",
-				TopicName:      "testTopic",
-				TargetVersion:  "",
-				MaxRetries:     10,
-				ByteLimit:      1048576,
-				Compress:       false,
-				WaitForAll:     false,
-				Idempotent:     false,
-				EnableSASL:     false,
-				SASLUsername:   "",
-				SASLPassword:   "",
-				SASLAlgorithm:  "sha512",
-				CertFile:       "",
-				KeyFile:        "",
-				CaFile:         "",
-				SkipVerifyTLS:  false,
-				ForceSync:      false,
-				FlushFrequency: 0,
-				FlushMessages:  0,
-				FlushBytes:     0,
+				Brokers:          "testBrokers",
+				TopicName:        "testTopic",
+				TargetVersion:    "",
+				MaxRetries:       10,
+				ByteLimit:        1048576,
+				CompressionCodec: "",
+				WaitForAll:       false,
+				Idempotent:       false,
+				EnableSASL:       false,
+				SASLUsername:     "",
+				SASLPassword:     "",
+				SASLAlgorithm:    "sha512",
+				CertFile:         "",
+				KeyFile:          "",
+				CaFile:           "",
+				SkipVerifyTLS:    false,
+				ForceSync:        false,
+				FlushFrequency:   0,
+				FlushMessages:    0,
+				FlushBytes:       0,
+				Partitioner:      "hash",
 			},
 		},
 		{
 			File: "target-kafka-extended.hcl",
 			Plug: testKafkaTargetAdapter(testKafkaTargetFunc),
 			Expected: &target.KafkaConfig{
-				Brokers:        "testBrokers",
-				TopicName:      "testTopic",
-				TargetVersion:  "1.2.3",
-				MaxRetries:     11,
-				ByteLimit:      1000000,
-				Compress:       true,
-				WaitForAll:     true,
-				Idempotent:     true,
-				EnableSASL:     true,
-				SASLUsername:   "testUsername",
-				SASLPassword:   "testPass",
-				SASLAlgorithm:  "sha256",
-				CertFile:       "myLocalhost.crt",
-				KeyFile:        "MyLocalhost.key",
-				CaFile:         "myRootCA.crt",
-				SkipVerifyTLS:  true,
-				ForceSync:      true,
-				FlushFrequency: 2,
-				FlushMessages:  2,
-				FlushBytes:     2,
+				Brokers:           "testBrokers",
+				TopicName:         "testTopic",
+				TargetVersion:     "1.2.3",
+				MaxRetries:        11,
+				ByteLimit:         1000000,
+				CompressionCodec:  "gzip",
+				WaitForAll:        true,
+				Idempotent:        true,
+				EnableSASL:        true,
+				SASLUsername:      "testUsername",
+				SASLPassword:      "testPass",
+				SASLAlgorithm:     "sha256",
+				CertFile:          "myLocalhost.crt",
+				KeyFile:           "MyLocalhost.key",
+				CaFile:            "myRootCA.crt",
+				SkipVerifyTLS:     true,
+				ForceSync:         true,
+				FlushFrequency:    2,
+				FlushMessages:     2,
+				FlushBytes:        2,
+				Headers:           "{\"schema\":\"{{ .Data.event_schema }}\"}",
+				Partitioner:       "manual",
+				PartitionTemplate: "{{ .Data.partition }}",
 			},
 		},
 		{
@@ -165,8 +204,79 @@ func TestCreateTargetComponentHCL(t *testing.T) {
 			File: "target-pubsub.hcl",
 			Plug: testPubSubTargetAdapter(testPubSubTargetFunc),
 			Expected: &target.PubSubTargetConfig{
-				ProjectID: "testId",
-				TopicName: "testTopic",
+				ProjectID:                         "testId",
+				TopicName:                         "testTopic",
+				PublishByteThreshold:              1000000,
+				PublishCountThreshold:             100,
+				PublishDelayThresholdInMillis:     10,
+				FlowControlMaxOutstandingMessages: 1000,
+				FlowControlMaxOutstandingBytes:    -1,
+				FlowControlLimitExceededBehavior:  "ignore",
+			},
+		},
+		{
+			File: "target-pubsub-extended.hcl",
+			Plug: testPubSubTargetAdapter(testPubSubTargetFunc),
+			Expected: &target.PubSubTargetConfig{
+				ProjectID:                         "testId",
+				TopicName:                         "testTopic",
+				EnableMessageOrdering:             true,
+				Attributes:                        "{\"source\":\"snowbridge\"}",
+				PublishByteThreshold:              500000,
+				PublishCountThreshold:             50,
+				PublishDelayThresholdInMillis:     100,
+				FlowControlMaxOutstandingMessages: 500,
+				FlowControlMaxOutstandingBytes:    100000000,
+				FlowControlLimitExceededBehavior:  "block",
+			},
+		},
+		{
+			File: "target-file.hcl",
+			Plug: testFileTargetAdapter(testFileTargetFunc),
+			Expected: &target.FileTargetConfig{
+				Path:                  "/tmp/snowbridge/events-%Y%m%d.ndjson.gz",
+				Compression:           "gzip",
+				RollSizeBytes:         1048576,
+				RollMessages:          1000,
+				RollIntervalInSeconds: 3600,
+			},
+		},
+		{
+			File: "target-s3.hcl",
+			Plug: testS3TargetAdapter(testS3TargetFunc),
+			Expected: &target.S3TargetConfig{
+				BucketName:             "testBucket",
+				Region:                 "eu-test-1",
+				KeyTemplate:            "{{ .Year }}/{{ .Month }}/{{ .Day }}/{{ .PartitionKey }}/{{ .ID }}.ndjson",
+				Compression:            "gzip",
+				MaxObjectSizeBytes:     16777216,
+				FlushIntervalInSeconds: 60,
+			},
+		},
+		{
+			File: "target-elasticsearch.hcl",
+			Plug: testElasticsearchTargetAdapter(testElasticsearchTargetFunc),
+			Expected: &target.ElasticsearchTargetConfig{
+				URL:                     "https://localhost:9200",
+				Index:                   "events-{{ .Data.app_id }}",
+				DocumentIDField:         "event_id",
+				RequestTimeoutInSeconds: 30,
+				BatchMaxMessages:        500,
+				BatchByteLimit:          5242880,
+				APIKey:                  "a2V5",
+			},
+		},
+		{
+			File: "target-splunk-hec.hcl",
+			Plug: testSplunkHECTargetAdapter(testSplunkHECTargetFunc),
+			Expected: &target.SplunkHECTargetConfig{
+				URL:                        "https://localhost:8088",
+				Token:                      "00000000-0000-0000-0000-000000000000",
+				SourceType:                 "snowplow:enriched",
+				RequestTimeoutInSeconds:    5,
+				BatchMaxMessages:           100,
+				BatchByteLimit:             1048576,
+				IndexerAckTimeoutInSeconds: 60,
 			},
 		},
 	}
@@ -211,26 +321,27 @@ func TestCreateFailureTargetComponentENV(t *testing.T) {
 		Name: "test_failure_target_kafka_extended_env",
 		Plug: testKafkaTargetAdapter(testKafkaTargetFunc),
 		Expected: &target.KafkaConfig{
-			Brokers:        "testBrokers",
-			TopicName:      "testTopic",
-			TargetVersion:  "1.2.3",
-			MaxRetries:     11,
-			ByteLimit:      1000000,
-			Compress:       true,
-			WaitForAll:     true,
-			Idempotent:     true,
-			EnableSASL:     true,
-			SASLUsername:   "testUsername",
-			SASLPassword:   "testPass",
-			SASLAlgorithm:  "sha256",
-			CertFile:       "test/certfile.crt",
-			KeyFile:        "test/keyfile.key",
-			CaFile:         "test/cafile.crt",
-			SkipVerifyTLS:  true,
-			ForceSync:      true,
-			FlushFrequency: 2,
-			FlushMessages:  2,
-			FlushBytes:     2,
+			Brokers:          "testBrokers",
+			TopicName:        "testTopic",
+			TargetVersion:    "1.2.3",
+			MaxRetries:       11,
+			ByteLimit:        1000000,
+			CompressionCodec: "gzip",
+			WaitForAll:       true,
+			Idempotent:       true,
+			EnableSASL:       true,
+			SASLUsername:     "testUsername",
+			SASLPassword:     "testPass",
+			SASLAlgorithm:    "sha256",
+			CertFile:         "test/certfile.crt",
+			KeyFile:          "test/keyfile.key",
+			CaFile:           "test/cafile.crt",
+			SkipVerifyTLS:    true,
+			ForceSync:        true,
+			FlushFrequency:   2,
+			FlushMessages:    2,
+			FlushBytes:       2,
+			Partitioner:      "hash",
 		},
 	}
 
@@ -243,7 +354,7 @@ func TestCreateFailureTargetComponentENV(t *testing.T) {
 		t.Setenv("FAILURE_TARGET_KAFKA_TARGET_VERSION", "1.2.3")
 		t.Setenv("FAILURE_TARGET_KAFKA_MAX_RETRIES", "11")
 		t.Setenv("FAILURE_TARGET_KAFKA_BYTE_LIMIT", "1000000")
-		t.Setenv("FAILURE_TARGET_KAFKA_COMPRESS", "true")
+		t.Setenv("FAILURE_TARGET_KAFKA_COMPRESSION_CODEC", "gzip")
 		t.Setenv("FAILURE_TARGET_KAFKA_WAIT_FOR_ALL", "true")
 		t.Setenv("FAILURE_TARGET_KAFKA_IDEMPOTENT", "true")
 		t.Setenv("FAILURE_TARGET_KAFKA_ENABLE_SASL", "true")
@@ -297,6 +408,16 @@ func TestCreateObserverComponentHCL(t *testing.T) {
 				Tags:    "{\"testKey\": \"testValue\"}",
 			},
 		},
+		{
+			File: "observer-prometheus.hcl",
+			Plug: testPrometheusAdapter(testPrometheusFunc),
+			Expected: &statsreceiver.PrometheusStatsReceiverConfig{
+				Address: "127.0.0.1:9090",
+				Path:    "/test/metrics",
+				Prefix:  "snowplow_test",
+				Tags:    "{\"testKey\": \"testValue\"}",
+			},
+		},
 	}
 
 	for _, tt := range testCases {
@@ -442,6 +563,78 @@ func testPubSubTargetFunc(c *target.PubSubTargetConfig) (*target.PubSubTargetCon
 	return c, nil
 }
 
+// File
+func testFileTargetAdapter(f func(c *target.FileTargetConfig) (*target.FileTargetConfig, error)) target.FileTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*target.FileTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected FileTargetConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testFileTargetFunc(c *target.FileTargetConfig) (*target.FileTargetConfig, error) {
+
+	return c, nil
+}
+
+// S3
+func testS3TargetAdapter(f func(c *target.S3TargetConfig) (*target.S3TargetConfig, error)) target.S3TargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*target.S3TargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected S3TargetConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testS3TargetFunc(c *target.S3TargetConfig) (*target.S3TargetConfig, error) {
+
+	return c, nil
+}
+
+// Elasticsearch
+func testElasticsearchTargetAdapter(f func(c *target.ElasticsearchTargetConfig) (*target.ElasticsearchTargetConfig, error)) target.ElasticsearchTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*target.ElasticsearchTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected ElasticsearchTargetConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testElasticsearchTargetFunc(c *target.ElasticsearchTargetConfig) (*target.ElasticsearchTargetConfig, error) {
+
+	return c, nil
+}
+
+// Splunk HEC
+func testSplunkHECTargetAdapter(f func(c *target.SplunkHECTargetConfig) (*target.SplunkHECTargetConfig, error)) target.SplunkHECTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*target.SplunkHECTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected SplunkHECTargetConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testSplunkHECTargetFunc(c *target.SplunkHECTargetConfig) (*target.SplunkHECTargetConfig, error) {
+
+	return c, nil
+}
+
 // StatsD
 func testStatsDAdapter(f func(c *statsreceiver.StatsDStatsReceiverConfig) (*statsreceiver.StatsDStatsReceiverConfig, error)) statsreceiver.StatsDStatsReceiverAdapter {
 	return func(i interface{}) (interface{}, error) {
@@ -459,3 +652,21 @@ func testStatsDFunc(c *statsreceiver.StatsDStatsReceiverConfig) (*statsreceiver.
 
 	return c, nil
 }
+
+// Prometheus
+func testPrometheusAdapter(f func(c *statsreceiver.PrometheusStatsReceiverConfig) (*statsreceiver.PrometheusStatsReceiverConfig, error)) statsreceiver.PrometheusStatsReceiverAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*statsreceiver.PrometheusStatsReceiverConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected PrometheusStatsReceiverConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testPrometheusFunc(c *statsreceiver.PrometheusStatsReceiverConfig) (*statsreceiver.PrometheusStatsReceiverConfig, error) {
+
+	return c, nil
+}
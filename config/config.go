@@ -21,6 +21,7 @@ import (
 	"github.com/snowplow/snowbridge/pkg/failure"
 	"github.com/snowplow/snowbridge/pkg/failure/failureiface"
 	"github.com/snowplow/snowbridge/pkg/observer"
+	"github.com/snowplow/snowbridge/pkg/retry"
 	"github.com/snowplow/snowbridge/pkg/statsreceiver"
 	"github.com/snowplow/snowbridge/pkg/statsreceiver/statsreceiveriface"
 	"github.com/snowplow/snowbridge/pkg/target"
@@ -39,19 +40,24 @@ type ConfigurationPair struct {
 type Config struct {
 	Data    *configurationData
 	Decoder Decoder
+
+	routePredicates target.RoutePredicateBuilder
 }
 
 // configurationData for holding all configuration options
 type configurationData struct {
-	Source           *component     `hcl:"source,block" envPrefix:"SOURCE_"`
-	Target           *component     `hcl:"target,block" envPrefix:"TARGET_"`
-	FailureTarget    *failureConfig `hcl:"failure_target,block"`
-	Sentry           *sentryConfig  `hcl:"sentry,block"`
-	StatsReceiver    *statsConfig   `hcl:"stats_receiver,block"`
-	Transformations  []*component   `hcl:"transform,block"`
-	LogLevel         string         `hcl:"log_level,optional" env:"LOG_LEVEL"`
-	UserProvidedID   string         `hcl:"user_provided_id,optional" env:"USER_PROVIDED_ID"`
-	DisableTelemetry bool           `hcl:"disable_telemetry,optional" env:"DISABLE_TELEMETRY"`
+	Source           *component        `hcl:"source,block" envPrefix:"SOURCE_"`
+	Target           *targetConfig     `hcl:"target,block" envPrefix:"TARGET_"`
+	FailureTarget    *failureConfig    `hcl:"failure_target,block"`
+	Sentry           *sentryConfig     `hcl:"sentry,block"`
+	StatsReceiver    *statsConfig      `hcl:"stats_receiver,block"`
+	Batching         *batchConfig      `hcl:"batching,block"`
+	Spillover        *spilloverConfig  `hcl:"spillover,block"`
+	Monitoring       *monitoringConfig `hcl:"monitoring,block"`
+	Transformations  []*component      `hcl:"transform,block"`
+	LogLevel         string            `hcl:"log_level,optional" env:"LOG_LEVEL"`
+	UserProvidedID   string            `hcl:"user_provided_id,optional" env:"USER_PROVIDED_ID"`
+	DisableTelemetry bool              `hcl:"disable_telemetry,optional" env:"DISABLE_TELEMETRY"`
 }
 
 // component is a type to abstract over configuration blocks.
@@ -65,11 +71,29 @@ type use struct {
 	Body hcl.Body `hcl:",remain"`
 }
 
+// targetConfig holds configuration for the target.
+// It includes the target component to use and how to retry writes to it.
+type targetConfig struct {
+	Use   *use         `hcl:"use,block"`
+	Retry *retryConfig `hcl:"retry,block" envPrefix:"RETRY_"`
+}
+
 // failureConfig holds configuration for the failure target.
-// It includes the target component to use.
+// It includes the target component to use and how to retry writes to it.
 type failureConfig struct {
-	Target *use   `hcl:"use,block" envPrefix:"FAILURE_TARGET_"`
-	Format string `hcl:"format,optional" env:"FAILURE_TARGETS_FORMAT"`
+	Target *use         `hcl:"use,block" envPrefix:"FAILURE_TARGET_"`
+	Format string       `hcl:"format,optional" env:"FAILURE_TARGETS_FORMAT"`
+	Retry  *retryConfig `hcl:"retry,block" envPrefix:"FAILURE_TARGET_RETRY_"`
+}
+
+// retryConfig configures the retry policy for writes to a target.
+type retryConfig struct {
+	MaxAttempts        int  `hcl:"max_attempts,optional" env:"MAX_ATTEMPTS"`
+	BaseDelayMs        int  `hcl:"base_delay_ms,optional" env:"BASE_DELAY_MS"`
+	MaxDelayMs         int  `hcl:"max_delay_ms,optional" env:"MAX_DELAY_MS"`
+	Jitter             bool `hcl:"jitter,optional" env:"JITTER"`
+	Infinite           bool `hcl:"infinite,optional" env:"INFINITE"`
+	AlertAfterAttempts int  `hcl:"alert_after_attempts,optional" env:"ALERT_AFTER_ATTEMPTS"`
 }
 
 // sentryConfig configures the Sentry error tracker.
@@ -87,15 +111,41 @@ type statsConfig struct {
 	BufferSec  int  `hcl:"buffer_sec,optional" env:"STATS_RECEIVER_BUFFER_SEC"`
 }
 
+// batchConfig configures how messages from the source are batched before being written.
+type batchConfig struct {
+	MaxMessages int `hcl:"max_messages,optional" env:"BATCHING_MAX_MESSAGES"`
+	MaxBytes    int `hcl:"max_bytes,optional" env:"BATCHING_MAX_BYTES"`
+	MaxWaitMs   int `hcl:"max_wait_ms,optional" env:"BATCHING_MAX_WAIT_MS"`
+}
+
+// spilloverConfig configures the buffer on disk which messages are spilled over to while the target is unavailable.
+type spilloverConfig struct {
+	Path            string `hcl:"path,optional" env:"SPILLOVER_PATH"`
+	MaxBytes        int64  `hcl:"max_bytes,optional" env:"SPILLOVER_MAX_BYTES"`
+	DrainIntervalMs int    `hcl:"drain_interval_ms,optional" env:"SPILLOVER_DRAIN_INTERVAL_MS"`
+}
+
+// monitoringConfig configures the HTTP server for the health of the app, and for pprof.
+type monitoringConfig struct {
+	Address              string `hcl:"address,optional" env:"MONITORING_ADDRESS"`
+	PprofAddress         string `hcl:"pprof_address,optional" env:"MONITORING_PPROF_ADDRESS"`
+	ReadyWriteFailureSec int    `hcl:"ready_write_failure_sec,optional" env:"MONITORING_READY_WRITE_FAILURE_SEC"`
+	ReadySourceIdleSec   int    `hcl:"ready_source_idle_sec,optional" env:"MONITORING_READY_SOURCE_IDLE_SEC"`
+}
+
 // defaultConfigData returns the initial main configuration target.
 func defaultConfigData() *configurationData {
 	return &configurationData{
 		Source: &component{&use{Name: "stdin"}},
-		Target: &component{&use{Name: "stdout"}},
+		Target: &targetConfig{
+			Use:   &use{Name: "stdout"},
+			Retry: defaultRetryConfig(),
+		},
 
 		FailureTarget: &failureConfig{
 			Target: &use{Name: "stdout"},
 			Format: "snowplow",
+			Retry:  defaultRetryConfig(),
 		},
 		Sentry: &sentryConfig{
 			Tags: "{}",
@@ -105,12 +155,36 @@ func defaultConfigData() *configurationData {
 			TimeoutSec: 1,
 			BufferSec:  15,
 		},
+		Batching: &batchConfig{
+			MaxMessages: 1,
+			MaxBytes:    1048576,
+			MaxWaitMs:   100,
+		},
+		Spillover: &spilloverConfig{
+			MaxBytes:        1073741824,
+			DrainIntervalMs: 1000,
+		},
+		Monitoring: &monitoringConfig{
+			ReadyWriteFailureSec: 60,
+		},
 		Transformations:  nil,
 		LogLevel:         "info",
 		DisableTelemetry: false,
 	}
 }
 
+// defaultRetryConfig returns the default retry policy for writes to a target.
+func defaultRetryConfig() *retryConfig {
+	return &retryConfig{
+		MaxAttempts:        5,
+		BaseDelayMs:        1000,
+		MaxDelayMs:         60000,
+		Jitter:             true,
+		Infinite:           false,
+		AlertAfterAttempts: 10,
+	}
+}
+
 // NewConfig returns a configuration
 func NewConfig() (*Config, error) {
 	filename := os.Getenv("SNOWBRIDGE_CONFIG_FILE")
@@ -192,45 +266,22 @@ func (c *Config) CreateComponent(p Pluggable, opts *DecoderOptions) (interface{}
 	return p.Create(decodedConfig)
 }
 
+// SetRoutePredicateBuilder sets how the predicates of the routes of the router target are built.
+// Predicates are transformations, which are configured outside of this package.
+func (c *Config) SetRoutePredicateBuilder(b target.RoutePredicateBuilder) {
+	c.routePredicates = b
+}
+
 // GetTarget builds and returns the target that is configured
 func (c *Config) GetTarget() (targetiface.Target, error) {
-	var plug Pluggable
 	useTarget := c.Data.Target.Use
 	decoderOpts := &DecoderOptions{
 		Input: useTarget.Body,
 	}
 
-	switch useTarget.Name {
-	case "stdout":
-		plug = target.AdaptStdoutTargetFunc(
-			target.StdoutTargetConfigFunction,
-		)
-	case "kinesis":
-		plug = target.AdaptKinesisTargetFunc(
-			target.KinesisTargetConfigFunction,
-		)
-	case "pubsub":
-		plug = target.AdaptPubSubTargetFunc(
-			target.PubSubTargetConfigFunction,
-		)
-	case "sqs":
-		plug = target.AdaptSQSTargetFunc(
-			target.SQSTargetConfigFunction,
-		)
-	case "kafka":
-		plug = target.AdaptKafkaTargetFunc(
-			target.NewKafkaTarget,
-		)
-	case "eventhub":
-		plug = target.AdaptEventHubTargetFunc(
-			target.EventHubTargetConfigFunction,
-		)
-	case "http":
-		plug = target.AdaptHTTPTargetFunc(
-			target.HTTPTargetConfigFunction,
-		)
-	default:
-		return nil, errors.New(fmt.Sprintf("Invalid target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http' and got '%s'", useTarget.Name))
+	plug := c.targetPlug(useTarget.Name)
+	if plug == nil {
+		return nil, errors.New(fmt.Sprintf("Invalid target found; expected one of '%s' and got '%s'", supportedTargets, useTarget.Name))
 	}
 
 	component, err := c.CreateComponent(plug, decoderOpts)
@@ -247,63 +298,136 @@ func (c *Config) GetTarget() (targetiface.Target, error) {
 
 // GetFailureTarget builds and returns the target that is configured
 func (c *Config) GetFailureTarget(AppName string, AppVersion string) (failureiface.Failure, error) {
-	var plug Pluggable
-	var err error
-
 	useFailureTarget := c.Data.FailureTarget.Target
 	decoderOpts := &DecoderOptions{
 		Prefix: "FAILURE_",
 		Input:  useFailureTarget.Body,
 	}
 
-	switch useFailureTarget.Name {
+	plug := c.targetPlug(useFailureTarget.Name)
+	if plug == nil {
+		return nil, errors.New(fmt.Sprintf("Invalid failure target found; expected one of '%s' and got '%s'", supportedTargets, useFailureTarget.Name))
+	}
+
+	component, err := c.CreateComponent(plug, decoderOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := component.(targetiface.Target); ok {
+		switch c.Data.FailureTarget.Format {
+		case "snowplow":
+			return failure.NewSnowplowFailure(t, AppName, AppVersion)
+		default:
+			return nil, errors.New(fmt.Sprintf("Invalid failure format found; expected one of 'snowplow' and got '%s'", c.Data.FailureTarget.Format))
+		}
+	}
+
+	return nil, fmt.Errorf("could not interpret failure target configuration for %q", useFailureTarget.Name)
+}
+
+// getNestedTarget builds and returns a target configured within another target, such as the router or tee targets
+func (c *Config) getNestedTarget(name string, body hcl.Body) (targetiface.Target, error) {
+	plug := c.targetPlug(name)
+	if plug == nil {
+		return nil, errors.New(fmt.Sprintf("Invalid nested target found; expected one of '%s' and got '%s'", supportedTargets, name))
+	}
+
+	component, err := c.CreateComponent(plug, &DecoderOptions{Input: body})
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := component.(targetiface.Target); ok {
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("could not interpret nested target configuration for %q", name)
+}
+
+// supportedTargets lists the names of the targets which can be configured
+const supportedTargets = "stdout, kinesis, pubsub, sqs, kafka, eventhub, http, file, s3, elasticsearch, splunk_hec, router, tee"
+
+// targetPlug returns the pluggable component for the target with the given name, or nil if there is none
+func (c *Config) targetPlug(name string) Pluggable {
+	switch name {
 	case "stdout":
-		plug = target.AdaptStdoutTargetFunc(
+		return target.AdaptStdoutTargetFunc(
 			target.StdoutTargetConfigFunction,
 		)
 	case "kinesis":
-		plug = target.AdaptKinesisTargetFunc(
+		return target.AdaptKinesisTargetFunc(
 			target.KinesisTargetConfigFunction,
 		)
 	case "pubsub":
-		plug = target.AdaptPubSubTargetFunc(
+		return target.AdaptPubSubTargetFunc(
 			target.PubSubTargetConfigFunction,
 		)
 	case "sqs":
-		plug = target.AdaptSQSTargetFunc(
+		return target.AdaptSQSTargetFunc(
 			target.SQSTargetConfigFunction,
 		)
 	case "kafka":
-		plug = target.AdaptKafkaTargetFunc(
+		return target.AdaptKafkaTargetFunc(
 			target.NewKafkaTarget,
 		)
 	case "eventhub":
-		plug = target.AdaptEventHubTargetFunc(
+		return target.AdaptEventHubTargetFunc(
 			target.EventHubTargetConfigFunction,
 		)
 	case "http":
-		plug = target.AdaptHTTPTargetFunc(
+		return target.AdaptHTTPTargetFunc(
 			target.HTTPTargetConfigFunction,
 		)
+	case "file":
+		return target.AdaptFileTargetFunc(
+			target.FileTargetConfigFunction,
+		)
+	case "s3":
+		return target.AdaptS3TargetFunc(
+			target.S3TargetConfigFunction,
+		)
+	case "elasticsearch":
+		return target.AdaptElasticsearchTargetFunc(
+			target.ElasticsearchTargetConfigFunction,
+		)
+	case "splunk_hec":
+		return target.AdaptSplunkHECTargetFunc(
+			target.SplunkHECTargetConfigFunction,
+		)
+	case "router":
+		return target.AdaptRouterTargetFunc(
+			target.RouterTargetConfigFunction(c.getNestedTarget, c.routePredicates),
+		)
+	case "tee":
+		return target.AdaptTeeTargetFunc(
+			target.TeeTargetConfigFunction(c.getNestedTarget),
+		)
 	default:
-		return nil, errors.New(fmt.Sprintf("Invalid failure target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http' and got '%s'", useFailureTarget.Name))
+		return nil
 	}
+}
 
-	component, err := c.CreateComponent(plug, decoderOpts)
-	if err != nil {
-		return nil, err
-	}
+// GetTargetRetryPolicy returns the retry policy for writes to the target
+func (c *Config) GetTargetRetryPolicy() *retry.Policy {
+	return newRetryPolicy(c.Data.Target.Retry)
+}
 
-	if t, ok := component.(targetiface.Target); ok {
-		switch c.Data.FailureTarget.Format {
-		case "snowplow":
-			return failure.NewSnowplowFailure(t, AppName, AppVersion)
-		default:
-			return nil, errors.New(fmt.Sprintf("Invalid failure format found; expected one of 'snowplow' and got '%s'", c.Data.FailureTarget.Format))
-		}
-	}
+// GetFailureTargetRetryPolicy returns the retry policy for writes to the failure target
+func (c *Config) GetFailureTargetRetryPolicy() *retry.Policy {
+	return newRetryPolicy(c.Data.FailureTarget.Retry)
+}
 
-	return nil, fmt.Errorf("could not interpret failure target configuration for %q", useFailureTarget.Name)
+// newRetryPolicy builds a retry policy from its configuration
+func newRetryPolicy(rc *retryConfig) *retry.Policy {
+	return &retry.Policy{
+		MaxAttempts:        rc.MaxAttempts,
+		BaseDelay:          time.Duration(rc.BaseDelayMs) * time.Millisecond,
+		MaxDelay:           time.Duration(rc.MaxDelayMs) * time.Millisecond,
+		Jitter:             rc.Jitter,
+		Infinite:           rc.Infinite,
+		AlertAfterAttempts: rc.AlertAfterAttempts,
+	}
 }
 
 // GetTags returns a list of tags to use in identifying this instance of snowbridge with enough
@@ -356,10 +480,33 @@ func (c *Config) getStatsReceiver(tags map[string]string) (statsreceiveriface.St
 			return r, nil
 		}
 
+		return nil, fmt.Errorf("could not interpret stats receiver configuration for %q", useReceiver.Name)
+	case "prometheus":
+		// Label the metrics with the source and target too, as they are scraped rather than pushed
+		labels := map[string]string{
+			"source": c.Data.Source.Use.Name,
+			"target": c.Data.Target.Use.Name,
+		}
+		for key, value := range tags {
+			labels[key] = value
+		}
+
+		plug := statsreceiver.AdaptPrometheusStatsReceiverFunc(
+			statsreceiver.NewPrometheusReceiverWithTags(labels),
+		)
+		component, err := c.CreateComponent(plug, decoderOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		if r, ok := component.(statsreceiveriface.StatsReceiver); ok {
+			return r, nil
+		}
+
 		return nil, fmt.Errorf("could not interpret stats receiver configuration for %q", useReceiver.Name)
 	case "":
 		return nil, nil
 	default:
-		return nil, errors.New(fmt.Sprintf("Invalid stats receiver found; expected one of 'statsd' and got '%s'", useReceiver.Name))
+		return nil, errors.New(fmt.Sprintf("Invalid stats receiver found; expected one of 'statsd, prometheus' and got '%s'", useReceiver.Name))
 	}
 }
@@ -10,6 +10,7 @@ package config
 import (
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/snowplow/snowbridge/assets"
 	"github.com/stretchr/testify/assert"
@@ -62,6 +63,33 @@ func TestNewConfig_FromEnv(t *testing.T) {
 	assert.Equal("kinesis", c.Data.Source.Use.Name)
 }
 
+func TestNewConfig_RetryFromEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("TARGET_RETRY_MAX_ATTEMPTS", "8")
+	t.Setenv("TARGET_RETRY_JITTER", "false")
+	t.Setenv("FAILURE_TARGET_RETRY_INFINITE", "true")
+	t.Setenv("FAILURE_TARGET_RETRY_BASE_DELAY_MS", "250")
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	targetRetry := c.GetTargetRetryPolicy()
+	assert.Equal(8, targetRetry.MaxAttempts)
+	assert.Equal(time.Second, targetRetry.BaseDelay)
+	assert.False(targetRetry.Jitter)
+	assert.False(targetRetry.Infinite)
+
+	failureTargetRetry := c.GetFailureTargetRetryPolicy()
+	assert.Equal(5, failureTargetRetry.MaxAttempts)
+	assert.Equal(250*time.Millisecond, failureTargetRetry.BaseDelay)
+	assert.True(failureTargetRetry.Jitter)
+	assert.True(failureTargetRetry.Infinite)
+}
+
 func TestNewConfig_FromEnvInvalid(t *testing.T) {
 	assert := assert.New(t)
 
@@ -90,7 +118,7 @@ func TestNewConfig_InvalidTarget(t *testing.T) {
 	assert.Nil(source)
 	assert.NotNil(err)
 	if err != nil {
-		assert.Equal("Invalid target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http' and got 'fake'", err.Error())
+		assert.Equal("Invalid target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http, file, s3, elasticsearch, splunk_hec, router, tee' and got 'fake'", err.Error())
 	}
 }
 
@@ -109,7 +137,7 @@ func TestNewConfig_InvalidFailureTarget(t *testing.T) {
 	assert.Nil(source)
 	assert.NotNil(err)
 	if err != nil {
-		assert.Equal("Invalid failure target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http' and got 'fake'", err.Error())
+		assert.Equal("Invalid failure target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http, file, s3, elasticsearch, splunk_hec, router, tee' and got 'fake'", err.Error())
 	}
 }
 
@@ -147,7 +175,7 @@ func TestNewConfig_InvalidStatsReceiver(t *testing.T) {
 	assert.Nil(source)
 	assert.NotNil(err)
 	if err != nil {
-		assert.Equal("Invalid stats receiver found; expected one of 'statsd' and got 'fake'", err.Error())
+		assert.Equal("Invalid stats receiver found; expected one of 'statsd, prometheus' and got 'fake'", err.Error())
 	}
 }
 
@@ -189,7 +217,7 @@ func TestNewConfig_Hcl_invalids(t *testing.T) {
 		assert.Nil(target)
 		assert.NotNil(err)
 		if err != nil {
-			assert.Equal("Invalid target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http' and got 'fakeHCL'", err.Error())
+			assert.Equal("Invalid target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http, file, s3, elasticsearch, splunk_hec, router, tee' and got 'fakeHCL'", err.Error())
 		}
 	})
 
@@ -198,12 +226,53 @@ func TestNewConfig_Hcl_invalids(t *testing.T) {
 		assert.Nil(ftarget)
 		assert.NotNil(err)
 		if err != nil {
-			assert.Equal("Invalid failure target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http' and got 'fakeHCL'", err.Error())
+			assert.Equal("Invalid failure target found; expected one of 'stdout, kinesis, pubsub, sqs, kafka, eventhub, http, file, s3, elasticsearch, splunk_hec, router, tee' and got 'fakeHCL'", err.Error())
 		}
 	})
 
 }
 
+func TestNewConfig_Hcl_router(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "config", "configs", "target-router.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	// The targets of the routes are configured like the top level target
+	target, err := c.GetTarget()
+	assert.Nil(err)
+	assert.NotNil(target)
+	if target != nil {
+		assert.Equal("router(http://localhost:8080/web,http://localhost:8080/mobile,stdout)", target.GetID())
+	}
+}
+
+func TestNewConfig_Hcl_tee(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "config", "configs", "target-tee.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	target, err := c.GetTarget()
+	assert.Nil(err)
+	assert.NotNil(target)
+	if target != nil {
+		assert.Equal("tee(http://localhost:8080/primary,stdout)", target.GetID())
+	}
+}
+
 func TestNewConfig_Hcl_defaults(t *testing.T) {
 	assert := assert.New(t)
 
@@ -224,9 +293,78 @@ func TestNewConfig_Hcl_defaults(t *testing.T) {
 	assert.Equal(false, c.Data.Sentry.Debug)
 	assert.Equal(1, c.Data.StatsReceiver.TimeoutSec)
 	assert.Equal(15, c.Data.StatsReceiver.BufferSec)
+	assert.Equal(5, c.Data.Target.Retry.MaxAttempts)
+	assert.Equal(1000, c.Data.Target.Retry.BaseDelayMs)
+	assert.Equal(60000, c.Data.Target.Retry.MaxDelayMs)
+	assert.Equal(true, c.Data.Target.Retry.Jitter)
+	assert.Equal(false, c.Data.Target.Retry.Infinite)
+	assert.Equal(10, c.Data.Target.Retry.AlertAfterAttempts)
+	assert.Equal(5, c.Data.FailureTarget.Retry.MaxAttempts)
+	assert.Equal(1, c.Data.Batching.MaxMessages)
+	assert.Equal(1048576, c.Data.Batching.MaxBytes)
+	assert.Equal(100, c.Data.Batching.MaxWaitMs)
+	assert.Equal("", c.Data.Spillover.Path)
+	assert.Equal(int64(1073741824), c.Data.Spillover.MaxBytes)
+	assert.Equal(1000, c.Data.Spillover.DrainIntervalMs)
+	assert.Equal("", c.Data.Monitoring.Address)
+	assert.Equal("", c.Data.Monitoring.PprofAddress)
+	assert.Equal(60, c.Data.Monitoring.ReadyWriteFailureSec)
+	assert.Equal(0, c.Data.Monitoring.ReadySourceIdleSec)
 	assert.Equal("info", c.Data.LogLevel)
 }
 
+func TestNewConfig_Hcl_batching(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "config", "configs", "batching.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	assert.Equal(500, c.Data.Batching.MaxMessages)
+	assert.Equal(1048576, c.Data.Batching.MaxBytes)
+	assert.Equal(250, c.Data.Batching.MaxWaitMs)
+}
+
+func TestNewConfig_Hcl_spillover(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "config", "configs", "spillover.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	assert.Equal("/tmp/snowbridge/spillover", c.Data.Spillover.Path)
+	assert.Equal(int64(5242880), c.Data.Spillover.MaxBytes)
+	assert.Equal(1000, c.Data.Spillover.DrainIntervalMs)
+}
+
+func TestNewConfig_Hcl_monitoring(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "config", "configs", "monitoring.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	assert.Equal(":8081", c.Data.Monitoring.Address)
+	assert.Equal("localhost:6060", c.Data.Monitoring.PprofAddress)
+	assert.Equal(60, c.Data.Monitoring.ReadyWriteFailureSec)
+	assert.Equal(300, c.Data.Monitoring.ReadySourceIdleSec)
+}
+
 func TestNewConfig_Hcl_sentry(t *testing.T) {
 	assert := assert.New(t)
 
@@ -244,6 +382,35 @@ func TestNewConfig_Hcl_sentry(t *testing.T) {
 	assert.Equal("testDsn", c.Data.Sentry.Dsn)
 }
 
+func TestNewConfig_Hcl_retry(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "config", "configs", "retry.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	targetRetry := c.GetTargetRetryPolicy()
+	assert.Equal(3, targetRetry.MaxAttempts)
+	assert.Equal(500*time.Millisecond, targetRetry.BaseDelay)
+	assert.Equal(time.Minute, targetRetry.MaxDelay)
+	assert.False(targetRetry.Jitter)
+	assert.False(targetRetry.Infinite)
+	assert.Equal(10, targetRetry.AlertAfterAttempts)
+
+	failureTargetRetry := c.GetFailureTargetRetryPolicy()
+	assert.Equal(5, failureTargetRetry.MaxAttempts)
+	assert.Equal(time.Second, failureTargetRetry.BaseDelay)
+	assert.Equal(30*time.Second, failureTargetRetry.MaxDelay)
+	assert.True(failureTargetRetry.Jitter)
+	assert.True(failureTargetRetry.Infinite)
+	assert.Equal(20, failureTargetRetry.AlertAfterAttempts)
+}
+
 func TestNewConfig_HclTransformationOrder(t *testing.T) {
 	assert := assert.New(t)
 
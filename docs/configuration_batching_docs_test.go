@@ -0,0 +1,29 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package docs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/snowplow/snowbridge/assets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchingDocumentation(t *testing.T) {
+	assert := assert.New(t)
+
+	batchingFilePath := filepath.Join(assets.AssetsRootDir, "docs", "configuration", "batching-example.hcl")
+
+	c := getConfigFromFilepath(t, batchingFilePath)
+
+	// Check that the example enables batching
+	assert.NotEqual(1, c.Data.Batching.MaxMessages)
+
+	checkComponentForZeros(t, c.Data.Batching)
+}
@@ -26,6 +26,10 @@ func TestMonitoringDocumentation(t *testing.T) {
 
 	testStatsDConfig(t, statsDFilePath, true)
 
+	prometheusFilePath := filepath.Join(assets.AssetsRootDir, "docs", "configuration", "monitoring", "prometheus-example.hcl")
+
+	testPrometheusConfig(t, prometheusFilePath, true)
+
 	loglevelFilePath := filepath.Join(assets.AssetsRootDir, "docs", "configuration", "monitoring", "log-level-example.hcl")
 
 	loglevelConf := getConfigFromFilepath(t, loglevelFilePath)
@@ -40,6 +44,14 @@ func TestMonitoringDocumentation(t *testing.T) {
 
 	testSentryConfig(t, sentryFilePath, true)
 
+	healthFilePath := filepath.Join(assets.AssetsRootDir, "docs", "configuration", "monitoring", "health-example.hcl")
+
+	healthConf := getConfigFromFilepath(t, healthFilePath)
+
+	// Check that the example enables the health endpoints
+	assert.NotEqual("", healthConf.Data.Monitoring.Address)
+
+	checkComponentForZeros(t, healthConf.Data.Monitoring)
 }
 
 func testStatsDConfig(t *testing.T, configpath string, fullExample bool) {
@@ -64,6 +76,28 @@ func testStatsDConfig(t *testing.T, configpath string, fullExample bool) {
 	}
 }
 
+func testPrometheusConfig(t *testing.T, configpath string, fullExample bool) {
+	assert := assert.New(t)
+	c := getConfigFromFilepath(t, configpath)
+
+	confStatsRec := c.Data.StatsReceiver
+
+	configObject := &statsreceiver.PrometheusStatsReceiverConfig{}
+
+	err := gohcl.DecodeBody(confStatsRec.Receiver.Body, config.CreateHclContext(), configObject)
+	if err != nil {
+		assert.Fail(confStatsRec.Receiver.Name, err.Error())
+	}
+
+	if fullExample {
+		checkComponentForZeros(t, configObject)
+
+		// Check the config values that are outside the statsreceiver part
+		assert.NotZero(confStatsRec.BufferSec)
+		assert.NotZero(confStatsRec.TimeoutSec)
+	}
+}
+
 func testSentryConfig(t *testing.T, configpath string, fullExample bool) {
 	assert := assert.New(t)
 	t.Setenv("SNOWBRIDGE_CONFIG_FILE", configpath)
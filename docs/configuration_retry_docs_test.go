@@ -0,0 +1,28 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package docs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/snowplow/snowbridge/assets"
+)
+
+func TestRetryDocumentation(t *testing.T) {
+	retryFilePath := filepath.Join(assets.AssetsRootDir, "docs", "configuration", "retry-example.hcl")
+
+	// Test that the target and failure target compile
+	testTargetConfig(t, retryFilePath, false)
+	testFailureTargetConfig(t, retryFilePath, false)
+
+	c := getConfigFromFilepath(t, retryFilePath)
+
+	checkComponentForZeros(t, c.Data.Target.Retry)
+	checkComponentForZeros(t, c.Data.FailureTarget.Retry)
+}
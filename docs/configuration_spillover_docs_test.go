@@ -0,0 +1,29 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package docs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/snowplow/snowbridge/assets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpilloverDocumentation(t *testing.T) {
+	assert := assert.New(t)
+
+	spilloverFilePath := filepath.Join(assets.AssetsRootDir, "docs", "configuration", "spillover-example.hcl")
+
+	c := getConfigFromFilepath(t, spilloverFilePath)
+
+	// Check that the example enables spillover
+	assert.NotEqual("", c.Data.Spillover.Path)
+
+	checkComponentForZeros(t, c.Data.Spillover)
+}
@@ -25,8 +25,11 @@ func TestTargetDocumentation(t *testing.T) {
 	// Set env vars referenced in the config examples
 	t.Setenv("MY_AUTH_PASSWORD", "test")
 	t.Setenv("SASL_PASSWORD", "test")
+	t.Setenv("MY_OAUTH2_CLIENT_SECRET", "test")
+	t.Setenv("MY_API_KEY", "test")
+	t.Setenv("MY_HEC_TOKEN", "test")
 
-	targetsToTest := []string{"eventhub", "http", "kafka", "kinesis", "pubsub", "sqs", "stdout"}
+	targetsToTest := []string{"elasticsearch", "eventhub", "file", "http", "kafka", "kinesis", "pubsub", "router", "s3", "splunk_hec", "sqs", "stdout", "tee"}
 
 	for _, tgt := range targetsToTest {
 
@@ -62,8 +65,12 @@ func testTargetComponent(t *testing.T, name string, body hcl.Body, fullExample b
 	assert := assert.New(t)
 	var configObject interface{}
 	switch name {
+	case "elasticsearch":
+		configObject = &target.ElasticsearchTargetConfig{}
 	case "eventhub":
 		configObject = &target.EventHubConfig{}
+	case "file":
+		configObject = &target.FileTargetConfig{}
 	case "http":
 		configObject = &target.HTTPTargetConfig{}
 	case "kafka":
@@ -72,12 +79,20 @@ func testTargetComponent(t *testing.T, name string, body hcl.Body, fullExample b
 		configObject = &target.KinesisTargetConfig{}
 	case "pubsub":
 		configObject = &target.PubSubTargetConfig{}
+	case "router":
+		configObject = &target.RouterTargetConfig{}
+	case "s3":
+		configObject = &target.S3TargetConfig{}
+	case "splunk_hec":
+		configObject = &target.SplunkHECTargetConfig{}
 	case "sqs":
 		configObject = &target.SQSTargetConfig{}
 	case "stdout":
 		// stdout doesn't have a config object, so we use an empty struct.
 		var s struct{}
 		configObject = &s
+	case "tee":
+		configObject = &target.TeeTargetConfig{}
 	default:
 		assert.Fail(fmt.Sprint("Target not recognised: ", name))
 	}
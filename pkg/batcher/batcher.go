@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package batcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// Batcher collects the messages from concurrent source writes into batches, so that
+// sources which write one message at a time still reach the target in bulk.
+//
+// Each call to Write blocks until the batch holding its messages has been written,
+// and returns the result of that write. AckFuncs are left untouched, so each
+// message is still acked individually by the target.
+type Batcher struct {
+	write       func(messages []*models.Message) error
+	maxMessages int
+	maxBytes    int
+	maxWait     time.Duration
+
+	current *batch
+	mutex   sync.Mutex
+}
+
+// batch is a set of messages which will be written together
+type batch struct {
+	messages []*models.Message
+	byteLen  int
+	timer    *time.Timer
+
+	// done is closed once the batch has been written, with the result in err
+	done chan struct{}
+	err  error
+}
+
+// New creates a Batcher which passes batches to write once they reach maxMessages
+// or maxBytes, or maxWait after their first message arrived. A maxMessages of 1 or
+// less disables batching, passing every write straight through.
+func New(write func(messages []*models.Message) error, maxMessages int, maxBytes int, maxWait time.Duration) *Batcher {
+	return &Batcher{
+		write:       write,
+		maxMessages: maxMessages,
+		maxBytes:    maxBytes,
+		maxWait:     maxWait,
+	}
+}
+
+// Write adds messages to the current batch, returning once that batch has been written
+func (b *Batcher) Write(messages []*models.Message) error {
+	if b.maxMessages <= 1 {
+		return b.write(messages)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	bt := b.current
+	if bt == nil {
+		bt = &batch{done: make(chan struct{})}
+		bt.timer = time.AfterFunc(b.maxWait, func() {
+			b.flushOnTimeout(bt)
+		})
+		b.current = bt
+	}
+
+	bt.messages = append(bt.messages, messages...)
+	for _, msg := range messages {
+		bt.byteLen += len(msg.Data)
+	}
+
+	full := len(bt.messages) >= b.maxMessages || (b.maxBytes > 0 && bt.byteLen >= b.maxBytes)
+	if full {
+		b.current = nil
+		bt.timer.Stop()
+	}
+	b.mutex.Unlock()
+
+	// The write that fills a batch is the one to flush it
+	if full {
+		b.flush(bt)
+	}
+
+	<-bt.done
+	return bt.err
+}
+
+// flushOnTimeout flushes a batch once it has waited for maxWait, unless it has already been filled
+func (b *Batcher) flushOnTimeout(bt *batch) {
+	b.mutex.Lock()
+	if b.current != bt {
+		b.mutex.Unlock()
+		return
+	}
+	b.current = nil
+	b.mutex.Unlock()
+
+	b.flush(bt)
+}
+
+// flush writes a batch and releases everyone waiting on it
+func (b *Batcher) flush(bt *batch) {
+	bt.err = b.write(bt.messages)
+	close(bt.done)
+}
@@ -0,0 +1,163 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package batcher
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/testutil"
+)
+
+// recordingWriter records the size of every batch written to it, acking every message
+type recordingWriter struct {
+	batches [][]*models.Message
+	err     error
+	mutex   sync.Mutex
+}
+
+func (w *recordingWriter) write(messages []*models.Message) error {
+	w.mutex.Lock()
+	w.batches = append(w.batches, messages)
+	w.mutex.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	for _, msg := range messages {
+		msg.AckFunc()
+	}
+	return nil
+}
+
+func (w *recordingWriter) batchSizes() []int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var sizes []int
+	for _, b := range w.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+// writeConcurrently writes each message in its own call, as single-record sources do,
+// returning the number of acks and the errors returned
+func writeConcurrently(b *Batcher, messages []*models.Message) (int64, []error) {
+	var acks int64
+	errs := make([]error, len(messages))
+
+	wg := sync.WaitGroup{}
+	for i, msg := range messages {
+		msg.AckFunc = func() {
+			atomic.AddInt64(&acks, 1)
+		}
+
+		wg.Add(1)
+		go func(i int, msg *models.Message) {
+			defer wg.Done()
+			errs[i] = b.Write([]*models.Message{msg})
+		}(i, msg)
+	}
+	wg.Wait()
+
+	return acks, errs
+}
+
+func TestBatcher_FlushesOnMaxMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	writer := &recordingWriter{}
+	b := New(writer.write, 10, 0, time.Minute)
+
+	messages := testutil.GetTestMessages(30, "Hello Batcher!!", nil)
+	acks, errs := writeConcurrently(b, messages)
+
+	assert.Equal(int64(30), acks)
+	for _, err := range errs {
+		assert.Nil(err)
+	}
+	assert.Equal([]int{10, 10, 10}, writer.batchSizes())
+}
+
+func TestBatcher_FlushesOnMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	writer := &recordingWriter{}
+	// Each message is 15 bytes, so a batch is full at its third message
+	b := New(writer.write, 100, 45, time.Minute)
+
+	messages := testutil.GetTestMessages(9, "Hello Batcher!!", nil)
+	acks, errs := writeConcurrently(b, messages)
+
+	assert.Equal(int64(9), acks)
+	for _, err := range errs {
+		assert.Nil(err)
+	}
+	assert.Equal([]int{3, 3, 3}, writer.batchSizes())
+}
+
+func TestBatcher_FlushesOnMaxWait(t *testing.T) {
+	assert := assert.New(t)
+
+	writer := &recordingWriter{}
+	b := New(writer.write, 100, 0, 50*time.Millisecond)
+
+	messages := testutil.GetTestMessages(5, "Hello Batcher!!", nil)
+
+	start := time.Now()
+	acks, errs := writeConcurrently(b, messages)
+
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+	assert.Equal(int64(5), acks)
+	for _, err := range errs {
+		assert.Nil(err)
+	}
+	assert.Equal([]int{5}, writer.batchSizes())
+}
+
+func TestBatcher_ReturnsErrorToEveryWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	writer := &recordingWriter{err: errors.New("write failed")}
+	b := New(writer.write, 4, 0, time.Minute)
+
+	messages := testutil.GetTestMessages(4, "Hello Batcher!!", nil)
+	acks, errs := writeConcurrently(b, messages)
+
+	assert.Equal(int64(0), acks)
+	for _, err := range errs {
+		assert.NotNil(err)
+		if err != nil {
+			assert.Equal("write failed", err.Error())
+		}
+	}
+	assert.Equal([]int{4}, writer.batchSizes())
+}
+
+func TestBatcher_Disabled(t *testing.T) {
+	assert := assert.New(t)
+
+	writer := &recordingWriter{}
+	b := New(writer.write, 1, 0, time.Minute)
+
+	messages := testutil.GetTestMessages(5, "Hello Batcher!!", nil)
+	acks, errs := writeConcurrently(b, messages)
+
+	assert.Equal(int64(5), acks)
+	for _, err := range errs {
+		assert.Nil(err)
+	}
+	assert.Equal([]int{1, 1, 1, 1, 1}, writer.batchSizes())
+}
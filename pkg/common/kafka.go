@@ -0,0 +1,102 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package common
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+
+	"github.com/Shopify/sarama"
+	log "github.com/sirupsen/logrus"
+	"github.com/xdg/scram"
+)
+
+// sarama.Logger is global and read by running clients, so it's set once for every Kafka source and target
+func init() {
+	sarama.Logger = log.WithFields(log.Fields{"client": "sarama"})
+}
+
+// GetKafkaVersion parses the requested Kafka version, returning the sarama default
+// if none is provided and an error if the version is not supported
+func GetKafkaVersion(targetVersion string) (sarama.KafkaVersion, error) {
+	preferredVersion := sarama.DefaultVersion
+
+	if targetVersion != "" {
+		parsedVersion, err := sarama.ParseKafkaVersion(targetVersion)
+		if err != nil {
+			return sarama.DefaultVersion, err
+		}
+
+		supportedVersion := false
+		for _, version := range sarama.SupportedVersions {
+			if version == parsedVersion {
+				supportedVersion = true
+				preferredVersion = parsedVersion
+				break
+			}
+		}
+		if !supportedVersion {
+			return sarama.DefaultVersion, fmt.Errorf("unsupported version `%s`. select older, compatible version instead", parsedVersion)
+		}
+	}
+
+	return preferredVersion, nil
+}
+
+// ConfigureKafkaSASL enables SASL authentication on a sarama configuration using
+// the provided credentials and algorithm ("sha512", "sha256" or "plaintext")
+func ConfigureKafkaSASL(saramaConfig *sarama.Config, username string, password string, algorithm string) error {
+	saramaConfig.Net.SASL.Enable = true
+	saramaConfig.Net.SASL.User = username
+	saramaConfig.Net.SASL.Password = password
+	saramaConfig.Net.SASL.Handshake = true
+	if algorithm == "sha512" {
+		saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &xdgSCRAMClient{HashGeneratorFcn: SHA512} }
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+	} else if algorithm == "sha256" {
+		saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &xdgSCRAMClient{HashGeneratorFcn: SHA256} }
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+	} else if algorithm == "plaintext" {
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	} else {
+		return fmt.Errorf("invalid SHA algorithm \"%s\": can be either \"sha256\" or \"sha512\"", algorithm)
+	}
+	return nil
+}
+
+// SHA256 hash
+var SHA256 scram.HashGeneratorFcn = func() hash.Hash { return sha256.New() }
+
+// SHA512 hash
+var SHA512 scram.HashGeneratorFcn = func() hash.Hash { return sha512.New() }
+
+type xdgSCRAMClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (x *xdgSCRAMClient) Begin(userName, password, authzID string) (err error) {
+	x.Client, err = x.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	x.ClientConversation = x.Client.NewConversation()
+	return nil
+}
+
+func (x *xdgSCRAMClient) Step(challenge string) (response string, err error) {
+	response, err = x.ClientConversation.Step(challenge)
+	return
+}
+
+func (x *xdgSCRAMClient) Done() bool {
+	return x.ClientConversation.Done()
+}
@@ -0,0 +1,25 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaramaLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	logger, ok := sarama.Logger.(*log.Entry)
+	if assert.True(ok) {
+		assert.Equal(log.Fields{"client": "sarama"}, logger.Data)
+	}
+}
@@ -20,6 +20,9 @@ type FilterResult struct {
 	// Filtered holds all the messages that were filtered out and acked without sending to the target
 	Filtered []*Message
 
+	// FilterTime is when the messages were filtered, which the latencies are measured to
+	FilterTime time.Time
+
 	// Delta between TimePulled and TimeOfAck tells us how well the
 	// application is at processing filtered data internally
 	MaxFilterLatency time.Duration
@@ -38,6 +41,8 @@ func NewFilterResult(filtered []*Message) *FilterResult {
 func newFilterResultWithTime(filtered []*Message, timeOfFilter time.Time) *FilterResult {
 	r := FilterResult{
 		FilteredCount: int64(len(filtered)),
+		Filtered:      filtered,
+		FilterTime:    timeOfFilter,
 	}
 
 	filteredLen := int64(len(filtered))
@@ -9,6 +9,8 @@ package models
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/snowplow/snowbridge/pkg/common"
@@ -20,6 +22,7 @@ type ObserverBuffer struct {
 	MsgSent       int64
 	MsgFailed     int64
 	MsgTotal      int64
+	MsgThrottled  int64
 
 	MsgFiltered int64
 
@@ -33,6 +36,9 @@ type ObserverBuffer struct {
 	InvalidMsgFailed     int64
 	InvalidMsgTotal      int64
 
+	TargetRetries        int64
+	FailureTargetRetries int64
+
 	MaxProcLatency      time.Duration
 	MinProcLatency      time.Duration
 	SumProcLatency      time.Duration
@@ -48,6 +54,18 @@ type ObserverBuffer struct {
 	MaxRequestLatency   time.Duration
 	MinRequestLatency   time.Duration
 	SumRequestLatency   time.Duration
+
+	// Destinations holds the message counts for each destination of the target, by their ID
+	Destinations map[string]*DestinationWriteResult
+
+	// Spillover holds the latest depth of the spillover buffer, when it is enabled
+	Spillover *SpilloverDepth
+}
+
+// SpilloverDepth contains the number of messages, and their size on disk, held by the spillover buffer
+type SpilloverDepth struct {
+	Messages int64
+	Bytes    int64
 }
 
 // AppendWrite adds a normal TargetWriteResult onto the buffer and stores the result
@@ -60,8 +78,10 @@ func (b *ObserverBuffer) AppendWrite(res *TargetWriteResult) {
 	b.MsgSent += res.SentCount
 	b.MsgFailed += res.FailedCount
 	b.MsgTotal += res.Total()
+	b.MsgThrottled += res.ThrottledCount
 
 	b.appendWriteResult(res)
+	b.appendDestinations(res.Destinations)
 }
 
 // AppendWriteOversized adds an oversized TargetWriteResult onto the buffer and stores the result
@@ -126,6 +146,33 @@ func (b *ObserverBuffer) appendWriteResult(res *TargetWriteResult) {
 	b.SumRequestLatency += res.AvgRequestLatency
 }
 
+func (b *ObserverBuffer) appendDestinations(destinations []*DestinationWriteResult) {
+	for _, d := range destinations {
+		if b.Destinations == nil {
+			b.Destinations = make(map[string]*DestinationWriteResult)
+		}
+		bd, ok := b.Destinations[d.ID]
+		if !ok {
+			bd = &DestinationWriteResult{ID: d.ID}
+			b.Destinations[d.ID] = bd
+		}
+		bd.SentCount += d.SentCount
+		bd.FailedCount += d.FailedCount
+		bd.OversizedCount += d.OversizedCount
+		bd.InvalidCount += d.InvalidCount
+	}
+}
+
+// AppendTargetRetry counts a retried write to the target
+func (b *ObserverBuffer) AppendTargetRetry() {
+	b.TargetRetries++
+}
+
+// AppendFailureTargetRetry counts a retried write to the failure target
+func (b *ObserverBuffer) AppendFailureTargetRetry() {
+	b.FailureTargetRetries++
+}
+
 // AppendFiltered adds a FilterResult onto the buffer and stores the result
 func (b *ObserverBuffer) AppendFiltered(res *FilterResult) {
 	if res == nil {
@@ -178,7 +225,7 @@ func (b *ObserverBuffer) GetAvgRequestLatency() time.Duration {
 
 func (b *ObserverBuffer) String() string {
 	return fmt.Sprintf(
-		"TargetResults:%d,MsgFiltered:%d,MsgSent:%d,MsgFailed:%d,OversizedTargetResults:%d,OversizedMsgSent:%d,OversizedMsgFailed:%d,InvalidTargetResults:%d,InvalidMsgSent:%d,InvalidMsgFailed:%d,MaxProcLatency:%d,MaxMsgLatency:%d,MaxFilterLatency:%d,MaxTransformLatency:%d,SumTransformLatency:%d,SumProcLatency:%d,SumMsgLatency:%d,MinReqLatency:%d,MaxReqLatency:%d,SumReqLatency:%d",
+		"TargetResults:%d,MsgFiltered:%d,MsgSent:%d,MsgFailed:%d,OversizedTargetResults:%d,OversizedMsgSent:%d,OversizedMsgFailed:%d,InvalidTargetResults:%d,InvalidMsgSent:%d,InvalidMsgFailed:%d,MaxProcLatency:%d,MaxMsgLatency:%d,MaxFilterLatency:%d,MaxTransformLatency:%d,SumTransformLatency:%d,SumProcLatency:%d,SumMsgLatency:%d,MinReqLatency:%d,MaxReqLatency:%d,SumReqLatency:%d,TargetRetries:%d,FailureTargetRetries:%d,MsgThrottled:%d",
 		b.TargetResults,
 		b.MsgFiltered,
 		b.MsgSent,
@@ -199,5 +246,32 @@ func (b *ObserverBuffer) String() string {
 		b.MinRequestLatency.Milliseconds(),
 		b.MaxRequestLatency.Milliseconds(),
 		b.SumRequestLatency.Milliseconds(),
-	)
+		b.TargetRetries,
+		b.FailureTargetRetries,
+		b.MsgThrottled,
+	) + b.destinationsString() + b.spilloverString()
+}
+
+// destinationsString formats the message counts for each destination, sorted by their ID
+func (b *ObserverBuffer) destinationsString() string {
+	ids := make([]string, 0, len(b.Destinations))
+	for id := range b.Destinations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	for _, id := range ids {
+		d := b.Destinations[id]
+		fmt.Fprintf(&sb, ",Destination[%s]:{MsgSent:%d,MsgFailed:%d,MsgOversized:%d,MsgInvalid:%d}", id, d.SentCount, d.FailedCount, d.OversizedCount, d.InvalidCount)
+	}
+	return sb.String()
+}
+
+// spilloverString formats the depth of the spillover buffer, when it is enabled
+func (b *ObserverBuffer) spilloverString() string {
+	if b.Spillover == nil {
+		return ""
+	}
+	return fmt.Sprintf(",SpilloverMsgs:%d,SpilloverBytes:%d", b.Spillover.Messages, b.Spillover.Bytes)
 }
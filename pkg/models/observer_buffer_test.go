@@ -66,6 +66,7 @@ func TestObserverBuffer(t *testing.T) {
 	}
 
 	r := NewTargetWriteResultWithTime(sent, failed, nil, nil, timeNow)
+	r.ThrottledCount = 1
 
 	b.AppendWrite(r)
 	b.AppendWrite(r)
@@ -81,10 +82,15 @@ func TestObserverBuffer(t *testing.T) {
 
 	b.AppendFiltered(fr)
 
+	b.AppendTargetRetry()
+	b.AppendTargetRetry()
+	b.AppendFailureTargetRetry()
+
 	assert.Equal(int64(2), b.TargetResults)
 	assert.Equal(int64(4), b.MsgSent)
 	assert.Equal(int64(2), b.MsgFailed)
 	assert.Equal(int64(6), b.MsgTotal)
+	assert.Equal(int64(2), b.MsgThrottled)
 
 	assert.Equal(int64(1), b.MsgFiltered)
 
@@ -98,6 +104,9 @@ func TestObserverBuffer(t *testing.T) {
 	assert.Equal(int64(2), b.InvalidMsgFailed)
 	assert.Equal(int64(6), b.InvalidMsgTotal)
 
+	assert.Equal(int64(2), b.TargetRetries)
+	assert.Equal(int64(1), b.FailureTargetRetries)
+
 	assert.Equal(time.Duration(10)*time.Minute, b.MaxProcLatency)
 	assert.Equal(time.Duration(4)*time.Minute, b.MinProcLatency)
 	assert.Equal(time.Duration(7)*time.Minute, b.GetAvgProcLatency())
@@ -115,7 +124,7 @@ func TestObserverBuffer(t *testing.T) {
 	assert.Equal(time.Duration(8)*time.Minute, b.MaxRequestLatency)
 	assert.Equal(time.Duration(1)*time.Minute, b.MinRequestLatency)
 
-	assert.Equal("TargetResults:2,MsgFiltered:1,MsgSent:4,MsgFailed:2,OversizedTargetResults:2,OversizedMsgSent:4,OversizedMsgFailed:2,InvalidTargetResults:2,InvalidMsgSent:4,InvalidMsgFailed:2,MaxProcLatency:600000,MaxMsgLatency:4200000,MaxFilterLatency:600000,MaxTransformLatency:180000,SumTransformLatency:720000,SumProcLatency:2520000,SumMsgLatency:18000000,MinReqLatency:60000,MaxReqLatency:480000,SumReqLatency:1320000", b.String())
+	assert.Equal("TargetResults:2,MsgFiltered:1,MsgSent:4,MsgFailed:2,OversizedTargetResults:2,OversizedMsgSent:4,OversizedMsgFailed:2,InvalidTargetResults:2,InvalidMsgSent:4,InvalidMsgFailed:2,MaxProcLatency:600000,MaxMsgLatency:4200000,MaxFilterLatency:600000,MaxTransformLatency:180000,SumTransformLatency:720000,SumProcLatency:2520000,SumMsgLatency:18000000,MinReqLatency:60000,MaxReqLatency:480000,SumReqLatency:1320000,TargetRetries:2,FailureTargetRetries:1,MsgThrottled:2", b.String())
 }
 
 // TestObserverBuffer_Basic is a basic version of the above test, stripping away all but one event
@@ -187,7 +196,7 @@ func TestObserverBuffer_Basic(t *testing.T) {
 	assert.Equal(time.Duration(1)*time.Minute, b.MaxRequestLatency)
 	assert.Equal(time.Duration(1)*time.Minute, b.MinRequestLatency)
 
-	assert.Equal("TargetResults:1,MsgFiltered:0,MsgSent:1,MsgFailed:0,OversizedTargetResults:0,OversizedMsgSent:0,OversizedMsgFailed:0,InvalidTargetResults:0,InvalidMsgSent:0,InvalidMsgFailed:0,MaxProcLatency:240000,MaxMsgLatency:3000000,MaxFilterLatency:0,MaxTransformLatency:120000,SumTransformLatency:120000,SumProcLatency:240000,SumMsgLatency:3000000,MinReqLatency:60000,MaxReqLatency:60000,SumReqLatency:60000", b.String())
+	assert.Equal("TargetResults:1,MsgFiltered:0,MsgSent:1,MsgFailed:0,OversizedTargetResults:0,OversizedMsgSent:0,OversizedMsgFailed:0,InvalidTargetResults:0,InvalidMsgSent:0,InvalidMsgFailed:0,MaxProcLatency:240000,MaxMsgLatency:3000000,MaxFilterLatency:0,MaxTransformLatency:120000,SumTransformLatency:120000,SumProcLatency:240000,SumMsgLatency:3000000,MinReqLatency:60000,MaxReqLatency:60000,SumReqLatency:60000,TargetRetries:0,FailureTargetRetries:0,MsgThrottled:0", b.String())
 }
 
 // TestObserverBuffer_Basic is a basic version of the above test, stripping away all but one event.
@@ -254,5 +263,41 @@ func TestObserverBuffer_BasicNoTransform(t *testing.T) {
 	assert.Equal(time.Duration(0)*time.Minute, b.MaxRequestLatency)
 	assert.Equal(time.Duration(0)*time.Minute, b.MinRequestLatency)
 
-	assert.Equal("TargetResults:1,MsgFiltered:0,MsgSent:1,MsgFailed:0,OversizedTargetResults:0,OversizedMsgSent:0,OversizedMsgFailed:0,InvalidTargetResults:0,InvalidMsgSent:0,InvalidMsgFailed:0,MaxProcLatency:240000,MaxMsgLatency:3000000,MaxFilterLatency:0,MaxTransformLatency:0,SumTransformLatency:0,SumProcLatency:240000,SumMsgLatency:3000000,MinReqLatency:0,MaxReqLatency:0,SumReqLatency:0", b.String())
+	assert.Equal("TargetResults:1,MsgFiltered:0,MsgSent:1,MsgFailed:0,OversizedTargetResults:0,OversizedMsgSent:0,OversizedMsgFailed:0,InvalidTargetResults:0,InvalidMsgSent:0,InvalidMsgFailed:0,MaxProcLatency:240000,MaxMsgLatency:3000000,MaxFilterLatency:0,MaxTransformLatency:0,SumTransformLatency:0,SumProcLatency:240000,SumMsgLatency:3000000,MinReqLatency:0,MaxReqLatency:0,SumReqLatency:0,TargetRetries:0,FailureTargetRetries:0,MsgThrottled:0", b.String())
+}
+
+func TestObserverBuffer_Destinations(t *testing.T) {
+	assert := assert.New(t)
+
+	b := ObserverBuffer{}
+
+	r1 := NewTargetWriteResult([]*Message{{Data: []byte("Baz")}}, nil, nil, nil)
+	r1.Destinations = []*DestinationWriteResult{
+		{ID: "primary", SentCount: 1},
+		{ID: "archive", FailedCount: 1},
+	}
+	r2 := NewTargetWriteResult([]*Message{{Data: []byte("Bar")}}, nil, nil, nil)
+	r2.Destinations = []*DestinationWriteResult{
+		{ID: "primary", SentCount: 1},
+		{ID: "archive", SentCount: 1, InvalidCount: 1},
+	}
+
+	b.AppendWrite(r1)
+	b.AppendWrite(r2)
+
+	assert.Equal(map[string]*DestinationWriteResult{
+		"primary": {ID: "primary", SentCount: 2},
+		"archive": {ID: "archive", SentCount: 1, FailedCount: 1, InvalidCount: 1},
+	}, b.Destinations)
+	assert.Regexp(",MsgThrottled:0,Destination\\[archive\\]:{MsgSent:1,MsgFailed:1,MsgOversized:0,MsgInvalid:1},Destination\\[primary\\]:{MsgSent:2,MsgFailed:0,MsgOversized:0,MsgInvalid:0}$", b.String())
+}
+
+func TestObserverBuffer_Spillover(t *testing.T) {
+	assert := assert.New(t)
+
+	b := ObserverBuffer{}
+	assert.NotRegexp("Spillover", b.String())
+
+	b.Spillover = &SpilloverDepth{Messages: 3, Bytes: 512}
+	assert.Regexp(",MsgThrottled:0,SpilloverMsgs:3,SpilloverBytes:512$", b.String())
 }
@@ -18,6 +18,10 @@ type TargetWriteResult struct {
 	SentCount   int64
 	FailedCount int64
 
+	// ThrottledCount is how many of the failed messages were rejected
+	// because the target was throttling writes.
+	ThrottledCount int64
+
 	// Sent holds all the messages that were successfully sent to the target
 	// and therefore have been acked by the target successfully.
 	Sent []*Message
@@ -35,6 +39,9 @@ type TargetWriteResult struct {
 	// and need to be specially handled.
 	Invalid []*Message
 
+	// WriteTime is when the write happened, which the latencies are measured to
+	WriteTime time.Time
+
 	// Delta between TimePulled and TimeOfWrite tells us how well the
 	// application is at processing data internally
 	MaxProcLatency time.Duration
@@ -57,6 +64,32 @@ type TargetWriteResult struct {
 	MaxRequestLatency time.Duration
 	MinRequestLatency time.Duration
 	AvgRequestLatency time.Duration
+
+	// Destinations holds the results of the writes to each destination of a target
+	// which writes to several of them, such as the tee target.
+	Destinations []*DestinationWriteResult
+}
+
+// DestinationWriteResult contains the message counts from a write to one of the
+// destinations of a target
+type DestinationWriteResult struct {
+	ID             string
+	SentCount      int64
+	FailedCount    int64
+	OversizedCount int64
+	InvalidCount   int64
+}
+
+// NewDestinationWriteResult builds the result of a write to a destination from the result
+// of the write to its target
+func NewDestinationWriteResult(id string, res *TargetWriteResult) *DestinationWriteResult {
+	return &DestinationWriteResult{
+		ID:             id,
+		SentCount:      res.SentCount,
+		FailedCount:    res.FailedCount,
+		OversizedCount: int64(len(res.Oversized)),
+		InvalidCount:   int64(len(res.Invalid)),
+	}
 }
 
 // NewTargetWriteResult uses the current time as the WriteTime and then calls NewTargetWriteResultWithTime
@@ -75,6 +108,7 @@ func NewTargetWriteResultWithTime(sent []*Message, failed []*Message, oversized
 		Failed:      failed,
 		Oversized:   oversized,
 		Invalid:     invalid,
+		WriteTime:   timeOfWrite,
 	}
 
 	// Calculate latency on sent & failed events
@@ -150,11 +184,18 @@ func (wr *TargetWriteResult) Append(nwr *TargetWriteResult) *TargetWriteResult {
 	if nwr != nil {
 		wrC.SentCount += nwr.SentCount
 		wrC.FailedCount += nwr.FailedCount
+		wrC.ThrottledCount += nwr.ThrottledCount
 
 		wrC.Sent = append(wrC.Sent, nwr.Sent...)
 		wrC.Failed = append(wrC.Failed, nwr.Failed...)
 		wrC.Oversized = append(wrC.Oversized, nwr.Oversized...)
 		wrC.Invalid = append(wrC.Invalid, nwr.Invalid...)
+		wrC.Destinations = append(wrC.Destinations, nwr.Destinations...)
+
+		// Results are often appended to an empty one, so the latest write time is kept
+		if wrC.WriteTime.Before(nwr.WriteTime) {
+			wrC.WriteTime = nwr.WriteTime
+		}
 
 		if wrC.MaxProcLatency < nwr.MaxProcLatency {
 			wrC.MaxProcLatency = nwr.MaxProcLatency
@@ -137,6 +137,7 @@ func TestNewTargetWriteResult_WithMessages(t *testing.T) {
 	}
 
 	r1 := NewTargetWriteResultWithTime(sent1, failed1, nil, nil, timeNow)
+	r1.ThrottledCount = 1
 	assert.NotNil(r)
 
 	// Append a result
@@ -152,6 +153,7 @@ func TestNewTargetWriteResult_WithMessages(t *testing.T) {
 	// Check appended result
 	assert.Equal(int64(3), r3.SentCount)
 	assert.Equal(int64(3), r3.FailedCount)
+	assert.Equal(int64(1), r3.ThrottledCount)
 	assert.Equal(int64(6), r3.Total())
 	assert.Equal(time.Duration(15)*time.Minute, r3.MaxProcLatency)
 	assert.Equal(time.Duration(2)*time.Minute, r3.MinProcLatency)
@@ -164,6 +166,24 @@ func TestNewTargetWriteResult_WithMessages(t *testing.T) {
 	assert.Equal(time.Duration(3)*time.Minute, r3.AvgTransformLatency)
 }
 
+// TestTargetWriteResult_AppendWriteTime tests that appending keeps the latest write time,
+// including when appending to an empty result
+func TestTargetWriteResult_AppendWriteTime(t *testing.T) {
+	assert := assert.New(t)
+
+	timeNow := time.Now().UTC()
+
+	r := &TargetWriteResult{}
+	r = r.Append(NewTargetWriteResultWithTime(nil, nil, nil, nil, timeNow))
+	assert.Equal(timeNow, r.WriteTime)
+
+	r = r.Append(NewTargetWriteResultWithTime(nil, nil, nil, nil, timeNow.Add(-time.Minute)))
+	assert.Equal(timeNow, r.WriteTime)
+
+	r = r.Append(NewTargetWriteResultWithTime(nil, nil, nil, nil, timeNow.Add(time.Minute)))
+	assert.Equal(timeNow.Add(time.Minute), r.WriteTime)
+}
+
 // TestNewTargetWriteResult_NoTransformation tests that reporting of statistics is as it should be when we don't have a timeTransformed
 func TestNewTargetWriteResult_NoTransformation(t *testing.T) {
 	assert := assert.New(t)
@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package monitoring
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Observations are what the readiness of the app is derived from, as recorded by the observer
+type Observations interface {
+	// LastTargetWrites returns when writes to the target last succeeded and failed
+	LastTargetWrites() (success time.Time, failure time.Time)
+
+	// LastPull returns when the latest message was pulled from the source
+	LastPull() time.Time
+
+	// IsTargetOpen returns whether the target is open
+	IsTargetOpen() bool
+}
+
+// Server serves the liveness and readiness of the app over HTTP, and optionally pprof
+type Server struct {
+	address      string
+	pprofAddress string
+
+	// writeFailureTimeout is how long writes to the target can keep failing before the app isn't ready
+	writeFailureTimeout time.Duration
+
+	// sourceIdleTimeout is how long the source can go without a message being pulled before the app
+	// isn't ready. The source isn't checked when it's zero.
+	sourceIdleTimeout time.Duration
+
+	observations Observations
+
+	started time.Time
+
+	servers []*http.Server
+
+	log *log.Entry
+}
+
+// check is the result of a readiness check, as reported in the response body
+type check struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// healthResponse is the response body of the health endpoints
+type healthResponse struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks,omitempty"`
+}
+
+// New creates a Server serving the health endpoints on address, and pprof on pprofAddress.
+// pprofAddress can be the same as address to serve both together.
+func New(address string, pprofAddress string, writeFailureTimeout time.Duration, sourceIdleTimeout time.Duration, observations Observations) *Server {
+	return &Server{
+		address:             address,
+		pprofAddress:        pprofAddress,
+		writeFailureTimeout: writeFailureTimeout,
+		sourceIdleTimeout:   sourceIdleTimeout,
+		observations:        observations,
+		started:             time.Now(),
+		log:                 log.WithFields(log.Fields{"name": "Monitoring"}),
+	}
+}
+
+// Start starts listening, returning an error if an address can't be listened on.
+// Nothing is served for an empty address.
+func (s *Server) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health/live", s.live)
+	mux.HandleFunc("/health/ready", s.ready)
+
+	if s.pprofAddress != "" {
+		if s.pprofAddress == s.address {
+			registerPprof(mux)
+		} else {
+			pprofMux := http.NewServeMux()
+			registerPprof(pprofMux)
+			if err := s.serve(s.pprofAddress, pprofMux); err != nil {
+				return errors.Wrap(err, "Error starting pprof server")
+			}
+		}
+	}
+
+	if s.address != "" {
+		if err := s.serve(s.address, mux); err != nil {
+			s.Stop()
+			return errors.Wrap(err, "Error starting monitoring server")
+		}
+	}
+	return nil
+}
+
+// Stop closes the servers
+func (s *Server) Stop() {
+	for _, server := range s.servers {
+		if err := server.Close(); err != nil {
+			s.log.WithFields(log.Fields{"error": err}).Warn("Error closing monitoring server")
+		}
+	}
+	s.servers = nil
+}
+
+// serve listens on the address and serves the handler in the background
+func (s *Server) serve(address string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler}
+	s.servers = append(s.servers, server)
+	s.log.Infof("Listening on %s", listener.Addr())
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.log.WithFields(log.Fields{"error": err}).Error("Monitoring server stopped")
+		}
+	}()
+	return nil
+}
+
+// live reports that the app is running
+func (s *Server) live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, &healthResponse{Status: "ok"})
+}
+
+// ready reports whether the source has pulled a message within the source idle timeout, the target
+// is open, and writes to the target haven't been failing for longer than the write failure timeout
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	reasons := map[string]string{
+		"source": s.checkSource(now),
+		"target": s.checkTarget(),
+		"writes": s.checkWrites(now),
+	}
+
+	checks := make(map[string]check, len(reasons))
+	ready := true
+	for name, reason := range reasons {
+		if reason != "" {
+			checks[name] = check{Status: "failed", Reason: reason}
+			ready = false
+			continue
+		}
+		checks[name] = check{Status: "ok"}
+	}
+
+	if !ready {
+		writeHealth(w, http.StatusServiceUnavailable, &healthResponse{Status: "failed", Checks: checks})
+		return
+	}
+	writeHealth(w, http.StatusOK, &healthResponse{Status: "ok", Checks: checks})
+}
+
+// checkSource returns why the source is unhealthy, or an empty string if it isn't.
+// The source is unhealthy when no message has been pulled from it within the source idle timeout.
+func (s *Server) checkSource(now time.Time) string {
+	if s.observations == nil || s.sourceIdleTimeout == 0 {
+		return ""
+	}
+
+	since := s.observations.LastPull()
+	if since.IsZero() {
+		since = s.started
+	}
+	if now.Sub(since) <= s.sourceIdleTimeout {
+		return ""
+	}
+	return "no message has been pulled from the source since " + since.UTC().Format(time.RFC3339)
+}
+
+// checkTarget returns why the target is unhealthy, or an empty string if it isn't
+func (s *Server) checkTarget() string {
+	if s.observations == nil || s.observations.IsTargetOpen() {
+		return ""
+	}
+	return "the target isn't open"
+}
+
+// checkWrites returns why writes to the target are unhealthy, or an empty string if they aren't.
+// Writes are unhealthy when the last one failed, and none has succeeded within the write failure timeout.
+func (s *Server) checkWrites(now time.Time) string {
+	if s.observations == nil {
+		return ""
+	}
+
+	success, failure := s.observations.LastTargetWrites()
+	if failure.IsZero() || success.After(failure) {
+		return ""
+	}
+
+	since := success
+	if since.IsZero() {
+		since = s.started
+	}
+	if now.Sub(since) <= s.writeFailureTimeout {
+		return ""
+	}
+	return "the last write to the target failed, and none has succeeded since " + since.UTC().Format(time.RFC3339)
+}
+
+// registerPprof registers the pprof handlers on a mux
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// writeHealth writes the response of a health endpoint
+func writeHealth(w http.ResponseWriter, status int, res *healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Error writing health response")
+	}
+}
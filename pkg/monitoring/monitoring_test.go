@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testObservations are set by the tests, rather than recorded by an observer
+type testObservations struct {
+	success    time.Time
+	failure    time.Time
+	pull       time.Time
+	targetOpen bool
+}
+
+func (o *testObservations) LastTargetWrites() (time.Time, time.Time) {
+	return o.success, o.failure
+}
+
+func (o *testObservations) LastPull() time.Time {
+	return o.pull
+}
+
+func (o *testObservations) IsTargetOpen() bool {
+	return o.targetOpen
+}
+
+func getHealth(t *testing.T, handler http.HandlerFunc) (int, *healthResponse) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var res healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, &res
+}
+
+func TestServer_Live(t *testing.T) {
+	assert := assert.New(t)
+
+	s := New(":0", "", time.Minute, 0, nil)
+
+	code, res := getHealth(t, s.live)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("ok", res.Status)
+}
+
+func TestServer_Ready(t *testing.T) {
+	assert := assert.New(t)
+
+	o := &testObservations{targetOpen: true}
+	s := New(":0", "", time.Minute, 0, o)
+
+	// Ready until writes fail
+	code, res := getHealth(t, s.ready)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("ok", res.Status)
+	assert.Equal(check{Status: "ok"}, res.Checks["source"])
+	assert.Equal(check{Status: "ok"}, res.Checks["target"])
+	assert.Equal(check{Status: "ok"}, res.Checks["writes"])
+
+	// Failing writes are tolerated until none has succeeded within the timeout
+	now := time.Now()
+	o.success = now.Add(-30 * time.Second)
+	o.failure = now
+	code, _ = getHealth(t, s.ready)
+	assert.Equal(http.StatusOK, code)
+
+	o.success = now.Add(-2 * time.Minute)
+	code, res = getHealth(t, s.ready)
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal("failed", res.Status)
+	assert.Equal("failed", res.Checks["writes"].Status)
+	assert.Regexp("^the last write to the target failed, and none has succeeded since ", res.Checks["writes"].Reason)
+
+	o.success = now.Add(time.Second)
+	code, _ = getHealth(t, s.ready)
+	assert.Equal(http.StatusOK, code)
+}
+
+func TestServer_ReadyTargetClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	o := &testObservations{}
+	s := New(":0", "", time.Minute, 0, o)
+
+	// Not ready until the target is open
+	code, res := getHealth(t, s.ready)
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(check{Status: "failed", Reason: "the target isn't open"}, res.Checks["target"])
+	assert.Equal(check{Status: "ok"}, res.Checks["writes"])
+
+	o.targetOpen = true
+	code, _ = getHealth(t, s.ready)
+	assert.Equal(http.StatusOK, code)
+}
+
+func TestServer_ReadySourceIdle(t *testing.T) {
+	assert := assert.New(t)
+
+	o := &testObservations{targetOpen: true}
+	s := New(":0", "", time.Minute, 5*time.Minute, o)
+
+	// Without any message pulled, the source is timed from the start of the app
+	assert.Equal("", s.checkSource(s.started.Add(5*time.Minute)))
+	assert.Regexp("^no message has been pulled from the source since ", s.checkSource(s.started.Add(6*time.Minute)))
+
+	// A source which has stopped pulling messages isn't ready
+	now := time.Now()
+	o.pull = now.Add(-10 * time.Minute)
+	code, res := getHealth(t, s.ready)
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal("failed", res.Checks["source"].Status)
+	assert.Equal(check{Status: "ok"}, res.Checks["target"])
+
+	o.pull = now.Add(-time.Minute)
+	code, _ = getHealth(t, s.ready)
+	assert.Equal(http.StatusOK, code)
+
+	// The source isn't checked without an idle timeout
+	s2 := New(":0", "", time.Minute, 0, &testObservations{targetOpen: true, pull: now.Add(-time.Hour)})
+	code, _ = getHealth(t, s2.ready)
+	assert.Equal(http.StatusOK, code)
+}
+
+func TestServer_CheckWritesNoSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	s := New(":0", "", time.Minute, 0, &testObservations{failure: time.Now()})
+
+	// Without any successful write, failures are timed from the start of the app
+	assert.Equal("", s.checkWrites(s.started.Add(time.Minute)))
+	assert.NotEqual("", s.checkWrites(s.started.Add(2*time.Minute)))
+}
+
+func TestServer_StartPprof(t *testing.T) {
+	assert := assert.New(t)
+
+	// pprof is served separately, unless its address is the same
+	s := New("127.0.0.1:0", "localhost:0", time.Minute, 0, nil)
+	assert.Nil(s.Start())
+	assert.Equal(2, len(s.servers))
+	s.Stop()
+
+	s2 := New("127.0.0.1:0", "127.0.0.1:0", time.Minute, 0, nil)
+	assert.Nil(s2.Start())
+	assert.Equal(1, len(s2.servers))
+	s2.Stop()
+
+	s3 := New("", "", time.Minute, 0, nil)
+	assert.Nil(s3.Start())
+	assert.Equal(0, len(s3.servers))
+}
+
+func TestServer_StartInvalidAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	s := New("invalid", "", time.Minute, 0, nil)
+	err := s.Start()
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("^Error starting monitoring server: ", err.Error())
+	}
+}
@@ -8,6 +8,7 @@
 package observer
 
 import (
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -20,23 +21,40 @@ import (
 // and emitting them to downstream destinations
 type Observer struct {
 	statsClient              statsreceiveriface.StatsReceiver
+	resultReceiver           statsreceiveriface.ResultReceiver
 	exitSignal               chan struct{}
 	stopDone                 chan struct{}
 	filteredChan             chan *models.FilterResult
 	targetWriteChan          chan *models.TargetWriteResult
 	targetWriteOversizedChan chan *models.TargetWriteResult
 	targetWriteInvalidChan   chan *models.TargetWriteResult
+	targetRetryChan          chan struct{}
+	failureTargetRetryChan   chan struct{}
+	spilloverChan            chan *models.SpilloverDepth
 	timeout                  time.Duration
 	reportInterval           time.Duration
 	isRunning                bool
 
+	// lastWriteSuccess and lastWriteFailure are when messages were last sent to, or failed
+	// to be sent to, the target. lastPull is when the latest message observed was pulled from
+	// the source, and targetOpen is whether the target has been opened and not closed since.
+	lastWriteSuccess time.Time
+	lastWriteFailure time.Time
+	lastPull         time.Time
+	targetOpen       bool
+	healthMutex      sync.Mutex
+
 	log *log.Entry
 }
 
 // New builds a new observer to be used to gather telemetry
 // about target writes
 func New(statsClient statsreceiveriface.StatsReceiver, timeout time.Duration, reportInterval time.Duration) *Observer {
+	// Stats receivers can also receive every result, as well as the buffers aggregating them
+	resultReceiver, _ := statsClient.(statsreceiveriface.ResultReceiver)
+
 	return &Observer{
+		resultReceiver:           resultReceiver,
 		statsClient:              statsClient,
 		exitSignal:               make(chan struct{}),
 		stopDone:                 make(chan struct{}),
@@ -44,6 +62,9 @@ func New(statsClient statsreceiveriface.StatsReceiver, timeout time.Duration, re
 		targetWriteChan:          make(chan *models.TargetWriteResult, 1000),
 		targetWriteOversizedChan: make(chan *models.TargetWriteResult, 1000),
 		targetWriteInvalidChan:   make(chan *models.TargetWriteResult, 1000),
+		targetRetryChan:          make(chan struct{}, 1000),
+		failureTargetRetryChan:   make(chan struct{}, 1000),
+		spilloverChan:            make(chan *models.SpilloverDepth, 1000),
 		timeout:                  timeout,
 		reportInterval:           reportInterval,
 		log:                      log.WithFields(log.Fields{"name": "Observer"}),
@@ -74,17 +95,48 @@ func (o *Observer) Start() {
 				if o.statsClient != nil {
 					o.statsClient.Send(&buffer)
 				}
+				if closer, ok := o.statsClient.(statsreceiveriface.Closer); ok {
+					closer.Close()
+				}
 
 				o.isRunning = false
 				break ObserverLoop
 			case res := <-o.filteredChan:
 				buffer.AppendFiltered(res)
+				if res != nil {
+					o.recordPulled(res.Filtered)
+				}
+				if o.resultReceiver != nil {
+					o.resultReceiver.ReceiveFiltered(res)
+				}
 			case res := <-o.targetWriteChan:
 				buffer.AppendWrite(res)
+				o.recordWrite(res)
+				if o.resultReceiver != nil {
+					o.resultReceiver.ReceiveWrite(res)
+				}
 			case res := <-o.targetWriteOversizedChan:
 				buffer.AppendWriteOversized(res)
+				if res != nil {
+					o.recordPulled(res.Sent, res.Failed)
+				}
+				if o.resultReceiver != nil {
+					o.resultReceiver.ReceiveWriteOversized(res)
+				}
 			case res := <-o.targetWriteInvalidChan:
 				buffer.AppendWriteInvalid(res)
+				if res != nil {
+					o.recordPulled(res.Sent, res.Failed)
+				}
+				if o.resultReceiver != nil {
+					o.resultReceiver.ReceiveWriteInvalid(res)
+				}
+			case <-o.targetRetryChan:
+				buffer.AppendTargetRetry()
+			case <-o.failureTargetRetryChan:
+				buffer.AppendFailureTargetRetry()
+			case depth := <-o.spilloverChan:
+				buffer.Spillover = depth
 			case <-time.After(o.timeout):
 				o.log.Debugf("Observer timed out after (%v) waiting for result", o.timeout)
 			}
@@ -96,7 +148,9 @@ func (o *Observer) Start() {
 				}
 
 				reportTime = time.Now().Add(o.reportInterval)
-				buffer = models.ObserverBuffer{}
+
+				// The depth of the spillover buffer is a gauge, so it is kept until it changes
+				buffer = models.ObserverBuffer{Spillover: buffer.Spillover}
 			}
 		}
 		o.stopDone <- struct{}{}
@@ -112,6 +166,86 @@ func (o *Observer) Stop() {
 	}
 }
 
+// recordWrite keeps track of when writes to the target last succeeded and failed
+func (o *Observer) recordWrite(res *models.TargetWriteResult) {
+	if res == nil {
+		return
+	}
+	o.recordPulled(res.Sent, res.Failed, res.Oversized, res.Invalid)
+
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	now := time.Now()
+	if res.SentCount > 0 {
+		o.lastWriteSuccess = now
+	}
+	if res.FailedCount > 0 {
+		o.lastWriteFailure = now
+	}
+}
+
+// LastTargetWrites returns when messages were last sent to, and last failed to be sent to,
+// the target. Either is the zero time if it hasn't happened yet.
+func (o *Observer) LastTargetWrites() (success time.Time, failure time.Time) {
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	return o.lastWriteSuccess, o.lastWriteFailure
+}
+
+// recordPulled keeps track of when the latest of the messages was pulled from the source
+func (o *Observer) recordPulled(batches ...[]*models.Message) {
+	var latest time.Time
+	for _, messages := range batches {
+		for _, msg := range messages {
+			if msg.TimePulled.After(latest) {
+				latest = msg.TimePulled
+			}
+		}
+	}
+
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	if latest.After(o.lastPull) {
+		o.lastPull = latest
+	}
+}
+
+// LastPull returns when the latest message observed was pulled from the source, or the zero
+// time if no message has been observed yet.
+func (o *Observer) LastPull() time.Time {
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	return o.lastPull
+}
+
+// TargetOpened records that the target has been opened
+func (o *Observer) TargetOpened() {
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	o.targetOpen = true
+}
+
+// TargetClosed records that the target has been closed
+func (o *Observer) TargetClosed() {
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	o.targetOpen = false
+}
+
+// IsTargetOpen returns whether the target has been opened, and not closed since
+func (o *Observer) IsTargetOpen() bool {
+	o.healthMutex.Lock()
+	defer o.healthMutex.Unlock()
+
+	return o.targetOpen
+}
+
 // --- Functions called to push information to observer
 
 // Filtered pushes a filter result onto a channel for processing
@@ -137,3 +271,21 @@ func (o *Observer) TargetWriteOversized(r *models.TargetWriteResult) {
 func (o *Observer) TargetWriteInvalid(r *models.TargetWriteResult) {
 	o.targetWriteInvalidChan <- r
 }
+
+// TargetWriteRetry pushes a retried target write onto a channel for processing
+// by the observer
+func (o *Observer) TargetWriteRetry() {
+	o.targetRetryChan <- struct{}{}
+}
+
+// FailureTargetWriteRetry pushes a retried failure target write onto a channel for processing
+// by the observer
+func (o *Observer) FailureTargetWriteRetry() {
+	o.failureTargetRetryChan <- struct{}{}
+}
+
+// SpilloverDepth pushes the depth of the spillover buffer onto a channel for processing
+// by the observer
+func (o *Observer) SpilloverDepth(messages int64, bytes int64) {
+	o.spilloverChan <- &models.SpilloverDepth{Messages: messages, Bytes: bytes}
+}
@@ -8,6 +8,7 @@
 package observer
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -26,6 +27,48 @@ func (s *TestStatsReceiver) Send(b *models.ObserverBuffer) {
 	s.onSend(b)
 }
 
+// --- Test ResultReceiver
+
+type TestResultReceiver struct {
+	TestStatsReceiver
+	writes   int64
+	filtered int64
+	mutex    sync.Mutex
+}
+
+func (s *TestResultReceiver) ReceiveFiltered(res *models.FilterResult) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.filtered += res.FilteredCount
+}
+
+func (s *TestResultReceiver) ReceiveWrite(res *models.TargetWriteResult) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.writes += res.Total()
+}
+
+func (s *TestResultReceiver) ReceiveWriteOversized(res *models.TargetWriteResult) {}
+
+func (s *TestResultReceiver) ReceiveWriteInvalid(res *models.TargetWriteResult) {}
+
+func (s *TestResultReceiver) counts() (int64, int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.writes, s.filtered
+}
+
+// --- Test Closer
+
+type TestClosingStatsReceiver struct {
+	TestStatsReceiver
+	closed chan struct{}
+}
+
+func (s *TestClosingStatsReceiver) Close() {
+	close(s.closed)
+}
+
 // --- Tests
 
 func TestObserverTargetWrite(t *testing.T) {
@@ -38,11 +81,15 @@ func TestObserverTargetWrite(t *testing.T) {
 			assert.Equal(int64(5), b.TargetResults)
 			assert.Equal(int64(5), b.OversizedTargetResults)
 			assert.Equal(int64(5), b.InvalidTargetResults)
+			assert.Equal(int64(5), b.TargetRetries)
+			assert.Equal(int64(5), b.FailureTargetRetries)
 			counter++
 		} else {
 			assert.Equal(int64(1), b.TargetResults)
 			assert.Equal(int64(1), b.OversizedTargetResults)
 			assert.Equal(int64(1), b.InvalidTargetResults)
+			assert.Equal(int64(0), b.TargetRetries)
+			assert.Equal(int64(0), b.FailureTargetRetries)
 		}
 	}
 
@@ -84,6 +131,8 @@ func TestObserverTargetWrite(t *testing.T) {
 		observer.TargetWrite(r)
 		observer.TargetWriteOversized(r)
 		observer.TargetWriteInvalid(r)
+		observer.TargetWriteRetry()
+		observer.FailureTargetWriteRetry()
 	}
 
 	// Trigger timeout (1 second)
@@ -101,3 +150,103 @@ func TestObserverTargetWrite(t *testing.T) {
 
 	observer.Stop()
 }
+
+func TestObserverLastTargetWrites(t *testing.T) {
+	assert := assert.New(t)
+
+	observer := New(nil, 1*time.Second, 3*time.Second)
+	observer.Start()
+	defer observer.Stop()
+
+	success, failure := observer.LastTargetWrites()
+	assert.True(success.IsZero())
+	assert.True(failure.IsZero())
+
+	failed := []*models.Message{{Data: []byte("Foo")}}
+	observer.TargetWrite(models.NewTargetWriteResult(nil, failed, nil, nil))
+
+	assert.Eventually(func() bool {
+		_, failure := observer.LastTargetWrites()
+		return !failure.IsZero()
+	}, time.Second, 10*time.Millisecond)
+	success, _ = observer.LastTargetWrites()
+	assert.True(success.IsZero())
+
+	sent := []*models.Message{{Data: []byte("Bar")}}
+	observer.TargetWrite(models.NewTargetWriteResult(sent, nil, nil, nil))
+
+	assert.Eventually(func() bool {
+		success, failure := observer.LastTargetWrites()
+		return !success.Before(failure)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestObserverLastPull(t *testing.T) {
+	assert := assert.New(t)
+
+	observer := New(nil, 1*time.Second, 3*time.Second)
+	observer.Start()
+	defer observer.Stop()
+
+	assert.True(observer.LastPull().IsZero())
+
+	// The latest pull is kept across every kind of result
+	now := time.Now().UTC()
+	observer.TargetWrite(models.NewTargetWriteResult(nil, []*models.Message{{TimePulled: now.Add(-time.Minute)}}, nil, nil))
+	observer.Filtered(models.NewFilterResult([]*models.Message{{TimePulled: now}}))
+	observer.TargetWriteInvalid(models.NewTargetWriteResult([]*models.Message{{TimePulled: now.Add(-2 * time.Minute)}}, nil, nil, nil))
+
+	assert.Eventually(func() bool {
+		return observer.LastPull().Equal(now)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestObserverTargetOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	observer := New(nil, 1*time.Second, 3*time.Second)
+	assert.False(observer.IsTargetOpen())
+
+	observer.TargetOpened()
+	assert.True(observer.IsTargetOpen())
+
+	observer.TargetClosed()
+	assert.False(observer.IsTargetOpen())
+}
+
+func TestObserverClosesStatsReceiver(t *testing.T) {
+	assert := assert.New(t)
+
+	sr := &TestClosingStatsReceiver{
+		TestStatsReceiver: TestStatsReceiver{onSend: func(b *models.ObserverBuffer) {}},
+		closed:            make(chan struct{}),
+	}
+	observer := New(sr, 1*time.Second, 3*time.Second)
+	observer.Start()
+	observer.Stop()
+
+	select {
+	case <-sr.closed:
+	default:
+		assert.Fail("stats receiver wasn't closed when the observer stopped")
+	}
+}
+
+func TestObserverResultReceiver(t *testing.T) {
+	assert := assert.New(t)
+
+	sr := &TestResultReceiver{TestStatsReceiver: TestStatsReceiver{onSend: func(b *models.ObserverBuffer) {}}}
+	observer := New(sr, 1*time.Second, 3*time.Second)
+	observer.Start()
+	defer observer.Stop()
+
+	messages := []*models.Message{{Data: []byte("Foo")}, {Data: []byte("Bar")}}
+	observer.TargetWrite(models.NewTargetWriteResult(messages, nil, nil, nil))
+	observer.Filtered(models.NewFilterResult(messages[:1]))
+
+	// Every result is passed on as it is observed, rather than waiting for the buffer
+	assert.Eventually(func() bool {
+		writes, filtered := sr.counts()
+		return writes == 2 && filtered == 1
+	}, time.Second, 10*time.Millisecond)
+}
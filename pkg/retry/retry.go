@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Policy configures how a failing operation is retried
+type Policy struct {
+	// MaxAttempts is the number of attempts made before giving up, including the first
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, doubling for each retry after it
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between retries
+	MaxDelay time.Duration
+
+	// Jitter randomises each delay to between half and all of its value
+	Jitter bool
+
+	// Infinite retries until the operation succeeds, ignoring MaxAttempts
+	Infinite bool
+
+	// AlertAfterAttempts raises an error level log, which is reported to Sentry if
+	// configured, every time this many consecutive attempts have failed
+	AlertAfterAttempts int
+
+	// sleep allows tests to skip the delays
+	sleep func(time.Duration)
+}
+
+// Run calls f until it succeeds or the policy gives up, returning the last error.
+// onRetry, if provided, is called every time a failed attempt is about to be retried.
+func (p *Policy) Run(name string, f func() error, onRetry func()) error {
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		if !p.Infinite && attempt >= p.MaxAttempts {
+			return errors.Wrap(err, name)
+		}
+
+		logger := log.WithFields(log.Fields{"error": err, "attempt": attempt, "func": name})
+		if p.AlertAfterAttempts > 0 && attempt%p.AlertAfterAttempts == 0 {
+			logger.Errorf("Func %s has failed %d consecutive attempts and is still retrying", name, attempt)
+		} else {
+			logger.Warnf("Retrying func (attempt: %d): %s: %s", attempt, name, err)
+		}
+
+		if onRetry != nil {
+			onRetry()
+		}
+		sleep(p.delay(attempt))
+	}
+}
+
+// delay returns how long to wait after a failed attempt
+func (p *Policy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < maxDelay(p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter && d > 0 {
+		half := d / 2
+		d = half + time.Duration(rand.Int63n(int64(d-half)+1))
+	}
+	return d
+}
+
+// maxDelay returns the cap on delays, falling back to a cap which cannot overflow when doubled
+func maxDelay(configured time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	return time.Duration(math.MaxInt64 / 2)
+}
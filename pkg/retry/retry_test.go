@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_RunSucceedsAfterRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	var delays []time.Duration
+	p := &Policy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    3 * time.Second,
+		sleep:       func(d time.Duration) { delays = append(delays, d) },
+	}
+
+	calls := 0
+	retries := 0
+	err := p.Run("test", func() error {
+		calls++
+		if calls < 4 {
+			return errors.New("failed")
+		}
+		return nil
+	}, func() { retries++ })
+
+	assert.Nil(err)
+	assert.Equal(4, calls)
+	assert.Equal(3, retries)
+	assert.Equal([]time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, delays)
+}
+
+func TestPolicy_RunGivesUpAfterMaxAttempts(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Second,
+		sleep:       func(d time.Duration) {},
+	}
+
+	calls := 0
+	retries := 0
+	err := p.Run("test", func() error {
+		calls++
+		return errors.New("failed")
+	}, func() { retries++ })
+
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("test: failed", err.Error())
+	}
+	assert.Equal(3, calls)
+	assert.Equal(2, retries)
+}
+
+func TestPolicy_RunInfinite(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Policy{
+		MaxAttempts:        1,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Minute,
+		Infinite:           true,
+		AlertAfterAttempts: 10,
+		sleep:              func(d time.Duration) {},
+	}
+
+	calls := 0
+	err := p.Run("test", func() error {
+		calls++
+		if calls < 100 {
+			return errors.New("failed")
+		}
+		return nil
+	}, nil)
+
+	assert.Nil(err)
+	assert.Equal(100, calls)
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	assert.Equal(100*time.Millisecond, p.delay(1))
+	assert.Equal(200*time.Millisecond, p.delay(2))
+	assert.Equal(800*time.Millisecond, p.delay(4))
+	assert.Equal(time.Second, p.delay(5))
+	assert.Equal(time.Second, p.delay(1000))
+
+	// Without a max delay, doubling stops short of overflowing
+	p = &Policy{BaseDelay: time.Second}
+	assert.True(p.delay(1000) > 0)
+
+	p = &Policy{BaseDelay: time.Second, MaxDelay: time.Minute, Jitter: true}
+	for i := 0; i < 100; i++ {
+		d := p.delay(3)
+		assert.True(d >= 2*time.Second && d <= 4*time.Second, d)
+	}
+}
@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package filesource
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fileState is the acked progress of a single file
+type fileState struct {
+	// Offset is the number of decompressed bytes from the start of the file which have been acked
+	Offset   int64 `json:"offset"`
+	Complete bool  `json:"complete"`
+}
+
+// checkpointState is the content of the checkpoint file, keyed by absolute file path
+type checkpointState struct {
+	Files map[string]*fileState `json:"files"`
+}
+
+// checkpoint records which files and offsets have been acked, persisting them to a local file
+type checkpoint struct {
+	path  string
+	state checkpointState
+	dirty bool
+	mutex sync.Mutex
+}
+
+// loadCheckpoint reads a checkpoint file, returning an empty checkpoint if it does not yet exist
+func loadCheckpoint(path string) (*checkpoint, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{
+		path:  abs,
+		state: checkpointState{Files: make(map[string]*fileState)},
+	}
+
+	content, err := os.ReadFile(abs)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read checkpoint file")
+	}
+
+	if err := json.Unmarshal(content, &cp.state); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse checkpoint file")
+	}
+	if cp.state.Files == nil {
+		cp.state.Files = make(map[string]*fileState)
+	}
+	return cp, nil
+}
+
+// get returns the acked offset of a file and whether it has been completed
+func (cp *checkpoint) get(file string) (int64, bool) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	state, ok := cp.state.Files[file]
+	if !ok {
+		return 0, false
+	}
+	return state.Offset, state.Complete
+}
+
+// setOffset records the acked offset of a file
+func (cp *checkpoint) setOffset(file string, offset int64) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	state, ok := cp.state.Files[file]
+	if !ok {
+		state = &fileState{}
+		cp.state.Files[file] = state
+	}
+	if offset > state.Offset {
+		state.Offset = offset
+		cp.dirty = true
+	}
+}
+
+// setComplete records that every line of a file has been acked
+func (cp *checkpoint) setComplete(file string) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	state, ok := cp.state.Files[file]
+	if !ok {
+		state = &fileState{}
+		cp.state.Files[file] = state
+	}
+	state.Complete = true
+	cp.dirty = true
+}
+
+// isOwnFile returns whether a path is the checkpoint file, or its temporary file
+func (cp *checkpoint) isOwnFile(path string) bool {
+	return path == cp.path || path == cp.path+".tmp"
+}
+
+// flush persists the checkpoint if it has changed, writing to a temporary file first
+// so that a crash never leaves a partially written checkpoint behind
+func (cp *checkpoint) flush() error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	if !cp.dirty {
+		return nil
+	}
+
+	content, err := json.Marshal(cp.state)
+	if err != nil {
+		return errors.Wrap(err, "Failed to serialise checkpoint")
+	}
+
+	tmpPath := cp.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create checkpoint file")
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Failed to write checkpoint file")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Failed to sync checkpoint file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "Failed to close checkpoint file")
+	}
+	if err := os.Rename(tmpPath, cp.path); err != nil {
+		return errors.Wrap(err, "Failed to replace checkpoint file")
+	}
+
+	cp.dirty = false
+	return nil
+}
+
+// fileProgress keeps the in-flight line end offsets of a single file in the order they
+// were read, so that the checkpoint only moves past a line once every line before it
+// has been acked
+type fileProgress struct {
+	pending   []int64
+	acked     map[int64]bool
+	eof       bool
+	completed bool
+	mutex     sync.Mutex
+}
+
+// newFileProgress creates an empty fileProgress
+func newFileProgress() *fileProgress {
+	return &fileProgress{
+		acked: make(map[int64]bool),
+	}
+}
+
+// track registers the end offset of a line which has been read but not yet acked
+func (fp *fileProgress) track(endOffset int64) {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+
+	fp.pending = append(fp.pending, endOffset)
+}
+
+// ack registers the line ending at an offset as acked, returning the offset up to which
+// every line has been acked, whether it has moved forward, and whether the file has
+// now been completed
+func (fp *fileProgress) ack(endOffset int64) (int64, bool, bool) {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+
+	fp.acked[endOffset] = true
+
+	var committed int64
+	moved := false
+	for len(fp.pending) > 0 && fp.acked[fp.pending[0]] {
+		committed = fp.pending[0]
+		moved = true
+
+		delete(fp.acked, fp.pending[0])
+		fp.pending = fp.pending[1:]
+	}
+
+	return committed, moved, fp.checkCompleted()
+}
+
+// finish registers that the whole file has been read, returning whether it has been completed
+func (fp *fileProgress) finish() bool {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+
+	fp.eof = true
+	return fp.checkCompleted()
+}
+
+// checkCompleted returns true exactly once, when the file has been read and every line acked
+func (fp *fileProgress) checkCompleted() bool {
+	if fp.eof && len(fp.pending) == 0 && !fp.completed {
+		fp.completed = true
+		return true
+	}
+	return false
+}
@@ -0,0 +1,483 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package filesource
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+
+	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+)
+
+const (
+	compressionAuto = "auto"
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+
+	// checkpointFlushInterval is how often acked progress is persisted to the checkpoint file
+	checkpointFlushInterval = time.Second
+)
+
+// Configuration configures the source for records pulled
+type Configuration struct {
+	Path             string `hcl:"path" env:"SOURCE_FILE_PATH"`
+	Compression      string `hcl:"compression,optional" env:"SOURCE_FILE_COMPRESSION"`
+	CheckpointFile   string `hcl:"checkpoint_file,optional" env:"SOURCE_FILE_CHECKPOINT_FILE"`
+	DoneDir          string `hcl:"done_dir,optional" env:"SOURCE_FILE_DONE_DIR"`
+	MaxLineBytes     int    `hcl:"max_line_bytes,optional" env:"SOURCE_FILE_MAX_LINE_BYTES"`
+	ConcurrentWrites int    `hcl:"concurrent_writes,optional" env:"SOURCE_CONCURRENT_WRITES"`
+}
+
+// fileSource holds a new client for reading messages from files
+type fileSource struct {
+	path             string
+	compression      string
+	doneDir          string
+	maxLineBytes     int
+	concurrentWrites int
+
+	checkpoint *checkpoint
+
+	log *log.Entry
+
+	// ctx is cancelled to halt reading, either by Stop() or on a failed write
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// err holds the first write error, which halts reading
+	err      error
+	errMutex sync.Mutex
+}
+
+// configFunction returns a file source from a config
+func configFunction(c *Configuration) (sourceiface.Source, error) {
+	return newFileSource(
+		c.Path,
+		c.Compression,
+		c.CheckpointFile,
+		c.DoneDir,
+		c.MaxLineBytes,
+		c.ConcurrentWrites,
+	)
+}
+
+// The adapter type is an adapter for functions to be used as
+// pluggable components for File Source. It implements the Pluggable interface.
+type adapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f adapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f adapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults
+	cfg := &Configuration{
+		Compression:      compressionAuto,
+		CheckpointFile:   "snowbridge-file-source.checkpoint",
+		MaxLineBytes:     10485760,
+		ConcurrentWrites: 50,
+	}
+
+	return cfg, nil
+}
+
+// adapterGenerator returns a File Source adapter.
+func adapterGenerator(f func(c *Configuration) (sourceiface.Source, error)) adapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*Configuration)
+		if !ok {
+			return nil, errors.New("invalid input, expected FileSourceConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// ConfigPair is passed to configuration to determine when to build a file source.
+var ConfigPair = config.ConfigurationPair{
+	Name:   "file",
+	Handle: adapterGenerator(configFunction),
+}
+
+// newFileSource creates a new client for reading messages from files
+func newFileSource(path string, compression string, checkpointFile string, doneDir string, maxLineBytes int, concurrentWrites int) (*fileSource, error) {
+	switch compression {
+	case compressionAuto, compressionNone, compressionGzip, compressionZstd:
+	default:
+		return nil, fmt.Errorf("invalid compression \"%s\": must be one of \"auto\", \"none\", \"gzip\" or \"zstd\"", compression)
+	}
+	if checkpointFile == "" {
+		return nil, errors.New("checkpoint_file must be set for the file source")
+	}
+
+	cp, err := loadCheckpoint(checkpointFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if doneDir != "" {
+		if err := os.MkdirAll(doneDir, 0755); err != nil {
+			return nil, errors.Wrap(err, "Failed to create done directory")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &fileSource{
+		path:             path,
+		compression:      compression,
+		doneDir:          doneDir,
+		maxLineBytes:     maxLineBytes,
+		concurrentWrites: concurrentWrites,
+		checkpoint:       cp,
+		log:              log.WithFields(log.Fields{"source": "file", "path": path}),
+		ctx:              ctx,
+		cancel:           cancel,
+	}, nil
+}
+
+// Read will read every file matching the path which has not yet been completed,
+// returning once all of them have been read or Stop is called
+func (fs *fileSource) Read(sf *sourceiface.SourceFunctions) error {
+	files, err := fs.listFiles()
+	if err != nil {
+		return err
+	}
+	fs.log.Infof("Reading messages from %d files ...", len(files))
+
+	// Persist acked progress periodically rather than on every ack
+	flushDone := make(chan struct{})
+	flushStopped := make(chan struct{})
+	go func() {
+		defer close(flushStopped)
+		ticker := time.NewTicker(checkpointFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := fs.checkpoint.flush(); err != nil {
+					fs.log.WithFields(log.Fields{"error": err}).Error(err)
+				}
+			case <-flushDone:
+				return
+			}
+		}
+	}()
+
+	throttle := make(chan struct{}, fs.concurrentWrites)
+	wg := sync.WaitGroup{}
+
+	var readErr error
+	for _, file := range files {
+		if fs.ctx.Err() != nil {
+			break
+		}
+		if err := fs.readFile(file, sf, throttle, &wg); err != nil {
+			readErr = err
+			break
+		}
+	}
+	wg.Wait()
+
+	close(flushDone)
+	<-flushStopped
+	if err := fs.checkpoint.flush(); err != nil {
+		return err
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+	return fs.getError()
+}
+
+// Stop will halt the reader processing more events
+func (fs *fileSource) Stop() {
+	fs.log.Warn("Cancelling file read ...")
+	fs.cancel()
+}
+
+// GetID returns the identifier for this source
+func (fs *fileSource) GetID() string {
+	return fmt.Sprintf("file:%s", fs.path)
+}
+
+// listFiles returns the sorted list of files to read: every regular file in the
+// path if it is a directory, otherwise every file matching it as a glob
+func (fs *fileSource) listFiles() ([]string, error) {
+	var matches []string
+
+	info, err := os.Stat(fs.path)
+	if err == nil && info.IsDir() {
+		entries, err := os.ReadDir(fs.path)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to list source directory")
+		}
+		for _, entry := range entries {
+			matches = append(matches, filepath.Join(fs.path, entry.Name()))
+		}
+	} else {
+		matches, err = filepath.Glob(fs.path)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to match source path")
+		}
+	}
+
+	var files []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to stat source file")
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		abs, err := filepath.Abs(match)
+		if err != nil {
+			return nil, err
+		}
+		if fs.checkpoint.isOwnFile(abs) {
+			continue
+		}
+		files = append(files, abs)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// readFile sends every line of a file to the target, resuming from its checkpointed offset
+func (fs *fileSource) readFile(file string, sf *sourceiface.SourceFunctions, throttle chan struct{}, wg *sync.WaitGroup) error {
+	offset, complete := fs.checkpoint.get(file)
+	if complete {
+		fs.log.Debugf("Skipping completed file %s", file)
+		return fs.moveToDone(file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "Failed to open source file")
+	}
+
+	reader, closeReader, err := fs.newReader(file, f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer func() {
+		closeReader()
+		f.Close()
+	}()
+
+	// Offsets are counted in the decompressed stream, so compressed files must be
+	// read up to the checkpoint rather than seeked
+	if offset > 0 {
+		fs.log.Infof("Resuming file %s from offset %d", file, offset)
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+			return errors.Wrap(err, "Failed to skip to checkpointed offset")
+		}
+	}
+
+	progress := newFileProgress()
+	onAck := func(endOffset int64) {
+		committed, moved, done := progress.ack(endOffset)
+		if moved {
+			fs.checkpoint.setOffset(file, committed)
+		}
+		if done {
+			fs.completeFile(file)
+		}
+	}
+
+	bufReader := bufio.NewReaderSize(reader, 65536)
+	for fs.ctx.Err() == nil {
+		line, err := readLine(bufReader, fs.maxLineBytes)
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, fmt.Sprintf("Failed to read source file %s", file))
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+
+		offset += int64(len(line))
+		endOffset := offset
+		data := trimLineEnding(line)
+
+		if len(data) > 0 {
+			timeNow := time.Now().UTC()
+			progress.track(endOffset)
+			messages := []*models.Message{
+				{
+					Data:         data,
+					PartitionKey: uuid.NewV4().String(),
+					TimeCreated:  timeNow,
+					TimePulled:   timeNow,
+					AckFunc: func() {
+						onAck(endOffset)
+					},
+				},
+			}
+
+			throttle <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := sf.WriteToTarget(messages)
+
+				// An unacked line blocks the checkpoint for this file from moving forward,
+				// so we stop reading and let the next run resume from the checkpoint.
+				if err != nil {
+					fs.setError(err)
+				}
+				<-throttle
+			}()
+		} else {
+			// Blank lines carry no message, so count as acked straight away
+			progress.track(endOffset)
+			onAck(endOffset)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if fs.ctx.Err() == nil {
+		if progress.finish() {
+			fs.completeFile(file)
+		}
+	}
+	return nil
+}
+
+// newReader wraps a file in the decompressor for its compression
+func (fs *fileSource) newReader(file string, f io.Reader) (io.Reader, func(), error) {
+	compression := fs.compression
+	if compression == compressionAuto {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".gz", ".gzip":
+			compression = compressionGzip
+		case ".zst", ".zstd":
+			compression = compressionZstd
+		default:
+			compression = compressionNone
+		}
+	}
+
+	switch compression {
+	case compressionGzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to open gzip file %s", file))
+		}
+		return gz, func() { gz.Close() }, nil
+	case compressionZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to open zstd file %s", file))
+		}
+		return zr, zr.Close, nil
+	default:
+		return f, func() {}, nil
+	}
+}
+
+// completeFile marks a file as fully acked and moves it to the done directory
+func (fs *fileSource) completeFile(file string) {
+	fs.checkpoint.setComplete(file)
+	fs.log.Infof("Completed file %s", file)
+
+	// The checkpoint must record completion before the file is moved, otherwise a crash
+	// in between would lose track of the file entirely
+	if err := fs.checkpoint.flush(); err != nil {
+		fs.log.WithFields(log.Fields{"error": err}).Error(err)
+		return
+	}
+	if err := fs.moveToDone(file); err != nil {
+		fs.log.WithFields(log.Fields{"error": err}).Error(err)
+	}
+}
+
+// moveToDone moves a completed file to the done directory, if one is configured
+func (fs *fileSource) moveToDone(file string) error {
+	if fs.doneDir == "" {
+		return nil
+	}
+	err := os.Rename(file, filepath.Join(fs.doneDir, filepath.Base(file)))
+	if err != nil {
+		return errors.Wrap(err, "Failed to move file to done directory")
+	}
+	return nil
+}
+
+// setError stores the first write error and cancels reading
+func (fs *fileSource) setError(err error) {
+	fs.log.WithFields(log.Fields{"error": err}).Error(err)
+
+	fs.errMutex.Lock()
+	if fs.err == nil {
+		fs.err = err
+	}
+	fs.errMutex.Unlock()
+
+	fs.cancel()
+}
+
+// getError returns the first write error, if any
+func (fs *fileSource) getError() error {
+	fs.errMutex.Lock()
+	defer fs.errMutex.Unlock()
+	return fs.err
+}
+
+// readLine reads up to and including the next newline, failing if the line is longer than maxBytes
+func readLine(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxBytes {
+			return nil, fmt.Errorf("line exceeds max_line_bytes of %d", maxBytes)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return line, err
+	}
+}
+
+// trimLineEnding returns a line without its trailing newline
+func trimLineEnding(line []byte) []byte {
+	trimmed := line
+	if n := len(trimmed); n > 0 && trimmed[n-1] == '\n' {
+		trimmed = trimmed[:n-1]
+		if n := len(trimmed); n > 0 && trimmed[n-1] == '\r' {
+			trimmed = trimmed[:n-1]
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,360 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package filesource
+
+import (
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/assets"
+	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/source/sourceconfig"
+	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+)
+
+func TestMain(m *testing.M) {
+	os.Clearenv()
+	exitVal := m.Run()
+	os.Exit(exitVal)
+}
+
+func TestFileSource_ReadSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	inputDir := filepath.Join(dir, "input")
+	doneDir := filepath.Join(dir, "done")
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	assert.Nil(os.MkdirAll(inputDir, 0755))
+
+	writePlainFile(t, filepath.Join(inputDir, "a.tsv"), "a1\na2\r\n\na3")
+	writeGzipFile(t, filepath.Join(inputDir, "b.tsv.gz"), "b1\nb2\n")
+	writeZstdFile(t, filepath.Join(inputDir, "c.tsv.zst"), "c1\nc2\n")
+
+	source, err := newFileSource(inputDir, "auto", checkpointFile, doneDir, 1024, 5)
+	assert.Nil(err)
+	assert.NotNil(source)
+	assert.Equal("file:"+inputDir, source.GetID())
+
+	received := readAll(t, source, nil)
+	sort.Strings(received)
+	assert.Equal([]string{"a1", "a2", "a3", "b1", "b2", "c1", "c2"}, received)
+
+	// Every file is recorded as complete and moved to the done directory
+	cp, err := loadCheckpoint(checkpointFile)
+	assert.Nil(err)
+	for _, name := range []string{"a.tsv", "b.tsv.gz", "c.tsv.zst"} {
+		_, complete := cp.get(filepath.Join(inputDir, name))
+		assert.True(complete, name)
+
+		_, err := os.Stat(filepath.Join(doneDir, name))
+		assert.Nil(err, name)
+		_, err = os.Stat(filepath.Join(inputDir, name))
+		assert.True(os.IsNotExist(err), name)
+	}
+}
+
+func TestFileSource_ResumesFromCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	inputFile := filepath.Join(dir, "events.tsv.gz")
+	writeGzipFile(t, inputFile, "one\ntwo\nthree\nfour\nfive\n")
+
+	// First run only acks the first and third lines
+	source, err := newFileSource(filepath.Join(dir, "*.gz"), "auto", checkpointFile, "", 1024, 1)
+	assert.Nil(err)
+	received := readAll(t, source, map[string]bool{"one": true, "three": true})
+	assert.Equal(5, len(received))
+
+	cp, err := loadCheckpoint(checkpointFile)
+	assert.Nil(err)
+	offset, complete := cp.get(inputFile)
+	assert.Equal(int64(len("one\n")), offset)
+	assert.False(complete)
+
+	// Second run resumes after the last contiguously acked line
+	source, err = newFileSource(filepath.Join(dir, "*.gz"), "auto", checkpointFile, "", 1024, 1)
+	assert.Nil(err)
+	received = readAll(t, source, nil)
+	assert.Equal([]string{"two", "three", "four", "five"}, received)
+
+	cp, err = loadCheckpoint(checkpointFile)
+	assert.Nil(err)
+	_, complete = cp.get(inputFile)
+	assert.True(complete)
+
+	// Third run has nothing left to read
+	source, err = newFileSource(filepath.Join(dir, "*.gz"), "auto", checkpointFile, "", 1024, 1)
+	assert.Nil(err)
+	received = readAll(t, source, nil)
+	assert.Empty(received)
+}
+
+func TestFileSource_ReadFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	inputFile := filepath.Join(dir, "events.tsv")
+	writePlainFile(t, inputFile, "one\ntwo\n")
+
+	source, err := newFileSource(inputFile, "none", checkpointFile, "", 1024, 1)
+	assert.Nil(err)
+
+	sf := sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			return errors.New("write failed")
+		},
+	}
+
+	err = source.Read(&sf)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("write failed", err.Error())
+	}
+
+	cp, err := loadCheckpoint(checkpointFile)
+	assert.Nil(err)
+	offset, complete := cp.get(inputFile)
+	assert.Equal(int64(0), offset)
+	assert.False(complete)
+}
+
+func TestFileSource_LineTooLong(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "events.tsv")
+	writePlainFile(t, inputFile, strings.Repeat("x", 100)+"\n")
+
+	source, err := newFileSource(inputFile, "none", filepath.Join(dir, "checkpoint.json"), "", 10, 1)
+	assert.Nil(err)
+
+	sf := sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			return nil
+		},
+	}
+
+	err = source.Read(&sf)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Contains(err.Error(), "line exceeds max_line_bytes of 10")
+	}
+}
+
+func TestNewFileSource_InvalidCompression(t *testing.T) {
+	assert := assert.New(t)
+
+	source, err := newFileSource("*.tsv", "lz4", filepath.Join(t.TempDir(), "checkpoint.json"), "", 1024, 1)
+	assert.Nil(source)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("invalid compression \"lz4\": must be one of \"auto\", \"none\", \"gzip\" or \"zstd\"", err.Error())
+	}
+}
+
+func TestFileProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	progress := newFileProgress()
+	for _, offset := range []int64{4, 8, 14} {
+		progress.track(offset)
+	}
+
+	_, moved, done := progress.ack(8)
+	assert.False(moved)
+	assert.False(done)
+
+	committed, moved, done := progress.ack(4)
+	assert.True(moved)
+	assert.False(done)
+	assert.Equal(int64(8), committed)
+
+	assert.False(progress.finish())
+
+	committed, moved, done = progress.ack(14)
+	assert.True(moved)
+	assert.True(done)
+	assert.Equal(int64(14), committed)
+
+	// Completion is only reported once
+	assert.False(progress.finish())
+}
+
+func TestGetSource_WithFileSource(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	t.Setenv("SOURCE_NAME", "file")
+	t.Setenv("SOURCE_FILE_PATH", filepath.Join(dir, "*.tsv"))
+	t.Setenv("SOURCE_FILE_CHECKPOINT_FILE", filepath.Join(dir, "checkpoint.json"))
+
+	supportedSources := []config.ConfigurationPair{ConfigPair}
+
+	c, err := config.NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	fileSource, err := sourceconfig.GetSource(c, supportedSources)
+
+	assert.NotNil(fileSource)
+	assert.Nil(err)
+	assert.Equal("file:"+filepath.Join(dir, "*.tsv"), fileSource.GetID())
+}
+
+func TestFileSourceHCL(t *testing.T) {
+	testFixPath := filepath.Join(assets.AssetsRootDir, "test", "source", "configs")
+	testCases := []struct {
+		File     string
+		Plug     config.Pluggable
+		Expected interface{}
+	}{
+		{
+			File: "source-file.hcl",
+			Plug: testFileSourceAdapter(testFileSourceFunc),
+			Expected: &Configuration{
+				Path:             "/data/enriched/*.tsv.gz",
+				Compression:      "gzip",
+				CheckpointFile:   "/data/checkpoint.json",
+				DoneDir:          "/data/done",
+				MaxLineBytes:     1048576,
+				ConcurrentWrites: 20,
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.File, func(t *testing.T) {
+			assert := assert.New(t)
+
+			filename := filepath.Join(testFixPath, tt.File)
+			t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+			c, err := config.NewConfig()
+			assert.NotNil(c)
+			if err != nil {
+				t.Fatalf("function NewConfig failed with error: %q", err.Error())
+			}
+
+			use := c.Data.Source.Use
+			decoderOpts := &config.DecoderOptions{
+				Input: use.Body,
+			}
+
+			result, err := c.CreateComponent(tt.Plug, decoderOpts)
+			assert.NotNil(result)
+			assert.Nil(err)
+
+			if !reflect.DeepEqual(result, tt.Expected) {
+				t.Errorf("GOT:\n%s\nEXPECTED:\n%s",
+					spew.Sdump(result),
+					spew.Sdump(tt.Expected))
+			}
+		})
+	}
+}
+
+// Helpers
+func testFileSourceAdapter(f func(c *Configuration) (*Configuration, error)) adapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*Configuration)
+		if !ok {
+			return nil, errors.New("invalid input, expected FileSourceConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testFileSourceFunc(c *Configuration) (*Configuration, error) {
+
+	return c, nil
+}
+
+// readAll reads every message from the source, acking those in toAck or every message if toAck is nil
+func readAll(t *testing.T, source *fileSource, toAck map[string]bool) []string {
+	var received []string
+	mutex := sync.Mutex{}
+	sf := sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, msg := range messages {
+				received = append(received, string(msg.Data))
+				if toAck == nil || toAck[string(msg.Data)] {
+					msg.AckFunc()
+				}
+			}
+			return nil
+		},
+	}
+
+	err := source.Read(&sf)
+	assert.Nil(t, err)
+
+	return received
+}
+
+func writePlainFile(t *testing.T, path string, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeGzipFile(t *testing.T, path string, content string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZstdFile(t *testing.T, path string, content string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
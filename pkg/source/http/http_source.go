@@ -0,0 +1,256 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package httpsource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+
+	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+)
+
+// ndjsonContentTypes are the media types for which a request body is split into one message per line
+var ndjsonContentTypes = map[string]bool{
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/jsonl":       true,
+	"application/x-jsonlines": true,
+}
+
+// Configuration configures the source for records pulled
+type Configuration struct {
+	Address           string `hcl:"address,optional" env:"SOURCE_HTTP_ADDRESS"`
+	Path              string `hcl:"path,optional" env:"SOURCE_HTTP_PATH"`
+	MaxBodyBytes      int64  `hcl:"max_body_bytes,optional" env:"SOURCE_HTTP_MAX_BODY_BYTES"`
+	AckTimeoutSeconds int    `hcl:"ack_timeout_seconds,optional" env:"SOURCE_HTTP_ACK_TIMEOUT_SECONDS"`
+}
+
+// httpSource holds a new server for receiving messages over HTTP
+type httpSource struct {
+	address      string
+	path         string
+	maxBodyBytes int64
+	ackTimeout   time.Duration
+
+	server *http.Server
+
+	log *log.Entry
+}
+
+// configFunction returns an http source from a config
+func configFunction(c *Configuration) (sourceiface.Source, error) {
+	return newHTTPSource(
+		c.Address,
+		c.Path,
+		c.MaxBodyBytes,
+		time.Duration(c.AckTimeoutSeconds)*time.Second,
+	)
+}
+
+// The adapter type is an adapter for functions to be used as
+// pluggable components for HTTP Source. It implements the Pluggable interface.
+type adapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f adapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f adapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults
+	cfg := &Configuration{
+		Address:           ":8081",
+		Path:              "/",
+		MaxBodyBytes:      10485760,
+		AckTimeoutSeconds: 30,
+	}
+
+	return cfg, nil
+}
+
+// adapterGenerator returns an HTTP Source adapter.
+func adapterGenerator(f func(c *Configuration) (sourceiface.Source, error)) adapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*Configuration)
+		if !ok {
+			return nil, errors.New("invalid input, expected HTTPSourceConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// ConfigPair is passed to configuration to determine when to build an HTTP source.
+var ConfigPair = config.ConfigurationPair{
+	Name:   "http",
+	Handle: adapterGenerator(configFunction),
+}
+
+// newHTTPSource creates a new server for receiving messages over HTTP
+func newHTTPSource(address string, path string, maxBodyBytes int64, ackTimeout time.Duration) (*httpSource, error) {
+	if maxBodyBytes <= 0 {
+		return nil, fmt.Errorf("invalid max_body_bytes %d: must be greater than 0", maxBodyBytes)
+	}
+	if ackTimeout <= 0 {
+		return nil, fmt.Errorf("invalid ack_timeout_seconds %v: must be greater than 0", ackTimeout.Seconds())
+	}
+
+	return &httpSource{
+		address:      address,
+		path:         path,
+		maxBodyBytes: maxBodyBytes,
+		ackTimeout:   ackTimeout,
+		server:       &http.Server{},
+		log:          log.WithFields(log.Fields{"source": "http", "address": address, "path": path}),
+	}, nil
+}
+
+// Read will serve requests on the configured address until Stop is called
+func (hs *httpSource) Read(sf *sourceiface.SourceFunctions) error {
+	hs.log.Info("Listening for messages over HTTP ...")
+
+	listener, err := net.Listen("tcp", hs.address)
+	if err != nil {
+		return errors.Wrap(err, "Failed to listen on HTTP source address")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(hs.path, hs.newHandler(sf))
+	hs.server.Handler = mux
+
+	err = hs.server.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "Failed to serve HTTP source")
+	}
+	return nil
+}
+
+// Stop will halt the server, waiting for requests in flight to be responded to
+func (hs *httpSource) Stop() {
+	hs.log.Warn("Shutting down HTTP server ...")
+
+	err := hs.server.Shutdown(context.Background())
+	if err != nil {
+		hs.log.WithFields(log.Fields{"error": err}).Error(err)
+	}
+}
+
+// GetID returns the identifier for this source
+func (hs *httpSource) GetID() string {
+	return fmt.Sprintf("http:%s%s", hs.address, hs.path)
+}
+
+// AckTimeout returns how long each request waits for its messages to be acked before failing
+func (hs *httpSource) AckTimeout() time.Duration {
+	return hs.ackTimeout
+}
+
+// newHandler returns the handler which writes each request body to the target, only
+// responding with a 200 once every message in the request has been acked
+func (hs *httpSource) newHandler(sf *sourceiface.SourceFunctions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, hs.maxBodyBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		timePulled := time.Now().UTC()
+		payloads := splitBody(body, r.Header.Get("Content-Type"))
+		if len(payloads) == 0 {
+			http.Error(w, "request body is empty", http.StatusBadRequest)
+			return
+		}
+
+		// acked is closed once every message has been acked, regardless of how many
+		// times each AckFunc is called
+		acked := make(chan struct{})
+		remaining := int64(len(payloads))
+
+		messages := make([]*models.Message, 0, len(payloads))
+		for _, payload := range payloads {
+			once := &sync.Once{}
+			messages = append(messages, &models.Message{
+				Data:         payload,
+				PartitionKey: uuid.NewV4().String(),
+				TimeCreated:  timePulled,
+				TimePulled:   timePulled,
+				AckFunc: func() {
+					once.Do(func() {
+						if atomic.AddInt64(&remaining, -1) == 0 {
+							close(acked)
+						}
+					})
+				},
+			})
+		}
+
+		err = sf.WriteToTarget(messages)
+		if err != nil {
+			hs.log.WithFields(log.Fields{"error": err}).Error(err)
+			http.Error(w, "failed to write messages", http.StatusInternalServerError)
+			return
+		}
+
+		select {
+		case <-acked:
+			w.WriteHeader(http.StatusOK)
+		case <-time.After(hs.ackTimeout):
+			hs.log.Warnf("Timed out waiting for %d of %d messages to be acked", atomic.LoadInt64(&remaining), len(messages))
+			http.Error(w, "timed out waiting for messages to be acked", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// splitBody returns the payloads contained in a request body: one per non-empty line
+// for newline-delimited content types, otherwise the whole body as a single payload
+func splitBody(body []byte, contentType string) [][]byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !ndjsonContentTypes[mediaType] {
+		if len(bytes.TrimSpace(body)) == 0 {
+			return nil
+		}
+		return [][]byte{body}
+	}
+
+	var payloads [][]byte
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		payloads = append(payloads, line)
+	}
+	return payloads
+}
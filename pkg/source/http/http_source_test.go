@@ -0,0 +1,335 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package httpsource
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/assets"
+	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/source/sourceconfig"
+	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+)
+
+func TestMain(m *testing.M) {
+	os.Clearenv()
+	exitVal := m.Run()
+	os.Exit(exitVal)
+}
+
+func TestHTTPSource_Handler(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		Method           string
+		ContentType      string
+		Body             string
+		Ack              bool
+		WriteErr         error
+		ExpectedStatus   int
+		ExpectedMessages []string
+	}{
+		{
+			Name:             "single",
+			Method:           http.MethodPost,
+			ContentType:      "application/json",
+			Body:             "{\"hello\":\"world\"}\n",
+			Ack:              true,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedMessages: []string{"{\"hello\":\"world\"}\n"},
+		},
+		{
+			Name:             "ndjson",
+			Method:           http.MethodPost,
+			ContentType:      "application/x-ndjson; charset=utf-8",
+			Body:             "one\r\ntwo\n\nthree\n",
+			Ack:              true,
+			ExpectedStatus:   http.StatusOK,
+			ExpectedMessages: []string{"one", "two", "three"},
+		},
+		{
+			Name:             "not_acked",
+			Method:           http.MethodPost,
+			ContentType:      "application/x-ndjson",
+			Body:             "one\ntwo",
+			Ack:              false,
+			ExpectedStatus:   http.StatusServiceUnavailable,
+			ExpectedMessages: []string{"one", "two"},
+		},
+		{
+			Name:             "write_error",
+			Method:           http.MethodPost,
+			Body:             "one",
+			Ack:              false,
+			WriteErr:         errors.New("write failed"),
+			ExpectedStatus:   http.StatusInternalServerError,
+			ExpectedMessages: []string{"one"},
+		},
+		{
+			Name:           "empty",
+			Method:         http.MethodPost,
+			ContentType:    "application/x-ndjson",
+			Body:           "\n\n",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "too_large",
+			Method:         http.MethodPost,
+			Body:           "this body is longer than the limit",
+			ExpectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			Name:           "wrong_method",
+			Method:         http.MethodGet,
+			ExpectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			source, err := newHTTPSource(":0", "/", 20, 100*time.Millisecond)
+			assert.Nil(err)
+
+			var received []*models.Message
+			sf := &sourceiface.SourceFunctions{
+				WriteToTarget: func(messages []*models.Message) error {
+					received = append(received, messages...)
+					if tt.Ack {
+						for _, msg := range messages {
+							msg.AckFunc()
+							// Acking more than once must not affect the response
+							msg.AckFunc()
+						}
+					}
+					return tt.WriteErr
+				},
+			}
+
+			req := httptest.NewRequest(tt.Method, "/", bytes.NewBufferString(tt.Body))
+			if tt.ContentType != "" {
+				req.Header.Set("Content-Type", tt.ContentType)
+			}
+			rec := httptest.NewRecorder()
+
+			source.newHandler(sf).ServeHTTP(rec, req)
+
+			assert.Equal(tt.ExpectedStatus, rec.Code)
+			assert.Equal(len(tt.ExpectedMessages), len(received))
+			for i, msg := range received {
+				assert.Equal(tt.ExpectedMessages[i], string(msg.Data))
+				assert.NotEmpty(msg.PartitionKey)
+				assert.False(msg.TimeCreated.IsZero())
+				assert.False(msg.TimePulled.IsZero())
+			}
+		})
+	}
+}
+
+func TestHTTPSource_HandlerWaitsForAsyncAcks(t *testing.T) {
+	assert := assert.New(t)
+
+	source, err := newHTTPSource(":0", "/", 1024, 5*time.Second)
+	assert.Nil(err)
+
+	wg := sync.WaitGroup{}
+	sf := &sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			for _, msg := range messages {
+				wg.Add(1)
+				go func(ack func()) {
+					defer wg.Done()
+					time.Sleep(50 * time.Millisecond)
+					ack()
+				}(msg.AckFunc)
+			}
+			return nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("one\ntwo\nthree"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+
+	source.newHandler(sf).ServeHTTP(rec, req)
+	wg.Wait()
+
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestHTTPSource_ReadSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	source, err := newHTTPSource("127.0.0.1:18081", "/events", 1024, time.Second)
+	assert.Nil(err)
+	assert.Equal("http:127.0.0.1:18081/events", source.GetID())
+
+	messageCount := 0
+	mutex := sync.Mutex{}
+	sf := sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, msg := range messages {
+				assert.Equal("Hello HTTP!!", string(msg.Data))
+				messageCount++
+
+				msg.AckFunc()
+			}
+			return nil
+		},
+	}
+
+	done := make(chan bool)
+	go func() {
+		err = source.Read(&sf)
+		assert.Nil(err)
+
+		done <- true
+	}()
+
+	// Wait for the server to start listening
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		resp, err := http.Post("http://127.0.0.1:18081/events", "text/plain", bytes.NewBufferString("Hello HTTP!!"))
+		assert.Nil(err)
+		if resp != nil {
+			assert.Equal(http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+		}
+	}
+
+	source.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("TestHTTPSource_ReadSuccess timed out!")
+	}
+
+	assert.Equal(10, messageCount)
+}
+
+func TestNewHTTPSource_InvalidConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	source, err := newHTTPSource(":0", "/", 0, time.Second)
+	assert.Nil(source)
+	assert.NotNil(err)
+
+	source, err = newHTTPSource(":0", "/", 1024, 0)
+	assert.Nil(source)
+	assert.NotNil(err)
+}
+
+func TestGetSource_WithHTTPSource(t *testing.T) {
+	t.Setenv("SOURCE_NAME", "http")
+	t.Setenv("SOURCE_HTTP_ADDRESS", "127.0.0.1:18082")
+
+	assert := assert.New(t)
+
+	supportedSources := []config.ConfigurationPair{ConfigPair}
+
+	c, err := config.NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	httpSource, err := sourceconfig.GetSource(c, supportedSources)
+
+	assert.NotNil(httpSource)
+	assert.Nil(err)
+	assert.Equal("http:127.0.0.1:18082/", httpSource.GetID())
+
+	waiter, ok := httpSource.(sourceiface.AckWaiter)
+	assert.True(ok)
+	assert.Equal(30*time.Second, waiter.AckTimeout())
+}
+
+func TestHTTPSourceHCL(t *testing.T) {
+	testFixPath := filepath.Join(assets.AssetsRootDir, "test", "source", "configs")
+	testCases := []struct {
+		File     string
+		Plug     config.Pluggable
+		Expected interface{}
+	}{
+		{
+			File: "source-http.hcl",
+			Plug: testHTTPSourceAdapter(testHTTPSourceFunc),
+			Expected: &Configuration{
+				Address:           "0.0.0.0:9090",
+				Path:              "/webhook",
+				MaxBodyBytes:      2048,
+				AckTimeoutSeconds: 10,
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.File, func(t *testing.T) {
+			assert := assert.New(t)
+
+			filename := filepath.Join(testFixPath, tt.File)
+			t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+			c, err := config.NewConfig()
+			assert.NotNil(c)
+			if err != nil {
+				t.Fatalf("function NewConfig failed with error: %q", err.Error())
+			}
+
+			use := c.Data.Source.Use
+			decoderOpts := &config.DecoderOptions{
+				Input: use.Body,
+			}
+
+			result, err := c.CreateComponent(tt.Plug, decoderOpts)
+			assert.NotNil(result)
+			assert.Nil(err)
+
+			if !reflect.DeepEqual(result, tt.Expected) {
+				t.Errorf("GOT:\n%s\nEXPECTED:\n%s",
+					spew.Sdump(result),
+					spew.Sdump(tt.Expected))
+			}
+		})
+	}
+}
+
+// Helpers
+func testHTTPSourceAdapter(f func(c *Configuration) (*Configuration, error)) adapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*Configuration)
+		if !ok {
+			return nil, errors.New("invalid input, expected HTTPSourceConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testHTTPSourceFunc(c *Configuration) (*Configuration, error) {
+
+	return c, nil
+}
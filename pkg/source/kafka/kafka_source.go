@@ -0,0 +1,353 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package kafkasource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+
+	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/common"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+)
+
+// Configuration configures the source for records pulled
+type Configuration struct {
+	Brokers          string `hcl:"brokers" env:"SOURCE_KAFKA_BROKERS"`
+	TopicName        string `hcl:"topic_name" env:"SOURCE_KAFKA_TOPIC_NAME"`
+	ConsumerName     string `hcl:"consumer_name" env:"SOURCE_KAFKA_CONSUMER_NAME"`
+	OffsetsInitial   int64  `hcl:"offsets_initial,optional" env:"SOURCE_KAFKA_OFFSETS_INITIAL"`
+	TargetVersion    string `hcl:"target_version,optional" env:"SOURCE_KAFKA_TARGET_VERSION"`
+	EnableSASL       bool   `hcl:"enable_sasl,optional" env:"SOURCE_KAFKA_ENABLE_SASL"`
+	SASLUsername     string `hcl:"sasl_username,optional" env:"SOURCE_KAFKA_SASL_USERNAME"`
+	SASLPassword     string `hcl:"sasl_password,optional" env:"SOURCE_KAFKA_SASL_PASSWORD"`
+	SASLAlgorithm    string `hcl:"sasl_algorithm,optional" env:"SOURCE_KAFKA_SASL_ALGORITHM"`
+	CertFile         string `hcl:"cert_file,optional" env:"SOURCE_KAFKA_TLS_CERT_FILE"`
+	KeyFile          string `hcl:"key_file,optional" env:"SOURCE_KAFKA_TLS_KEY_FILE"`
+	CaFile           string `hcl:"ca_file,optional" env:"SOURCE_KAFKA_TLS_CA_FILE"`
+	SkipVerifyTLS    bool   `hcl:"skip_verify_tls,optional" env:"SOURCE_KAFKA_TLS_SKIP_VERIFY_TLS"`
+	ConcurrentWrites int    `hcl:"concurrent_writes,optional" env:"SOURCE_CONCURRENT_WRITES"`
+}
+
+// kafkaSource holds a new client for reading messages from Apache Kafka
+type kafkaSource struct {
+	client           sarama.ConsumerGroup
+	brokers          string
+	topicName        string
+	consumerName     string
+	concurrentWrites int
+
+	log *log.Entry
+
+	// ctx is cancelled to halt reading, either by Stop() or on a failed write
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// configFunction returns a kafka source from a config
+func configFunction(c *Configuration) (sourceiface.Source, error) {
+	kafkaVersion, err := common.GetKafkaVersion(c.TargetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.ClientID = "Snowbridge"
+	saramaConfig.Version = kafkaVersion
+	saramaConfig.Consumer.Offsets.Initial = c.OffsetsInitial
+
+	if c.EnableSASL {
+		err := common.ConfigureKafkaSASL(saramaConfig, c.SASLUsername, c.SASLPassword, c.SASLAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := common.CreateTLSConfiguration(c.CertFile, c.KeyFile, c.CaFile, c.SkipVerifyTLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		saramaConfig.Net.TLS.Config = tlsConfig
+		saramaConfig.Net.TLS.Enable = true
+	}
+
+	client, err := sarama.NewConsumerGroup(strings.Split(c.Brokers, ","), c.ConsumerName, saramaConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create Kafka consumer group")
+	}
+
+	return newKafkaSourceWithInterfaces(client, c.ConcurrentWrites, c.Brokers, c.TopicName, c.ConsumerName)
+}
+
+// The adapter type is an adapter for functions to be used as
+// pluggable components for Kafka Source. It implements the Pluggable interface.
+type adapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f adapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f adapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults
+	cfg := &Configuration{
+		OffsetsInitial:   sarama.OffsetOldest,
+		SASLAlgorithm:    "sha512",
+		ConcurrentWrites: 50,
+	}
+
+	return cfg, nil
+}
+
+// adapterGenerator returns a Kafka Source adapter.
+func adapterGenerator(f func(c *Configuration) (sourceiface.Source, error)) adapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*Configuration)
+		if !ok {
+			return nil, errors.New("invalid input, expected KafkaSourceConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// ConfigPair is passed to configuration to determine when to build a Kafka source.
+var ConfigPair = config.ConfigurationPair{
+	Name:   "kafka",
+	Handle: adapterGenerator(configFunction),
+}
+
+// newKafkaSourceWithInterfaces allows you to provide a consumer group client directly to allow
+// for mocking and testing against a local or mock broker
+func newKafkaSourceWithInterfaces(client sarama.ConsumerGroup, concurrentWrites int, brokers string, topicName string, consumerName string) (*kafkaSource, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &kafkaSource{
+		client:           client,
+		brokers:          brokers,
+		topicName:        topicName,
+		consumerName:     consumerName,
+		concurrentWrites: concurrentWrites,
+		log:              log.WithFields(log.Fields{"source": "kafka", "brokers": brokers, "topic": topicName, "consumer": consumerName}),
+		ctx:              ctx,
+		cancel:           cancel,
+	}, nil
+}
+
+// Read will pull messages from the noted Kafka topic forever
+func (ks *kafkaSource) Read(sf *sourceiface.SourceFunctions) error {
+	ks.log.Info("Reading messages from topic ...")
+
+	handler := &consumerGroupHandler{
+		sf:               sf,
+		concurrentWrites: ks.concurrentWrites,
+		cancel:           ks.cancel,
+		log:              ks.log,
+	}
+
+	var consumeErr error
+	for {
+		// Consume blocks for the lifetime of a consumer group session, so must be called
+		// again after every rebalance to pick up the new claims
+		err := ks.client.Consume(ks.ctx, []string{ks.topicName}, handler)
+		if err != nil {
+			consumeErr = errors.Wrap(err, "Failed to consume from Kafka topic")
+			break
+		}
+		if ks.ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := ks.client.Close(); err != nil {
+		ks.log.WithFields(log.Fields{"error": err}).Error(err)
+	}
+
+	if consumeErr != nil {
+		return consumeErr
+	}
+	return handler.getError()
+}
+
+// Stop will halt the reader processing more events
+func (ks *kafkaSource) Stop() {
+	ks.log.Warn("Cancelling Kafka receive ...")
+	ks.cancel()
+}
+
+// GetID returns the identifier for this source
+func (ks *kafkaSource) GetID() string {
+	return fmt.Sprintf("brokers:%s:topic:%s:consumer:%s", ks.brokers, ks.topicName, ks.consumerName)
+}
+
+// consumerGroupHandler implements sarama.ConsumerGroupHandler, writing each claimed
+// record to the target and marking offsets as their messages are acked
+type consumerGroupHandler struct {
+	sf               *sourceiface.SourceFunctions
+	concurrentWrites int
+	cancel           context.CancelFunc
+
+	log *log.Entry
+
+	// err holds the first write error, which halts reading
+	err      error
+	errMutex sync.Mutex
+}
+
+// Setup does nothing for this handler
+func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup does nothing for this handler
+func (h *consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim reads records from a claimed partition until the claim is revoked or
+// the session ends, waiting for all writes in flight to finish before returning
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker()
+
+	throttle := make(chan struct{}, h.concurrentWrites)
+	wg := sync.WaitGroup{}
+
+ClaimLoop:
+	for {
+		select {
+		case <-session.Context().Done():
+			break ClaimLoop
+		case record, ok := <-claim.Messages():
+			if !ok {
+				break ClaimLoop
+			}
+			timePulled := time.Now().UTC()
+
+			offset := record.Offset
+			tracker.track(offset)
+
+			ackFunc := func() {
+				h.log.Debugf("Ack'ing record with partition: %d, offset: %d", claim.Partition(), offset)
+				if next, ok := tracker.ack(offset); ok {
+					session.MarkOffset(claim.Topic(), claim.Partition(), next, "")
+				}
+			}
+
+			partitionKey := string(record.Key)
+			if partitionKey == "" {
+				partitionKey = uuid.NewV4().String()
+			}
+
+			timeCreated := record.Timestamp.UTC()
+			if record.Timestamp.IsZero() {
+				timeCreated = timePulled
+			}
+
+			messages := []*models.Message{
+				{
+					Data:         record.Value,
+					PartitionKey: partitionKey,
+					AckFunc:      ackFunc,
+					TimeCreated:  timeCreated,
+					TimePulled:   timePulled,
+				},
+			}
+
+			throttle <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := h.sf.WriteToTarget(messages)
+
+				// An unacked record blocks its partition from committing any later offsets,
+				// so we stop reading and let the app restart from the last committed offset.
+				if err != nil {
+					h.setError(err)
+				}
+				<-throttle
+			}()
+		}
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// setError stores the first write error and cancels reading
+func (h *consumerGroupHandler) setError(err error) {
+	h.log.WithFields(log.Fields{"error": err}).Error(err)
+
+	h.errMutex.Lock()
+	if h.err == nil {
+		h.err = err
+	}
+	h.errMutex.Unlock()
+
+	h.cancel()
+}
+
+// getError returns the first write error, if any
+func (h *consumerGroupHandler) getError() error {
+	h.errMutex.Lock()
+	defer h.errMutex.Unlock()
+	return h.err
+}
+
+// offsetTracker keeps the in-flight offsets of a single partition in the order they
+// were read, so that an offset is only marked for commit once every record before it
+// has been acked. Offsets are not assumed to be contiguous, as compaction and
+// transaction markers leave gaps.
+type offsetTracker struct {
+	pending []int64
+	acked   map[int64]bool
+	mutex   sync.Mutex
+}
+
+// newOffsetTracker creates an empty offsetTracker
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		acked: make(map[int64]bool),
+	}
+}
+
+// track registers an offset which has been read but not yet acked
+func (ot *offsetTracker) track(offset int64) {
+	ot.mutex.Lock()
+	defer ot.mutex.Unlock()
+
+	ot.pending = append(ot.pending, offset)
+}
+
+// ack registers an offset as acked, returning the next offset to commit and
+// whether it has moved forward as a result
+func (ot *offsetTracker) ack(offset int64) (int64, bool) {
+	ot.mutex.Lock()
+	defer ot.mutex.Unlock()
+
+	ot.acked[offset] = true
+
+	var next int64
+	moved := false
+	for len(ot.pending) > 0 && ot.acked[ot.pending[0]] {
+		// Kafka expects the offset of the next record to read, not the last one read
+		next = ot.pending[0] + 1
+		moved = true
+
+		delete(ot.acked, ot.pending[0])
+		ot.pending = ot.pending[1:]
+	}
+
+	return next, moved
+}
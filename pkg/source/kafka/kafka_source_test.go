@@ -0,0 +1,408 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package kafkasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/davecgh/go-spew/spew"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/assets"
+	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/source/sourceconfig"
+	"github.com/snowplow/snowbridge/pkg/source/sourceiface"
+)
+
+func TestMain(m *testing.M) {
+	os.Clearenv()
+	exitVal := m.Run()
+	os.Exit(exitVal)
+}
+
+// mockSession implements sarama.ConsumerGroupSession, recording marked offsets per partition
+type mockSession struct {
+	ctx    context.Context
+	marked map[int32]int64
+	mutex  sync.Mutex
+}
+
+func newMockSession(ctx context.Context) *mockSession {
+	return &mockSession{ctx: ctx, marked: make(map[int32]int64)}
+}
+
+func (m *mockSession) Claims() map[string][]int32 { return nil }
+func (m *mockSession) MemberID() string           { return "test-member" }
+func (m *mockSession) GenerationID() int32        { return 1 }
+func (m *mockSession) Commit()                    {}
+func (m *mockSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (m *mockSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {}
+func (m *mockSession) Context() context.Context                                 { return m.ctx }
+
+func (m *mockSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if offset > m.marked[partition] {
+		m.marked[partition] = offset
+	}
+}
+
+func (m *mockSession) getMarked(partition int32) int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.marked[partition]
+}
+
+// mockClaim implements sarama.ConsumerGroupClaim over a channel of records
+type mockClaim struct {
+	partition int32
+	records   chan *sarama.ConsumerMessage
+}
+
+func newMockClaim(partition int32, count int) *mockClaim {
+	records := make(chan *sarama.ConsumerMessage, count)
+	for i := 0; i < count; i++ {
+		records <- &sarama.ConsumerMessage{
+			Topic:     "test-topic",
+			Partition: partition,
+			Offset:    int64(i),
+			Key:       []byte(fmt.Sprint(i)),
+			Value:     []byte("Hello Kafka!!"),
+			Timestamp: time.Now(),
+		}
+	}
+	close(records)
+	return &mockClaim{partition: partition, records: records}
+}
+
+func (m *mockClaim) Topic() string                            { return "test-topic" }
+func (m *mockClaim) Partition() int32                         { return m.partition }
+func (m *mockClaim) InitialOffset() int64                     { return 0 }
+func (m *mockClaim) HighWaterMarkOffset() int64               { return int64(cap(m.records)) }
+func (m *mockClaim) Messages() <-chan *sarama.ConsumerMessage { return m.records }
+
+// mockConsumerGroup implements sarama.ConsumerGroup, running one session over the provided claim
+type mockConsumerGroup struct {
+	sarama.ConsumerGroup
+	claim   *mockClaim
+	session *mockSession
+	closed  bool
+}
+
+func (m *mockConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	if m.session == nil {
+		m.session = newMockSession(ctx)
+		if err := handler.ConsumeClaim(m.session, m.claim); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (m *mockConsumerGroup) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestOffsetTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := newOffsetTracker()
+	for _, offset := range []int64{0, 1, 2, 5} {
+		tracker.track(offset)
+	}
+
+	_, moved := tracker.ack(1)
+	assert.False(moved)
+
+	next, moved := tracker.ack(0)
+	assert.True(moved)
+	assert.Equal(int64(2), next)
+
+	_, moved = tracker.ack(5)
+	assert.False(moved)
+
+	next, moved = tracker.ack(2)
+	assert.True(moved)
+	assert.Equal(int64(6), next)
+	assert.Empty(tracker.pending)
+	assert.Empty(tracker.acked)
+}
+
+func TestConsumeClaim_MarksOffsetOnlyWhenAllPriorAcked(t *testing.T) {
+	assert := assert.New(t)
+
+	var received []*models.Message
+	mutex := sync.Mutex{}
+	sf := &sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			mutex.Lock()
+			received = append(received, messages...)
+			mutex.Unlock()
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := &consumerGroupHandler{sf: sf, concurrentWrites: 5, cancel: cancel, log: log.WithFields(log.Fields{"source": "kafka"})}
+	session := newMockSession(ctx)
+	claim := newMockClaim(3, 10)
+
+	err := handler.ConsumeClaim(session, claim)
+	assert.Nil(err)
+	assert.Equal(10, len(received))
+
+	// Ack everything other than the first record, in reverse order
+	byOffset := make(map[string]*models.Message)
+	for _, msg := range received {
+		byOffset[msg.PartitionKey] = msg
+		assert.Equal("Hello Kafka!!", string(msg.Data))
+	}
+	for i := 9; i > 0; i-- {
+		byOffset[fmt.Sprint(i)].AckFunc()
+	}
+	assert.Equal(int64(0), session.getMarked(3))
+
+	byOffset["0"].AckFunc()
+	assert.Equal(int64(10), session.getMarked(3))
+	assert.Nil(handler.getError())
+}
+
+func TestConsumeClaim_WriteFailureCancels(t *testing.T) {
+	assert := assert.New(t)
+
+	sf := &sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			return errors.New("write failed")
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := &consumerGroupHandler{sf: sf, concurrentWrites: 1, cancel: cancel, log: log.WithFields(log.Fields{"source": "kafka"})}
+	session := newMockSession(ctx)
+
+	err := handler.ConsumeClaim(session, newMockClaim(0, 3))
+	assert.Nil(err)
+
+	assert.NotNil(ctx.Err())
+	assert.NotNil(handler.getError())
+	if handler.getError() != nil {
+		assert.Equal("write failed", handler.getError().Error())
+	}
+	assert.Equal(int64(0), session.getMarked(0))
+}
+
+func TestKafkaSource_ReadSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockConsumerGroup{claim: newMockClaim(0, 50)}
+	source, err := newKafkaSourceWithInterfaces(client, 10, "localhost:9092", "test-topic", "test-consumer")
+	assert.Nil(err)
+	assert.NotNil(source)
+	assert.Equal("brokers:localhost:9092:topic:test-topic:consumer:test-consumer", source.GetID())
+
+	messageCount := 0
+	mutex := sync.Mutex{}
+	sf := sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, msg := range messages {
+				assert.Equal("Hello Kafka!!", string(msg.Data))
+				messageCount++
+
+				msg.AckFunc()
+			}
+			return nil
+		},
+	}
+
+	done := make(chan bool)
+	go func() {
+		err = source.Read(&sf)
+		assert.Nil(err)
+
+		done <- true
+	}()
+
+	time.Sleep(1 * time.Second)
+	source.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("TestKafkaSource_ReadSuccess timed out!")
+	}
+
+	assert.Equal(50, messageCount)
+	assert.Equal(int64(50), client.session.getMarked(0))
+	assert.True(client.closed)
+}
+
+func TestKafkaSource_ReadFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockConsumerGroup{claim: newMockClaim(0, 5)}
+	source, err := newKafkaSourceWithInterfaces(client, 1, "localhost:9092", "test-topic", "test-consumer")
+	assert.Nil(err)
+
+	sf := sourceiface.SourceFunctions{
+		WriteToTarget: func(messages []*models.Message) error {
+			return errors.New("write failed")
+		},
+	}
+
+	err = source.Read(&sf)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("write failed", err.Error())
+	}
+	assert.True(client.closed)
+}
+
+func TestGetSource_WithKafkaSource(t *testing.T) {
+	assert := assert.New(t)
+
+	// The in-process mock broker only needs to answer metadata requests to build the consumer group
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test-topic", 0, broker.BrokerID()),
+	})
+
+	t.Setenv("SOURCE_NAME", "kafka")
+	t.Setenv("SOURCE_KAFKA_BROKERS", broker.Addr())
+	t.Setenv("SOURCE_KAFKA_TOPIC_NAME", "test-topic")
+	t.Setenv("SOURCE_KAFKA_CONSUMER_NAME", "test-consumer")
+
+	c, err := config.NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	supportedSources := []config.ConfigurationPair{ConfigPair}
+
+	source, err := sourceconfig.GetSource(c, supportedSources)
+	assert.Nil(err)
+	assert.NotNil(source)
+	assert.IsType(&kafkaSource{}, source)
+	if ks, ok := source.(*kafkaSource); ok {
+		assert.Equal(fmt.Sprintf("brokers:%s:topic:test-topic:consumer:test-consumer", broker.Addr()), ks.GetID())
+		ks.client.Close()
+	}
+}
+
+func TestKafkaSourceHCL(t *testing.T) {
+	testFixPath := filepath.Join(assets.AssetsRootDir, "test", "source", "configs")
+	testCases := []struct {
+		File     string
+		Plug     config.Pluggable
+		Expected interface{}
+	}{
+		{
+			File: "source-kafka-simple.hcl",
+			Plug: testKafkaSourceAdapter(testKafkaSourceFunc),
+			Expected: &Configuration{
+				Brokers:          "testBrokers",
+				TopicName:        "testTopic",
+				ConsumerName:     "testConsumer",
+				OffsetsInitial:   -2,
+				SASLAlgorithm:    "sha512",
+				ConcurrentWrites: 50,
+			},
+		},
+		{
+			File: "source-kafka-extended.hcl",
+			Plug: testKafkaSourceAdapter(testKafkaSourceFunc),
+			Expected: &Configuration{
+				Brokers:          "testBrokers",
+				TopicName:        "testTopic",
+				ConsumerName:     "testConsumer",
+				OffsetsInitial:   -1,
+				TargetVersion:    "2.7.0",
+				EnableSASL:       true,
+				SASLUsername:     "testUsername",
+				SASLPassword:     "testPass",
+				SASLAlgorithm:    "sha256",
+				CertFile:         "myLocalhost.crt",
+				KeyFile:          "MyLocalhost.key",
+				CaFile:           "myRootCA.crt",
+				SkipVerifyTLS:    true,
+				ConcurrentWrites: 15,
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.File, func(t *testing.T) {
+			assert := assert.New(t)
+
+			filename := filepath.Join(testFixPath, tt.File)
+			t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+			c, err := config.NewConfig()
+			assert.NotNil(c)
+			if err != nil {
+				t.Fatalf("function NewConfig failed with error: %q", err.Error())
+			}
+
+			use := c.Data.Source.Use
+			decoderOpts := &config.DecoderOptions{
+				Input: use.Body,
+			}
+
+			result, err := c.CreateComponent(tt.Plug, decoderOpts)
+			assert.NotNil(result)
+			assert.Nil(err)
+
+			if !reflect.DeepEqual(result, tt.Expected) {
+				t.Errorf("GOT:\n%s\nEXPECTED:\n%s",
+					spew.Sdump(result),
+					spew.Sdump(tt.Expected))
+			}
+		})
+	}
+}
+
+// Helpers
+func testKafkaSourceAdapter(f func(c *Configuration) (*Configuration, error)) adapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*Configuration)
+		if !ok {
+			return nil, errors.New("invalid input, expected KafkaSourceConfig")
+		}
+
+		return f(cfg)
+	}
+
+}
+
+func testKafkaSourceFunc(c *Configuration) (*Configuration, error) {
+
+	return c, nil
+}
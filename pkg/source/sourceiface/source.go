@@ -7,9 +7,19 @@
 
 package sourceiface
 
+import (
+	"time"
+)
+
 // Source describes the interface for how to read the data pulled from the source
 type Source interface {
 	Read(sf *SourceFunctions) error
 	Stop()
 	GetID() string
 }
+
+// AckWaiter is implemented by sources which only wait for a limited time for the messages they
+// read to be acked
+type AckWaiter interface {
+	AckTimeout() time.Duration
+}
@@ -0,0 +1,475 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package spillover
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+const (
+	segmentSuffix = ".spill"
+	tmpSuffix     = ".tmp"
+	corruptSuffix = ".corrupt"
+)
+
+// ErrFull is returned when spilling messages would take the buffer over its maximum size
+var ErrFull = errors.New("The spillover buffer is full")
+
+// Buffer persists messages to disk while the target is unavailable, so that they can be acked
+// on the source, and drains them back to the target in the order they were spilled.
+//
+// Each call to Spill writes a segment file, which is deleted once all of its messages have been
+// acked by the target. Segments left over by a previous run are drained after a restart, so
+// messages are written at least once.
+type Buffer struct {
+	dir           string
+	maxBytes      int64
+	drainInterval time.Duration
+	onDepth       func(messages int64, bytes int64)
+
+	segments []*segment
+	nextSeq  uint64
+	messages int64
+	bytes    int64
+	mutex    sync.Mutex
+
+	// reportMutex keeps depth reports in order, without holding mutex while onDepth runs
+	reportMutex sync.Mutex
+
+	exitSignal chan struct{}
+	stopDone   chan struct{}
+	stopOnce   sync.Once
+	isRunning  bool
+
+	log *log.Entry
+}
+
+// segment is a file holding the messages from one call to Spill
+type segment struct {
+	path     string
+	messages int64
+	bytes    int64
+
+	// drained is set once the messages have been written to the target, which acks them in acked.
+	// pending holds the messages a failed write is yet to write.
+	drained bool
+	acked   []bool
+	pending []*models.Message
+}
+
+// record is how a message is persisted in a segment
+type record struct {
+	PartitionKey    string
+	Data            []byte
+	TimeCreated     time.Time
+	TimePulled      time.Time
+	TimeTransformed time.Time
+}
+
+// New creates a Buffer holding up to maxBytes of segments in dir, picking up any segments left
+// in it. Every change in the depth of the buffer is reported to onDepth, if provided.
+func New(dir string, maxBytes int64, drainInterval time.Duration, onDepth func(messages int64, bytes int64)) (*Buffer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "Error creating spillover directory")
+	}
+
+	b := &Buffer{
+		dir:           dir,
+		maxBytes:      maxBytes,
+		drainInterval: drainInterval,
+		onDepth:       onDepth,
+		exitSignal:    make(chan struct{}),
+		stopDone:      make(chan struct{}),
+		log:           log.WithFields(log.Fields{"name": "Spillover", "dir": dir}),
+	}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	if b.messages > 0 {
+		b.log.Warnf("Found %d spilled over messages from a previous run", b.messages)
+	}
+	b.report()
+	return b, nil
+}
+
+// load picks up the segments in the directory, in the order they were written
+func (b *Buffer) load() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return errors.Wrap(err, "Error reading spillover directory")
+	}
+
+	// Entries are sorted by name, which is the zero padded sequence number of the segment
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(b.dir, name)
+
+		if strings.HasSuffix(name, tmpSuffix) {
+			// An interrupted spill, whose messages were never acked
+			if err := os.Remove(path); err != nil {
+				return errors.Wrap(err, "Error removing incomplete spillover segment")
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return errors.Wrap(err, "Error reading spillover segment")
+		}
+		count, err := readSegmentCount(path)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error reading spillover segment %s", name))
+		}
+
+		b.segments = append(b.segments, &segment{path: path, messages: count, bytes: info.Size()})
+		b.messages += count
+		b.bytes += info.Size()
+		b.nextSeq = seq + 1
+	}
+	return nil
+}
+
+// IsEmpty reports whether the buffer holds no messages. Messages should only be written straight
+// to the target while it is empty, so that they don't overtake the messages spilled before them.
+func (b *Buffer) IsEmpty() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.segments) == 0
+}
+
+// Spill persists the messages to disk and acks them, returning ErrFull if they don't fit
+func (b *Buffer) Spill(messages []*models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	records := make([]record, 0, len(messages))
+	for _, msg := range messages {
+		records = append(records, record{
+			PartitionKey:    msg.PartitionKey,
+			Data:            msg.Data,
+			TimeCreated:     msg.TimeCreated,
+			TimePulled:      msg.TimePulled,
+			TimeTransformed: msg.TimeTransformed,
+		})
+	}
+	if err := enc.Encode(int64(len(records))); err != nil {
+		return errors.Wrap(err, "Error encoding spillover segment")
+	}
+	if err := enc.Encode(records); err != nil {
+		return errors.Wrap(err, "Error encoding spillover segment")
+	}
+	size := int64(buf.Len())
+
+	b.mutex.Lock()
+	if b.bytes+size > b.maxBytes {
+		b.mutex.Unlock()
+		return errors.Wrap(ErrFull, fmt.Sprintf("%d bytes of %d used, %d more needed", b.bytes, b.maxBytes, size))
+	}
+
+	path := filepath.Join(b.dir, fmt.Sprintf("%020d%s", b.nextSeq, segmentSuffix))
+	if err := writeFileSync(path, buf.Bytes()); err != nil {
+		b.mutex.Unlock()
+		return errors.Wrap(err, "Error writing spillover segment")
+	}
+
+	b.nextSeq++
+	b.segments = append(b.segments, &segment{path: path, messages: int64(len(messages)), bytes: size})
+	b.messages += int64(len(messages))
+	b.bytes += size
+	b.mutex.Unlock()
+	b.report()
+
+	b.log.Debugf("Spilled over %d messages", len(messages))
+
+	for _, msg := range messages {
+		if msg.AckFunc != nil {
+			msg.AckFunc()
+		}
+	}
+	return nil
+}
+
+// Start launches a goroutine which drains the buffer to write, oldest segment first. A segment
+// is retried every drain interval until write succeeds. A buffer is only drained once, so Start
+// does nothing after the first call.
+func (b *Buffer) Start(write func(messages []*models.Message) error) {
+	b.mutex.Lock()
+	if b.isRunning {
+		b.mutex.Unlock()
+		b.log.Warn("Spillover has already been started")
+		return
+	}
+	b.isRunning = true
+	b.mutex.Unlock()
+
+	go func() {
+		for {
+			drained, err := b.drainNext(write)
+			if err != nil {
+				b.log.WithFields(log.Fields{"error": err}).Warn("Error draining spillover segment, retrying ...")
+			}
+
+			// The next segment is drained straight away, unless there is none or this one failed
+			wait := b.drainInterval
+			if drained {
+				wait = 0
+			}
+
+			select {
+			case <-b.exitSignal:
+				close(b.stopDone)
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop halts draining, leaving the segments yet to be drained on disk. It is safe to call
+// more than once, and from several goroutines.
+func (b *Buffer) Stop() {
+	b.log.Info("Spillover Stop() called")
+	b.mutex.Lock()
+	isRunning := b.isRunning
+	b.mutex.Unlock()
+
+	if isRunning {
+		b.stopOnce.Do(func() {
+			close(b.exitSignal)
+		})
+		<-b.stopDone
+	}
+}
+
+// drainNext writes the oldest segment which is yet to be drained, reporting whether it was
+func (b *Buffer) drainNext(write func(messages []*models.Message) error) (bool, error) {
+	b.mutex.Lock()
+	var seg *segment
+	for _, s := range b.segments {
+		if !s.drained {
+			seg = s
+			break
+		}
+	}
+	b.mutex.Unlock()
+	if seg == nil {
+		return false, nil
+	}
+
+	messages := seg.pending
+	if messages == nil {
+		var err error
+		messages, err = b.readSegment(seg)
+		if err != nil {
+			b.discard(seg, err)
+			return true, nil
+		}
+	}
+
+	err := write(messages)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err != nil {
+		var pending []*models.Message
+		for i, msg := range messages {
+			if !seg.acked[i] {
+				pending = append(pending, msg)
+			}
+		}
+		seg.pending = pending
+		return false, err
+	}
+
+	seg.drained = true
+	seg.pending = nil
+	return true, nil
+}
+
+// readSegment reads the messages of a segment, whose AckFuncs delete it once they have all been called
+func (b *Buffer) readSegment(seg *segment) ([]*models.Message, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	var count int64
+	var records []record
+	if err := dec.Decode(&count); err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(&records); err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	seg.acked = make([]bool, len(records))
+	b.mutex.Unlock()
+
+	messages := make([]*models.Message, 0, len(records))
+	for i, r := range records {
+		var once sync.Once
+		index := i
+		messages = append(messages, &models.Message{
+			PartitionKey:    r.PartitionKey,
+			Data:            r.Data,
+			TimeCreated:     r.TimeCreated,
+			TimePulled:      r.TimePulled,
+			TimeTransformed: r.TimeTransformed,
+			AckFunc: func() {
+				once.Do(func() {
+					b.ack(seg, index)
+				})
+			},
+		})
+	}
+	return messages, nil
+}
+
+// ack records that a message of a segment was written, deleting the segment once all of them were
+func (b *Buffer) ack(seg *segment, index int) {
+	b.mutex.Lock()
+	seg.acked[index] = true
+	for _, acked := range seg.acked {
+		if !acked {
+			b.mutex.Unlock()
+			return
+		}
+	}
+
+	if err := os.Remove(seg.path); err != nil {
+		b.log.WithFields(log.Fields{"error": err}).Errorf("Error removing drained spillover segment %s", seg.path)
+	}
+	removed := b.remove(seg)
+	b.mutex.Unlock()
+
+	if removed {
+		b.report()
+	}
+}
+
+// discard sets aside a segment which can't be read, so that it doesn't block the ones after it
+func (b *Buffer) discard(seg *segment, err error) {
+	b.log.WithFields(log.Fields{"error": err}).Errorf("Error reading spillover segment %s, setting it aside", seg.path)
+	if err := os.Rename(seg.path, seg.path+corruptSuffix); err != nil {
+		b.log.WithFields(log.Fields{"error": err}).Errorf("Error setting aside spillover segment %s", seg.path)
+	}
+
+	b.mutex.Lock()
+	removed := b.remove(seg)
+	b.mutex.Unlock()
+
+	if removed {
+		b.report()
+	}
+}
+
+// remove stops tracking a segment, reporting whether it was tracked. The mutex must be held.
+func (b *Buffer) remove(seg *segment) bool {
+	for i, s := range b.segments {
+		if s == seg {
+			b.segments = append(b.segments[:i], b.segments[i+1:]...)
+			b.messages -= seg.messages
+			b.bytes -= seg.bytes
+			return true
+		}
+	}
+	return false
+}
+
+// report passes the current depth of the buffer on. The mutex must not be held, so that a slow
+// onDepth doesn't block the buffer. Reports are made one at a time, so the last one is always current.
+func (b *Buffer) report() {
+	if b.onDepth == nil {
+		return
+	}
+
+	b.reportMutex.Lock()
+	defer b.reportMutex.Unlock()
+
+	b.mutex.Lock()
+	messages, bytes := b.messages, b.bytes
+	b.mutex.Unlock()
+
+	b.onDepth(messages, bytes)
+}
+
+// readSegmentCount reads the number of messages in a segment
+func readSegmentCount(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var count int64
+	if err := gob.NewDecoder(f).Decode(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// writeFileSync writes a file under a temporary name and renames it once synced to disk,
+// so that a segment is either complete or absent after a crash
+func writeFileSync(path string, data []byte) error {
+	tmp := path + tmpSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Sync the directory too, so that the rename is durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,258 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package spillover
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// recordingWriter records the data of the messages written to it, failing the given number
+// of writes after accepting the first message of the write
+type recordingWriter struct {
+	written  []string
+	failures int
+	mutex    sync.Mutex
+}
+
+func (w *recordingWriter) write(messages []*models.Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i, msg := range messages {
+		if w.failures > 0 && i > 0 {
+			w.failures--
+			return errors.New("target unavailable")
+		}
+		w.written = append(w.written, string(msg.Data))
+		msg.AckFunc()
+	}
+	return nil
+}
+
+func (w *recordingWriter) writtenData() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return append([]string(nil), w.written...)
+}
+
+// depthRecorder records the latest depth reported by a buffer
+type depthRecorder struct {
+	messages int64
+	bytes    int64
+}
+
+func (d *depthRecorder) record(messages int64, bytes int64) {
+	atomic.StoreInt64(&d.messages, messages)
+	atomic.StoreInt64(&d.bytes, bytes)
+}
+
+func testMessages(ackOps *int64, data ...string) []*models.Message {
+	var messages []*models.Message
+	for _, d := range data {
+		messages = append(messages, &models.Message{
+			Data:         []byte(d),
+			PartitionKey: "key-" + d,
+			AckFunc: func() {
+				atomic.AddInt64(ackOps, 1)
+			},
+		})
+	}
+	return messages
+}
+
+func TestBuffer_SpillAndDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	depth := &depthRecorder{}
+	b, err := New(t.TempDir(), 1048576, 10*time.Millisecond, depth.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(b.IsEmpty())
+
+	// Spilled messages are acked once they are on disk
+	var ackOps int64
+	assert.Nil(b.Spill(testMessages(&ackOps, "one", "two")))
+	assert.Nil(b.Spill(testMessages(&ackOps, "three")))
+	assert.Equal(int64(3), ackOps)
+	assert.False(b.IsEmpty())
+	assert.Equal(int64(3), atomic.LoadInt64(&depth.messages))
+	assert.True(atomic.LoadInt64(&depth.bytes) > 0)
+
+	// They are drained in order, with the first write failing part way through
+	w := &recordingWriter{failures: 1}
+	b.Start(w.write)
+	assert.Eventually(func() bool {
+		return b.IsEmpty()
+	}, time.Second, 5*time.Millisecond)
+	b.Stop()
+
+	assert.Equal([]string{"one", "two", "three"}, w.writtenData())
+	assert.Equal(int64(0), atomic.LoadInt64(&depth.messages))
+	assert.Equal(int64(0), atomic.LoadInt64(&depth.bytes))
+
+	entries, err := os.ReadDir(b.dir)
+	assert.Nil(err)
+	assert.Empty(entries)
+}
+
+func TestBuffer_ReportWithoutLock(t *testing.T) {
+	assert := assert.New(t)
+
+	// onDepth can use the buffer, as it isn't called with the buffer locked
+	var b *Buffer
+	var empty []bool
+	b, err := New(t.TempDir(), 1048576, 10*time.Millisecond, func(messages int64, bytes int64) {
+		if b != nil {
+			empty = append(empty, b.IsEmpty())
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spilled := make(chan error)
+	go func() {
+		var ackOps int64
+		spilled <- b.Spill(testMessages(&ackOps, "one"))
+	}()
+
+	select {
+	case err := <-spilled:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		t.Fatal("Spill blocked on onDepth")
+	}
+	assert.Equal([]bool{false}, empty)
+}
+
+func TestBuffer_StopTwice(t *testing.T) {
+	b, err := New(t.TempDir(), 1048576, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopping a buffer which isn't draining does nothing
+	b.Stop()
+
+	w := &recordingWriter{}
+	b.Start(w.write)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Stop()
+		}()
+	}
+	wg.Wait()
+	b.Stop()
+}
+
+func TestBuffer_Restart(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	b, err := New(dir, 1048576, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	assert.Nil(b.Spill(testMessages(&ackOps, "one")))
+	assert.Nil(b.Spill(testMessages(&ackOps, "two", "three")))
+
+	// Incomplete segments from an interrupted spill are discarded
+	assert.Nil(os.WriteFile(filepath.Join(dir, "00000000000000000002.spill.tmp"), []byte("partial"), 0o644))
+
+	depth := &depthRecorder{}
+	b2, err := New(dir, 1048576, 10*time.Millisecond, depth.record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(int64(3), atomic.LoadInt64(&depth.messages))
+	assert.Equal(b.bytes, atomic.LoadInt64(&depth.bytes))
+
+	// New segments follow the ones left over
+	assert.Nil(b2.Spill(testMessages(&ackOps, "four")))
+
+	w := &recordingWriter{}
+	b2.Start(w.write)
+	assert.Eventually(func() bool {
+		return b2.IsEmpty()
+	}, time.Second, 5*time.Millisecond)
+	b2.Stop()
+
+	assert.Equal([]string{"one", "two", "three", "four"}, w.writtenData())
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(err)
+	assert.Empty(entries)
+}
+
+func TestBuffer_SpillFull(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := New(t.TempDir(), 250, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	assert.Nil(b.Spill(testMessages(&ackOps, "one")))
+
+	// Messages which don't fit are neither persisted nor acked
+	err = b.Spill(testMessages(&ackOps, "two"))
+	assert.NotNil(err)
+	if err != nil {
+		assert.True(errors.Is(err, ErrFull))
+		assert.Regexp("The spillover buffer is full", err.Error())
+	}
+	assert.Equal(int64(1), ackOps)
+	assert.Equal(int64(1), b.messages)
+}
+
+func TestBuffer_DrainCorruptSegment(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	b, err := New(dir, 1048576, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	assert.Nil(b.Spill(testMessages(&ackOps, "one")))
+	assert.Nil(b.Spill(testMessages(&ackOps, "two")))
+
+	// A segment which can't be read is set aside, rather than blocking the others
+	assert.Nil(os.Truncate(b.segments[0].path, 4))
+
+	w := &recordingWriter{}
+	b.Start(w.write)
+	assert.Eventually(func() bool {
+		return b.IsEmpty()
+	}, time.Second, 5*time.Millisecond)
+	b.Stop()
+
+	assert.Equal([]string{"two"}, w.writtenData())
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000000.spill.corrupt"))
+	assert.Nil(err)
+}
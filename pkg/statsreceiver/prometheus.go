@@ -0,0 +1,318 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package statsreceiver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+const (
+	failureTypeLabel = "failure_type"
+	destinationLabel = "destination"
+
+	failureTypeOversized = "oversized"
+	failureTypeInvalid   = "invalid"
+)
+
+// latencyBuckets are the upper bounds of the latency histograms in seconds, from 1ms to around 9 minutes
+var latencyBuckets = prometheus.ExponentialBuckets(0.001, 2, 20)
+
+// PrometheusStatsReceiverConfig configures the Prometheus metrics receiver
+type PrometheusStatsReceiverConfig struct {
+	Address string `hcl:"address,optional" env:"STATS_RECEIVER_PROMETHEUS_ADDRESS"`
+	Path    string `hcl:"path,optional" env:"STATS_RECEIVER_PROMETHEUS_PATH"`
+	Prefix  string `hcl:"prefix,optional" env:"STATS_RECEIVER_PROMETHEUS_PREFIX"`
+	Tags    string `hcl:"tags,optional" env:"STATS_RECEIVER_PROMETHEUS_TAGS"`
+}
+
+// prometheusStatsReceiver holds the metrics served to Prometheus. Counters are incremented from
+// the observer buffers, while the latency histograms are observed from every result.
+type prometheusStatsReceiver struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+	server   *http.Server
+
+	targetSuccess        prometheus.Counter
+	targetFailed         prometheus.Counter
+	targetThrottled      prometheus.Counter
+	messageFiltered      prometheus.Counter
+	failureTargetSuccess *prometheus.CounterVec
+	failureTargetFailed  *prometheus.CounterVec
+	destinationSuccess   *prometheus.CounterVec
+	destinationFailed    *prometheus.CounterVec
+	destinationOversized *prometheus.CounterVec
+	destinationInvalid   *prometheus.CounterVec
+	targetRetries        prometheus.Counter
+	failureTargetRetries prometheus.Counter
+	spilloverMessages    prometheus.Gauge
+	spilloverBytes       prometheus.Gauge
+
+	processingLatency *prometheus.HistogramVec
+	messageLatency    *prometheus.HistogramVec
+	transformLatency  *prometheus.HistogramVec
+	requestLatency    *prometheus.HistogramVec
+	filterLatency     prometheus.Histogram
+}
+
+// newPrometheusStatsReceiver creates the metrics, labelled with the tags, and serves them on the address
+func newPrometheusStatsReceiver(address string, path string, prefix string, tagsRaw string, tagsMapClient map[string]string) (*prometheusStatsReceiver, error) {
+	tagsMap := map[string]string{}
+	err := json.Unmarshal([]byte(tagsRaw), &tagsMap)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshall PROMETHEUS_TAGS to map")
+	}
+	labels := prometheus.Labels{}
+	for key, value := range tagsMap {
+		labels[key] = value
+	}
+	for key, value := range tagsMapClient {
+		labels[key] = value
+	}
+
+	r := newPrometheusMetrics(prefix, labels)
+	if err := r.register(); err != nil {
+		return nil, errors.Wrap(err, "Failed to register Prometheus metrics")
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to listen for Prometheus scrapes")
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, r.handler)
+	r.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := r.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.WithFields(log.Fields{"error": err}).Error("Prometheus metrics server stopped")
+		}
+	}()
+
+	return r, nil
+}
+
+// Close stops serving the metrics
+func (r *prometheusStatsReceiver) Close() {
+	if r.server == nil {
+		return
+	}
+	if err := r.server.Close(); err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Error closing Prometheus metrics server")
+	}
+}
+
+// newPrometheusMetrics creates the metrics, with a handler serving them from their own registry
+func newPrometheusMetrics(prefix string, labels prometheus.Labels) *prometheusStatsReceiver {
+	counter := func(name string, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Namespace: prefix, Name: name, Help: help, ConstLabels: labels})
+	}
+	counterVec := func(name string, help string, label string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: prefix, Name: name, Help: help, ConstLabels: labels}, []string{label})
+	}
+	gauge := func(name string, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Namespace: prefix, Name: name, Help: help, ConstLabels: labels})
+	}
+	latency := func(name string, help string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: prefix, Name: name, Help: help, ConstLabels: labels, Buckets: latencyBuckets}, []string{failureTypeLabel})
+	}
+
+	registry := prometheus.NewRegistry()
+	return &prometheusStatsReceiver{
+		registry: registry,
+		handler:  promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+
+		targetSuccess:        counter("target_success_total", "Messages sent to the target."),
+		targetFailed:         counter("target_failed_total", "Messages which failed to be sent to the target."),
+		targetThrottled:      counter("target_throttled_total", "Messages which failed to be sent to the target as it was throttling writes."),
+		messageFiltered:      counter("message_filtered_total", "Messages filtered out by transformations."),
+		failureTargetSuccess: counterVec("failure_target_success_total", "Oversized and invalid messages sent to the failure target.", failureTypeLabel),
+		failureTargetFailed:  counterVec("failure_target_failed_total", "Oversized and invalid messages which failed to be sent to the failure target.", failureTypeLabel),
+		destinationSuccess:   counterVec("destination_success_total", "Messages sent to each destination of a target writing to several of them.", destinationLabel),
+		destinationFailed:    counterVec("destination_failed_total", "Messages which failed to be sent to each destination of a target writing to several of them.", destinationLabel),
+		destinationOversized: counterVec("destination_oversized_total", "Messages too large for each destination of a target writing to several of them.", destinationLabel),
+		destinationInvalid:   counterVec("destination_invalid_total", "Messages invalid for each destination of a target writing to several of them.", destinationLabel),
+		targetRetries:        counter("target_retries_total", "Retried writes to the target."),
+		failureTargetRetries: counter("failure_target_retries_total", "Retried writes to the failure target."),
+		spilloverMessages:    gauge("spillover_messages", "Messages held by the spillover buffer."),
+		spilloverBytes:       gauge("spillover_bytes", "Size on disk of the messages held by the spillover buffer."),
+
+		processingLatency: latency("processing_latency_seconds", "Time from messages being pulled from the source to being written."),
+		messageLatency:    latency("message_latency_seconds", "Time from messages being created to being written."),
+		transformLatency:  latency("transform_latency_seconds", "Time from messages being pulled from the source to being transformed."),
+		requestLatency:    latency("request_latency_seconds", "Time taken by the requests writing messages."),
+		filterLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: prefix, Name: "filter_latency_seconds", Help: "Time from messages being pulled from the source to being filtered out.", ConstLabels: labels, Buckets: latencyBuckets,
+		}),
+	}
+}
+
+// register registers all the metrics
+func (r *prometheusStatsReceiver) register() error {
+	collectors := []prometheus.Collector{
+		r.targetSuccess, r.targetFailed, r.targetThrottled, r.messageFiltered,
+		r.failureTargetSuccess, r.failureTargetFailed,
+		r.destinationSuccess, r.destinationFailed, r.destinationOversized, r.destinationInvalid,
+		r.targetRetries, r.failureTargetRetries,
+		r.spilloverMessages, r.spilloverBytes,
+		r.processingLatency, r.messageLatency, r.transformLatency, r.requestLatency, r.filterLatency,
+	}
+	for _, c := range collectors {
+		if err := r.registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewPrometheusReceiverWithTags closes over a given tags map and returns a function
+// that creates a prometheusStatsReceiver given a PrometheusStatsReceiverConfig.
+func NewPrometheusReceiverWithTags(tags map[string]string) func(c *PrometheusStatsReceiverConfig) (*prometheusStatsReceiver, error) {
+	return func(c *PrometheusStatsReceiverConfig) (*prometheusStatsReceiver, error) {
+		return newPrometheusStatsReceiver(
+			c.Address,
+			c.Path,
+			c.Prefix,
+			c.Tags,
+			tags,
+		)
+	}
+}
+
+// The PrometheusStatsReceiverAdapter type is an adapter for functions to be used as
+// pluggable components for Prometheus Stats Receiver.
+// It implements the Pluggable interface.
+type PrometheusStatsReceiverAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f PrometheusStatsReceiverAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f PrometheusStatsReceiverAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults for the optional parameters
+	// whose default is not their zero value.
+	cfg := &PrometheusStatsReceiverConfig{
+		Address: ":9464",
+		Path:    "/metrics",
+		Prefix:  "snowplow_snowbridge",
+		Tags:    "{}",
+	}
+
+	return cfg, nil
+}
+
+// AdaptPrometheusStatsReceiverFunc returns a PrometheusStatsReceiverAdapter.
+func AdaptPrometheusStatsReceiverFunc(f func(c *PrometheusStatsReceiverConfig) (*prometheusStatsReceiver, error)) PrometheusStatsReceiverAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*PrometheusStatsReceiverConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected PrometheusStatsReceiverConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// Send increments the counters by the buffered metrics
+func (r *prometheusStatsReceiver) Send(b *models.ObserverBuffer) {
+	// overall
+	r.targetSuccess.Add(float64(b.MsgSent))
+	r.targetFailed.Add(float64(b.MsgFailed))
+	r.targetThrottled.Add(float64(b.MsgThrottled))
+	r.messageFiltered.Add(float64(b.MsgFiltered))
+
+	// unsendable
+	r.failureTargetSuccess.WithLabelValues(failureTypeOversized).Add(float64(b.OversizedMsgSent))
+	r.failureTargetSuccess.WithLabelValues(failureTypeInvalid).Add(float64(b.InvalidMsgSent))
+	r.failureTargetFailed.WithLabelValues(failureTypeOversized).Add(float64(b.OversizedMsgFailed))
+	r.failureTargetFailed.WithLabelValues(failureTypeInvalid).Add(float64(b.InvalidMsgFailed))
+
+	// destinations of targets writing to several of them
+	for id, d := range b.Destinations {
+		r.destinationSuccess.WithLabelValues(id).Add(float64(d.SentCount))
+		r.destinationFailed.WithLabelValues(id).Add(float64(d.FailedCount))
+		r.destinationOversized.WithLabelValues(id).Add(float64(d.OversizedCount))
+		r.destinationInvalid.WithLabelValues(id).Add(float64(d.InvalidCount))
+	}
+
+	// spillover buffer depth
+	if b.Spillover != nil {
+		r.spilloverMessages.Set(float64(b.Spillover.Messages))
+		r.spilloverBytes.Set(float64(b.Spillover.Bytes))
+	}
+
+	// retries
+	r.targetRetries.Add(float64(b.TargetRetries))
+	r.failureTargetRetries.Add(float64(b.FailureTargetRetries))
+}
+
+// ReceiveFiltered observes the latency of each filtered message
+func (r *prometheusStatsReceiver) ReceiveFiltered(res *models.FilterResult) {
+	if res == nil {
+		return
+	}
+	for _, msg := range res.Filtered {
+		if !msg.TimePulled.IsZero() {
+			r.filterLatency.Observe(res.FilterTime.Sub(msg.TimePulled).Seconds())
+		}
+	}
+}
+
+// ReceiveWrite observes the latencies of each message written to the target
+func (r *prometheusStatsReceiver) ReceiveWrite(res *models.TargetWriteResult) {
+	r.observeWrite(res, "")
+}
+
+// ReceiveWriteOversized observes the latencies of each oversized message written to the failure target
+func (r *prometheusStatsReceiver) ReceiveWriteOversized(res *models.TargetWriteResult) {
+	r.observeWrite(res, failureTypeOversized)
+}
+
+// ReceiveWriteInvalid observes the latencies of each invalid message written to the failure target
+func (r *prometheusStatsReceiver) ReceiveWriteInvalid(res *models.TargetWriteResult) {
+	r.observeWrite(res, failureTypeInvalid)
+}
+
+// observeWrite observes the latencies of the messages sent by a write. Failed messages are left out,
+// as they are observed again on every retry, as are latencies whose times weren't recorded.
+func (r *prometheusStatsReceiver) observeWrite(res *models.TargetWriteResult, failureType string) {
+	if res == nil {
+		return
+	}
+
+	processingLatency := r.processingLatency.WithLabelValues(failureType)
+	messageLatency := r.messageLatency.WithLabelValues(failureType)
+	transformLatency := r.transformLatency.WithLabelValues(failureType)
+	requestLatency := r.requestLatency.WithLabelValues(failureType)
+
+	for _, msg := range res.Sent {
+		if !msg.TimePulled.IsZero() {
+			processingLatency.Observe(res.WriteTime.Sub(msg.TimePulled).Seconds())
+		}
+		if !msg.TimeCreated.IsZero() {
+			messageLatency.Observe(res.WriteTime.Sub(msg.TimeCreated).Seconds())
+		}
+		if !msg.TimeTransformed.IsZero() && !msg.TimePulled.IsZero() {
+			transformLatency.Observe(msg.TimeTransformed.Sub(msg.TimePulled).Seconds())
+		}
+		if !msg.TimeRequestStarted.IsZero() && !msg.TimeRequestFinished.IsZero() {
+			requestLatency.Observe(msg.TimeRequestFinished.Sub(msg.TimeRequestStarted).Seconds())
+		}
+	}
+}
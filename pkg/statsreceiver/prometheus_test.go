@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package statsreceiver
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+func scrapePrometheus(t *testing.T, r *prometheusStatsReceiver) string {
+	server := httptest.NewServer(r.handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestPrometheusStatsReceiver_Send(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newPrometheusMetrics("snowplow_test", prometheus.Labels{"source": "kinesis", "target": "http"})
+	assert.Nil(r.register())
+
+	// Counters accumulate across buffers, while gauges hold the latest value
+	for i := 0; i < 2; i++ {
+		r.Send(&models.ObserverBuffer{
+			MsgSent:          3,
+			MsgFailed:        1,
+			MsgFiltered:      2,
+			OversizedMsgSent: 1,
+			InvalidMsgFailed: 4,
+			TargetRetries:    1,
+			Destinations:     map[string]*models.DestinationWriteResult{"primary": {ID: "primary", SentCount: 3}},
+			Spillover:        &models.SpilloverDepth{Messages: int64(10 * (i + 1)), Bytes: 100},
+		})
+	}
+
+	metrics := scrapePrometheus(t, r)
+	assert.Contains(metrics, `snowplow_test_target_success_total{source="kinesis",target="http"} 6`)
+	assert.Contains(metrics, `snowplow_test_target_failed_total{source="kinesis",target="http"} 2`)
+	assert.Contains(metrics, `snowplow_test_message_filtered_total{source="kinesis",target="http"} 4`)
+	assert.Contains(metrics, `snowplow_test_failure_target_success_total{failure_type="oversized",source="kinesis",target="http"} 2`)
+	assert.Contains(metrics, `snowplow_test_failure_target_failed_total{failure_type="invalid",source="kinesis",target="http"} 8`)
+	assert.Contains(metrics, `snowplow_test_destination_success_total{destination="primary",source="kinesis",target="http"} 6`)
+	assert.Contains(metrics, `snowplow_test_target_retries_total{source="kinesis",target="http"} 2`)
+	assert.Contains(metrics, `snowplow_test_spillover_messages{source="kinesis",target="http"} 20`)
+}
+
+func TestPrometheusStatsReceiver_Latencies(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newPrometheusMetrics("snowplow_test", prometheus.Labels{})
+	assert.Nil(r.register())
+
+	now := time.Now().UTC()
+	messages := []*models.Message{
+		{
+			TimeCreated:         now.Add(-4 * time.Second),
+			TimePulled:          now.Add(-2 * time.Second),
+			TimeTransformed:     now.Add(-1 * time.Second),
+			TimeRequestStarted:  now.Add(-500 * time.Millisecond),
+			TimeRequestFinished: now.Add(-100 * time.Millisecond),
+		},
+		{
+			// Latencies whose times weren't recorded are left out
+			TimePulled: now.Add(-3 * time.Second),
+		},
+		{
+			// Failed messages are left out, as they are observed again when retried
+			TimeCreated: now.Add(-20 * time.Second),
+			TimePulled:  now.Add(-10 * time.Second),
+		},
+	}
+
+	r.ReceiveWrite(models.NewTargetWriteResultWithTime(messages[:2], messages[2:], nil, nil, now))
+	r.ReceiveWriteInvalid(models.NewTargetWriteResultWithTime(messages[:1], nil, nil, nil, now))
+	r.ReceiveFiltered(&models.FilterResult{Filtered: messages[1:2], FilterTime: now})
+	r.ReceiveWrite(nil)
+	r.ReceiveFiltered(nil)
+
+	metrics := scrapePrometheus(t, r)
+	assert.Contains(metrics, `snowplow_test_processing_latency_seconds_count{failure_type=""} 2`)
+	assert.Contains(metrics, `snowplow_test_processing_latency_seconds_sum{failure_type=""} 5`)
+	assert.Contains(metrics, `snowplow_test_processing_latency_seconds_bucket{failure_type="",le="2.048"} 1`)
+	assert.Contains(metrics, `snowplow_test_message_latency_seconds_count{failure_type=""} 1`)
+	assert.Contains(metrics, `snowplow_test_transform_latency_seconds_sum{failure_type=""} 1`)
+	assert.Contains(metrics, `snowplow_test_request_latency_seconds_sum{failure_type=""} 0.4`)
+	assert.Contains(metrics, `snowplow_test_processing_latency_seconds_count{failure_type="invalid"} 1`)
+	assert.Contains(metrics, `snowplow_test_filter_latency_seconds_sum 3`)
+}
+
+func TestPrometheusStatsReceiver_Close(t *testing.T) {
+	assert := assert.New(t)
+
+	// Find a free address to serve the metrics on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	r, err := newPrometheusStatsReceiver(address, "/metrics", "snowplow_test", "{}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + address + "/metrics")
+	assert.Nil(err)
+	if err == nil {
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	// The metrics are no longer served once closed
+	r.Close()
+	_, err = http.Get("http://" + address + "/metrics")
+	assert.NotNil(err)
+}
+
+func TestNewPrometheusStatsReceiver_InvalidTags(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := newPrometheusStatsReceiver("127.0.0.1:0", "/metrics", "snowplow_test", "not json", nil)
+	assert.Nil(r)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Failed to unmarshall PROMETHEUS_TAGS to map", err.Error())
+	}
+
+	r, err = newPrometheusStatsReceiver("127.0.0.1:0", "/metrics", "snowplow_test", "{\"invalid-label\": \"value\"}", nil)
+	assert.Nil(r)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Failed to register Prometheus metrics", err.Error())
+	}
+}
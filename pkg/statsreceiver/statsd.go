@@ -111,12 +111,32 @@ func (s *statsDStatsReceiver) Send(b *models.ObserverBuffer) {
 	// overall
 	s.client.Incr("target_success", b.MsgSent)
 	s.client.Incr("target_failed", b.MsgFailed)
+	s.client.Incr("target_throttled", b.MsgThrottled)
 	s.client.Incr("message_filtered", b.MsgFiltered)
 
 	// unsendable
 	s.client.Incr("failure_target_success", b.OversizedMsgSent+b.InvalidMsgFailed)
 	s.client.Incr("failure_target_failed", b.OversizedMsgFailed+b.InvalidMsgFailed)
 
+	// destinations of targets writing to several of them
+	for id, d := range b.Destinations {
+		tag := statsd.StringTag("destination", id)
+		s.client.Incr("destination_success", d.SentCount, tag)
+		s.client.Incr("destination_failed", d.FailedCount, tag)
+		s.client.Incr("destination_oversized", d.OversizedCount, tag)
+		s.client.Incr("destination_invalid", d.InvalidCount, tag)
+	}
+
+	// spillover buffer depth
+	if b.Spillover != nil {
+		s.client.Gauge("spillover_messages", b.Spillover.Messages)
+		s.client.Gauge("spillover_bytes", b.Spillover.Bytes)
+	}
+
+	// retries
+	s.client.Incr("target_retries", b.TargetRetries)
+	s.client.Incr("failure_target_retries", b.FailureTargetRetries)
+
 	// latencies
 	s.client.PrecisionTiming("min_processing_latency", b.MinProcLatency)
 	s.client.PrecisionTiming("max_processing_latency", b.MaxProcLatency)
@@ -16,3 +16,19 @@ import (
 type StatsReceiver interface {
 	Send(buffer *models.ObserverBuffer)
 }
+
+// ResultReceiver is implemented by stats receivers which also receive every result as it is
+// observed, rather than only the buffers aggregating them, such as to record the latency of
+// each message
+type ResultReceiver interface {
+	ReceiveFiltered(r *models.FilterResult)
+	ReceiveWrite(r *models.TargetWriteResult)
+	ReceiveWriteOversized(r *models.TargetWriteResult)
+	ReceiveWriteInvalid(r *models.TargetWriteResult)
+}
+
+// Closer is implemented by stats receivers holding resources, such as a server, which are
+// released when the observer stops
+type Closer interface {
+	Close()
+}
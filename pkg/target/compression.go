@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// compressor is implemented by both the gzip and zstd writers
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// getCompression validates a configured compression, defaulting to no compression
+func getCompression(compression string) (string, error) {
+	switch compression {
+	case "":
+		return compressionNone, nil
+	case compressionNone, compressionGzip, compressionZstd:
+		return compression, nil
+	default:
+		return "", errors.New(fmt.Sprintf("Invalid compression '%s', must be one of 'none', 'gzip' or 'zstd'", compression))
+	}
+}
+
+// newCompressor creates a writer compressing data into w, or returns nil if there is no compression
+func newCompressor(compression string, w io.Writer) (compressor, error) {
+	switch compression {
+	case compressionGzip:
+		return gzip.NewWriter(w), nil
+	case compressionZstd:
+		encoder, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to create zstd writer")
+		}
+		return encoder, nil
+	}
+	return nil, nil
+}
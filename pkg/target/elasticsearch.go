@@ -0,0 +1,438 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/snowplow/snowbridge/pkg/common"
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// ElasticsearchTargetConfig configures the destination for records consumed
+type ElasticsearchTargetConfig struct {
+	URL                     string `hcl:"url" env:"TARGET_ELASTICSEARCH_URL"`
+	Index                   string `hcl:"index" env:"TARGET_ELASTICSEARCH_INDEX"`
+	DocumentIDField         string `hcl:"document_id_field,optional" env:"TARGET_ELASTICSEARCH_DOCUMENT_ID_FIELD"`
+	RequestTimeoutInSeconds int    `hcl:"request_timeout_in_seconds,optional" env:"TARGET_ELASTICSEARCH_TIMEOUT_IN_SECONDS"`
+	BatchMaxMessages        int    `hcl:"batch_max_messages,optional" env:"TARGET_ELASTICSEARCH_BATCH_MAX_MESSAGES"`
+	BatchByteLimit          int    `hcl:"batch_byte_limit,optional" env:"TARGET_ELASTICSEARCH_BATCH_BYTE_LIMIT"`
+	BasicAuthUsername       string `hcl:"basic_auth_username,optional" env:"TARGET_ELASTICSEARCH_BASICAUTH_USERNAME"`
+	BasicAuthPassword       string `hcl:"basic_auth_password,optional" env:"TARGET_ELASTICSEARCH_BASICAUTH_PASSWORD"`
+	APIKey                  string `hcl:"api_key,optional" env:"TARGET_ELASTICSEARCH_API_KEY"`
+	CertFile                string `hcl:"cert_file,optional" env:"TARGET_ELASTICSEARCH_TLS_CERT_FILE"`
+	KeyFile                 string `hcl:"key_file,optional" env:"TARGET_ELASTICSEARCH_TLS_KEY_FILE"`
+	CaFile                  string `hcl:"ca_file,optional" env:"TARGET_ELASTICSEARCH_TLS_CA_FILE"`
+	SkipVerifyTLS           bool   `hcl:"skip_verify_tls,optional" env:"TARGET_ELASTICSEARCH_TLS_SKIP_VERIFY_TLS"` // false
+}
+
+// ElasticsearchTarget holds a new client for indexing messages with the Elasticsearch or OpenSearch bulk API
+type ElasticsearchTarget struct {
+	client            *http.Client
+	url               string
+	bulkURL           string
+	index             string
+	indexTemplate     *template.Template
+	documentIDField   []string
+	batchMaxMessages  int
+	batchByteLimit    int
+	basicAuthUsername string
+	basicAuthPassword string
+	apiKey            string
+	log               *log.Entry
+}
+
+// bulkAction is the action line which precedes each document in a bulk request
+type bulkAction struct {
+	Index bulkActionMetadata `json:"index"`
+}
+
+type bulkActionMetadata struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
+
+// bulkResponse is the response to a bulk request, with an item for each action in the order they were sent
+type bulkResponse struct {
+	Errors bool                           `json:"errors"`
+	Items  []map[string]*bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	Status int                `json:"status"`
+	Error  *bulkResponseError `json:"error"`
+}
+
+type bulkResponseError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// newElasticsearchTarget creates a client for indexing messages with the bulk API
+func newElasticsearchTarget(url string, index string, documentIDField string, requestTimeout int, batchMaxMessages int, batchByteLimit int,
+	basicAuthUsername string, basicAuthPassword string, apiKey string,
+	certFile string, keyFile string, caFile string, skipVerifyTLS bool) (*ElasticsearchTarget, error) {
+	if err := checkURL(url); err != nil {
+		return nil, err
+	}
+
+	if index == "" {
+		return nil, errors.New("An index must be set for the Elasticsearch target")
+	}
+	// The index is a template if it contains any template actions
+	var indexTmpl *template.Template
+	if hasTemplateActions(index) {
+		var err error
+		indexTmpl, err = parseTemplate("index", index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var idField []string
+	if documentIDField != "" {
+		idField = strings.Split(documentIDField, ".")
+	}
+
+	if (basicAuthUsername != "" || basicAuthPassword != "") && apiKey != "" {
+		return nil, errors.New("Only one of basic auth and an API key can be used to authenticate with Elasticsearch")
+	}
+	if batchMaxMessages < 1 {
+		batchMaxMessages = 1
+	}
+
+	transport := &http.Transport{}
+	tlsConfig, err := common.CreateTLSConfiguration(certFile, keyFile, caFile, skipVerifyTLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &ElasticsearchTarget{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(requestTimeout) * time.Second,
+		},
+		url:               url,
+		bulkURL:           strings.TrimSuffix(url, "/") + "/_bulk",
+		index:             index,
+		indexTemplate:     indexTmpl,
+		documentIDField:   idField,
+		batchMaxMessages:  batchMaxMessages,
+		batchByteLimit:    batchByteLimit,
+		basicAuthUsername: basicAuthUsername,
+		basicAuthPassword: basicAuthPassword,
+		apiKey:            apiKey,
+		log:               log.WithFields(log.Fields{"target": "elasticsearch", "url": url}),
+	}, nil
+}
+
+// ElasticsearchTargetConfigFunction creates ElasticsearchTarget from ElasticsearchTargetConfig
+func ElasticsearchTargetConfigFunction(c *ElasticsearchTargetConfig) (*ElasticsearchTarget, error) {
+	return newElasticsearchTarget(
+		c.URL,
+		c.Index,
+		c.DocumentIDField,
+		c.RequestTimeoutInSeconds,
+		c.BatchMaxMessages,
+		c.BatchByteLimit,
+		c.BasicAuthUsername,
+		c.BasicAuthPassword,
+		c.APIKey,
+		c.CertFile,
+		c.KeyFile,
+		c.CaFile,
+		c.SkipVerifyTLS,
+	)
+}
+
+// The ElasticsearchTargetAdapter type is an adapter for functions to be used as
+// pluggable components for Elasticsearch Target. It implements the Pluggable interface.
+type ElasticsearchTargetAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f ElasticsearchTargetAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f ElasticsearchTargetAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults for the optional parameters
+	// whose default is not their zero value.
+	cfg := &ElasticsearchTargetConfig{
+		RequestTimeoutInSeconds: 30,
+		BatchMaxMessages:        500,
+		BatchByteLimit:          5242880,
+	}
+
+	return cfg, nil
+}
+
+// AdaptElasticsearchTargetFunc returns an ElasticsearchTargetAdapter.
+func AdaptElasticsearchTargetFunc(f func(c *ElasticsearchTargetConfig) (*ElasticsearchTarget, error)) ElasticsearchTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*ElasticsearchTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected ElasticsearchTargetConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// Write indexes the messages with a bulk request per chunk
+func (et *ElasticsearchTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	et.log.Debugf("Writing %d messages to Elasticsearch ...", len(messages))
+
+	chunks, oversized := models.GetChunkedMessages(
+		messages,
+		et.batchMaxMessages,
+		et.MaximumAllowedMessageSizeBytes(),
+		et.batchByteLimit,
+	)
+
+	writeResult := &models.TargetWriteResult{
+		Oversized: oversized,
+	}
+
+	var errResult error
+
+	for _, chunk := range chunks {
+		res, err := et.process(chunk)
+		writeResult = writeResult.Append(res)
+
+		if err != nil {
+			errResult = multierror.Append(errResult, err)
+		}
+	}
+
+	if errResult != nil {
+		errResult = errors.Wrap(errResult, "Error writing messages to Elasticsearch")
+	}
+
+	et.log.Debugf("Successfully wrote %d/%d messages", len(writeResult.Sent), len(messages))
+	return writeResult, errResult
+}
+
+// process makes a bulk request for a chunk of messages, splitting them by the result of each item
+func (et *ElasticsearchTarget) process(messages []*models.Message) (*models.TargetWriteResult, error) {
+	body, included, invalid := et.bulkBody(messages)
+	if len(included) == 0 {
+		return models.NewTargetWriteResult(nil, nil, nil, invalid), nil
+	}
+
+	requestStarted := time.Now()
+	items, err := et.bulk(body)
+	requestFinished := time.Now()
+
+	for _, msg := range included {
+		msg.TimeRequestStarted = requestStarted
+		msg.TimeRequestFinished = requestFinished
+	}
+
+	if err != nil {
+		return models.NewTargetWriteResult(nil, included, nil, invalid), err
+	}
+	if len(items) != len(included) {
+		return models.NewTargetWriteResult(nil, included, nil, invalid),
+			errors.New(fmt.Sprintf("Got %d items in bulk response for %d documents", len(items), len(included)))
+	}
+
+	var sent []*models.Message
+	var failed []*models.Message
+	errorCounts := make(map[string]int)
+
+	for i, msg := range included {
+		item := items[i]
+		switch {
+		case item.Status >= 200 && item.Status < 300:
+			if msg.AckFunc != nil {
+				msg.AckFunc()
+			}
+			sent = append(sent, msg)
+		case item.Status == http.StatusTooManyRequests || item.Status >= 500:
+			// Rejected because the cluster is busy or unavailable, so it can be retried
+			failed = append(failed, msg)
+			errorCounts[item.errorType()]++
+		default:
+			// Rejected because of the document itself, eg. it doesn't match the index mapping
+			msg.SetError(errors.New(fmt.Sprintf("Document rejected with status %d: %s", item.Status, item.errorReason())))
+			invalid = append(invalid, msg)
+		}
+	}
+
+	if len(failed) > 0 {
+		return models.NewTargetWriteResult(sent, failed, nil, invalid),
+			errors.New(fmt.Sprintf("Failed to index %d/%d documents in bulk request: %s", len(failed), len(included), formatErrorCounts(errorCounts)))
+	}
+	return models.NewTargetWriteResult(sent, nil, nil, invalid), nil
+}
+
+// bulkBody builds the NDJSON body of a bulk request, with an action line followed by the document for
+// each message. Messages which aren't JSON objects, or which have no document ID, are returned as invalid.
+func (et *ElasticsearchTarget) bulkBody(messages []*models.Message) (body []byte, included []*models.Message, invalid []*models.Message) {
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		// Documents are compacted, as they can't contain newlines
+		var doc bytes.Buffer
+		if err := json.Compact(&doc, msg.Data); err != nil || !bytes.HasPrefix(doc.Bytes(), []byte("{")) {
+			msg.SetError(errors.New("Message data is not a JSON object, so cannot be indexed as a document"))
+			invalid = append(invalid, msg)
+			continue
+		}
+
+		action, err := et.bulkAction(msg)
+		if err != nil {
+			msg.SetError(err)
+			invalid = append(invalid, msg)
+			continue
+		}
+
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(doc.Bytes())
+		buf.WriteByte('\n')
+		included = append(included, msg)
+	}
+	return buf.Bytes(), included, invalid
+}
+
+// bulkAction renders the action line for a message, with its index and document ID
+func (et *ElasticsearchTarget) bulkAction(msg *models.Message) ([]byte, error) {
+	data := lazyTemplateData(msg)
+	metadata := bulkActionMetadata{Index: et.index}
+
+	if et.indexTemplate != nil {
+		index, err := renderTemplate(et.indexTemplate, data())
+		if err != nil {
+			return nil, err
+		}
+		metadata.Index = string(index)
+	}
+
+	if et.documentIDField != nil {
+		id, err := documentID(data().Data, et.documentIDField)
+		if err != nil {
+			return nil, err
+		}
+		metadata.ID = id
+	}
+
+	return json.Marshal(bulkAction{Index: metadata})
+}
+
+// documentID returns the value of a field in the message data, given as the path of keys to it
+func documentID(data interface{}, field []string) (string, error) {
+	value := data
+	for _, key := range field {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case json.Number:
+		return v.String(), nil
+	}
+	return "", errors.New(fmt.Sprintf("Message data has no string or number document ID field '%s'", strings.Join(field, ".")))
+}
+
+// bulk makes a bulk request, returning the result of each item
+func (et *ElasticsearchTarget) bulk(body []byte) ([]*bulkResponseItem, error) {
+	request, err := http.NewRequest("POST", et.bulkURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+	request.Header.Add("Content-Type", "application/x-ndjson")
+	if et.basicAuthUsername != "" && et.basicAuthPassword != "" {
+		request.SetBasicAuth(et.basicAuthUsername, et.basicAuthPassword)
+	}
+	if et.apiKey != "" {
+		request.Header.Add("Authorization", "ApiKey "+et.apiKey)
+	}
+
+	resp, err := et.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+		return nil, errors.New(fmt.Sprintf("Got response status: %s, body: %s", resp.Status, string(respBody)))
+	}
+
+	var parsed bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, errors.Wrap(err, "Error parsing bulk response")
+	}
+
+	// Each item is keyed by its action, and every action in a request is "index"
+	items := make([]*bulkResponseItem, len(parsed.Items))
+	for i, item := range parsed.Items {
+		items[i] = item["index"]
+		if items[i] == nil {
+			return nil, errors.New("Bulk response has an item without an index result")
+		}
+	}
+	return items, nil
+}
+
+// errorType returns the type of error an item failed with
+func (i *bulkResponseItem) errorType() string {
+	if i.Error == nil || i.Error.Type == "" {
+		return fmt.Sprintf("status %d", i.Status)
+	}
+	return i.Error.Type
+}
+
+// errorReason describes the error an item failed with
+func (i *bulkResponseItem) errorReason() string {
+	if i.Error == nil {
+		return "no error given"
+	}
+	return fmt.Sprintf("%s: %s", i.Error.Type, i.Error.Reason)
+}
+
+// Open does nothing for this target
+func (et *ElasticsearchTarget) Open() {}
+
+// Close does nothing for this target
+func (et *ElasticsearchTarget) Close() {}
+
+// MaximumAllowedMessageSizeBytes returns the max number of bytes that can be sent
+// per message for this target
+func (et *ElasticsearchTarget) MaximumAllowedMessageSizeBytes() int {
+	return et.batchByteLimit
+}
+
+// GetID returns an identifier for this target
+func (et *ElasticsearchTarget) GetID() string {
+	return et.url
+}
@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// bulkTestServer stands in for the bulk API. Documents are given the status set for their "status"
+// field, or 201 if they don't have one.
+type bulkTestServer struct {
+	*httptest.Server
+
+	requests      []string
+	authorization []string
+	mutex         sync.Mutex
+}
+
+func newBulkTestServer(t *testing.T) *bulkTestServer {
+	s := &bulkTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/_bulk", req.URL.Path)
+		assert.Equal(t, "application/x-ndjson", req.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			panic(err)
+		}
+		s.mutex.Lock()
+		s.requests = append(s.requests, string(body))
+		s.authorization = append(s.authorization, req.Header.Get("Authorization"))
+		s.mutex.Unlock()
+
+		var items []string
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			if !scanner.Scan() {
+				panic("action without a document")
+			}
+			var doc struct {
+				Status int `json:"status"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				panic(err)
+			}
+
+			switch doc.Status {
+			case 0:
+				items = append(items, `{"index":{"status":201}}`)
+			case 400:
+				items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+			default:
+				items = append(items, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}}}`, doc.Status))
+			}
+		}
+		fmt.Fprintf(w, `{"took":1,"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}))
+	return s
+}
+
+func TestElasticsearchTarget_WriteBulk(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newBulkTestServer(t)
+	defer server.Close()
+
+	target, err := newElasticsearchTarget(server.URL, "events-{{ .Data.app_id }}", "event.id", 5, 3, 1048576, "", "", "", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte(`{"app_id":"app1","event":{"id":"e1"}}`), AckFunc: ackFunc},
+		{Data: []byte("{\n  \"app_id\": \"app2\",\n  \"event\": {\"id\": 2}\n}"), AckFunc: ackFunc},
+		{Data: []byte(`{"app_id":"app1","event":{"id":"e3"},"status":429}`), AckFunc: ackFunc},
+		{Data: []byte(`{"app_id":"app1","event":{"id":"e4"},"status":400}`), AckFunc: ackFunc},
+		{Data: []byte(`{"app_id":"app1","event":{}}`), AckFunc: ackFunc},
+		{Data: []byte(`not json`), AckFunc: ackFunc},
+		{Data: []byte(`{"event":{"id":"e7"}}`), AckFunc: ackFunc},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Failed to index 1/3 documents in bulk request: es_rejected_execution_exception \\(1\\)", err.Error())
+	}
+	assert.Equal(2, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Failed))
+	assert.Equal(4, len(writeResult.Invalid))
+	assert.Equal(int64(2), ackOps)
+
+	assert.Equal(messages[2], writeResult.Failed[0])
+	assert.Equal("Document rejected with status 400: mapper_parsing_exception: failed to parse", messages[3].GetError().Error())
+	assert.Equal("Message data has no string or number document ID field 'event.id'", messages[4].GetError().Error())
+	assert.Equal("Message data is not a JSON object, so cannot be indexed as a document", messages[5].GetError().Error())
+	assert.Regexp("Error rendering index template: .*", messages[6].GetError().Error())
+
+	// The documents are compacted, and every chunk is sent in its own request
+	assert.Equal([]string{
+		`{"index":{"_index":"events-app1","_id":"e1"}}` + "\n" +
+			`{"app_id":"app1","event":{"id":"e1"}}` + "\n" +
+			`{"index":{"_index":"events-app2","_id":"2"}}` + "\n" +
+			`{"app_id":"app2","event":{"id":2}}` + "\n" +
+			`{"index":{"_index":"events-app1","_id":"e3"}}` + "\n" +
+			`{"app_id":"app1","event":{"id":"e3"},"status":429}` + "\n",
+		`{"index":{"_index":"events-app1","_id":"e4"}}` + "\n" +
+			`{"app_id":"app1","event":{"id":"e4"},"status":400}` + "\n",
+	}, server.requests)
+}
+
+func TestElasticsearchTarget_WriteInvalidJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newBulkTestServer(t)
+	defer server.Close()
+
+	target, err := newElasticsearchTarget(server.URL+"/", "events", "", 5, 10, 1048576, "", "", "", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte(`{"app_id":"app1"}`)},
+		{Data: []byte(`not json`)},
+		{Data: []byte(`["not","an","object"]`)},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(1, len(writeResult.Sent))
+	assert.Equal(2, len(writeResult.Invalid))
+	for _, msg := range writeResult.Invalid {
+		assert.Equal("Message data is not a JSON object, so cannot be indexed as a document", msg.GetError().Error())
+	}
+	assert.Equal([]string{`{"index":{"_index":"events"}}` + "\n" + `{"app_id":"app1"}` + "\n"}, server.requests)
+}
+
+func TestElasticsearchTarget_WriteAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newBulkTestServer(t)
+	defer server.Close()
+
+	basic, err := newElasticsearchTarget(server.URL, "events", "", 5, 10, 1048576, "user", "pass", "", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, err := newElasticsearchTarget(server.URL, "events", "", 5, 10, 1048576, "", "", "a2V5", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err1 := basic.Write([]*models.Message{{Data: []byte(`{}`)}})
+	assert.Nil(err1)
+	_, err2 := apiKey.Write([]*models.Message{{Data: []byte(`{}`)}})
+	assert.Nil(err2)
+
+	assert.Equal([]string{"Basic dXNlcjpwYXNz", "ApiKey a2V5"}, server.authorization)
+}
+
+func TestElasticsearchTarget_WriteRequestFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"unauthorized"}`))
+	}))
+	defer server.Close()
+
+	target, err := newElasticsearchTarget(server.URL, "events", "", 5, 10, 1048576, "", "", "", "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	writeResult, err := target.Write([]*models.Message{{Data: []byte(`{}`), AckFunc: ackFunc}, {Data: []byte(`{}`), AckFunc: ackFunc}})
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Got response status: 401 Unauthorized, body: {\"error\":\"unauthorized\"}", err.Error())
+	}
+	assert.Equal(2, len(writeResult.Failed))
+	assert.Equal(int64(0), ackOps)
+}
+
+func TestNewElasticsearchTarget_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newElasticsearchTarget("localhost:9200", "events", "", 5, 10, 1048576, "", "", "", "", "", "", false)
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("Invalid url for HTTP target: 'localhost:9200'", err.Error())
+	}
+
+	target2, err2 := newElasticsearchTarget("http://localhost:9200", "", "", 5, 10, 1048576, "", "", "", "", "", "", false)
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("An index must be set for the Elasticsearch target", err2.Error())
+	}
+
+	target3, err3 := newElasticsearchTarget("http://localhost:9200", "events-{{ .Data.app_id", "", 5, 10, 1048576, "", "", "", "", "", "", false)
+	assert.Nil(target3)
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Regexp("Error parsing index template: .*", err3.Error())
+	}
+
+	target4, err4 := newElasticsearchTarget("http://localhost:9200", "events", "", 5, 10, 1048576, "user", "pass", "a2V5", "", "", "", false)
+	assert.Nil(target4)
+	assert.NotNil(err4)
+	if err4 != nil {
+		assert.Equal("Only one of basic auth and an API key can be used to authenticate with Elasticsearch", err4.Error())
+	}
+}
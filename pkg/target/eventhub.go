@@ -9,6 +9,7 @@ package target
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -32,6 +33,8 @@ type EventHubConfig struct {
 	ContextTimeoutInSeconds int    `hcl:"context_timeout_in_seconds,optional" env:"TARGET_EVENTHUB_CONTEXT_TIMEOUT_SECONDS"`
 	BatchByteLimit          int    `hcl:"batch_byte_limit,optional" env:"TARGET_EVENTHUB_BATCH_BYTE_LIMIT"`
 	SetEHPartitionKey       bool   `hcl:"set_eh_partition_key,optional" env:"TARGET_EVENTHUB_SET_EH_PK"`
+	PartitionID             string `hcl:"partition_id,optional" env:"TARGET_EVENTHUB_PARTITION_ID"`
+	Properties              string `hcl:"properties,optional" env:"TARGET_EVENTHUB_PROPERTIES"`
 }
 
 // EventHubTarget holds a new client for writing messages to Azure EventHub
@@ -45,6 +48,8 @@ type EventHubTarget struct {
 	contextTimeoutInSeconds int
 	batchByteLimit          int
 	setEHPartitionKey       bool
+	partitionID             string
+	properties              []*templatedValue
 
 	log *log.Entry
 }
@@ -56,7 +61,12 @@ type clientIface interface {
 }
 
 // newEventHubTargetWithInterfaces allows for mocking the eventhub client
-func newEventHubTargetWithInterfaces(client clientIface, cfg *EventHubConfig) *EventHubTarget {
+func newEventHubTargetWithInterfaces(client clientIface, cfg *EventHubConfig) (*EventHubTarget, error) {
+	properties, err := getEventHubProperties(cfg.Properties)
+	if err != nil {
+		return nil, err
+	}
+
 	return &EventHubTarget{
 		client:                  client,
 		eventHubNamespace:       cfg.EventHubNamespace,
@@ -67,9 +77,27 @@ func newEventHubTargetWithInterfaces(client clientIface, cfg *EventHubConfig) *E
 		contextTimeoutInSeconds: cfg.ContextTimeoutInSeconds,
 		batchByteLimit:          cfg.BatchByteLimit,
 		setEHPartitionKey:       cfg.SetEHPartitionKey,
+		partitionID:             cfg.PartitionID,
+		properties:              properties,
 
 		log: log.WithFields(log.Fields{"target": "eventhub", "cloud": "Azure", "namespace": cfg.EventHubNamespace, "eventhub": cfg.EventHubName}),
+	}, nil
+}
+
+// getEventHubProperties parses the application properties, which are provided as a JSON object of
+// property names to values. Values containing template actions are rendered for every message.
+func getEventHubProperties(properties string) ([]*templatedValue, error) {
+	if properties == "" {
+		return nil, nil
+	}
+	var parsed map[string]string
+
+	err := json.Unmarshal([]byte(properties), &parsed)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing properties. Ensure that properties are provided as a JSON of string key-value pairs")
 	}
+
+	return parseTemplatedValues("property", parsed)
 }
 
 // newEventHubTarget creates a new client for writing messages to Azure EventHub
@@ -92,12 +120,22 @@ func newEventHubTarget(cfg *EventHubConfig) (*EventHubTarget, error) {
 		return nil, errors.Errorf("Error initialising EventHub client: No valid combination of authentication Env vars found. https://pkg.go.dev/github.com/Azure/azure-event-hubs-go#NewHubWithNamespaceNameAndEnvironment")
 	}
 
-	hub, err := eventhub.NewHubWithNamespaceNameAndEnvironment(cfg.EventHubNamespace, cfg.EventHubName, eventhub.HubWithSenderMaxRetryCount(cfg.MaxAutoRetries))
 	// Using HubWithSenderMaxRetryCount limits the amount of retries that are handled by the eventhubs package natively (this app handles retries externally to this also)
 	// If none is specified, it will retry indefinitely until the context times out, which hides the actual error message
 	// To avoid obscuring errors, contextTimeoutInSeconds should be configured to ensure all retries may be completed before its expiry
+	hubOpts := []eventhub.HubOption{eventhub.HubWithSenderMaxRetryCount(cfg.MaxAutoRetries)}
+
+	// A partitioned sender sends every event to the same partition
+	if cfg.PartitionID != "" {
+		hubOpts = append(hubOpts, eventhub.HubWithPartitionedSender(cfg.PartitionID))
+	}
+
+	hub, err := eventhub.NewHubWithNamespaceNameAndEnvironment(cfg.EventHubNamespace, cfg.EventHubName, hubOpts...)
+	if err != nil {
+		return nil, err
+	}
 
-	return newEventHubTargetWithInterfaces(hub, cfg), err
+	return newEventHubTargetWithInterfaces(hub, cfg)
 }
 
 // EventHubTargetConfigFunction creates an EventHubTarget from an EventHubconfig
@@ -180,13 +218,29 @@ func (eht *EventHubTarget) process(messages []*models.Message) (*models.TargetWr
 	messageCount := len(messages)
 	eht.log.Debugf("Writing chunk of %d messages to eventHub ...", messageCount)
 
-	ehBatch := make([]*eventhub.Event, messageCount)
-	for i, msg := range messages {
-		ehEvent := eventhub.NewEvent(msg.Data)
-		if eht.setEHPartitionKey {
-			ehEvent.PartitionKey = &msg.PartitionKey
+	// Messages whose properties can't be rendered are invalid, as they never will be
+	var ehBatch []*eventhub.Event
+	var valid []*models.Message
+	var invalid []*models.Message
+	for _, msg := range messages {
+		ehEvent, err := eht.newEvent(msg)
+		if err != nil {
+			msg.SetError(err)
+			invalid = append(invalid, msg)
+			continue
 		}
-		ehBatch[i] = ehEvent
+		ehBatch = append(ehBatch, ehEvent)
+		valid = append(valid, msg)
+	}
+	messages = valid
+
+	if len(ehBatch) == 0 {
+		return models.NewTargetWriteResult(
+			nil,
+			nil,
+			nil,
+			invalid,
+		), nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(eht.contextTimeoutInSeconds)*time.Second)
@@ -209,7 +263,7 @@ func (eht *EventHubTarget) process(messages []*models.Message) (*models.TargetWr
 			nil,
 			messages,
 			nil,
-			nil,
+			invalid,
 		), errors.Wrap(err, "Failed to send message batch to EventHub")
 	}
 
@@ -225,10 +279,34 @@ func (eht *EventHubTarget) process(messages []*models.Message) (*models.TargetWr
 		messages,
 		nil,
 		nil,
-		nil,
+		invalid,
 	), nil
 }
 
+// newEvent creates the event for a message, rendering its application properties
+func (eht *EventHubTarget) newEvent(msg *models.Message) (*eventhub.Event, error) {
+	ehEvent := eventhub.NewEvent(msg.Data)
+
+	// Events sent to a partition ID can't also have a partition key
+	if eht.setEHPartitionKey && eht.partitionID == "" {
+		ehEvent.PartitionKey = &msg.PartitionKey
+	}
+
+	if len(eht.properties) > 0 {
+		data := lazyTemplateData(msg)
+		ehEvent.Properties = make(map[string]interface{}, len(eht.properties))
+		for _, property := range eht.properties {
+			value, err := property.render(data)
+			if err != nil {
+				return nil, err
+			}
+			ehEvent.Properties[property.name] = string(value)
+		}
+	}
+
+	return ehEvent, nil
+}
+
 // Open does not do anything for this target
 func (eht *EventHubTarget) Open() {}
 
@@ -44,6 +44,8 @@ type mockHub struct {
 	results chan *eventhub.EventBatch
 	// Boolean to allow us to mock failure path
 	fail bool
+	// Channel to output the events sent, if provided, as batches don't expose them
+	events chan *eventhub.Event
 }
 
 // Sendbatch is a mock of the Eventhubs SendBatch method. If m.fail is true, it returns an error.
@@ -66,6 +68,14 @@ func (m mockHub) SendBatch(ctx context.Context, iterator eventhub.BatchIterator,
 		}
 	}
 
+	if ebi, ok := iterator.(*eventhub.EventBatchIterator); ok && m.events != nil {
+		for _, events := range ebi.PartitionEventsMap {
+			for _, event := range events {
+				m.events <- event
+			}
+		}
+	}
+
 	for !iterator.Done() {
 		id := uuid.NewV4()
 
@@ -83,6 +93,15 @@ func (m mockHub) Close(context.Context) error {
 	return nil
 }
 
+// newTestEventHubTarget creates an EventHubTarget which sends to the mock client
+func newTestEventHubTarget(t *testing.T, m mockHub, c *EventHubConfig) *EventHubTarget {
+	tgt, err := newEventHubTargetWithInterfaces(m, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tgt
+}
+
 // getResults retrieves and returns results from the mock's results channel,
 // it blocks until no result have come in for the timeout period
 func getResults(resultChannel chan *eventhub.EventBatch, timeout time.Duration) []*eventhub.EventBatch {
@@ -110,7 +129,7 @@ func TestProcessWithRandomPartitionKeys(t *testing.T) {
 	m := mockHub{
 		results: make(chan *eventhub.EventBatch),
 	}
-	tgt := newEventHubTargetWithInterfaces(m, &cfg)
+	tgt := newTestEventHubTarget(t, m, &cfg)
 
 	// Mechanism for counting acks
 	var ackOps int64
@@ -149,7 +168,7 @@ func TestProcessFailure(t *testing.T) {
 		results: make(chan *eventhub.EventBatch),
 		fail:    true,
 	}
-	tgtToFail := newEventHubTargetWithInterfaces(m, &cfg)
+	tgtToFail := newTestEventHubTarget(t, m, &cfg)
 
 	var ackOps int64
 	ackFunc := func() {
@@ -193,7 +212,7 @@ func TestProcessWithNoPartitionKey(t *testing.T) {
 	m := mockHub{
 		results: make(chan *eventhub.EventBatch),
 	}
-	tgt := newEventHubTargetWithInterfaces(m, &cfg)
+	tgt := newTestEventHubTarget(t, m, &cfg)
 	tgt.setEHPartitionKey = false
 
 	// Mechanism for counting acks
@@ -232,7 +251,7 @@ func TestProcessBatchingByPartitionKey(t *testing.T) {
 	m := mockHub{
 		results: make(chan *eventhub.EventBatch),
 	}
-	tgt := newEventHubTargetWithInterfaces(m, &cfg)
+	tgt := newTestEventHubTarget(t, m, &cfg)
 
 	// Mechanism for counting acks
 	var ackOps int64
@@ -283,7 +302,7 @@ func TestWriteSuccess(t *testing.T) {
 	m := mockHub{
 		results: make(chan *eventhub.EventBatch),
 	}
-	tgt := newEventHubTargetWithInterfaces(m, &cfg)
+	tgt := newTestEventHubTarget(t, m, &cfg)
 	// Max chunk size of 20 just to validate behaviour with some chunking involved.
 	tgt.chunkMessageLimit = 20
 
@@ -329,7 +348,7 @@ func TestWriteFailure(t *testing.T) {
 		results: make(chan *eventhub.EventBatch),
 		fail:    true,
 	}
-	tgt := newEventHubTargetWithInterfaces(m, &cfg)
+	tgt := newTestEventHubTarget(t, m, &cfg)
 	// Max chunk size of 20 just to validate behaviour with several errors
 	tgt.chunkMessageLimit = 20
 
@@ -365,6 +384,97 @@ func TestWriteFailure(t *testing.T) {
 	assert.Nil(twres.Invalid)
 }
 
+// TestProcessWithProperties tests that application properties are set on events, and that messages whose properties can't be rendered are invalid.
+func TestProcessWithProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	m := mockHub{
+		results: make(chan *eventhub.EventBatch),
+		events:  make(chan *eventhub.Event, 10),
+	}
+	propertiesCfg := cfg
+	propertiesCfg.SetEHPartitionKey = false
+	propertiesCfg.Properties = `{"schema":"{{ .Data.schema }}","source":"snowbridge"}`
+	tgt := newTestEventHubTarget(t, m, &propertiesCfg)
+
+	messages := []*models.Message{
+		{Data: []byte(`{"schema":"page_view"}`)},
+		{Data: []byte(`{"schema":"page_ping"}`)},
+		{Data: []byte(`{"event":"unstruct"}`)},
+	}
+
+	var twres *models.TargetWriteResult
+	var err error
+
+	done := make(chan struct{})
+	go func() {
+		twres, err = tgt.process(messages)
+		close(done)
+	}()
+	res := getResults(m.results, 1*time.Second)
+	<-done
+
+	assert.Equal(1, len(res))
+	assert.Nil(err)
+	assert.Equal(2, len(twres.Sent))
+	assert.Equal(1, len(twres.Invalid))
+	assert.Regexp("Error rendering schema property template: .*", twres.Invalid[0].GetError().Error())
+
+	var schemas []interface{}
+	for len(m.events) > 0 {
+		event := <-m.events
+		assert.Equal("snowbridge", event.Properties["source"])
+		schemas = append(schemas, event.Properties["schema"])
+	}
+	assert.Equal([]interface{}{"page_view", "page_ping"}, schemas)
+}
+
+// TestProcessWithPartitionID tests that partition keys aren't set when sending to a partition ID.
+func TestProcessWithPartitionID(t *testing.T) {
+	assert := assert.New(t)
+
+	m := mockHub{
+		results: make(chan *eventhub.EventBatch),
+	}
+	partitionCfg := cfg
+	partitionCfg.PartitionID = "1"
+	tgt := newTestEventHubTarget(t, m, &partitionCfg)
+
+	messages := testutil.GetTestMessages(10, testutil.GenRandomString(100), nil)
+
+	var twres *models.TargetWriteResult
+	var err error
+
+	done := make(chan struct{})
+	go func() {
+		twres, err = tgt.process(messages)
+		close(done)
+	}()
+	res := getResults(m.results, 1*time.Second)
+	<-done
+
+	// Without partition keys, all events fit in one batch
+	assert.Equal(1, len(res))
+	assert.Nil(err)
+	assert.Equal(10, len(twres.Sent))
+	assert.Nil(res[0].PartitionKey)
+}
+
+// TestNewEventHubTarget_InvalidProperties tests that we fail on startup when properties can't be parsed.
+func TestNewEventHubTarget_InvalidProperties(t *testing.T) {
+	assert := assert.New(t)
+
+	invalidCfg := cfg
+	invalidCfg.Properties = `{"schema":"{{ .Data.schema"}`
+
+	tgt, err := newEventHubTargetWithInterfaces(mockHub{}, &invalidCfg)
+	assert.Nil(tgt)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Error parsing schema property template: .*", err.Error())
+	}
+}
+
 // TestNewEventHubTarget_KeyValue tests that we can initialise a client with key value credentials.
 func TestNewEventHubTarget_KeyValue(t *testing.T) {
 	assert := assert.New(t)
@@ -0,0 +1,480 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+const (
+	// How often the current file is checked for whether its roll interval has elapsed
+	fileRollCheckInterval = time.Second
+)
+
+// FileTargetConfig configures the destination for records consumed
+type FileTargetConfig struct {
+	Path                  string `hcl:"path" env:"TARGET_FILE_PATH"`
+	Compression           string `hcl:"compression,optional" env:"TARGET_FILE_COMPRESSION"`
+	RollSizeBytes         int    `hcl:"roll_size_bytes,optional" env:"TARGET_FILE_ROLL_SIZE_BYTES"`
+	RollMessages          int    `hcl:"roll_messages,optional" env:"TARGET_FILE_ROLL_MESSAGES"`
+	RollIntervalInSeconds int    `hcl:"roll_interval_in_seconds,optional" env:"TARGET_FILE_ROLL_INTERVAL_SECONDS"`
+}
+
+// FileTarget holds a new client for writing messages to local files
+type FileTarget struct {
+	path          string
+	compression   string
+	rollSizeBytes int
+	rollMessages  int
+	rollInterval  time.Duration
+
+	// current is the file being written to, which is nil until the first write and after a roll
+	current *rollingFile
+	mutex   sync.Mutex
+
+	// now returns the current time, used to render the path and roll by time
+	now func() time.Time
+
+	// Files are closed in the background once their roll interval has elapsed, so that idle
+	// files are finished rather than left open until the next write
+	checkInterval time.Duration
+	stop          chan struct{}
+	stopped       sync.WaitGroup
+
+	log *log.Entry
+}
+
+// rollingFile is an open output file, with the writer which compresses data into it
+type rollingFile struct {
+	// rendered is the path rendered from the template, and path is where the file was
+	// actually created, which has a counter added if a file already existed there
+	rendered   string
+	path       string
+	file       *os.File
+	writer     io.Writer
+	compressor compressor
+	opened     time.Time
+	bytes      int
+	messages   int
+}
+
+// newFileTarget creates a new client for writing messages to local files
+func newFileTarget(path string, compression string, rollSizeBytes int, rollMessages int, rollIntervalInSeconds int) (*FileTarget, error) {
+	if path == "" {
+		return nil, errors.New("A path must be set for the file target")
+	}
+
+	compression, err := getCompression(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if rollSizeBytes < 0 || rollMessages < 0 || rollIntervalInSeconds < 0 {
+		return nil, errors.New("roll_size_bytes, roll_messages and roll_interval_in_seconds cannot be negative")
+	}
+
+	return &FileTarget{
+		path:          path,
+		compression:   compression,
+		rollSizeBytes: rollSizeBytes,
+		rollMessages:  rollMessages,
+		rollInterval:  time.Duration(rollIntervalInSeconds) * time.Second,
+		now:           time.Now,
+		checkInterval: fileRollCheckInterval,
+		log:           log.WithFields(log.Fields{"target": "file", "path": path}),
+	}, nil
+}
+
+// FileTargetConfigFunction creates a FileTarget from a FileTargetConfig
+func FileTargetConfigFunction(c *FileTargetConfig) (*FileTarget, error) {
+	return newFileTarget(c.Path, c.Compression, c.RollSizeBytes, c.RollMessages, c.RollIntervalInSeconds)
+}
+
+// The FileTargetAdapter type is an adapter for functions to be used as
+// pluggable components for File Target. It implements the Pluggable interface.
+type FileTargetAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f FileTargetAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f FileTargetAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults for the optional parameters
+	// whose default is not their zero value.
+	cfg := &FileTargetConfig{
+		Compression: compressionNone,
+	}
+
+	return cfg, nil
+}
+
+// AdaptFileTargetFunc returns a FileTargetAdapter.
+func AdaptFileTargetFunc(f func(c *FileTargetConfig) (*FileTarget, error)) FileTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*FileTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected FileTargetConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// Write appends all messages to the current file as newline delimited records. Messages are only
+// acked once the file has been synced to disk, so that acked messages are durable.
+func (ft *FileTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	ft.log.Debugf("Writing %d messages to file ...", len(messages))
+
+	safeMessages, oversized := models.FilterOversizedMessages(
+		messages,
+		ft.MaximumAllowedMessageSizeBytes(),
+	)
+
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	var valid []*models.Message
+	var invalid []*models.Message
+	for _, msg := range safeMessages {
+		// A message containing a newline would be read back as several records
+		if bytes.ContainsRune(msg.Data, '\n') {
+			msg.SetError(errors.New("Messages written to a file cannot contain newlines"))
+			invalid = append(invalid, msg)
+			continue
+		}
+		valid = append(valid, msg)
+	}
+
+	requestStarted := time.Now()
+	for _, msg := range valid {
+		if err := ft.writeMessage(msg); err != nil {
+			return ft.writeFailed(valid, oversized, invalid, errors.Wrap(err, "Error writing messages to file"))
+		}
+	}
+
+	if ft.current != nil {
+		if err := ft.current.sync(); err != nil {
+			return ft.writeFailed(valid, oversized, invalid, errors.Wrap(err, "Error syncing file"))
+		}
+	}
+	requestFinished := time.Now()
+
+	for _, msg := range valid {
+		msg.TimeRequestStarted = requestStarted
+		msg.TimeRequestFinished = requestFinished
+
+		if msg.AckFunc != nil {
+			msg.AckFunc()
+		}
+	}
+
+	ft.log.Debugf("Successfully wrote %d/%d messages", len(valid), len(safeMessages))
+	return models.NewTargetWriteResult(
+		valid,
+		nil,
+		oversized,
+		invalid,
+	), nil
+}
+
+// writeFailed closes the current file after an error, so that the next write starts a new file,
+// and returns every valid message as failed. Messages which were written before the error will
+// be written again when retried.
+func (ft *FileTarget) writeFailed(valid []*models.Message, oversized []*models.Message, invalid []*models.Message, err error) (*models.TargetWriteResult, error) {
+	if ft.current != nil {
+		if closeErr := ft.current.close(); closeErr != nil {
+			ft.log.WithFields(log.Fields{"error": closeErr}).Warn("Failed to close file after a write error")
+		}
+		ft.current = nil
+	}
+
+	return models.NewTargetWriteResult(
+		nil,
+		valid,
+		oversized,
+		invalid,
+	), err
+}
+
+// writeMessage writes a message to the current file, rolling it first if it's due
+func (ft *FileTarget) writeMessage(msg *models.Message) error {
+	now := ft.now().UTC()
+	path := renderFilePath(ft.path, now)
+
+	if ft.current != nil && ft.shouldRoll(path, len(msg.Data)+1, now) {
+		if err := ft.current.close(); err != nil {
+			ft.current = nil
+			return err
+		}
+		ft.log.Debugf("Rolled file %s after %d messages", ft.current.path, ft.current.messages)
+		ft.current = nil
+	}
+
+	if ft.current == nil {
+		f, err := ft.openFile(path, now)
+		if err != nil {
+			return err
+		}
+		ft.current = f
+	}
+
+	return ft.current.write(msg.Data)
+}
+
+// shouldRoll reports whether the current file should be closed before writing a record of the given size
+func (ft *FileTarget) shouldRoll(path string, size int, now time.Time) bool {
+	f := ft.current
+	switch {
+	case f.rendered != path:
+		// The date parts of the path have changed
+		return true
+	case ft.rollMessages > 0 && f.messages >= ft.rollMessages:
+		return true
+	case ft.rollSizeBytes > 0 && f.bytes > 0 && f.bytes+size > ft.rollSizeBytes:
+		return true
+	case ft.rollInterval > 0 && now.Sub(f.opened) >= ft.rollInterval:
+		return true
+	}
+	return false
+}
+
+// openFile creates a new file at the rendered path, with the writer compressing data into it.
+// The directories holding the file are synced, so that the file is still there after a crash.
+func (ft *FileTarget) openFile(rendered string, now time.Time) (*rollingFile, error) {
+	if err := mkdirAllSync(filepath.Dir(rendered)); err != nil {
+		return nil, errors.Wrap(err, "Failed to create directory for file")
+	}
+
+	file, path, err := createUniqueFile(rendered)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "Failed to sync directory of file")
+	}
+
+	f := &rollingFile{
+		rendered: rendered,
+		path:     path,
+		file:     file,
+		writer:   file,
+		opened:   now,
+	}
+
+	compressor, err := newCompressor(ft.compression, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if compressor != nil {
+		f.compressor = compressor
+		f.writer = compressor
+	}
+
+	ft.log.Debugf("Opened file %s", path)
+	return f, nil
+}
+
+// createUniqueFile creates a file at the path, or if one already exists there, at the path with a
+// counter added before its extensions. Existing files are never appended to.
+func createUniqueFile(path string) (*os.File, string, error) {
+	dir, base := filepath.Split(path)
+	name, ext := base, ""
+	if i := strings.Index(base, "."); i > 0 {
+		name, ext = base[:i], base[i:]
+	}
+
+	candidate := path
+	for n := 1; ; n++ {
+		file, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file, candidate, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", errors.Wrap(err, "Failed to create file")
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s.%d%s", name, n, ext))
+	}
+}
+
+// mkdirAllSync creates a directory along with any missing parents, syncing the parent of each
+// directory created so that they are durable
+func mkdirAllSync(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		_, err := os.Stat(d)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := syncDir(filepath.Dir(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir syncs a directory, so that the entries created in it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// renderFilePath replaces the date parts of a path with the given time
+func renderFilePath(path string, t time.Time) string {
+	return strings.NewReplacer(
+		"%Y", t.Format("2006"),
+		"%m", t.Format("01"),
+		"%d", t.Format("02"),
+		"%H", t.Format("15"),
+		"%M", t.Format("04"),
+		"%S", t.Format("05"),
+		"%%", "%",
+	).Replace(path)
+}
+
+// write writes a record followed by a newline
+func (f *rollingFile) write(data []byte) error {
+	if _, err := f.writer.Write(data); err != nil {
+		return err
+	}
+	if _, err := f.writer.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+	f.bytes += len(data) + 1
+	f.messages++
+	return nil
+}
+
+// sync flushes any buffered compressed data and syncs the file to disk
+func (f *rollingFile) sync() error {
+	if f.compressor != nil {
+		if err := f.compressor.Flush(); err != nil {
+			return err
+		}
+	}
+	return f.file.Sync()
+}
+
+// close finishes compressing, then syncs and closes the file
+func (f *rollingFile) close() error {
+	if f.compressor != nil {
+		if err := f.compressor.Close(); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// rollOnInterval closes the current file once its roll interval has elapsed, until the target is closed
+func (ft *FileTarget) rollOnInterval() {
+	defer ft.stopped.Done()
+
+	ticker := time.NewTicker(ft.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ft.stop:
+			return
+		case <-ticker.C:
+			ft.mutex.Lock()
+			if ft.current != nil && ft.now().UTC().Sub(ft.current.opened) >= ft.rollInterval {
+				if err := ft.current.close(); err != nil {
+					ft.log.WithFields(log.Fields{"error": err}).Error("Failed to close file")
+				} else {
+					ft.log.Debugf("Rolled file %s after %d messages", ft.current.path, ft.current.messages)
+				}
+				ft.current = nil
+			}
+			ft.mutex.Unlock()
+		}
+	}
+}
+
+// Open starts closing files once their roll interval has elapsed in the background, when rolling
+// by time. Files themselves are opened when they are first written to.
+func (ft *FileTarget) Open() {
+	if ft.rollInterval > 0 {
+		ft.stop = make(chan struct{})
+		ft.stopped.Add(1)
+		go ft.rollOnInterval()
+	}
+}
+
+// Close stops rolling files in the background and closes the current file
+func (ft *FileTarget) Close() {
+	if ft.stop != nil {
+		close(ft.stop)
+		ft.stopped.Wait()
+		ft.stop = nil
+	}
+
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	if ft.current != nil {
+		if err := ft.current.close(); err != nil {
+			ft.log.WithFields(log.Fields{"error": err}).Error("Failed to close file")
+		}
+		ft.current = nil
+	}
+}
+
+// MaximumAllowedMessageSizeBytes returns the max number of bytes that can be sent
+// per message for this target
+//
+// Note: Technically no limit but we are putting in a limit of 10 MiB here
+// to keep records to a manageable size
+func (ft *FileTarget) MaximumAllowedMessageSizeBytes() int {
+	return 10485760
+}
+
+// GetID returns the identifier for this target
+func (ft *FileTarget) GetID() string {
+	return fmt.Sprintf("file:%s", ft.path)
+}
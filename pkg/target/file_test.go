@@ -0,0 +1,328 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/testutil"
+)
+
+// readFiles returns the decompressed contents of every file in the directory, keyed by file name
+func readFiles(t *testing.T, dir string, compression string) map[string]string {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := make(map[string]string)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var reader io.Reader = file
+		switch compression {
+		case compressionGzip:
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = gz
+		case compressionZstd:
+			decoder, err := zstd.NewReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer decoder.Close()
+			reader = decoder
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		contents[filepath.Base(path)] = string(data)
+	}
+	return contents
+}
+
+func TestFileTarget_Write(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	target, err := newFileTarget(filepath.Join(dir, "events.ndjson"), "", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(3, "Hello File!!", ackFunc)
+	messages = append(messages, &models.Message{Data: []byte("Hello\nFile!!"), AckFunc: ackFunc})
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(3, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Equal("Messages written to a file cannot contain newlines", writeResult.Invalid[0].GetError().Error())
+	assert.Equal(int64(3), ackOps)
+
+	// Acked messages are already on disk before the file is closed
+	assert.Equal(map[string]string{
+		"events.ndjson": "Hello File!!\nHello File!!\nHello File!!\n",
+	}, readFiles(t, dir, compressionNone))
+
+	// Writes are appended to the same file until it is rolled
+	writeResult2, err2 := target.Write(testutil.GetTestMessages(1, "Goodbye File!!", ackFunc))
+	assert.Nil(err2)
+	assert.Equal(1, len(writeResult2.Sent))
+	target.Close()
+
+	assert.Equal(map[string]string{
+		"events.ndjson": "Hello File!!\nHello File!!\nHello File!!\nGoodbye File!!\n",
+	}, readFiles(t, dir, compressionNone))
+}
+
+func TestFileTarget_WriteCompressed(t *testing.T) {
+	for _, compression := range []string{compressionGzip, compressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			assert := assert.New(t)
+
+			dir := t.TempDir()
+			target, err := newFileTarget(filepath.Join(dir, "events.ndjson"), compression, 0, 2, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			writeResult, err := target.Write(testutil.GetSequentialTestMessages(5, nil))
+			assert.Nil(err)
+			assert.Equal(5, len(writeResult.Sent))
+			target.Close()
+
+			assert.Equal(map[string]string{
+				"events.ndjson":   "0\n1\n",
+				"events.1.ndjson": "2\n3\n",
+				"events.2.ndjson": "4\n",
+			}, readFiles(t, dir, compression))
+		})
+	}
+}
+
+func TestFileTarget_RollBySize(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	target, err := newFileTarget(filepath.Join(dir, "events"), "", 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A record larger than the roll size is still written, to a file of its own
+	messages := []*models.Message{
+		{Data: []byte("1234")},
+		{Data: []byte("5678")},
+		{Data: []byte("0123456789")},
+		{Data: []byte("9")},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(4, len(writeResult.Sent))
+	target.Close()
+
+	assert.Equal(map[string]string{
+		"events":   "1234\n5678\n",
+		"events.1": "0123456789\n",
+		"events.2": "9\n",
+	}, readFiles(t, dir, compressionNone))
+}
+
+func TestFileTarget_RollByTime(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	target, err := newFileTarget(filepath.Join(dir, "%Y%m%d", "events-%H%%.ndjson"), "", 0, 0, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2023, 12, 31, 23, 40, 0, 0, time.UTC)
+	target.now = func() time.Time { return now }
+
+	write := func(data string) {
+		writeResult, err := target.Write([]*models.Message{{Data: []byte(data)}})
+		assert.Nil(err)
+		assert.Equal(1, len(writeResult.Sent))
+	}
+
+	write("a")
+	now = now.Add(5 * time.Minute)
+	write("b")
+
+	// The roll interval has elapsed
+	now = now.Add(5 * time.Minute)
+	write("c")
+
+	// The rendered path has changed
+	now = now.Add(10 * time.Minute)
+	write("d")
+	target.Close()
+
+	var dirs []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		dirs = append(dirs, entry.Name())
+	}
+	sort.Strings(dirs)
+	assert.Equal([]string{"20231231", "20240101"}, dirs)
+
+	assert.Equal(map[string]string{
+		"events-23%.ndjson":   "a\nb\n",
+		"events-23%.1.ndjson": "c\n",
+	}, readFiles(t, filepath.Join(dir, "20231231"), compressionNone))
+	assert.Equal(map[string]string{
+		"events-00%.ndjson": "d\n",
+	}, readFiles(t, filepath.Join(dir, "20240101"), compressionNone))
+}
+
+func TestFileTarget_RollOnInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	target, err := newFileTarget(filepath.Join(dir, "events.ndjson"), compressionGzip, 0, 0, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var now int64 = time.Date(2023, 12, 31, 23, 40, 0, 0, time.UTC).UnixNano()
+	target.now = func() time.Time { return time.Unix(0, atomic.LoadInt64(&now)) }
+	target.checkInterval = 10 * time.Millisecond
+	target.Open()
+	defer target.Close()
+
+	writeResult, err := target.Write(testutil.GetTestMessages(1, "idle", nil))
+	assert.Nil(err)
+	assert.Equal(1, len(writeResult.Sent))
+
+	// An idle file is finished once the roll interval has elapsed, without waiting for the next write
+	isClosed := func() bool {
+		target.mutex.Lock()
+		defer target.mutex.Unlock()
+		return target.current == nil
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.False(isClosed())
+
+	atomic.AddInt64(&now, int64(10*time.Minute))
+	assert.Eventually(isClosed, time.Second, 10*time.Millisecond)
+	assert.Equal(map[string]string{
+		"events.ndjson": "idle\n",
+	}, readFiles(t, dir, compressionGzip))
+}
+
+func TestFileTarget_ExistingFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	if err := os.WriteFile(path, []byte("existing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := newFileTarget(path, "", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeResult, err := target.Write(testutil.GetTestMessages(1, "new", nil))
+	assert.Nil(err)
+	assert.Equal(1, len(writeResult.Sent))
+	target.Close()
+
+	assert.Equal(map[string]string{
+		"events.ndjson":   "existing\n",
+		"events.1.ndjson": "new\n",
+	}, readFiles(t, dir, compressionNone))
+}
+
+func TestFileTarget_WriteFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	// The directory can't be created, as a file is in the way
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "blocked"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := newFileTarget(filepath.Join(dir, "blocked", "events.ndjson"), "", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(2, "Hello File!!", ackFunc)
+	messages = append(messages, &models.Message{Data: []byte("Hello\nFile!!"), AckFunc: ackFunc})
+
+	writeResult, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Error writing messages to file: Failed to create directory for file: .*", err.Error())
+	}
+	assert.Equal(2, len(writeResult.Failed))
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Equal(int64(0), ackOps)
+}
+
+func TestNewFileTarget_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newFileTarget("", "", 0, 0, 0)
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("A path must be set for the file target", err.Error())
+	}
+
+	target2, err2 := newFileTarget("events.ndjson", "lz4", 0, 0, 0)
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("Invalid compression 'lz4', must be one of 'none', 'gzip' or 'zstd'", err2.Error())
+	}
+
+	target3, err3 := newFileTarget("events.ndjson", "", 0, -1, 0)
+	assert.Nil(target3)
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Equal("roll_size_bytes, roll_messages and roll_interval_in_seconds cannot be negative", err3.Error())
+	}
+}
@@ -11,13 +11,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
 
 	"github.com/snowplow/snowbridge/pkg/common"
 	"github.com/snowplow/snowbridge/pkg/models"
@@ -36,6 +43,60 @@ type HTTPTargetConfig struct {
 	KeyFile                 string `hcl:"key_file,optional" env:"TARGET_HTTP_TLS_KEY_FILE"`
 	CaFile                  string `hcl:"ca_file,optional" env:"TARGET_HTTP_TLS_CA_FILE"`
 	SkipVerifyTLS           bool   `hcl:"skip_verify_tls,optional" env:"TARGET_HTTP_TLS_SKIP_VERIFY_TLS"` // false
+
+	BatchMaxMessages int    `hcl:"batch_max_messages,optional" env:"TARGET_HTTP_BATCH_MAX_MESSAGES"`
+	BatchByteLimit   int    `hcl:"batch_byte_limit,optional" env:"TARGET_HTTP_BATCH_BYTE_LIMIT"`
+	BatchFormat      string `hcl:"batch_format,optional" env:"TARGET_HTTP_BATCH_FORMAT"`
+
+	MaxConcurrentRequests          int `hcl:"max_concurrent_requests,optional" env:"TARGET_HTTP_MAX_CONCURRENT_REQUESTS"`
+	MaxIdleConnections             int `hcl:"max_idle_connections,optional" env:"TARGET_HTTP_MAX_IDLE_CONNECTIONS"`
+	IdleConnectionTimeoutInSeconds int `hcl:"idle_connection_timeout_in_seconds,optional" env:"TARGET_HTTP_IDLE_CONNECTION_TIMEOUT_IN_SECONDS"`
+
+	OAuth2ClientID     string   `hcl:"oauth2_client_id,optional" env:"TARGET_HTTP_OAUTH2_CLIENT_ID"`
+	OAuth2ClientSecret string   `hcl:"oauth2_client_secret,optional" env:"TARGET_HTTP_OAUTH2_CLIENT_SECRET"`
+	OAuth2TokenURL     string   `hcl:"oauth2_token_url,optional" env:"TARGET_HTTP_OAUTH2_TOKEN_URL"`
+	OAuth2Scopes       []string `hcl:"oauth2_scopes,optional" env:"TARGET_HTTP_OAUTH2_SCOPES"`
+
+	BodyTemplate string `hcl:"body_template,optional" env:"TARGET_HTTP_BODY_TEMPLATE"`
+
+	ResponseRules []*HTTPResponseRule `hcl:"response_rule,block"`
+}
+
+// Supported formats for the body of batched requests
+const (
+	batchFormatJSON   = "json"
+	batchFormatNDJSON = "ndjson"
+)
+
+// HTTPResponseRule maps response status codes to how the message that was sent is handled.
+// Codes are given either as single codes, eg. "400", or as inclusive ranges, eg. "500-599".
+// Result is one of "success", "retry" or "invalid".
+type HTTPResponseRule struct {
+	Codes  []string `hcl:"codes"`
+	Result string   `hcl:"result"`
+}
+
+// responseResult is the outcome of a request, as decided by the response rules
+type responseResult int
+
+const (
+	responseSuccess responseResult = iota
+	responseRetry
+	responseInvalid
+)
+
+// maxResponseBodyBytes caps how much of a response body is attached to an invalid message
+const maxResponseBodyBytes = 4096
+
+// maxDrainBodyBytes caps how much of an unread response body is drained so that its connection
+// can be reused. Larger bodies are left unread, and the connection closed instead.
+const maxDrainBodyBytes = 65536
+
+// responseRule is a parsed HTTPResponseRule for a single code range
+type responseRule struct {
+	from   int
+	to     int
+	result responseResult
 }
 
 // HTTPTarget holds a new client for writing messages to HTTP endpoints
@@ -47,6 +108,15 @@ type HTTPTarget struct {
 	headers           map[string]string
 	basicAuthUsername string
 	basicAuthPassword string
+	responseRules     []responseRule
+	batchMaxMessages  int
+	batchByteLimit    int
+	batchFormat       string
+	maxConcurrency    int
+	oauth2            *oauth2Tokens
+	urlTemplate       *template.Template
+	headerTemplates   map[string]*template.Template
+	bodyTemplate      *template.Template
 	log               *log.Entry
 }
 
@@ -76,6 +146,83 @@ func getHeaders(headers string) (map[string]string, error) {
 	return parsed, nil
 }
 
+// parseResponseRules validates the configured response rules, splitting each one into its code ranges
+func parseResponseRules(rules []*HTTPResponseRule) ([]responseRule, error) {
+	var parsed []responseRule
+
+	for _, rule := range rules {
+		var result responseResult
+		switch rule.Result {
+		case "success":
+			result = responseSuccess
+		case "retry":
+			result = responseRetry
+		case "invalid":
+			result = responseInvalid
+		default:
+			return nil, errors.New(fmt.Sprintf("Invalid response rule result '%s', must be one of 'success', 'retry' or 'invalid'", rule.Result))
+		}
+
+		if len(rule.Codes) == 0 {
+			return nil, errors.New(fmt.Sprintf("Response rule with result '%s' has no codes", rule.Result))
+		}
+
+		for _, code := range rule.Codes {
+			from, to, err := parseCodeRange(code)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, responseRule{from: from, to: to, result: result})
+		}
+	}
+
+	return parsed, nil
+}
+
+// parseCodeRange parses a single code, eg. "404", or an inclusive range, eg. "400-499"
+func parseCodeRange(code string) (int, int, error) {
+	bounds := strings.SplitN(code, "-", 2)
+
+	from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, errors.Wrap(err, fmt.Sprintf("Invalid response rule code '%s'", code))
+	}
+	to := from
+	if len(bounds) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if err != nil {
+			return 0, 0, errors.Wrap(err, fmt.Sprintf("Invalid response rule code '%s'", code))
+		}
+	}
+
+	if from < 100 || to > 599 || from > to {
+		return 0, 0, errors.New(fmt.Sprintf("Invalid response rule code '%s', codes must be between 100 and 599", code))
+	}
+	return from, to, nil
+}
+
+// classifyResponse returns the result of the first rule matching the status code.
+// When no rule matches, any 2xx status is a success and everything else is retried.
+func (ht *HTTPTarget) classifyResponse(statusCode int) responseResult {
+	for _, rule := range ht.responseRules {
+		if statusCode >= rule.from && statusCode <= rule.to {
+			return rule.result
+		}
+	}
+
+	if statusCode >= 200 && statusCode < 300 {
+		return responseSuccess
+	}
+	return responseRetry
+}
+
+// drainAndClose reads what is left of a response body before closing it, which allows the
+// transport to reuse the connection for another request
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainBodyBytes))
+	body.Close()
+}
+
 func addHeadersToRequest(request *http.Request, headers map[string]string) {
 	if headers == nil {
 		return
@@ -89,8 +236,19 @@ func addHeadersToRequest(request *http.Request, headers map[string]string) {
 
 // newHTTPTarget creates a client for writing events to HTTP
 func newHTTPTarget(httpURL string, requestTimeout int, byteLimit int, contentType string, headers string, basicAuthUsername string, basicAuthPassword string,
-	certFile string, keyFile string, caFile string, skipVerifyTLS bool) (*HTTPTarget, error) {
-	err := checkURL(httpURL)
+	certFile string, keyFile string, caFile string, skipVerifyTLS bool, responseRules []*HTTPResponseRule,
+	batchMaxMessages int, batchByteLimit int, batchFormat string,
+	maxConcurrentRequests int, maxIdleConnections int, idleConnectionTimeout int,
+	oauth2ClientID string, oauth2ClientSecret string, oauth2TokenURL string, oauth2Scopes []string,
+	bodyTemplate string) (*HTTPTarget, error) {
+	// The url and header values are templates if they contain any template actions
+	var urlTmpl *template.Template
+	var err error
+	if hasTemplateActions(httpURL) {
+		urlTmpl, err = parseTemplate("url", httpURL)
+	} else {
+		err = checkURL(httpURL)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +256,49 @@ func newHTTPTarget(httpURL string, requestTimeout int, byteLimit int, contentTyp
 	if err1 != nil {
 		return nil, err1
 	}
-	transport := &http.Transport{}
+	var headerTmpls map[string]*template.Template
+	for key, value := range parsedHeaders {
+		if !hasTemplateActions(value) {
+			continue
+		}
+		if headerTmpls == nil {
+			headerTmpls = make(map[string]*template.Template)
+		}
+		headerTmpls[key], err = parseTemplate("header "+key, value)
+		if err != nil {
+			return nil, err
+		}
+		delete(parsedHeaders, key)
+	}
+	var bodyTmpl *template.Template
+	if bodyTemplate != "" {
+		bodyTmpl, err = parseTemplate("body", bodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if (urlTmpl != nil || headerTmpls != nil) && batchMaxMessages > 1 {
+		return nil, errors.New("URL and header templates cannot be used when batching requests, as every message in a batch is sent in the same request")
+	}
+	parsedRules, err3 := parseResponseRules(responseRules)
+	if err3 != nil {
+		return nil, err3
+	}
+	if batchFormat != batchFormatJSON && batchFormat != batchFormatNDJSON {
+		return nil, errors.New(fmt.Sprintf("Invalid batch format '%s', must be one of '%s' or '%s'", batchFormat, batchFormatJSON, batchFormatNDJSON))
+	}
+	if batchMaxMessages < 1 {
+		batchMaxMessages = 1
+	}
+	if maxConcurrentRequests < 1 {
+		maxConcurrentRequests = 1
+	}
+	// Every request goes to the same host, so all idle connections may be kept for it
+	transport := &http.Transport{
+		MaxIdleConns:        maxIdleConnections,
+		MaxIdleConnsPerHost: maxIdleConnections,
+		IdleConnTimeout:     time.Duration(idleConnectionTimeout) * time.Second,
+	}
 
 	tlsConfig, err2 := common.CreateTLSConfiguration(certFile, keyFile, caFile, skipVerifyTLS)
 	if err2 != nil {
@@ -108,17 +308,36 @@ func newHTTPTarget(httpURL string, requestTimeout int, byteLimit int, contentTyp
 		transport.TLSClientConfig = tlsConfig
 	}
 
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(requestTimeout) * time.Second,
+	}
+
+	var tokens *oauth2Tokens
+	if oauth2ClientID != "" || oauth2ClientSecret != "" || oauth2TokenURL != "" {
+		tokens, err = newOAuth2Tokens(oauth2ClientID, oauth2ClientSecret, oauth2TokenURL, oauth2Scopes, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &HTTPTarget{
-		client: &http.Client{
-			Transport: transport,
-			Timeout:   time.Duration(requestTimeout) * time.Second,
-		},
+		client:            client,
 		httpURL:           httpURL,
 		byteLimit:         byteLimit,
 		contentType:       contentType,
 		headers:           parsedHeaders,
 		basicAuthUsername: basicAuthUsername,
 		basicAuthPassword: basicAuthPassword,
+		responseRules:     parsedRules,
+		batchMaxMessages:  batchMaxMessages,
+		batchByteLimit:    batchByteLimit,
+		batchFormat:       batchFormat,
+		maxConcurrency:    maxConcurrentRequests,
+		oauth2:            tokens,
+		urlTemplate:       urlTmpl,
+		headerTemplates:   headerTmpls,
+		bodyTemplate:      bodyTmpl,
 		log:               log.WithFields(log.Fields{"target": "http", "url": httpURL}),
 	}, nil
 }
@@ -137,6 +356,18 @@ func HTTPTargetConfigFunction(c *HTTPTargetConfig) (*HTTPTarget, error) {
 		c.KeyFile,
 		c.CaFile,
 		c.SkipVerifyTLS,
+		c.ResponseRules,
+		c.BatchMaxMessages,
+		c.BatchByteLimit,
+		c.BatchFormat,
+		c.MaxConcurrentRequests,
+		c.MaxIdleConnections,
+		c.IdleConnectionTimeoutInSeconds,
+		c.OAuth2ClientID,
+		c.OAuth2ClientSecret,
+		c.OAuth2TokenURL,
+		c.OAuth2Scopes,
+		c.BodyTemplate,
 	)
 }
 
@@ -154,9 +385,15 @@ func (f HTTPTargetAdapter) ProvideDefault() (interface{}, error) {
 	// Provide defaults for the optional parameters
 	// whose default is not their zero value.
 	cfg := &HTTPTargetConfig{
-		ByteLimit:               1048576,
-		RequestTimeoutInSeconds: 5,
-		ContentType:             "application/json",
+		ByteLimit:                      1048576,
+		RequestTimeoutInSeconds:        5,
+		ContentType:                    "application/json",
+		BatchMaxMessages:               1,
+		BatchByteLimit:                 1048576,
+		BatchFormat:                    "json",
+		MaxConcurrentRequests:          1,
+		MaxIdleConnections:             100,
+		IdleConnectionTimeoutInSeconds: 90,
 	}
 
 	return cfg, nil
@@ -177,64 +414,254 @@ func AdaptHTTPTargetFunc(f func(c *HTTPTargetConfig) (*HTTPTarget, error)) HTTPT
 func (ht *HTTPTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
 	ht.log.Debugf("Writing %d messages to endpoint ...", len(messages))
 
-	safeMessages, oversized := models.FilterOversizedMessages(
+	chunks, oversized := models.GetChunkedMessages(
 		messages,
+		ht.batchMaxMessages,
 		ht.MaximumAllowedMessageSizeBytes(),
+		ht.batchByteLimit,
 	)
 
+	// Requests are made by a bounded pool of workers, with each result stored at the index of its chunk
+	results := make([]httpRequestResult, len(chunks))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < ht.maxConcurrency && w < len(chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := &results[i]
+				r.sent, r.failed, r.invalid, r.err = ht.send(chunks[i])
+			}
+		}()
+	}
+	for i := range chunks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
 	var invalid []*models.Message
 	var failed []*models.Message
 	var sent []*models.Message
 	var errResult error
 
-	for _, msg := range safeMessages {
+	for _, r := range results {
+		if r.err != nil {
+			errResult = multierror.Append(errResult, r.err)
+		}
+		sent = append(sent, r.sent...)
+		failed = append(failed, r.failed...)
+		invalid = append(invalid, r.invalid...)
+	}
+	if errResult != nil {
+		errResult = errors.Wrap(errResult, "Error sending http requests")
+	}
 
-		request, err := http.NewRequest("POST", ht.httpURL, bytes.NewBuffer(msg.Data))
+	ht.log.Debugf("Successfully wrote %d/%d messages", len(sent), len(messages))
+	return models.NewTargetWriteResult(
+		sent,
+		failed,
+		oversized,
+		invalid,
+	), errResult
+}
+
+// httpRequestResult holds the outcome of a single request
+type httpRequestResult struct {
+	sent    []*models.Message
+	failed  []*models.Message
+	invalid []*models.Message
+	err     error
+}
+
+// send makes a single request for a chunk of messages, returning the messages split by the outcome
+func (ht *HTTPTarget) send(chunk []*models.Message) (sent []*models.Message, failed []*models.Message, invalid []*models.Message, err error) {
+	req, included, invalid := ht.buildRequest(chunk)
+	if len(included) == 0 {
+		return nil, nil, invalid, nil
+	}
+
+	requestStarted := time.Now()
+	resp, err := ht.do(req)
+	requestFinished := time.Now()
+
+	for _, msg := range included {
+		msg.TimeRequestStarted = requestStarted
+		msg.TimeRequestFinished = requestFinished
+	}
+
+	if err != nil {
+		return nil, included, invalid, err
+	}
+	defer drainAndClose(resp.Body)
+
+	switch ht.classifyResponse(resp.StatusCode) {
+	case responseSuccess:
+		for _, msg := range included {
+			if msg.AckFunc != nil { // Ack successful messages
+				msg.AckFunc()
+			}
+		}
+		return included, nil, invalid, nil
+	case responseInvalid:
+		// Invalid messages will never succeed, so they go to the failure target along with the response
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+		for _, msg := range included {
+			msg.SetError(errors.New(fmt.Sprintf("Got response status: %s, body: %s", resp.Status, string(respBody))))
+		}
+		return nil, nil, append(invalid, included...), nil
+	default:
+		return nil, included, invalid, errors.New("Got response status: " + resp.Status)
+	}
+}
+
+// httpRequest holds the rendered parts of a single request
+type httpRequest struct {
+	url     string
+	headers map[string]string
+	body    []byte
+}
+
+// buildRequest renders the request for a chunk of messages. Messages whose templates fail to render
+// are returned as invalid, as are messages which cannot be combined into the body of a batched request.
+func (ht *HTTPTarget) buildRequest(chunk []*models.Message) (req *httpRequest, included []*models.Message, invalid []*models.Message) {
+	req = &httpRequest{url: ht.httpURL, headers: ht.headers}
+
+	var rendered []*models.Message
+	var bodies [][]byte
+	for _, msg := range chunk {
+		body, err := ht.renderMessage(msg, req)
 		if err != nil {
-			errResult = multierror.Append(errResult, errors.Wrap(err, "Error creating request"))
-			failed = append(failed, msg)
+			msg.SetError(err)
+			invalid = append(invalid, msg)
 			continue
 		}
+		rendered = append(rendered, msg)
+		bodies = append(bodies, body)
+	}
+	if len(rendered) == 0 {
+		return req, nil, invalid
+	}
+
+	body, included, notCombined := ht.requestBody(rendered, bodies)
+	req.body = body
+	return req, included, append(invalid, notCombined...)
+}
+
+// renderMessage renders the templates for a message, returning its body. URL and header templates
+// are only allowed without batching, so they are rendered into the request of the single message.
+func (ht *HTTPTarget) renderMessage(msg *models.Message, req *httpRequest) ([]byte, error) {
+	if ht.urlTemplate == nil && ht.headerTemplates == nil && ht.bodyTemplate == nil {
+		return msg.Data, nil
+	}
+	td := newTemplateData(msg)
+
+	if ht.urlTemplate != nil {
+		renderedURL, err := renderTemplate(ht.urlTemplate, td)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkURL(string(renderedURL)); err != nil {
+			return nil, err
+		}
+		req.url = string(renderedURL)
+	}
+
+	if ht.headerTemplates != nil {
+		headers := make(map[string]string, len(ht.headers)+len(ht.headerTemplates))
+		for key, value := range ht.headers {
+			headers[key] = value
+		}
+		for key, tmpl := range ht.headerTemplates {
+			value, err := renderTemplate(tmpl, td)
+			if err != nil {
+				return nil, err
+			}
+			headers[key] = string(value)
+		}
+		req.headers = headers
+	}
+
+	if ht.bodyTemplate != nil {
+		return renderTemplate(ht.bodyTemplate, td)
+	}
+	return msg.Data, nil
+}
+
+// do makes a request. When using OAuth2, a response of 401 Unauthorized means the token
+// was rejected, so a new token is requested and the request retried once.
+func (ht *HTTPTarget) do(req *httpRequest) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequest("POST", req.url, bytes.NewBuffer(req.body))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating request")
+		}
 		request.Header.Add("Content-Type", ht.contentType)            // Add content type
-		addHeadersToRequest(request, ht.headers)                      // Add headers if there are any
+		addHeadersToRequest(request, req.headers)                     // Add headers if there are any
 		if ht.basicAuthUsername != "" && ht.basicAuthPassword != "" { // Add basic auth if set
 			request.SetBasicAuth(ht.basicAuthUsername, ht.basicAuthPassword)
 		}
-		requestStarted := time.Now()
-		resp, err := ht.client.Do(request) // Make request
-		requestFinished := time.Now()
 
-		msg.TimeRequestStarted = requestStarted
-		msg.TimeRequestFinished = requestFinished
+		var token *oauth2.Token
+		if ht.oauth2 != nil { // Add bearer token if using OAuth2
+			token, err = ht.oauth2.token()
+			if err != nil {
+				return nil, err
+			}
+			token.SetAuthHeader(request)
+		}
 
-		if err != nil {
-			errResult = multierror.Append(errResult, err)
-			failed = append(failed, msg)
-			continue
+		resp, err := ht.client.Do(request) // Make request
+		if err != nil || token == nil || resp.StatusCode != http.StatusUnauthorized || attempt > 1 {
+			return resp, err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusOK {
-			sent = append(sent, msg)
-			if msg.AckFunc != nil { // Ack successful messages
-				msg.AckFunc()
+
+		ht.log.Warn("OAuth2 token was rejected, retrying with a new token")
+		drainAndClose(resp.Body)
+		ht.oauth2.discard(token)
+	}
+}
+
+// requestBody builds the body of a request from the bodies of its messages. Without batching the body
+// of the single message is sent as it is, otherwise the bodies are combined into a JSON array or into
+// newline delimited records. Messages which cannot be combined in the configured format are returned
+// as invalid, and left out of the body.
+func (ht *HTTPTarget) requestBody(chunk []*models.Message, bodies [][]byte) (body []byte, included []*models.Message, invalid []*models.Message) {
+	if ht.batchMaxMessages <= 1 {
+		return bodies[0], chunk, nil
+	}
+
+	var buf bytes.Buffer
+	if ht.batchFormat == batchFormatNDJSON {
+		for i, msg := range chunk {
+			if bytes.ContainsRune(bodies[i], '\n') {
+				msg.SetError(errors.New("Message body contains a newline, so cannot be sent in a newline delimited batch"))
+				invalid = append(invalid, msg)
+				continue
 			}
-		} else {
-			errResult = multierror.Append(errResult, errors.New("Got response status: "+resp.Status))
-			failed = append(failed, msg)
-			continue
+			buf.Write(bodies[i])
+			buf.WriteByte('\n')
+			included = append(included, msg)
 		}
-	}
-	if errResult != nil {
-		errResult = errors.Wrap(errResult, "Error sending http requests")
+		return buf.Bytes(), included, invalid
 	}
 
-	ht.log.Debugf("Successfully wrote %d/%d messages", len(sent), len(messages))
-	return models.NewTargetWriteResult(
-		sent,
-		failed,
-		oversized,
-		invalid,
-	), errResult
+	buf.WriteByte('[')
+	for i, msg := range chunk {
+		if !json.Valid(bodies[i]) {
+			msg.SetError(errors.New("Message body is not valid JSON, so cannot be sent in a JSON array batch"))
+			invalid = append(invalid, msg)
+			continue
+		}
+		if len(included) > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(bodies[i])
+		included = append(included, msg)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), included, invalid
 }
 
 // Open does nothing for this target
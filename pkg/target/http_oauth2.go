@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauth2Tokens provides bearer tokens obtained with the OAuth2 client credentials grant.
+//
+// Tokens are cached, and a new one is requested shortly before the cached token expires.
+// A token rejected by the endpoint can be discarded, so that the next request gets a new one.
+type oauth2Tokens struct {
+	config *clientcredentials.Config
+	ctx    context.Context
+
+	source oauth2.TokenSource
+	last   *oauth2.Token
+	mutex  sync.Mutex
+}
+
+// newOAuth2Tokens creates an oauth2Tokens which requests tokens using the given client
+func newOAuth2Tokens(clientID string, clientSecret string, tokenURL string, scopes []string, client *http.Client) (*oauth2Tokens, error) {
+	if clientID == "" || clientSecret == "" || tokenURL == "" {
+		return nil, errors.New("OAuth2 requires all of oauth2_client_id, oauth2_client_secret and oauth2_token_url to be set")
+	}
+	if err := checkURL(tokenURL); err != nil {
+		return nil, errors.Wrap(err, "Invalid OAuth2 token url")
+	}
+
+	config := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       scopes,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+
+	return &oauth2Tokens{
+		config: config,
+		ctx:    ctx,
+		source: config.TokenSource(ctx),
+	}, nil
+}
+
+// token returns a valid token, requesting a new one if there is no cached token or it is about to expire
+func (o *oauth2Tokens) token() (*oauth2.Token, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	token, err := o.source.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting OAuth2 token")
+	}
+	o.last = token
+	return token, nil
+}
+
+// discard drops the cached token if it is the one that was rejected, so that the next call to token
+// requests a new one. Requests which were rejected with an already replaced token don't trigger
+// another refresh.
+func (o *oauth2Tokens) discard(rejected *oauth2.Token) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.last != nil && o.last.AccessToken == rejected.AccessToken {
+		o.source = o.config.TokenSource(o.ctx)
+		o.last = nil
+	}
+}
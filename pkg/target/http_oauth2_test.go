@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/testutil"
+)
+
+// oauth2TestServers is a token server issuing numbered tokens, and an API server which only
+// accepts the token set as valid
+type oauth2TestServers struct {
+	tokenServer   *httptest.Server
+	apiServer     *httptest.Server
+	expiresIn     int
+	tokenRequests int64
+	apiRequests   int64
+
+	validToken string
+	mutex      sync.Mutex
+}
+
+func newOAuth2TestServers(t *testing.T, expiresIn int) *oauth2TestServers {
+	s := &oauth2TestServers{expiresIn: expiresIn, validToken: "token-1"}
+
+	s.tokenServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		clientID, clientSecret, _ := req.BasicAuth()
+		if req.Form.Get("grant_type") != "client_credentials" || clientID != "testClient" || clientSecret != "testSecret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "read write", req.Form.Get("scope"))
+
+		n := atomic.AddInt64(&s.tokenRequests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, s.expiresIn)
+	}))
+
+	s.apiServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&s.apiRequests, 1)
+		s.mutex.Lock()
+		valid := s.validToken
+		s.mutex.Unlock()
+		if valid != "" && req.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	return s
+}
+
+func (s *oauth2TestServers) setValidToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.validToken = token
+}
+
+func (s *oauth2TestServers) close() {
+	s.tokenServer.Close()
+	s.apiServer.Close()
+}
+
+func TestHttpWrite_OAuth2(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := newOAuth2TestServers(t, 3600)
+	defer servers.close()
+
+	target, err := newHTTPTarget(servers.apiServer.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90,
+		"testClient", "testSecret", servers.tokenServer.URL, []string{"read", "write"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	// The token is requested once and then reused
+	writeResult, err1 := target.Write(testutil.GetTestMessages(5, "Hello Server!!", ackFunc))
+	assert.Nil(err1)
+	assert.Equal(5, len(writeResult.Sent))
+	assert.Equal(int64(1), atomic.LoadInt64(&servers.tokenRequests))
+	assert.Equal(int64(5), atomic.LoadInt64(&servers.apiRequests))
+
+	// Once the token is rejected, a new one is requested and the request retried
+	servers.setValidToken("token-2")
+	writeResult2, err2 := target.Write(testutil.GetTestMessages(5, "Hello Server!!", ackFunc))
+	assert.Nil(err2)
+	assert.Equal(5, len(writeResult2.Sent))
+	assert.Equal(int64(2), atomic.LoadInt64(&servers.tokenRequests))
+	assert.Equal(int64(11), atomic.LoadInt64(&servers.apiRequests))
+	assert.Equal(int64(10), ackOps)
+
+	// A request is only retried once when the new token is rejected too
+	servers.setValidToken("never-issued")
+	writeResult3, err3 := target.Write(testutil.GetTestMessages(1, "Hello Server!!", ackFunc))
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Regexp("Got response status: 401 Unauthorized", err3.Error())
+	}
+	assert.Equal(1, len(writeResult3.Failed))
+	assert.Equal(int64(3), atomic.LoadInt64(&servers.tokenRequests))
+	assert.Equal(int64(13), atomic.LoadInt64(&servers.apiRequests))
+	assert.Equal(int64(10), ackOps)
+}
+
+func TestHttpWrite_OAuth2RefreshesBeforeExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	// Tokens which are about to expire are refreshed, so a short lived token is replaced for every request
+	servers := newOAuth2TestServers(t, 5)
+	servers.setValidToken("")
+	defer servers.close()
+
+	target, err := newHTTPTarget(servers.apiServer.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90,
+		"testClient", "testSecret", servers.tokenServer.URL, []string{"read", "write"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeResult, err1 := target.Write(testutil.GetTestMessages(3, "Hello Server!!", nil))
+	assert.Nil(err1)
+	assert.Equal(3, len(writeResult.Sent))
+	assert.Equal(int64(3), atomic.LoadInt64(&servers.tokenRequests))
+}
+
+func TestHttpWrite_OAuth2TokenFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := newOAuth2TestServers(t, 3600)
+	defer servers.close()
+
+	target, err := newHTTPTarget(servers.apiServer.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90,
+		"testClient", "wrongSecret", servers.tokenServer.URL, []string{"read", "write"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeResult, err1 := target.Write(testutil.GetTestMessages(2, "Hello Server!!", nil))
+	assert.NotNil(err1)
+	if err1 != nil {
+		assert.Regexp("Error getting OAuth2 token", err1.Error())
+	}
+	assert.Equal(2, len(writeResult.Failed))
+	assert.Equal(int64(0), atomic.LoadInt64(&servers.apiRequests))
+}
+
+func TestNewHTTPTarget_OAuth2Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90,
+		"testClient", "", "http://something/token", nil, "")
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("OAuth2 requires all of oauth2_client_id, oauth2_client_secret and oauth2_token_url to be set", err.Error())
+	}
+
+	target2, err2 := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90,
+		"testClient", "testSecret", "token", nil, "")
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("Invalid OAuth2 token url: Invalid url for HTTP target: 'token'", err2.Error())
+	}
+}
@@ -0,0 +1,147 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// templateTestRequest is what the test server received in a request
+type templateTestRequest struct {
+	path      string
+	partition string
+	static    string
+	token     string
+	body      string
+}
+
+func createTemplateTestServer(results *[]templateTestRequest) *httptest.Server {
+	mutex := &sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			panic(err)
+		}
+		mutex.Lock()
+		*results = append(*results, templateTestRequest{
+			path:      req.URL.Path,
+			partition: req.Header.Get("X-Partition"),
+			static:    req.Header.Get("X-Static"),
+			token:     req.Header.Get("X-Token"),
+			body:      string(data),
+		})
+		mutex.Unlock()
+	}))
+}
+
+func TestNewHTTPTarget_Templates(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newHTTPTarget("http://something/{{ .Data.app_id", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Error parsing url template: .*", err.Error())
+	}
+
+	target2, err2 := newHTTPTarget("http://something", 5, 1048576, "application/json", `{"X-App":"{{ .Data.app_id }}"}`, "", "", "", "", "", true, nil, 10, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("URL and header templates cannot be used when batching requests, as every message in a batch is sent in the same request", err2.Error())
+	}
+
+	target3, err3 := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 10, 1048576, "json", 1, 100, 90, "", "", "", nil, `{{ .Data.app_id }`)
+	assert.Nil(target3)
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Regexp("Error parsing body template: .*", err3.Error())
+	}
+}
+
+func TestHttpWrite_Templates(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("TEST_TOKEN", "secret")
+
+	var results []templateTestRequest
+	server := createTemplateTestServer(&results)
+	defer server.Close()
+
+	headers := `{"X-Partition":"{{ .PartitionKey }}","X-Static":"static","X-Token":"{{ env \"TEST_TOKEN\" }}"}`
+	body := `{"event":{{ json .Data.event }},"app":"{{ .Data.app_id }}"}`
+	target, err := newHTTPTarget(server.URL+"/apps/{{ .Data.app_id }}", 5, 1048576, "application/json", headers, "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte(`{"app_id":"app1","event":{"name":"page_view"}}`), PartitionKey: "pk1", AckFunc: ackFunc},
+		{Data: []byte(`{"app_id":"app2","event":{"name":"page_ping"}}`), PartitionKey: "pk2", AckFunc: ackFunc},
+		{Data: []byte(`{"event":{"name":"page_ping"}}`), PartitionKey: "pk3", AckFunc: ackFunc},
+		{Data: []byte("not json"), PartitionKey: "pk4", AckFunc: ackFunc},
+	}
+
+	writeResult, err1 := target.Write(messages)
+
+	assert.Nil(err1)
+	assert.Equal(2, len(writeResult.Sent))
+	assert.Equal(2, len(writeResult.Invalid))
+	assert.Equal(int64(2), ackOps)
+	for _, msg := range writeResult.Invalid {
+		assert.Regexp("Error rendering url template: .*", msg.GetError().Error())
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].path < results[j].path })
+	assert.Equal([]templateTestRequest{
+		{path: "/apps/app1", partition: "pk1", static: "static", token: "secret", body: `{"event":{"name":"page_view"},"app":"app1"}`},
+		{path: "/apps/app2", partition: "pk2", static: "static", token: "secret", body: `{"event":{"name":"page_ping"},"app":"app2"}`},
+	}, results)
+}
+
+func TestHttpWrite_BatchedBodyTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	var results []templateTestRequest
+	server := createTemplateTestServer(&results)
+	defer server.Close()
+
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 10, 1048576, "json", 1, 100, 90, "", "", "", nil, `{"name":{{ json .Data.event.name }}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte(`{"event":{"name":"page_view"}}`)},
+		{Data: []byte(`{"event":{"name":"page_ping"}}`)},
+		{Data: []byte(`{"event":{}}`)},
+	}
+
+	writeResult, err1 := target.Write(messages)
+
+	assert.Nil(err1)
+	assert.Equal(2, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Equal(1, len(results))
+	assert.Equal(`[{"name":"page_view"},{"name":"page_ping"}]`, results[0].body)
+}
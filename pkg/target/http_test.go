@@ -11,11 +11,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -119,12 +122,12 @@ func TestAddHeadersToRequest(t *testing.T) {
 func TestNewHTTPTarget(t *testing.T) {
 	assert := assert.New(t)
 
-	httpTarget, err := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	httpTarget, err := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 
 	assert.Nil(err)
 	assert.NotNil(httpTarget)
 
-	failedHTTPTarget, err1 := newHTTPTarget("something", 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	failedHTTPTarget, err1 := newHTTPTarget("something", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 
 	assert.NotNil(err1)
 	if err1 != nil {
@@ -132,12 +135,19 @@ func TestNewHTTPTarget(t *testing.T) {
 	}
 	assert.Nil(failedHTTPTarget)
 
-	failedHTTPTarget2, err2 := newHTTPTarget("", 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	failedHTTPTarget2, err2 := newHTTPTarget("", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 	assert.NotNil(err2)
 	if err2 != nil {
 		assert.Equal("Invalid url for HTTP target: ''", err2.Error())
 	}
 	assert.Nil(failedHTTPTarget2)
+
+	failedHTTPTarget3, err3 := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 10, 1048576, "xml", 1, 100, 90, "", "", "", nil, "")
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Equal("Invalid batch format 'xml', must be one of 'json' or 'ndjson'", err3.Error())
+	}
+	assert.Nil(failedHTTPTarget3)
 }
 
 func TestHttpWrite_Simple(t *testing.T) {
@@ -148,7 +158,7 @@ func TestHttpWrite_Simple(t *testing.T) {
 	server := createTestServer(&results, &wg)
 	defer server.Close()
 
-	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -182,7 +192,7 @@ func TestHttpWrite_Concurrent(t *testing.T) {
 	server := createTestServer(&results, &wg)
 	defer server.Close()
 
-	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -225,7 +235,7 @@ func TestHttpWrite_Failure(t *testing.T) {
 	server := createTestServer(&results, &wg)
 	defer server.Close()
 
-	target, err := newHTTPTarget("http://NonexistentEndpoint", 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	target, err := newHTTPTarget("http://NonexistentEndpoint", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -257,7 +267,7 @@ func TestHttpWrite_Oversized(t *testing.T) {
 	server := createTestServer(&results, &wg)
 	defer server.Close()
 
-	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true)
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -286,6 +296,290 @@ func TestHttpWrite_Oversized(t *testing.T) {
 	assert.Equal(int64(10), ackOps)
 }
 
+func TestHttpWrite_BatchedJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	var results [][]byte
+	wg := sync.WaitGroup{}
+	server := createTestServer(&results, &wg)
+	defer server.Close()
+
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 10, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(25, `{"hello":"server"}`, ackFunc)
+	messages = append(messages, testutil.GetTestMessages(1, "not json", ackFunc)...)
+
+	wg.Add(3)
+	writeResult, err1 := target.Write(messages)
+
+	wg.Wait()
+
+	assert.Nil(err1)
+	assert.Equal(25, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Equal(3, len(results))
+
+	var received int
+	for _, result := range results {
+		var batch []map[string]string
+		assert.Nil(json.Unmarshal(result, &batch))
+		for _, event := range batch {
+			assert.Equal("server", event["hello"])
+		}
+		received += len(batch)
+	}
+	assert.Equal(25, received)
+	assert.Equal(int64(25), ackOps)
+}
+
+func TestHttpWrite_BatchedNDJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	var results [][]byte
+	wg := sync.WaitGroup{}
+	server := createTestServer(&results, &wg)
+	defer server.Close()
+
+	// Each message is 14 bytes, so 3 fit within the byte limit of a request
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/x-ndjson", "", "", "", "", "", "", true, nil, 10, 45, "ndjson", 1, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(9, "Hello Server!!", ackFunc)
+
+	wg.Add(3)
+	writeResult, err1 := target.Write(messages)
+
+	wg.Wait()
+
+	assert.Nil(err1)
+	assert.Equal(9, len(writeResult.Sent))
+	assert.Equal(3, len(results))
+	for _, result := range results {
+		assert.Equal("Hello Server!!\nHello Server!!\nHello Server!!\n", string(result))
+	}
+	assert.Equal(int64(9), ackOps)
+}
+
+func TestHttpWrite_BatchedFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newHTTPTarget("http://NonexistentEndpoint", 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 4, 1048576, "ndjson", 1, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(10, "Hello Server!!", ackFunc)
+
+	writeResult, err1 := target.Write(messages)
+
+	// Every message in a failed request is reported as failed
+	assert.NotNil(err1)
+	if err1 != nil {
+		assert.Regexp("Error sending http requests: 3 errors occurred:.*", err1.Error())
+	}
+	assert.Equal(10, len(writeResult.Failed))
+	assert.Nil(writeResult.Sent)
+	assert.Equal(int64(0), ackOps)
+}
+
+func TestHttpWrite_MaxConcurrentRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	var inFlight int64
+	var maxInFlight int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		current := atomic.AddInt64(&inFlight, 1)
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt64(&inFlight, -1)
+	}))
+	defer server.Close()
+
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 5, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(50, "Hello Server!!", ackFunc)
+	writeResult, err1 := target.Write(messages)
+
+	assert.Nil(err1)
+	assert.Equal(50, len(writeResult.Sent))
+	assert.Equal(int64(50), ackOps)
+	assert.True(atomic.LoadInt64(&maxInFlight) > 1)
+	assert.True(atomic.LoadInt64(&maxInFlight) <= 5)
+	for _, msg := range writeResult.Sent {
+		assert.False(msg.TimeRequestStarted.IsZero())
+		assert.True(msg.TimeRequestFinished.After(msg.TimeRequestStarted))
+	}
+}
+
+func TestHttpWrite_ReusesConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	// Responses have bodies which the target doesn't need, so they must be drained for the connection to be reused
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 10000))
+	}))
+	var connections int64
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, nil, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := testutil.GetTestMessages(20, "Hello Server!!", nil)
+	writeResult, err1 := target.Write(messages)
+
+	assert.Nil(err1)
+	assert.Equal(20, len(writeResult.Sent))
+	assert.Equal(int64(1), atomic.LoadInt64(&connections))
+}
+
+func TestParseResponseRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := parseResponseRules([]*HTTPResponseRule{
+		{Codes: []string{"400", "409-422"}, Result: "invalid"},
+		{Codes: []string{"300-399"}, Result: "success"},
+		{Codes: []string{"200"}, Result: "retry"},
+	})
+	assert.Nil(err)
+	assert.Equal([]responseRule{
+		{from: 400, to: 400, result: responseInvalid},
+		{from: 409, to: 422, result: responseInvalid},
+		{from: 300, to: 399, result: responseSuccess},
+		{from: 200, to: 200, result: responseRetry},
+	}, rules)
+
+	_, err1 := parseResponseRules([]*HTTPResponseRule{{Codes: []string{"400"}, Result: "drop"}})
+	assert.NotNil(err1)
+	if err1 != nil {
+		assert.Equal("Invalid response rule result 'drop', must be one of 'success', 'retry' or 'invalid'", err1.Error())
+	}
+
+	_, err2 := parseResponseRules([]*HTTPResponseRule{{Codes: []string{"499-400"}, Result: "invalid"}})
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("Invalid response rule code '499-400', codes must be between 100 and 599", err2.Error())
+	}
+
+	_, err3 := parseResponseRules([]*HTTPResponseRule{{Codes: []string{"4xx"}, Result: "invalid"}})
+	assert.NotNil(err3)
+
+	_, err4 := parseResponseRules([]*HTTPResponseRule{{Result: "invalid"}})
+	assert.NotNil(err4)
+}
+
+func TestClassifyResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newHTTPTarget("http://something", 5, 1048576, "application/json", "", "", "", "", "", "", true, []*HTTPResponseRule{
+		{Codes: []string{"404"}, Result: "success"},
+		{Codes: []string{"400-499"}, Result: "invalid"},
+	}, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(responseSuccess, target.classifyResponse(200))
+	assert.Equal(responseSuccess, target.classifyResponse(204))
+	assert.Equal(responseSuccess, target.classifyResponse(404))
+	assert.Equal(responseInvalid, target.classifyResponse(400))
+	assert.Equal(responseInvalid, target.classifyResponse(422))
+	assert.Equal(responseRetry, target.classifyResponse(302))
+	assert.Equal(responseRetry, target.classifyResponse(503))
+}
+
+func TestHttpWrite_ResponseRules(t *testing.T) {
+	assert := assert.New(t)
+
+	// The server responds with the status code given in the request body
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			panic(err)
+		}
+		code, err := strconv.Atoi(string(data))
+		if err != nil {
+			panic(err)
+		}
+		w.WriteHeader(code)
+		w.Write([]byte("response for " + string(data)))
+	}))
+	defer server.Close()
+
+	target, err := newHTTPTarget(server.URL, 5, 1048576, "application/json", "", "", "", "", "", "", true, []*HTTPResponseRule{
+		{Codes: []string{"400-499"}, Result: "invalid"},
+	}, 1, 1048576, "json", 1, 100, 90, "", "", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	var messages []*models.Message
+	for _, code := range []string{"200", "201", "204", "400", "422", "500", "503"} {
+		messages = append(messages, testutil.GetTestMessages(1, code, ackFunc)...)
+	}
+
+	writeResult, err1 := target.Write(messages)
+
+	assert.NotNil(err1)
+	if err1 != nil {
+		assert.Regexp("Error sending http requests: 2 errors occurred:.*", err1.Error())
+	}
+	assert.Equal(3, len(writeResult.Sent))
+	assert.Equal(2, len(writeResult.Failed))
+	assert.Equal(2, len(writeResult.Invalid))
+	assert.Equal(int64(3), ackOps)
+
+	for _, msg := range writeResult.Invalid {
+		assert.Regexp("Got response status: 4.. .*, body: response for 4..", msg.GetError().Error())
+	}
+}
+
 // Steps to create certs manually:
 
 // openssl genrsa -out rootCA.key 4096
@@ -312,7 +606,19 @@ func TestHttpWrite_TLS(t *testing.T) {
 		string(`../../integration/http/localhost.crt`),
 		string(`../../integration/http/localhost.key`),
 		string(`../../integration/http/rootCA.crt`),
-		false)
+		false,
+		nil,
+		1,
+		1048576,
+		"json",
+		1,
+		100,
+		90,
+		"",
+		"",
+		"",
+		nil,
+		"")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -344,7 +650,19 @@ func TestHttpWrite_TLS(t *testing.T) {
 		string(`../../integration/http/localhost.crt`),
 		string(`../../integration/http/localhost.key`),
 		string(`../../integration/http/rootCA.crt`),
-		false)
+		false,
+		nil,
+		1,
+		1048576,
+		"json",
+		1,
+		100,
+		90,
+		"",
+		"",
+		"",
+		nil,
+		"")
 	if err2 != nil {
 		t.Fatal(err2)
 	}
@@ -369,7 +687,19 @@ func TestHttpWrite_TLS(t *testing.T) {
 		"",
 		"",
 		"",
-		false)
+		false,
+		nil,
+		1,
+		1048576,
+		"json",
+		1,
+		100,
+		90,
+		"",
+		"",
+		"",
+		nil,
+		"")
 	if err4 != nil {
 		t.Fatal(err4)
 	}
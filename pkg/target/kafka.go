@@ -8,18 +8,16 @@
 package target
 
 import (
-	"crypto/sha256"
-	"crypto/sha512"
 	"fmt"
-	"hash"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"github.com/xdg/scram"
 
 	"github.com/snowplow/snowbridge/pkg/common"
 	"github.com/snowplow/snowbridge/pkg/models"
@@ -27,26 +25,31 @@ import (
 
 // KafkaConfig contains configurable options for the kafka target
 type KafkaConfig struct {
-	Brokers        string `hcl:"brokers" env:"TARGET_KAFKA_BROKERS"`
-	TopicName      string `hcl:"topic_name" env:"TARGET_KAFKA_TOPIC_NAME"`
-	TargetVersion  string `hcl:"target_version,optional" env:"TARGET_KAFKA_TARGET_VERSION"`
-	MaxRetries     int    `hcl:"max_retries,optional" env:"TARGET_KAFKA_MAX_RETRIES"`
-	ByteLimit      int    `hcl:"byte_limit,optional" env:"TARGET_KAFKA_BYTE_LIMIT"`
-	Compress       bool   `hcl:"compress,optional" env:"TARGET_KAFKA_COMPRESS"`
-	WaitForAll     bool   `hcl:"wait_for_all,optional" env:"TARGET_KAFKA_WAIT_FOR_ALL"`
-	Idempotent     bool   `hcl:"idempotent,optional" env:"TARGET_KAFKA_IDEMPOTENT"`
-	EnableSASL     bool   `hcl:"enable_sasl,optional" env:"TARGET_KAFKA_ENABLE_SASL"`
-	SASLUsername   string `hcl:"sasl_username,optional" env:"TARGET_KAFKA_SASL_USERNAME" `
-	SASLPassword   string `hcl:"sasl_password,optional" env:"TARGET_KAFKA_SASL_PASSWORD"`
-	SASLAlgorithm  string `hcl:"sasl_algorithm,optional" env:"TARGET_KAFKA_SASL_ALGORITHM"`
-	CertFile       string `hcl:"cert_file,optional" env:"TARGET_KAFKA_TLS_CERT_FILE"`
-	KeyFile        string `hcl:"key_file,optional" env:"TARGET_KAFKA_TLS_KEY_FILE"`
-	CaFile         string `hcl:"ca_file,optional" env:"TARGET_KAFKA_TLS_CA_FILE"`
-	SkipVerifyTLS  bool   `hcl:"skip_verify_tls,optional" env:"TARGET_KAFKA_TLS_SKIP_VERIFY_TLS"`
-	ForceSync      bool   `hcl:"force_sync_producer,optional" env:"TARGET_KAFKA_FORCE_SYNC_PRODUCER"`
-	FlushFrequency int    `hcl:"flush_frequency,optional" env:"TARGET_KAFKA_FLUSH_FREQUENCY"`
-	FlushMessages  int    `hcl:"flush_messages,optional" env:"TARGET_KAFKA_FLUSH_MESSAGES"`
-	FlushBytes     int    `hcl:"flush_bytes,optional" env:"TARGET_KAFKA_FLUSH_BYTES"`
+	Brokers          string `hcl:"brokers" env:"TARGET_KAFKA_BROKERS"`
+	TopicName        string `hcl:"topic_name" env:"TARGET_KAFKA_TOPIC_NAME"`
+	TargetVersion    string `hcl:"target_version,optional" env:"TARGET_KAFKA_TARGET_VERSION"`
+	MaxRetries       int    `hcl:"max_retries,optional" env:"TARGET_KAFKA_MAX_RETRIES"`
+	ByteLimit        int    `hcl:"byte_limit,optional" env:"TARGET_KAFKA_BYTE_LIMIT"`
+	CompressionCodec string `hcl:"compression_codec,optional" env:"TARGET_KAFKA_COMPRESSION_CODEC"`
+	// Deprecated: use CompressionCodec. Compress enables snappy compression when no compression codec is set.
+	Compress          bool   `hcl:"compress,optional" env:"TARGET_KAFKA_COMPRESS"`
+	WaitForAll        bool   `hcl:"wait_for_all,optional" env:"TARGET_KAFKA_WAIT_FOR_ALL"`
+	Idempotent        bool   `hcl:"idempotent,optional" env:"TARGET_KAFKA_IDEMPOTENT"`
+	EnableSASL        bool   `hcl:"enable_sasl,optional" env:"TARGET_KAFKA_ENABLE_SASL"`
+	SASLUsername      string `hcl:"sasl_username,optional" env:"TARGET_KAFKA_SASL_USERNAME" `
+	SASLPassword      string `hcl:"sasl_password,optional" env:"TARGET_KAFKA_SASL_PASSWORD"`
+	SASLAlgorithm     string `hcl:"sasl_algorithm,optional" env:"TARGET_KAFKA_SASL_ALGORITHM"`
+	CertFile          string `hcl:"cert_file,optional" env:"TARGET_KAFKA_TLS_CERT_FILE"`
+	KeyFile           string `hcl:"key_file,optional" env:"TARGET_KAFKA_TLS_KEY_FILE"`
+	CaFile            string `hcl:"ca_file,optional" env:"TARGET_KAFKA_TLS_CA_FILE"`
+	SkipVerifyTLS     bool   `hcl:"skip_verify_tls,optional" env:"TARGET_KAFKA_TLS_SKIP_VERIFY_TLS"`
+	ForceSync         bool   `hcl:"force_sync_producer,optional" env:"TARGET_KAFKA_FORCE_SYNC_PRODUCER"`
+	FlushFrequency    int    `hcl:"flush_frequency,optional" env:"TARGET_KAFKA_FLUSH_FREQUENCY"`
+	FlushMessages     int    `hcl:"flush_messages,optional" env:"TARGET_KAFKA_FLUSH_MESSAGES"`
+	FlushBytes        int    `hcl:"flush_bytes,optional" env:"TARGET_KAFKA_FLUSH_BYTES"`
+	Headers           string `hcl:"headers,optional" env:"TARGET_KAFKA_HEADERS"`
+	Partitioner       string `hcl:"partitioner,optional" env:"TARGET_KAFKA_PARTITIONER"`
+	PartitionTemplate string `hcl:"partition_template,optional" env:"TARGET_KAFKA_PARTITION_TEMPLATE"`
 }
 
 // KafkaTarget holds a new client for writing messages to Apache Kafka
@@ -58,6 +61,11 @@ type KafkaTarget struct {
 	brokers          string
 	messageByteLimit int
 
+	// topicTemplate is set when the topic name is a template, rendered for every message
+	topicTemplate     *template.Template
+	headers           []*templatedValue
+	partitionTemplate *template.Template
+
 	log *log.Entry
 }
 
@@ -69,13 +77,52 @@ type saramaResult struct {
 
 // NewKafkaTarget creates a new client for writing messages to Apache Kafka
 func NewKafkaTarget(cfg *KafkaConfig) (*KafkaTarget, error) {
-	kafkaVersion, err := getKafkaVersion(cfg.TargetVersion)
+	kafkaVersion, err := common.GetKafkaVersion(cfg.TargetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err := getCompressionCodec(cfg.CompressionCodec, cfg.Compress)
 	if err != nil {
 		return nil, err
 	}
 
+	var topicTemplate *template.Template
+	if hasTemplateActions(cfg.TopicName) {
+		topicTemplate, err = parseTemplate("topic", cfg.TopicName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headers, err := getKafkaHeaders(cfg.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 && !kafkaVersion.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, errors.New(fmt.Sprintf("Record headers require Kafka version 0.11.0.0 or later, but target_version is %s", kafkaVersion))
+	}
+
+	partitioner, err := getPartitionerConstructor(cfg.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	// The manual partitioner uses the partition set on each record, which is rendered from the template
+	var partitionTemplate *template.Template
+	if cfg.Partitioner == "manual" {
+		if cfg.PartitionTemplate == "" {
+			return nil, errors.New("partition_template must be set when using the manual partitioner")
+		}
+		partitionTemplate, err = parseTemplate("partition", cfg.PartitionTemplate)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.PartitionTemplate != "" {
+		return nil, errors.New("partition_template can only be used with the manual partitioner")
+	}
+
 	logger := log.WithFields(log.Fields{"target": "kafka", "brokers": cfg.Brokers, "topic": cfg.TopicName, "version": kafkaVersion})
-	sarama.Logger = logger
 
 	saramaConfig := sarama.NewConfig()
 	saramaConfig.ClientID = "Snowbridge"
@@ -97,25 +144,13 @@ func NewKafkaTarget(cfg *KafkaConfig) (*KafkaTarget, error) {
 		saramaConfig.Net.MaxOpenRequests = 1
 	}
 
-	if cfg.Compress {
-		saramaConfig.Producer.Compression = sarama.CompressionSnappy // Compress messages
-	}
+	saramaConfig.Producer.Compression = compression
+	saramaConfig.Producer.Partitioner = partitioner
 
 	if cfg.EnableSASL {
-		saramaConfig.Net.SASL.Enable = true
-		saramaConfig.Net.SASL.User = cfg.SASLUsername
-		saramaConfig.Net.SASL.Password = cfg.SASLPassword
-		saramaConfig.Net.SASL.Handshake = true
-		if cfg.SASLAlgorithm == "sha512" {
-			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &xdgSCRAMClient{HashGeneratorFcn: SHA512} }
-			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		} else if cfg.SASLAlgorithm == "sha256" {
-			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &xdgSCRAMClient{HashGeneratorFcn: SHA256} }
-			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
-		} else if cfg.SASLAlgorithm == "plaintext" {
-			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
-		} else {
-			return nil, fmt.Errorf("invalid SHA algorithm \"%s\": can be either \"sha256\" or \"sha512\"", cfg.SASLAlgorithm)
+		err := common.ConfigureKafkaSASL(saramaConfig, cfg.SASLUsername, cfg.SASLPassword, cfg.SASLAlgorithm)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -168,16 +203,57 @@ func NewKafkaTarget(cfg *KafkaConfig) (*KafkaTarget, error) {
 	}
 
 	return &KafkaTarget{
-		syncProducer:     syncProducer,
-		asyncProducer:    asyncProducer,
-		asyncResults:     asyncResults,
-		brokers:          cfg.Brokers,
-		topicName:        cfg.TopicName,
-		messageByteLimit: cfg.ByteLimit,
-		log:              logger,
+		syncProducer:      syncProducer,
+		asyncProducer:     asyncProducer,
+		asyncResults:      asyncResults,
+		brokers:           cfg.Brokers,
+		topicName:         cfg.TopicName,
+		messageByteLimit:  cfg.ByteLimit,
+		topicTemplate:     topicTemplate,
+		headers:           headers,
+		partitionTemplate: partitionTemplate,
+		log:               logger,
 	}, producerError
 }
 
+// getCompressionCodec returns the codec used to compress batches of records. The deprecated compress
+// option enables snappy, as it did before codecs could be chosen, unless a codec is set.
+func getCompressionCodec(codec string, compress bool) (sarama.CompressionCodec, error) {
+	if compress && codec == "" {
+		log.Warn("The Kafka target option 'compress' is deprecated, use 'compression_codec = \"snappy\"' instead")
+		return sarama.CompressionSnappy, nil
+	}
+	if compress {
+		log.Warn("The Kafka target option 'compress' is deprecated and ignored when 'compression_codec' is set")
+	}
+
+	switch codec {
+	case "", "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return sarama.CompressionNone, errors.New(fmt.Sprintf("Invalid compression codec '%s', must be one of 'none', 'gzip', 'snappy', 'lz4' or 'zstd'", codec))
+	}
+}
+
+// getKafkaHeaders parses the headers, which are provided as a JSON object of header names to values.
+// Values containing template actions are rendered for every message.
+func getKafkaHeaders(headers string) ([]*templatedValue, error) {
+	parsed, err := getHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTemplatedValues("header", parsed)
+}
+
 // The KafkaTargetAdapter type is an adapter for functions to be used as
 // pluggable components for Kafka target. It implements the Pluggable interface.
 type KafkaTargetAdapter func(i interface{}) (interface{}, error)
@@ -195,6 +271,7 @@ func (f KafkaTargetAdapter) ProvideDefault() (interface{}, error) {
 		MaxRetries:    10,
 		ByteLimit:     1048576,
 		SASLAlgorithm: "sha512",
+		Partitioner:   "hash",
 	}
 
 	return cfg, nil
@@ -223,24 +300,36 @@ func (kt *KafkaTarget) Write(messages []*models.Message) (*models.TargetWriteRes
 
 	var sent []*models.Message
 	var failed []*models.Message
+	var invalid []*models.Message
 	var errResult error
 
+	// Messages whose topic or headers can't be rendered are invalid, as they never will be
+	var records []*sarama.ProducerMessage
+	for _, msg := range safeMessages {
+		record, err := kt.producerMessage(msg)
+		if err != nil {
+			msg.SetError(err)
+			invalid = append(invalid, msg)
+			continue
+		}
+		records = append(records, record)
+	}
+
 	if kt.asyncProducer != nil {
 		// Not adding request latency metric to async producer for now, since it would complicate the implementation, and delay our debug.
-		for _, msg := range safeMessages {
-			kt.asyncProducer.Input() <- &sarama.ProducerMessage{
-				Topic:    kt.topicName,
-				Key:      sarama.StringEncoder(msg.PartitionKey),
-				Value:    sarama.ByteEncoder(msg.Data),
-				Metadata: msg,
-			}
+		for _, record := range records {
+			kt.asyncProducer.Input() <- record
 		}
 
-		for i := 0; i < len(safeMessages); i++ {
+		for i := 0; i < len(records); i++ {
 
 			result := <-kt.asyncResults // Block until result is returned
 
-			if result.Err != nil {
+			if result.Err != nil && kt.isInvalidPartition(result.Err) {
+				originalMessage := result.Msg.Metadata.(*models.Message)
+				originalMessage.SetError(result.Err)
+				invalid = append(invalid, originalMessage)
+			} else if result.Err != nil {
 				errResult = multierror.Append(errResult, result.Err)
 				originalMessage := result.Msg.Metadata.(*models.Message)
 				originalMessage.SetError(result.Err)
@@ -254,19 +343,19 @@ func (kt *KafkaTarget) Write(messages []*models.Message) (*models.TargetWriteRes
 			}
 		}
 	} else if kt.syncProducer != nil {
-		for _, msg := range safeMessages {
+		for _, record := range records {
+			msg := record.Metadata.(*models.Message)
 			requestStarted := time.Now()
-			_, _, err := kt.syncProducer.SendMessage(&sarama.ProducerMessage{
-				Topic: kt.topicName,
-				Key:   sarama.StringEncoder(msg.PartitionKey),
-				Value: sarama.ByteEncoder(msg.Data),
-			})
+			_, _, err := kt.syncProducer.SendMessage(record)
 			requestFinished := time.Now()
 
 			msg.TimeRequestStarted = requestStarted
 			msg.TimeRequestFinished = requestFinished
 
-			if err != nil {
+			if err != nil && kt.isInvalidPartition(err) {
+				msg.SetError(err)
+				invalid = append(invalid, msg)
+			} else if err != nil {
 				errResult = multierror.Append(errResult, err)
 				msg.SetError(err)
 				failed = append(failed, msg)
@@ -285,15 +374,69 @@ func (kt *KafkaTarget) Write(messages []*models.Message) (*models.TargetWriteRes
 		errResult = errors.Wrap(errResult, fmt.Sprintf("Error writing messages to Kafka topic: %v", kt.topicName))
 	}
 
-	kt.log.Debugf("Successfully wrote %d/%d messages", len(sent), len(safeMessages))
+	kt.log.Debugf("Successfully wrote %d/%d messages", len(sent), len(records))
 	return models.NewTargetWriteResult(
 		sent,
 		failed,
 		oversized,
-		nil,
+		invalid,
 	), errResult
 }
 
+// isInvalidPartition reports whether a record was rejected because the partition rendered for it
+// doesn't exist, in which case retrying won't help
+func (kt *KafkaTarget) isInvalidPartition(err error) bool {
+	return kt.partitionTemplate != nil && errors.Is(err, sarama.ErrInvalidPartition)
+}
+
+// producerMessage builds the record for a message, rendering the topic, header and partition templates if there are any
+func (kt *KafkaTarget) producerMessage(msg *models.Message) (*sarama.ProducerMessage, error) {
+	record := &sarama.ProducerMessage{
+		Topic:    kt.topicName,
+		Key:      sarama.StringEncoder(msg.PartitionKey),
+		Value:    sarama.ByteEncoder(msg.Data),
+		Metadata: msg,
+	}
+
+	data := lazyTemplateData(msg)
+
+	if kt.topicTemplate != nil {
+		topic, err := renderTemplate(kt.topicTemplate, data())
+		if err != nil {
+			return nil, err
+		}
+		if len(topic) == 0 {
+			return nil, errors.New("Rendering the topic template resulted in an empty topic name")
+		}
+		record.Topic = string(topic)
+	}
+
+	for _, header := range kt.headers {
+		value, err := header.render(data)
+		if err != nil {
+			return nil, err
+		}
+		record.Headers = append(record.Headers, sarama.RecordHeader{
+			Key:   []byte(header.name),
+			Value: value,
+		})
+	}
+
+	if kt.partitionTemplate != nil {
+		rendered, err := renderTemplate(kt.partitionTemplate, data())
+		if err != nil {
+			return nil, err
+		}
+		partition, err := strconv.ParseInt(string(rendered), 10, 32)
+		if err != nil || partition < 0 {
+			return nil, errors.New(fmt.Sprintf("Rendering the partition template resulted in '%s', which isn't a valid partition", rendered))
+		}
+		record.Partition = int32(partition)
+	}
+
+	return record, nil
+}
+
 // Open does not do anything for this target
 func (kt *KafkaTarget) Open() {}
 
@@ -324,58 +467,3 @@ func (kt *KafkaTarget) MaximumAllowedMessageSizeBytes() int {
 func (kt *KafkaTarget) GetID() string {
 	return fmt.Sprintf("brokers:%s:topic:%s", kt.brokers, kt.topicName)
 }
-
-func getKafkaVersion(targetVersion string) (sarama.KafkaVersion, error) {
-	preferredVersion := sarama.DefaultVersion
-
-	if targetVersion != "" {
-		parsedVersion, err := sarama.ParseKafkaVersion(targetVersion)
-		if err != nil {
-			return sarama.DefaultVersion, err
-		}
-
-		supportedVersion := false
-		for _, version := range sarama.SupportedVersions {
-			if version == parsedVersion {
-				supportedVersion = true
-				preferredVersion = parsedVersion
-				break
-			}
-		}
-		if !supportedVersion {
-			return sarama.DefaultVersion, fmt.Errorf("unsupported version `%s`. select older, compatible version instead", parsedVersion)
-		}
-	}
-
-	return preferredVersion, nil
-}
-
-// SHA256 hash
-var SHA256 scram.HashGeneratorFcn = func() hash.Hash { return sha256.New() }
-
-// SHA512 hash
-var SHA512 scram.HashGeneratorFcn = func() hash.Hash { return sha512.New() }
-
-type xdgSCRAMClient struct {
-	*scram.Client
-	*scram.ClientConversation
-	scram.HashGeneratorFcn
-}
-
-func (x *xdgSCRAMClient) Begin(userName, password, authzID string) (err error) {
-	x.Client, err = x.HashGeneratorFcn.NewClient(userName, password, authzID)
-	if err != nil {
-		return err
-	}
-	x.ClientConversation = x.Client.NewConversation()
-	return nil
-}
-
-func (x *xdgSCRAMClient) Step(challenge string) (response string, err error) {
-	response, err = x.ClientConversation.Step(challenge)
-	return
-}
-
-func (x *xdgSCRAMClient) Done() bool {
-	return x.ClientConversation.Done()
-}
@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// getPartitionerConstructor returns the constructor for the partitioner which picks the partition of each record
+func getPartitionerConstructor(partitioner string) (sarama.PartitionerConstructor, error) {
+	switch partitioner {
+	case "", "hash":
+		return sarama.NewHashPartitioner, nil
+	case "round_robin":
+		return sarama.NewRoundRobinPartitioner, nil
+	case "murmur2":
+		return newMurmur2Partitioner, nil
+	case "manual":
+		return sarama.NewManualPartitioner, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid partitioner '%s', must be one of 'hash', 'round_robin', 'murmur2' or 'manual'", partitioner))
+	}
+}
+
+// murmur2Partitioner places records in the same partitions as the default partitioner of the Java client,
+// by taking the murmur2 hash of the key. Records without a key are placed randomly.
+type murmur2Partitioner struct {
+	random sarama.Partitioner
+}
+
+func newMurmur2Partitioner(topic string) sarama.Partitioner {
+	return &murmur2Partitioner{random: sarama.NewRandomPartitioner(topic)}
+}
+
+// Partition implements the sarama.Partitioner interface
+func (p *murmur2Partitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return p.random.Partition(message, numPartitions)
+	}
+	key, err := message.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+
+	// The Java client clears the sign bit rather than taking the absolute value
+	return int32(murmur2(key)&0x7fffffff) % numPartitions, nil
+}
+
+// RequiresConsistency implements the sarama.Partitioner interface
+func (p *murmur2Partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// murmur2 is the 32 bit murmur2 hash, with the same seed as the Java client
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
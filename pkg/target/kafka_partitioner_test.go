@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// javaMurmur2Cases are hashes produced by org.apache.kafka.common.utils.Utils.murmur2 in the Java client
+var javaMurmur2Cases = []struct {
+	key  string
+	hash int32
+}{
+	{"21", -973932308},
+	{"foobar", -790332482},
+	{"a-little-bit-long-string", -985981536},
+	{"a-little-bit-longer-string", -1486304829},
+	{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+	{"abc", 479470107},
+}
+
+func TestMurmur2(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range javaMurmur2Cases {
+		assert.Equal(c.hash, int32(murmur2([]byte(c.key))), c.key)
+	}
+}
+
+// TestMurmur2Partitioner_JavaCompatible checks keys are placed in the same partitions as the Java default
+// partitioner, which takes toPositive(murmur2(key)) % numPartitions. Taking the absolute value of the
+// hash instead would place most of these keys differently.
+func TestMurmur2Partitioner_JavaCompatible(t *testing.T) {
+	assert := assert.New(t)
+
+	expected := map[string]int32{
+		"21":                         0,
+		"foobar":                     6,
+		"a-little-bit-long-string":   8,
+		"a-little-bit-longer-string": 11,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": 5,
+		"abc": 3,
+	}
+
+	partitioner := newMurmur2Partitioner("topic")
+	assert.True(partitioner.RequiresConsistency())
+
+	for key, partition := range expected {
+		actual, err := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(key)}, 12)
+		assert.Nil(err)
+		assert.Equal(partition, actual, key)
+	}
+
+	// Records without a key are placed randomly
+	actual, err := partitioner.Partition(&sarama.ProducerMessage{}, 12)
+	assert.Nil(err)
+	assert.True(actual >= 0 && actual < 12)
+}
+
+func TestGetPartitionerConstructor(t *testing.T) {
+	assert := assert.New(t)
+
+	constructor, err := getPartitionerConstructor("round_robin")
+	assert.Nil(err)
+	partitioner := constructor("topic")
+	for i := int32(0); i < 6; i++ {
+		partition, err := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("key")}, 3)
+		assert.Nil(err)
+		assert.Equal(i%3, partition)
+	}
+
+	constructor2, err2 := getPartitionerConstructor("manual")
+	assert.Nil(err2)
+	partition, err3 := constructor2("topic").Partition(&sarama.ProducerMessage{Partition: 2}, 3)
+	assert.Nil(err3)
+	assert.Equal(int32(2), partition)
+
+	_, err4 := getPartitionerConstructor("sticky")
+	assert.NotNil(err4)
+	if err4 != nil {
+		assert.Equal("Invalid partitioner 'sticky', must be one of 'hash', 'round_robin', 'murmur2' or 'manual'", err4.Error())
+	}
+}
@@ -8,6 +8,7 @@
 package target
 
 import (
+	"fmt"
 	"sync/atomic"
 	"testing"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/Shopify/sarama/mocks"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/snowplow/snowbridge/pkg/models"
 	"github.com/snowplow/snowbridge/pkg/testutil"
 	"github.com/stretchr/testify/assert"
 )
@@ -237,3 +239,129 @@ func TestKafkaTarget_WriteSuccess_OversizeRecord(t *testing.T) {
 	assert.Equal(int64(0), writeRes.FailedCount)
 	assert.Equal(1, len(writeRes.Oversized))
 }
+
+func TestKafkaTarget_WriteTopicTemplateAndHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	mockProducer, target := SetUpMockSyncProducer(t)
+
+	topicTemplate, err := parseTemplate("topic", "enriched-{{ .Data.app_id }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := getKafkaHeaders(`{"source":"snowbridge","schema":"{{ .Data.schema }}","pk":"{{ .PartitionKey }}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.topicTemplate = topicTemplate
+	target.headers = headers
+
+	checker := func(topic string, schema string, pk string) mocks.MessageChecker {
+		return func(record *sarama.ProducerMessage) error {
+			if record.Topic != topic {
+				return fmt.Errorf("expected topic %s, got %s", topic, record.Topic)
+			}
+			expected := []sarama.RecordHeader{
+				{Key: []byte("pk"), Value: []byte(pk)},
+				{Key: []byte("schema"), Value: []byte(schema)},
+				{Key: []byte("source"), Value: []byte("snowbridge")},
+			}
+			if !assert.Equal(expected, record.Headers) {
+				return fmt.Errorf("unexpected headers")
+			}
+			return nil
+		}
+	}
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checker("enriched-app1", "page_view", "pk1"))
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checker("enriched-app2", "page_ping", "pk2"))
+
+	defer target.Close()
+	target.Open()
+
+	messages := []*models.Message{
+		{Data: []byte(`{"app_id":"app1","schema":"page_view"}`), PartitionKey: "pk1"},
+		{Data: []byte(`{"app_id":"app2","schema":"page_ping"}`), PartitionKey: "pk2"},
+		{Data: []byte(`{"schema":"page_ping"}`), PartitionKey: "pk3"},
+	}
+
+	writeRes, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(int64(2), writeRes.SentCount)
+	assert.Equal(1, len(writeRes.Invalid))
+	assert.Regexp("Error rendering topic template: .*", writeRes.Invalid[0].GetError().Error())
+}
+
+func TestGetCompressionCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	codec, err := getCompressionCodec("zstd", false)
+	assert.Nil(err)
+	assert.Equal(sarama.CompressionZSTD, codec)
+
+	// The deprecated compress option enables snappy, unless a codec is set
+	codec, err = getCompressionCodec("", true)
+	assert.Nil(err)
+	assert.Equal(sarama.CompressionSnappy, codec)
+
+	codec, err = getCompressionCodec("gzip", true)
+	assert.Nil(err)
+	assert.Equal(sarama.CompressionGZIP, codec)
+
+	codec, err = getCompressionCodec("", false)
+	assert.Nil(err)
+	assert.Equal(sarama.CompressionNone, codec)
+
+	_, err2 := getCompressionCodec("brotli", false)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("Invalid compression codec 'brotli', must be one of 'none', 'gzip', 'snappy', 'lz4' or 'zstd'", err2.Error())
+	}
+}
+
+func TestKafkaTarget_WriteManualPartition(t *testing.T) {
+	assert := assert.New(t)
+
+	// The mock producer applies the partitioner to records, as the real one does
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+	mockProducer := mocks.NewSyncProducer(t, config)
+	target := &KafkaTarget{
+		syncProducer:     mockProducer,
+		messageByteLimit: 1048576,
+		log:              log.WithFields(log.Fields{"target": "kafka"}),
+	}
+
+	partitionTemplate, err := parseTemplate("partition", "{{ .Data.partition }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.partitionTemplate = partitionTemplate
+
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(record *sarama.ProducerMessage) error {
+		if record.Partition != 2 {
+			return fmt.Errorf("expected partition 2, got %d", record.Partition)
+		}
+		return nil
+	})
+	// A partition which doesn't exist is rejected by the producer
+	mockProducer.ExpectSendMessageAndFail(sarama.ErrInvalidPartition)
+
+	defer target.Close()
+	target.Open()
+
+	messages := []*models.Message{
+		{Data: []byte(`{"partition":2}`)},
+		{Data: []byte(`{"partition":20}`)},
+		{Data: []byte(`{"partition":"first"}`)},
+	}
+
+	writeRes, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(int64(1), writeRes.SentCount)
+	assert.Equal(int64(0), writeRes.FailedCount)
+	assert.Equal(2, len(writeRes.Invalid))
+	assert.Equal("Rendering the partition template resulted in 'first', which isn't a valid partition", writeRes.Invalid[0].GetError().Error())
+	assert.Equal(sarama.ErrInvalidPartition, writeRes.Invalid[1].GetError())
+}
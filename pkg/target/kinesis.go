@@ -9,6 +9,8 @@ package target
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -179,25 +181,50 @@ func (kt *KinesisTarget) process(messages []*models.Message) (*models.TargetWrit
 		), errors.Wrap(err, "Failed to send message batch to Kinesis stream")
 	}
 
-	// TODO: Can we ack successful messages when some fail in the batch? This will cause duplicate processing on failure.
+	// Records in the response are in the same order as in the request, and only those with an
+	// ErrorCode failed, so successful records are acked and only the failed ones retried
 	if res.FailedRecordCount != nil && *res.FailedRecordCount > int64(0) {
-		failed := messages
+		if len(res.Records) != len(messages) {
+			return models.NewTargetWriteResult(
+				nil,
+				messages,
+				nil,
+				nil,
+			), errors.New(fmt.Sprintf("Failed to write messages in batch to Kinesis stream: got %d records in response for %d messages", len(res.Records), len(messages)))
+		}
 
-		// Wrap produces nil if the initial error is nil, so create an empty error instead
-		kinesisErrs := errors.New("")
+		var sent []*models.Message
+		var failed []*models.Message
+		var throttled int64
+		errorCounts := make(map[string]int)
+
+		for i, record := range res.Records {
+			msg := messages[i]
+			if record.ErrorCode == nil {
+				if msg.AckFunc != nil {
+					msg.AckFunc()
+				}
+				sent = append(sent, msg)
+				continue
+			}
 
-		for _, record := range res.Records {
-			if record.ErrorMessage != nil {
-				kinesisErrs = errors.Wrap(kinesisErrs, *record.ErrorMessage)
+			failed = append(failed, msg)
+			if *record.ErrorCode == kinesis.ErrCodeProvisionedThroughputExceededException {
+				throttled++
 			}
+			errorCounts[*record.ErrorCode]++
 		}
 
-		return models.NewTargetWriteResult(
-			nil,
+		writeResult := models.NewTargetWriteResult(
+			sent,
 			failed,
 			nil,
 			nil,
-		), errors.Wrap(kinesisErrs, "Failed to write all messages in batch to Kinesis stream")
+		)
+		writeResult.ThrottledCount = throttled
+
+		kt.log.Debugf("Successfully wrote %d/%d messages", len(sent), len(messages))
+		return writeResult, errors.New(fmt.Sprintf("Failed to write %d/%d messages in batch to Kinesis stream: %s", len(failed), len(messages), formatErrorCounts(errorCounts)))
 	}
 
 	for _, msg := range messages {
@@ -217,6 +244,21 @@ func (kt *KinesisTarget) process(messages []*models.Message) (*models.TargetWrit
 	), nil
 }
 
+// formatErrorCounts lists how many records failed with each error code, in a stable order
+func formatErrorCounts(errorCounts map[string]int) string {
+	codes := make([]string, 0, len(errorCounts))
+	for code := range errorCounts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	formatted := make([]string, len(codes))
+	for i, code := range codes {
+		formatted[i] = fmt.Sprintf("%s (%d)", code, errorCounts[code])
+	}
+	return strings.Join(formatted, ", ")
+}
+
 // Open does not do anything for this target
 func (kt *KinesisTarget) Open() {}
 
@@ -11,11 +11,76 @@ import (
 	"sync/atomic"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/snowplow/snowbridge/pkg/testutil"
 )
 
+// mockKinesisClient fails every record whose data is in failures, with the mapped error code
+type mockKinesisClient struct {
+	kinesisiface.KinesisAPI
+	failures map[string]string
+}
+
+func (m *mockKinesisClient) PutRecords(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+	output := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int64(0)}
+	for _, record := range input.Records {
+		if code, ok := m.failures[string(record.Data)]; ok {
+			*output.FailedRecordCount++
+			output.Records = append(output.Records, &kinesis.PutRecordsResultEntry{
+				ErrorCode:    aws.String(code),
+				ErrorMessage: aws.String("failed"),
+			})
+			continue
+		}
+		output.Records = append(output.Records, &kinesis.PutRecordsResultEntry{
+			SequenceNumber: aws.String("1"),
+			ShardId:        aws.String("shardId-000000000000"),
+		})
+	}
+	return output, nil
+}
+
+func TestKinesisTarget_WritePartialFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockKinesisClient{failures: map[string]string{
+		"1": kinesis.ErrCodeProvisionedThroughputExceededException,
+		"3": kinesis.ErrCodeProvisionedThroughputExceededException,
+		"4": "InternalFailure",
+	}}
+	target, err := newKinesisTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "test-stream")
+	assert.Nil(err)
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetSequentialTestMessages(6, ackFunc)
+
+	writeRes, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Contains(err.Error(), "Failed to write 3/6 messages in batch to Kinesis stream: InternalFailure (1), ProvisionedThroughputExceededException (2)")
+	}
+
+	// Only the records which failed are retried, and the rest are acked
+	assert.Equal(int64(3), writeRes.SentCount)
+	assert.Equal(int64(3), writeRes.FailedCount)
+	assert.Equal(int64(2), writeRes.ThrottledCount)
+	assert.Equal(int64(3), ackOps)
+
+	var failedData []string
+	for _, msg := range writeRes.Failed {
+		failedData = append(failedData, string(msg.Data))
+	}
+	assert.Equal([]string{"1", "3", "4"}, failedData)
+}
+
 func TestKinesisTarget_WriteFailure(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
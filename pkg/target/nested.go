@@ -0,0 +1,31 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/snowplow/snowbridge/pkg/target/targetiface"
+)
+
+// NestedComponent is a block holding a component configured within a target, such as
+// the targets the router and tee targets write to. It is configured as at the top level.
+type NestedComponent struct {
+	Use *NestedComponentUse `hcl:"use,block"`
+}
+
+// NestedComponentUse denotes what a nested component is configured to use
+type NestedComponentUse struct {
+	Name string   `hcl:",label"`
+	Body hcl.Body `hcl:",remain"`
+}
+
+// NestedTargetBuilder builds a nested target from its configuration. Targets are created
+// from their configuration outside of this package, so it is provided when a target with
+// nested targets is created.
+type NestedTargetBuilder func(name string, body hcl.Body) (targetiface.Target, error)
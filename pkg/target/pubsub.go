@@ -9,6 +9,7 @@ package target
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -31,6 +32,16 @@ const (
 type PubSubTargetConfig struct {
 	ProjectID string `hcl:"project_id" env:"TARGET_PUBSUB_PROJECT_ID"`
 	TopicName string `hcl:"topic_name" env:"TARGET_PUBSUB_TOPIC_NAME"`
+
+	EnableMessageOrdering bool   `hcl:"enable_message_ordering,optional" env:"TARGET_PUBSUB_ENABLE_MESSAGE_ORDERING"`
+	Attributes            string `hcl:"attributes,optional" env:"TARGET_PUBSUB_ATTRIBUTES"`
+
+	PublishByteThreshold              int    `hcl:"publish_byte_threshold,optional" env:"TARGET_PUBSUB_PUBLISH_BYTE_THRESHOLD"`
+	PublishCountThreshold             int    `hcl:"publish_count_threshold,optional" env:"TARGET_PUBSUB_PUBLISH_COUNT_THRESHOLD"`
+	PublishDelayThresholdInMillis     int    `hcl:"publish_delay_threshold_in_millis,optional" env:"TARGET_PUBSUB_PUBLISH_DELAY_THRESHOLD_IN_MILLIS"`
+	FlowControlMaxOutstandingMessages int    `hcl:"flow_control_max_outstanding_messages,optional" env:"TARGET_PUBSUB_FLOW_CONTROL_MAX_OUTSTANDING_MESSAGES"`
+	FlowControlMaxOutstandingBytes    int    `hcl:"flow_control_max_outstanding_bytes,optional" env:"TARGET_PUBSUB_FLOW_CONTROL_MAX_OUTSTANDING_BYTES"`
+	FlowControlLimitExceededBehavior  string `hcl:"flow_control_limit_exceeded_behavior,optional" env:"TARGET_PUBSUB_FLOW_CONTROL_LIMIT_EXCEEDED_BEHAVIOR"`
 }
 
 // PubSubTarget holds a new client for writing messages to Google PubSub
@@ -40,6 +51,10 @@ type PubSubTarget struct {
 	topic     *pubsub.Topic
 	topicName string
 
+	enableMessageOrdering bool
+	attributes            map[string]string
+	publishSettings       pubsub.PublishSettings
+
 	log *log.Entry
 }
 
@@ -51,7 +66,12 @@ type pubSubPublishResult struct {
 }
 
 // newPubSubTarget creates a new client for writing messages to Google PubSub
-func newPubSubTarget(projectID string, topicName string) (*PubSubTarget, error) {
+func newPubSubTarget(projectID string, topicName string, enableMessageOrdering bool, attributes string, publishSettings pubsub.PublishSettings) (*PubSubTarget, error) {
+	parsedAttributes, err := getPubSubAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
 
 	client, err := pubsub.NewClient(ctx, projectID)
@@ -63,13 +83,61 @@ func newPubSubTarget(projectID string, topicName string) (*PubSubTarget, error)
 		projectID: projectID,
 		client:    client,
 		topicName: topicName,
-		log:       log.WithFields(log.Fields{"target": "pubsub", "cloud": "GCP", "project": projectID, "topic": topicName}),
+
+		enableMessageOrdering: enableMessageOrdering,
+		attributes:            parsedAttributes,
+		publishSettings:       publishSettings,
+
+		log: log.WithFields(log.Fields{"target": "pubsub", "cloud": "GCP", "project": projectID, "topic": topicName}),
 	}, nil
 }
 
 // PubSubTargetConfigFunction creates PubSubTarget from PubSubTargetConfig
 func PubSubTargetConfigFunction(c *PubSubTargetConfig) (*PubSubTarget, error) {
-	return newPubSubTarget(c.ProjectID, c.TopicName)
+	publishSettings, err := getPublishSettings(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPubSubTarget(c.ProjectID, c.TopicName, c.EnableMessageOrdering, c.Attributes, publishSettings)
+}
+
+// getPubSubAttributes parses the attributes, which are provided as a JSON object of string values
+func getPubSubAttributes(attributes string) (map[string]string, error) {
+	if attributes == "" {
+		return nil, nil
+	}
+	var parsed map[string]string
+
+	err := json.Unmarshal([]byte(attributes), &parsed)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing attributes. Ensure that attributes are provided as a JSON of string key-value pairs")
+	}
+
+	return parsed, nil
+}
+
+// getPublishSettings builds the settings used to batch and flow control publishing from the config
+func getPublishSettings(c *PubSubTargetConfig) (pubsub.PublishSettings, error) {
+	settings := pubsub.DefaultPublishSettings
+	settings.ByteThreshold = c.PublishByteThreshold
+	settings.CountThreshold = c.PublishCountThreshold
+	settings.DelayThreshold = time.Duration(c.PublishDelayThresholdInMillis) * time.Millisecond
+	settings.FlowControlSettings.MaxOutstandingMessages = c.FlowControlMaxOutstandingMessages
+	settings.FlowControlSettings.MaxOutstandingBytes = c.FlowControlMaxOutstandingBytes
+
+	switch c.FlowControlLimitExceededBehavior {
+	case "ignore":
+		settings.FlowControlSettings.LimitExceededBehavior = pubsub.FlowControlIgnore
+	case "block":
+		settings.FlowControlSettings.LimitExceededBehavior = pubsub.FlowControlBlock
+	case "signal_error":
+		settings.FlowControlSettings.LimitExceededBehavior = pubsub.FlowControlSignalError
+	default:
+		return settings, errors.New(fmt.Sprintf("Invalid flow control limit exceeded behavior '%s', must be one of 'ignore', 'block' or 'signal_error'", c.FlowControlLimitExceededBehavior))
+	}
+
+	return settings, nil
 }
 
 // The PubSubTargetAdapter type is an adapter for functions to be used as
@@ -84,7 +152,14 @@ func (f PubSubTargetAdapter) Create(i interface{}) (interface{}, error) {
 // ProvideDefault implements the ComponentConfigurable interface.
 func (f PubSubTargetAdapter) ProvideDefault() (interface{}, error) {
 	// Provide defaults if any
-	cfg := &PubSubTargetConfig{}
+	cfg := &PubSubTargetConfig{
+		PublishByteThreshold:              pubsub.DefaultPublishSettings.ByteThreshold,
+		PublishCountThreshold:             pubsub.DefaultPublishSettings.CountThreshold,
+		PublishDelayThresholdInMillis:     int(pubsub.DefaultPublishSettings.DelayThreshold / time.Millisecond),
+		FlowControlMaxOutstandingMessages: pubsub.DefaultPublishSettings.FlowControlSettings.MaxOutstandingMessages,
+		FlowControlMaxOutstandingBytes:    pubsub.DefaultPublishSettings.FlowControlSettings.MaxOutstandingBytes,
+		FlowControlLimitExceededBehavior:  "ignore",
+	}
 
 	return cfg, nil
 }
@@ -130,14 +205,18 @@ func (ps *PubSubTarget) Write(messages []*models.Message) (*models.TargetWriteRe
 
 	for _, msg := range safeMessages {
 		// Sent empty messages to invalid queue
-		if len(msg.Data) == 0 {
+		if len(msg.Data) == 0 && len(ps.attributes) == 0 {
 			msg.SetError(errors.New("pubsub cannot accept empty messages: each message must contain either non-empty data, or at least one attribute"))
 			invalid = append(invalid, msg)
 			continue
 		}
 
 		pubSubMsg := &pubsub.Message{
-			Data: msg.Data,
+			Data:       msg.Data,
+			Attributes: ps.attributes,
+		}
+		if ps.enableMessageOrdering {
+			pubSubMsg.OrderingKey = msg.PartitionKey
 		}
 		requestStarted := time.Now()
 		r := ps.topic.Publish(ctx, pubSubMsg)
@@ -163,6 +242,12 @@ func (ps *PubSubTarget) Write(messages []*models.Message) (*models.TargetWriteRe
 			errResult = multierror.Append(errResult, err)
 
 			failed = append(failed, r.Message)
+
+			// Publishing for an ordering key is paused after a failure, so that later messages
+			// aren't published ahead of it. Resuming lets the failed messages be retried in order.
+			if ps.enableMessageOrdering && r.Message.PartitionKey != "" {
+				ps.topic.ResumePublish(r.Message.PartitionKey)
+			}
 		} else {
 			if r.Message.AckFunc != nil {
 				r.Message.AckFunc()
@@ -189,6 +274,8 @@ func (ps *PubSubTarget) Write(messages []*models.Message) (*models.TargetWriteRe
 func (ps *PubSubTarget) Open() {
 	ps.log.Warnf("Opening target for topic '%s' in project %s", ps.topicName, ps.projectID)
 	ps.topic = ps.client.Topic(ps.topicName)
+	ps.topic.PublishSettings = ps.publishSettings
+	ps.topic.EnableMessageOrdering = ps.enableMessageOrdering
 }
 
 // Close stops the topic
@@ -10,10 +10,13 @@ package target
 import (
 	"context"
 	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/pubsub/pstest"
 	"github.com/stretchr/testify/assert"
 	pubsubV1 "google.golang.org/genproto/googleapis/pubsub/v1"
@@ -36,7 +39,7 @@ func TestPubSubTarget_WriteSuccessIntegration(t *testing.T) {
 	// Write to topic
 	testutil.WriteToPubSubTopic(t, topic, 10)
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 	assert.NotNil(pubsubTarget)
 	assert.Nil(err)
 	assert.Equal("projects/project-test/topics/test-topic", pubsubTarget.GetID())
@@ -67,7 +70,7 @@ func TestPubSubTarget_WriteTopicUnopenedIntegration(t *testing.T) {
 	// Write to topic
 	testutil.WriteToPubSubTopic(t, topic, 10)
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 	assert.NotNil(pubsubTarget)
 	assert.Nil(err)
 	assert.Equal("projects/project-test/topics/test-topic", pubsubTarget.GetID())
@@ -92,7 +95,7 @@ func TestPubSubTarget_WithInvalidMessageIntegration(t *testing.T) {
 	// Write to topic
 	testutil.WriteToPubSubTopic(t, topic, 10)
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 	assert.NotNil(pubsubTarget)
 	assert.Nil(err)
 	assert.Equal("projects/project-test/topics/test-topic", pubsubTarget.GetID())
@@ -117,7 +120,7 @@ func TestPubSubTarget_WriteSuccessWithMocks(t *testing.T) {
 	defer srv.Close()
 	defer conn.Close()
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 	assert.NotNil(pubsubTarget)
 	assert.Nil(err)
 	assert.Equal("projects/project-test/topics/test-topic", pubsubTarget.GetID())
@@ -175,7 +178,7 @@ func TestPubSubTarget_WriteFailureWithMocks(t *testing.T) {
 	defer srv.Close()
 	defer conn.Close()
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 	assert.NotNil(pubsubTarget)
 	if err != nil {
 		t.Fatal(err)
@@ -226,7 +229,7 @@ func TestPubSubTarget_WriteFailureRetryableWithMocks(t *testing.T) {
 	defer srv.Close()
 	defer conn.Close()
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 	assert.NotNil(pubsubTarget)
 	if err != nil {
 		t.Fatal(err)
@@ -259,6 +262,94 @@ func TestPubSubTarget_WriteFailureRetryableWithMocks(t *testing.T) {
 	}
 }
 
+// TestPubSubTarget_WriteOrderingAndAttributesWithMocks tests that ordering keys and attributes are set on published messages
+func TestPubSubTarget_WriteOrderingAndAttributesWithMocks(t *testing.T) {
+	assert := assert.New(t)
+	srv, conn := testutil.InitMockPubsubServer(8563, nil, t)
+	defer srv.Close()
+	defer conn.Close()
+
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, true, `{"source":"snowbridge"}`, pubsub.DefaultPublishSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubsubTarget.Open()
+	defer pubsubTarget.Close()
+
+	messages := []*models.Message{
+		{Data: []byte("1"), PartitionKey: "user-1"},
+		{Data: []byte("2"), PartitionKey: "user-2"},
+		{Data: []byte("3"), PartitionKey: "user-1"},
+		// Empty data is accepted when there are attributes
+		{Data: []byte(""), PartitionKey: "user-2"},
+	}
+
+	twres, err := pubsubTarget.Write(messages)
+	assert.Nil(err)
+	assert.Equal(int64(4), twres.SentCount)
+	assert.Nil(twres.Invalid)
+
+	res, pullErr := srv.GServer.Pull(context.TODO(), &pubsubV1.PullRequest{
+		Subscription: "projects/project-test/subscriptions/test-sub",
+		MaxMessages:  10,
+	})
+	if pullErr != nil {
+		t.Fatal(pullErr)
+	}
+
+	// The mock server doesn't return messages in the order they were published, so sort them by
+	// their IDs, which it assigns in the order it receives them
+	received := res.ReceivedMessages
+	sort.Slice(received, func(i, j int) bool {
+		return pstestMessageSeq(t, received[i].Message.MessageId) < pstestMessageSeq(t, received[j].Message.MessageId)
+	})
+
+	orderingKeys := make(map[string][]string)
+	for _, msg := range received {
+		assert.Equal(map[string]string{"source": "snowbridge"}, msg.Message.Attributes)
+		orderingKeys[msg.Message.OrderingKey] = append(orderingKeys[msg.Message.OrderingKey], string(msg.Message.Data))
+	}
+	assert.Equal(map[string][]string{"user-1": {"1", "3"}, "user-2": {"2", ""}}, orderingKeys)
+}
+
+// pstestMessageSeq returns the sequence number of an ID assigned by the mock server, such as "m3"
+func pstestMessageSeq(t *testing.T, id string) int {
+	seq, err := strconv.Atoi(strings.TrimPrefix(id, "m"))
+	if err != nil {
+		t.Fatalf("unexpected message ID %q", id)
+	}
+	return seq
+}
+
+func TestGetPublishSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &PubSubTargetConfig{
+		PublishByteThreshold:              5000,
+		PublishCountThreshold:             50,
+		PublishDelayThresholdInMillis:     100,
+		FlowControlMaxOutstandingMessages: 200,
+		FlowControlMaxOutstandingBytes:    1000000,
+		FlowControlLimitExceededBehavior:  "block",
+	}
+	settings, err := getPublishSettings(c)
+	assert.Nil(err)
+	assert.Equal(5000, settings.ByteThreshold)
+	assert.Equal(50, settings.CountThreshold)
+	assert.Equal(100*time.Millisecond, settings.DelayThreshold)
+	assert.Equal(200, settings.FlowControlSettings.MaxOutstandingMessages)
+	assert.Equal(1000000, settings.FlowControlSettings.MaxOutstandingBytes)
+	assert.Equal(pubsub.FlowControlBlock, settings.FlowControlSettings.LimitExceededBehavior)
+	assert.Equal(pubsub.DefaultPublishSettings.Timeout, settings.Timeout)
+
+	c.FlowControlLimitExceededBehavior = "drop"
+	_, err2 := getPublishSettings(c)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("Invalid flow control limit exceeded behavior 'drop', must be one of 'ignore', 'block' or 'signal_error'", err2.Error())
+	}
+}
+
 // TestNewPubSubTarget_Success tests that we newPubSubTarget returns a PubSubTarget
 func TestNewPubSubTarget_Success(t *testing.T) {
 	assert := assert.New(t)
@@ -268,7 +359,7 @@ func TestNewPubSubTarget_Success(t *testing.T) {
 	defer srv.Close()
 	defer conn.Close()
 
-	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`)
+	pubsubTarget, err := newPubSubTarget(`project-test`, `test-topic`, false, "", pubsub.DefaultPublishSettings)
 
 	assert.Nil(err)
 	assert.NotNil(pubsubTarget)
@@ -282,7 +373,7 @@ func TestNewPubSubTarget_Success(t *testing.T) {
 func TestnewPubSubTarget_Failure(t *testing.T) {
 	assert := assert.New(t)
 
-	pubsubTarget, err := newPubSubTarget(`nonexistent-project`, `nonexistent-topic`)
+	pubsubTarget, err := newPubSubTarget(`nonexistent-project`, `nonexistent-topic`, false, "", pubsub.DefaultPublishSettings)
 
 	// TODO: Test for the actual error we expect, when we have instrumented failing fast
 	assert.NotNil(err)
@@ -0,0 +1,345 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/snowplow/snowplow-golang-analytics-sdk/analytics"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/target/targetiface"
+)
+
+// RouterTargetConfig configures the routes messages are dispatched to
+type RouterTargetConfig struct {
+	Routes  []*RouteConfig   `hcl:"route,block"`
+	Default *NestedComponent `hcl:"default,block"`
+}
+
+// RouteConfig configures a route, with the rules a message must match to be written to its target.
+// A message which matches all the rules of several routes is written to the first of them.
+type RouteConfig struct {
+	AtomicField       string           `hcl:"atomic_field,optional"`
+	Regex             string           `hcl:"regex,optional"`
+	PartitionKeyRegex string           `hcl:"partition_key_regex,optional"`
+	Predicate         *NestedComponent `hcl:"predicate,block"`
+	Target            *NestedComponent `hcl:"target,block"`
+}
+
+// RouteMatcher reports whether a message matches a rule of a route
+type RouteMatcher func(message *models.Message) (bool, error)
+
+// RoutePredicateBuilder builds the predicate of a route from the configuration of a transformation.
+// The route is matched by messages which the transformation keeps.
+type RoutePredicateBuilder func(name string, body hcl.Body) (RouteMatcher, error)
+
+// route is a target along with the rules a message must match to be written to it
+type route struct {
+	rules  []RouteMatcher
+	target targetiface.Target
+}
+
+// RouterTarget dispatches messages to the target of the first route they match, or to the default target
+type RouterTarget struct {
+	routes        []*route
+	defaultTarget targetiface.Target
+
+	log *log.Entry
+}
+
+// newRouterTarget creates a target which dispatches messages to the given routes
+func newRouterTarget(routes []*route, defaultTarget targetiface.Target) *RouterTarget {
+	return &RouterTarget{
+		routes:        routes,
+		defaultTarget: defaultTarget,
+		log:           log.WithFields(log.Fields{"target": "router"}),
+	}
+}
+
+// RouterTargetConfigFunction returns a function creating a RouterTarget from a RouterTargetConfig,
+// which uses the given builders for the targets and predicates of its routes
+func RouterTargetConfigFunction(newTarget NestedTargetBuilder, newPredicate RoutePredicateBuilder) func(c *RouterTargetConfig) (*RouterTarget, error) {
+	return func(c *RouterTargetConfig) (*RouterTarget, error) {
+		if c.Default == nil || c.Default.Use == nil {
+			return nil, errors.New("The router target must have a default route")
+		}
+
+		routes := make([]*route, 0, len(c.Routes))
+		for i, rc := range c.Routes {
+			r, err := newRoute(rc, newTarget, newPredicate)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Error creating route %d", i))
+			}
+			routes = append(routes, r)
+		}
+
+		defaultTarget, err := newTarget(c.Default.Use.Name, c.Default.Use.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating default route")
+		}
+
+		return newRouterTarget(routes, defaultTarget), nil
+	}
+}
+
+// newRoute creates a route from its configuration
+func newRoute(c *RouteConfig, newTarget NestedTargetBuilder, newPredicate RoutePredicateBuilder) (*route, error) {
+	if c.Target == nil || c.Target.Use == nil {
+		return nil, errors.New("A route must have a target")
+	}
+
+	var rules []RouteMatcher
+	if c.AtomicField != "" || c.Regex != "" {
+		rule, err := newAtomicFieldMatcher(c.AtomicField, c.Regex)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if c.PartitionKeyRegex != "" {
+		rule, err := newPartitionKeyMatcher(c.PartitionKeyRegex)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if c.Predicate != nil && c.Predicate.Use != nil {
+		if newPredicate == nil {
+			return nil, errors.New("Route predicates are not supported")
+		}
+		rule, err := newPredicate(c.Predicate.Use.Name, c.Predicate.Use.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating route predicate")
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("A route must have at least one of atomic_field, partition_key_regex or a predicate")
+	}
+
+	t, err := newTarget(c.Target.Use.Name, c.Target.Use.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &route{rules: rules, target: t}, nil
+}
+
+// newAtomicFieldMatcher returns a rule matched by Snowplow enriched events whose atomic field matches
+// the regex. An empty field is matched as an empty string.
+func newAtomicFieldMatcher(field string, regex string) (RouteMatcher, error) {
+	if field == "" || regex == "" {
+		return nil, errors.New("Both atomic_field and regex must be set to route by an atomic field")
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error compiling regex for route")
+	}
+
+	return func(message *models.Message) (bool, error) {
+		parsedEvent, err := analytics.ParseEvent(string(message.Data))
+		if err != nil {
+			return false, err
+		}
+		value, err := parsedEvent.GetValue(field)
+		if err != nil && err.Error() != analytics.EmptyFieldErr {
+			return false, err
+		}
+		if value == nil {
+			value = ""
+		}
+		return re.MatchString(fmt.Sprintf("%v", value)), nil
+	}, nil
+}
+
+// newPartitionKeyMatcher returns a rule matched by messages whose partition key matches the regex
+func newPartitionKeyMatcher(regex string) (RouteMatcher, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error compiling partition key regex for route")
+	}
+
+	return func(message *models.Message) (bool, error) {
+		return re.MatchString(message.PartitionKey), nil
+	}, nil
+}
+
+// The RouterTargetAdapter type is an adapter for functions to be used as
+// pluggable components for Router Target. It implements the Pluggable interface.
+type RouterTargetAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f RouterTargetAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f RouterTargetAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults
+	cfg := &RouterTargetConfig{}
+
+	return cfg, nil
+}
+
+// AdaptRouterTargetFunc returns a RouterTargetAdapter.
+func AdaptRouterTargetFunc(f func(c *RouterTargetConfig) (*RouterTarget, error)) RouterTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*RouterTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected RouterTargetConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// Write dispatches the messages to the targets of the routes they match, writing to each
+// target concurrently. The results of the writes are merged, so that only messages accepted
+// by the target they were dispatched to are sent.
+func (rt *RouterTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	rt.log.Debugf("Routing %d messages ...", len(messages))
+
+	// The last batch is for the default route
+	batches := make([][]*models.Message, len(rt.routes)+1)
+	var invalid []*models.Message
+
+	for _, msg := range messages {
+		i, err := rt.match(msg)
+		if err != nil {
+			msg.SetError(errors.Wrap(err, "Error matching message to a route"))
+			invalid = append(invalid, msg)
+			continue
+		}
+		batches[i] = append(batches[i], msg)
+	}
+
+	results := make([]*models.TargetWriteResult, len(batches))
+	errs := make([]error, len(batches))
+
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, batch []*models.Message) {
+			defer wg.Done()
+
+			t := rt.target(i)
+			res, err := t.Write(batch)
+			if res == nil {
+				res = models.NewTargetWriteResult(nil, batch, nil, nil)
+			}
+			results[i] = res
+			if err != nil {
+				errs[i] = errors.Wrap(err, fmt.Sprintf("Error writing to target %s", t.GetID()))
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+
+	writeResult := models.NewTargetWriteResult(nil, nil, nil, invalid)
+	var errResult error
+	for i, res := range results {
+		writeResult = writeResult.Append(res)
+		if errs[i] != nil {
+			errResult = multierror.Append(errResult, errs[i])
+		}
+	}
+
+	rt.log.Debugf("Successfully wrote %d/%d messages", len(writeResult.Sent), len(messages))
+	return writeResult, errResult
+}
+
+// match returns the index of the first route a message matches, or of the default route
+func (rt *RouterTarget) match(message *models.Message) (int, error) {
+	for i, r := range rt.routes {
+		matched := true
+		for _, rule := range r.rules {
+			ok, err := rule(message)
+			if err != nil {
+				return 0, err
+			}
+			if !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i, nil
+		}
+	}
+	return len(rt.routes), nil
+}
+
+// target returns the target of a route by its index
+func (rt *RouterTarget) target(i int) targetiface.Target {
+	if i == len(rt.routes) {
+		return rt.defaultTarget
+	}
+	return rt.routes[i].target
+}
+
+// Open opens the targets of every route
+func (rt *RouterTarget) Open() {
+	for i := range rt.routes {
+		rt.routes[i].target.Open()
+	}
+	rt.defaultTarget.Open()
+}
+
+// Close closes the targets of every route
+func (rt *RouterTarget) Close() {
+	for i := range rt.routes {
+		rt.routes[i].target.Close()
+	}
+	rt.defaultTarget.Close()
+}
+
+// MaximumAllowedMessageSizeBytes returns the largest of the maximum message sizes of the
+// targets, as each target handles the messages too large for it
+func (rt *RouterTarget) MaximumAllowedMessageSizeBytes() int {
+	max := rt.defaultTarget.MaximumAllowedMessageSizeBytes()
+	for _, r := range rt.routes {
+		if size := r.target.MaximumAllowedMessageSizeBytes(); size > max {
+			max = size
+		}
+	}
+	return max
+}
+
+// MaximumAckDelay returns the longest of the delays before the targets ack the messages written to them
+func (rt *RouterTarget) MaximumAckDelay() time.Duration {
+	max := targetiface.MaximumAckDelay(rt.defaultTarget)
+	for _, r := range rt.routes {
+		if delay := targetiface.MaximumAckDelay(r.target); delay > max {
+			max = delay
+		}
+	}
+	return max
+}
+
+// GetID returns an identifier for this target, made of the identifiers of the targets routed to
+func (rt *RouterTarget) GetID() string {
+	ids := make([]string, 0, len(rt.routes)+1)
+	for _, r := range rt.routes {
+		ids = append(ids, r.target.GetID())
+	}
+	ids = append(ids, rt.defaultTarget.GetID())
+	return fmt.Sprintf("router(%s)", strings.Join(ids, ","))
+}
@@ -0,0 +1,261 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/target/targetiface"
+)
+
+// routerTestTarget keeps the data of the messages written to it, failing messages whose data is "fail"
+type routerTestTarget struct {
+	id      string
+	written []string
+	opened  bool
+	mutex   sync.Mutex
+}
+
+func (t *routerTestTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var sent, failed []*models.Message
+	for _, msg := range messages {
+		t.written = append(t.written, string(msg.Data))
+		if string(msg.Data) == "fail" {
+			failed = append(failed, msg)
+			continue
+		}
+		if msg.AckFunc != nil {
+			msg.AckFunc()
+		}
+		sent = append(sent, msg)
+	}
+
+	if len(failed) > 0 {
+		return models.NewTargetWriteResult(sent, failed, nil, nil), errors.New("write failed")
+	}
+	return models.NewTargetWriteResult(sent, nil, nil, nil), nil
+}
+
+func (t *routerTestTarget) Open() { t.opened = true }
+
+func (t *routerTestTarget) Close() { t.opened = false }
+
+func (t *routerTestTarget) MaximumAllowedMessageSizeBytes() int { return len(t.id) }
+
+func (t *routerTestTarget) GetID() string { return t.id }
+
+// routerTestTargets returns test targets by their name, along with a builder for them
+func routerTestTargets(names ...string) (map[string]*routerTestTarget, NestedTargetBuilder) {
+	targets := make(map[string]*routerTestTarget)
+	for _, name := range names {
+		targets[name] = &routerTestTarget{id: name}
+	}
+	return targets, func(name string, body hcl.Body) (targetiface.Target, error) {
+		t, ok := targets[name]
+		if !ok {
+			return nil, errors.New("unknown target " + name)
+		}
+		return t, nil
+	}
+}
+
+// routerTestPredicate is a predicate builder for predicates matching messages which contain their name
+func routerTestPredicate(name string, body hcl.Body) (RouteMatcher, error) {
+	return func(message *models.Message) (bool, error) {
+		return bytes.Contains(message.Data, []byte(name)), nil
+	}, nil
+}
+
+// routerTestEvent returns a Snowplow enriched event with the given app_id
+func routerTestEvent(appID string) []byte {
+	fields := make([]string, 131)
+	fields[0] = appID
+	return []byte(strings.Join(fields, "\t"))
+}
+
+func routerTestUse(name string) *NestedComponent {
+	return &NestedComponent{Use: &NestedComponentUse{Name: name}}
+}
+
+func TestRouterTarget_WriteRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	targets, newTarget := routerTestTargets("web", "mobile", "other")
+	target, err := RouterTargetConfigFunction(newTarget, nil)(&RouterTargetConfig{
+		Routes: []*RouteConfig{
+			{AtomicField: "app_id", Regex: "^web-", Target: routerTestUse("web")},
+			{PartitionKeyRegex: "^mobile$", Target: routerTestUse("mobile")},
+		},
+		Default: routerTestUse("other"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target.Open()
+	assert.True(targets["web"].opened)
+	assert.True(targets["other"].opened)
+	assert.Equal("router(web,mobile,other)", target.GetID())
+	assert.Equal(6, target.MaximumAllowedMessageSizeBytes())
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: routerTestEvent("web-1"), PartitionKey: "mobile", AckFunc: ackFunc},
+		{Data: routerTestEvent("ios"), PartitionKey: "mobile", AckFunc: ackFunc},
+		{Data: routerTestEvent(""), PartitionKey: "mobile", AckFunc: ackFunc},
+		{Data: routerTestEvent("web-2"), AckFunc: ackFunc},
+		{Data: routerTestEvent("server"), AckFunc: ackFunc},
+		{Data: []byte("not enriched"), PartitionKey: "mobile", AckFunc: ackFunc},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(5, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Equal(int64(5), ackOps)
+	assert.Regexp("Error matching message to a route: .*", messages[5].GetError().Error())
+
+	// Messages go to the first route they match
+	assert.Equal([]string{string(messages[0].Data), string(messages[3].Data)}, targets["web"].written)
+	assert.Equal([]string{string(messages[1].Data), string(messages[2].Data)}, targets["mobile"].written)
+	assert.Equal([]string{string(messages[4].Data)}, targets["other"].written)
+
+	target.Close()
+	assert.False(targets["mobile"].opened)
+}
+
+func TestRouterTarget_WriteMergesResults(t *testing.T) {
+	assert := assert.New(t)
+
+	targets, newTarget := routerTestTargets("a", "b", "default")
+	target, err := RouterTargetConfigFunction(newTarget, routerTestPredicate)(&RouterTargetConfig{
+		Routes: []*RouteConfig{
+			// Every rule of a route must match
+			{PartitionKeyRegex: "^a", Predicate: routerTestUse("fail"), Target: routerTestUse("a")},
+			{Predicate: routerTestUse("b"), Target: routerTestUse("b")},
+		},
+		Default: routerTestUse("default"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("fail"), PartitionKey: "a1", AckFunc: ackFunc},
+		{Data: []byte("b1"), PartitionKey: "a1", AckFunc: ackFunc},
+		{Data: []byte("b2"), AckFunc: ackFunc},
+		{Data: []byte("fail"), AckFunc: ackFunc},
+		{Data: []byte("c1"), AckFunc: ackFunc},
+	}
+
+	// Only the messages accepted by the target they are dispatched to are sent and acked
+	writeResult, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("(?s)Error writing to target a: write failed.*Error writing to target default: write failed", err.Error())
+	}
+	assert.Equal([]*models.Message{messages[1], messages[2], messages[4]}, writeResult.Sent)
+	assert.Equal([]*models.Message{messages[0], messages[3]}, writeResult.Failed)
+	assert.Equal(int64(3), ackOps)
+
+	assert.Equal([]string{"fail"}, targets["a"].written)
+	assert.Equal([]string{"b1", "b2"}, targets["b"].written)
+	assert.Equal([]string{"fail", "c1"}, targets["default"].written)
+}
+
+func TestRouterTarget_MaximumAckDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	delayed := &teeDelayedTarget{teeTestTarget: teeTestTarget{id: "delayed"}, delay: time.Minute}
+	target := newRouterTarget([]*route{{target: delayed}}, &routerTestTarget{id: "default"})
+	assert.Equal(time.Minute, target.MaximumAckDelay())
+
+	target = newRouterTarget([]*route{{target: &routerTestTarget{id: "a"}}}, &routerTestTarget{id: "default"})
+	assert.Equal(time.Duration(0), target.MaximumAckDelay())
+}
+
+func TestRouterTargetConfigFunction_Invalid(t *testing.T) {
+	_, newTarget := routerTestTargets("a", "default")
+
+	testCases := []struct {
+		Name   string
+		Config *RouterTargetConfig
+		Error  string
+	}{
+		{
+			"NoDefault",
+			&RouterTargetConfig{},
+			"The router target must have a default route",
+		},
+		{
+			"NoRules",
+			&RouterTargetConfig{Routes: []*RouteConfig{{Target: routerTestUse("a")}}, Default: routerTestUse("default")},
+			"Error creating route 0: A route must have at least one of atomic_field, partition_key_regex or a predicate",
+		},
+		{
+			"NoTarget",
+			&RouterTargetConfig{Routes: []*RouteConfig{{PartitionKeyRegex: "a"}}, Default: routerTestUse("default")},
+			"Error creating route 0: A route must have a target",
+		},
+		{
+			"NoRegex",
+			&RouterTargetConfig{Routes: []*RouteConfig{{AtomicField: "app_id", Target: routerTestUse("a")}}, Default: routerTestUse("default")},
+			"Error creating route 0: Both atomic_field and regex must be set to route by an atomic field",
+		},
+		{
+			"InvalidRegex",
+			&RouterTargetConfig{Routes: []*RouteConfig{{PartitionKeyRegex: "(", Target: routerTestUse("a")}}, Default: routerTestUse("default")},
+			"Error creating route 0: Error compiling partition key regex for route: .*",
+		},
+		{
+			"NoPredicates",
+			&RouterTargetConfig{Routes: []*RouteConfig{{Predicate: routerTestUse("js"), Target: routerTestUse("a")}}, Default: routerTestUse("default")},
+			"Error creating route 0: Route predicates are not supported",
+		},
+		{
+			"UnknownTarget",
+			&RouterTargetConfig{Default: routerTestUse("kinesis")},
+			"Error creating default route: unknown target kinesis",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			target, err := RouterTargetConfigFunction(newTarget, nil)(tt.Config)
+			assert.Nil(target)
+			assert.NotNil(err)
+			if err != nil {
+				assert.Regexp(tt.Error, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+
+	"github.com/snowplow/snowbridge/pkg/common"
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+const (
+	// The default key puts objects into a folder per hour
+	s3DefaultKeyTemplate = "{{ .Year }}/{{ .Month }}/{{ .Day }}/{{ .Hour }}/{{ .ID }}.ndjson"
+	// How often the buffered objects are checked for any which are due to be uploaded
+	s3FlushCheckInterval = time.Second
+)
+
+// S3TargetConfig configures the destination for records consumed
+type S3TargetConfig struct {
+	BucketName        string `hcl:"bucket_name" env:"TARGET_S3_BUCKET_NAME"`
+	Region            string `hcl:"region" env:"TARGET_S3_REGION"`
+	RoleARN           string `hcl:"role_arn,optional" env:"TARGET_S3_ROLE_ARN"`
+	CustomAWSEndpoint string `hcl:"custom_aws_endpoint,optional" env:"SOURCE_CUSTOM_AWS_ENDPOINT"`
+
+	KeyTemplate            string `hcl:"key_template,optional" env:"TARGET_S3_KEY_TEMPLATE"`
+	Compression            string `hcl:"compression,optional" env:"TARGET_S3_COMPRESSION"`
+	MaxObjectSizeBytes     int    `hcl:"max_object_size_bytes,optional" env:"TARGET_S3_MAX_OBJECT_SIZE_BYTES"`
+	FlushIntervalInSeconds int    `hcl:"flush_interval_in_seconds,optional" env:"TARGET_S3_FLUSH_INTERVAL_SECONDS"`
+}
+
+// S3Target holds a new client for writing messages to objects in an S3 bucket.
+//
+// Messages are buffered into objects, which are uploaded once they reach the maximum size or
+// have been buffered for the flush interval. Messages are only acked once their object has been
+// uploaded, so the source keeps them until then.
+type S3Target struct {
+	client     s3iface.S3API
+	bucketName string
+	region     string
+	accountID  string
+
+	keyTemplate   *template.Template
+	compression   string
+	extension     string
+	maxObjectSize int
+	flushInterval time.Duration
+
+	// objects are the objects being filled, by their key rendered without an ID, and ready are
+	// the objects which are due to be uploaded, including any which failed to upload
+	objects map[string]*s3Object
+	ready   []*s3Object
+	// uploaded are the messages uploaded in the background since the last write, which are
+	// reported as sent by the next write
+	uploaded []*models.Message
+	mutex    sync.Mutex
+
+	// now returns the current time, used to render keys and flush by time
+	now           func() time.Time
+	checkInterval time.Duration
+	stop          chan struct{}
+	stopped       sync.WaitGroup
+
+	log *log.Entry
+}
+
+// s3Object is a set of messages which will be uploaded together as one object
+type s3Object struct {
+	key      *s3KeyData
+	messages []*models.Message
+	bytes    int
+	opened   time.Time
+}
+
+// s3KeyData is what the key template is rendered against
+type s3KeyData struct {
+	// Year, Month, Day and Hour are the UTC time the object was started, zero padded
+	Year  string
+	Month string
+	Day   string
+	Hour  string
+
+	// PartitionKey is the partition key of the messages in the object
+	PartitionKey string
+
+	// ID is a unique ID for the object, which is empty while messages are being grouped
+	ID string
+
+	data func() *templateData
+}
+
+// Data returns the message data parsed as JSON, or nil if it isn't valid JSON. It is only parsed
+// if the key template uses it.
+func (d *s3KeyData) Data() interface{} {
+	return d.data().Data
+}
+
+// newS3Target creates a new client for writing messages to S3
+func newS3Target(region string, bucketName string, roleARN string, customAWSEndpoint string, keyTemplate string, compression string, maxObjectSizeBytes int, flushIntervalInSeconds int) (*S3Target, error) {
+	awsSession, awsConfig, awsAccountID, err := common.GetAWSSession(region, roleARN, customAWSEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// S3 compatible stores such as localstack and MinIO don't support bucket subdomains
+	s3Client := s3.New(awsSession, awsConfig, aws.NewConfig().WithS3ForcePathStyle(customAWSEndpoint != ""))
+
+	return newS3TargetWithInterfaces(s3Client, *awsAccountID, region, bucketName, keyTemplate, compression, maxObjectSizeBytes, flushIntervalInSeconds)
+}
+
+// newS3TargetWithInterfaces allows you to provide an S3 client directly to allow
+// for mocking and localstack usage
+func newS3TargetWithInterfaces(client s3iface.S3API, awsAccountID string, region string, bucketName string, keyTemplate string, compression string, maxObjectSizeBytes int, flushIntervalInSeconds int) (*S3Target, error) {
+	if keyTemplate == "" {
+		keyTemplate = s3DefaultKeyTemplate
+	}
+	if !strings.Contains(keyTemplate, ".ID") {
+		return nil, errors.New("The key template must include {{ .ID }}, so that every object has a unique key")
+	}
+	tmpl, err := parseTemplate("key", keyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err = getCompression(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxObjectSizeBytes <= 0 || flushIntervalInSeconds <= 0 {
+		return nil, errors.New("max_object_size_bytes and flush_interval_in_seconds must be greater than 0")
+	}
+
+	return &S3Target{
+		client:        client,
+		bucketName:    bucketName,
+		region:        region,
+		accountID:     awsAccountID,
+		keyTemplate:   tmpl,
+		compression:   compression,
+		extension:     getS3KeyExtension(compression),
+		maxObjectSize: maxObjectSizeBytes,
+		flushInterval: time.Duration(flushIntervalInSeconds) * time.Second,
+		objects:       make(map[string]*s3Object),
+		now:           time.Now,
+		checkInterval: s3FlushCheckInterval,
+		log:           log.WithFields(log.Fields{"target": "s3", "cloud": "AWS", "region": region, "bucket": bucketName}),
+	}, nil
+}
+
+// S3TargetConfigFunction creates S3Target from S3TargetConfig
+func S3TargetConfigFunction(c *S3TargetConfig) (*S3Target, error) {
+	return newS3Target(c.Region, c.BucketName, c.RoleARN, c.CustomAWSEndpoint, c.KeyTemplate, c.Compression, c.MaxObjectSizeBytes, c.FlushIntervalInSeconds)
+}
+
+// The S3TargetAdapter type is an adapter for functions to be used as
+// pluggable components for S3 Target. It implements the Pluggable interface.
+type S3TargetAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f S3TargetAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f S3TargetAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults for the optional parameters
+	// whose default is not their zero value.
+	cfg := &S3TargetConfig{
+		KeyTemplate:            s3DefaultKeyTemplate,
+		Compression:            compressionNone,
+		MaxObjectSizeBytes:     16777216,
+		FlushIntervalInSeconds: 60,
+	}
+
+	return cfg, nil
+}
+
+// AdaptS3TargetFunc returns an S3TargetAdapter.
+func AdaptS3TargetFunc(f func(c *S3TargetConfig) (*S3Target, error)) S3TargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*S3TargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected S3TargetConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// getS3KeyExtension returns the extension added to keys for the compression
+func getS3KeyExtension(compression string) string {
+	switch compression {
+	case compressionGzip:
+		return ".gz"
+	case compressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Write adds the messages to the buffered objects, and uploads any objects which are full or have
+// been buffered for the flush interval. Buffered messages aren't reported in the result until their
+// object has been uploaded, at which point they are acked and reported as sent.
+//
+// The messages in objects which fail to upload are reported as failed, so that they are written again.
+func (st *S3Target) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	st.log.Debugf("Writing %d messages to bucket ...", len(messages))
+
+	safeMessages, oversized := models.FilterOversizedMessages(
+		messages,
+		st.MaximumAllowedMessageSizeBytes(),
+	)
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	now := st.now().UTC()
+
+	var invalid []*models.Message
+	for _, msg := range safeMessages {
+		if err := st.buffer(msg, now); err != nil {
+			msg.SetError(err)
+			invalid = append(invalid, msg)
+		}
+	}
+
+	sent, failedObjects, err := st.flush(now, false)
+	sent = append(st.uploaded, sent...)
+	st.uploaded = nil
+
+	var failed []*models.Message
+	for _, obj := range failedObjects {
+		failed = append(failed, obj.messages...)
+	}
+
+	if err != nil {
+		err = errors.Wrap(err, "Error uploading objects to S3")
+	} else {
+		st.log.Debugf("Successfully wrote %d messages", len(sent))
+	}
+	return models.NewTargetWriteResult(
+		sent,
+		failed,
+		oversized,
+		invalid,
+	), err
+}
+
+// buffer adds a message to the object for its key, starting a new object if that one would
+// go over the maximum size
+func (st *S3Target) buffer(msg *models.Message, now time.Time) error {
+	// A message containing a newline would be read back as several records
+	if bytes.ContainsRune(msg.Data, '\n') {
+		return errors.New("Messages written to S3 cannot contain newlines")
+	}
+
+	key := &s3KeyData{
+		Year:         now.Format("2006"),
+		Month:        now.Format("01"),
+		Day:          now.Format("02"),
+		Hour:         now.Format("15"),
+		PartitionKey: msg.PartitionKey,
+		data:         lazyTemplateData(msg),
+	}
+	group, err := renderTemplate(st.keyTemplate, key)
+	if err != nil {
+		return err
+	}
+
+	size := len(msg.Data) + 1
+	obj := st.objects[string(group)]
+	if obj != nil && obj.bytes+size > st.maxObjectSize {
+		st.ready = append(st.ready, obj)
+		obj = nil
+	}
+	if obj == nil {
+		obj = &s3Object{key: key, opened: now}
+		st.objects[string(group)] = obj
+	}
+
+	obj.messages = append(obj.messages, msg)
+	obj.bytes += size
+	return nil
+}
+
+// flush uploads the objects which are ready, along with any which have been buffered for the flush
+// interval, or every object if all is set. The messages in the uploaded objects are acked and returned,
+// along with the objects which failed to upload.
+func (st *S3Target) flush(now time.Time, all bool) ([]*models.Message, []*s3Object, error) {
+	groups := make([]string, 0, len(st.objects))
+	for group, obj := range st.objects {
+		if all || now.Sub(obj.opened) >= st.flushInterval {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		st.ready = append(st.ready, st.objects[group])
+		delete(st.objects, group)
+	}
+
+	var sent []*models.Message
+	var failed []*s3Object
+	var errResult error
+
+	for _, obj := range st.ready {
+		if err := st.upload(obj); err != nil {
+			errResult = multierror.Append(errResult, err)
+			failed = append(failed, obj)
+			continue
+		}
+		sent = append(sent, obj.messages...)
+	}
+	st.ready = nil
+
+	return sent, failed, errResult
+}
+
+// upload uploads an object with a new unique key, acking its messages once it has been uploaded
+func (st *S3Target) upload(obj *s3Object) error {
+	obj.key.ID = uuid.NewV4().String()
+	key, err := renderTemplate(st.keyTemplate, obj.key)
+	if err != nil {
+		return err
+	}
+	objectKey := string(key) + st.extension
+
+	body, err := st.objectBody(obj)
+	if err != nil {
+		return err
+	}
+
+	requestStarted := time.Now()
+	_, err = st.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(st.bucketName),
+		Key:    aws.String(objectKey),
+		Body:   bytes.NewReader(body),
+	})
+	requestFinished := time.Now()
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Failed to upload object %s", objectKey))
+	}
+
+	for _, msg := range obj.messages {
+		msg.TimeRequestStarted = requestStarted
+		msg.TimeRequestFinished = requestFinished
+
+		if msg.AckFunc != nil {
+			msg.AckFunc()
+		}
+	}
+
+	st.log.Debugf("Uploaded object %s with %d messages", objectKey, len(obj.messages))
+	return nil
+}
+
+// objectBody returns the messages in an object as newline delimited records, compressed if configured
+func (st *S3Target) objectBody(obj *s3Object) ([]byte, error) {
+	var body bytes.Buffer
+	compressor, err := newCompressor(st.compression, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = &body
+	if compressor != nil {
+		w = compressor
+	}
+	for _, msg := range obj.messages {
+		if _, err := w.Write(msg.Data); err != nil {
+			return nil, errors.Wrap(err, "Failed to compress object")
+		}
+		if _, err := w.Write([]byte{'\n'}); err != nil {
+			return nil, errors.Wrap(err, "Failed to compress object")
+		}
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return nil, errors.Wrap(err, "Failed to compress object")
+		}
+	}
+
+	return body.Bytes(), nil
+}
+
+// flushOnInterval uploads objects which are due in the background, so that messages are still
+// uploaded when no further writes arrive. Objects which fail to upload are retried on the next check.
+func (st *S3Target) flushOnInterval() {
+	defer st.stopped.Done()
+
+	ticker := time.NewTicker(st.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-st.stop:
+			return
+		case <-ticker.C:
+			st.mutex.Lock()
+			sent, failed, err := st.flush(st.now().UTC(), false)
+			st.uploaded = append(st.uploaded, sent...)
+			st.ready = append(st.ready, failed...)
+			st.mutex.Unlock()
+
+			if err != nil {
+				st.log.WithFields(log.Fields{"error": err}).Warn("Failed to upload objects to S3, retrying")
+			}
+		}
+	}
+}
+
+// Open starts uploading objects when they are due in the background
+func (st *S3Target) Open() {
+	st.stop = make(chan struct{})
+	st.stopped.Add(1)
+	go st.flushOnInterval()
+}
+
+// Close stops the background uploads and uploads every buffered object. Messages in objects which
+// fail to upload aren't acked, so they are sent again by the source.
+func (st *S3Target) Close() {
+	if st.stop != nil {
+		close(st.stop)
+		st.stopped.Wait()
+		st.stop = nil
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if _, _, err := st.flush(st.now().UTC(), true); err != nil {
+		st.log.WithFields(log.Fields{"error": err}).Error("Failed to upload buffered objects to S3")
+	}
+}
+
+// MaximumAllowedMessageSizeBytes returns the max number of bytes that can be sent
+// per message for this target
+//
+// Note: Objects can be up to 5 GB but we are putting in a limit of 10 MiB here
+// to keep records to a manageable size
+func (st *S3Target) MaximumAllowedMessageSizeBytes() int {
+	return 10485760
+}
+
+// MaximumAckDelay returns how long messages may be buffered before they are uploaded and acked
+func (st *S3Target) MaximumAckDelay() time.Duration {
+	return st.flushInterval + st.checkInterval
+}
+
+// GetID returns the identifier for this target
+func (st *S3Target) GetID() string {
+	return fmt.Sprintf("arn:aws:s3:::%s", st.bucketName)
+}
@@ -0,0 +1,343 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/testutil"
+)
+
+// mockS3Client keeps the objects put into it, and fails the given number of puts first
+type mockS3Client struct {
+	s3iface.S3API
+
+	failures int
+	objects  map[string][]byte
+	mutex    sync.Mutex
+}
+
+func (m *mockS3Client) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.failures > 0 {
+		m.failures--
+		return nil, errors.New("ServiceUnavailable")
+	}
+
+	body, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	if m.objects == nil {
+		m.objects = make(map[string][]byte)
+	}
+	m.objects[*input.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+// bodies returns the sorted bodies of the objects put, by their key with the ID replaced by "ID"
+func (m *mockS3Client) bodies() map[string][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	id := regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	bodies := make(map[string][]string)
+	for key, body := range m.objects {
+		key = id.ReplaceAllString(key, "ID")
+		bodies[key] = append(bodies[key], string(body))
+		sort.Strings(bodies[key])
+	}
+	return bodies
+}
+
+func TestS3Target_WriteFlushBySize(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockS3Client{}
+	target, err := newS3TargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "bucket", "{{ .PartitionKey }}/{{ .ID }}", "", 12, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("one"), PartitionKey: "a", AckFunc: ackFunc},
+		{Data: []byte("two"), PartitionKey: "a", AckFunc: ackFunc},
+		{Data: []byte("three"), PartitionKey: "b", AckFunc: ackFunc},
+		{Data: []byte("four"), PartitionKey: "a", AckFunc: ackFunc},
+		{Data: []byte("fi\nve"), PartitionKey: "a", AckFunc: ackFunc},
+	}
+
+	// The object for partition key "a" is full once "four" is added
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(2, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Equal("Messages written to S3 cannot contain newlines", writeResult.Invalid[0].GetError().Error())
+	assert.Equal(int64(2), ackOps)
+	assert.Equal(map[string][]string{"a/ID": {"one\ntwo\n"}}, client.bodies())
+
+	// The remaining objects are uploaded on close
+	target.Close()
+	assert.Equal(int64(4), ackOps)
+	assert.Equal(map[string][]string{"a/ID": {"four\n", "one\ntwo\n"}, "b/ID": {"three\n"}}, client.bodies())
+}
+
+func TestS3Target_WriteFlushByTime(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockS3Client{}
+	target, err := newS3TargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "bucket", "", "gzip", 1048576, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2023, 12, 31, 23, 59, 30, 0, time.UTC)
+	target.now = func() time.Time { return now }
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	writeResult, err := target.Write(testutil.GetTestMessages(2, "Hello S3!!", ackFunc))
+	assert.Nil(err)
+	assert.Equal(0, len(writeResult.Sent))
+	assert.Equal(int64(0), ackOps)
+
+	// Messages buffered in the next hour go into another object
+	now = now.Add(time.Minute)
+	writeResult2, err2 := target.Write(testutil.GetTestMessages(1, "Goodbye S3!!", ackFunc))
+	assert.Nil(err2)
+	assert.Equal(2, len(writeResult2.Sent))
+	assert.Equal(int64(2), ackOps)
+
+	now = now.Add(time.Minute)
+	writeResult3, err3 := target.Write(nil)
+	assert.Nil(err3)
+	assert.Equal(1, len(writeResult3.Sent))
+	assert.Equal(int64(3), ackOps)
+
+	bodies := make(map[string]string)
+	for key, objects := range client.bodies() {
+		assert.Equal(1, len(objects))
+		reader, err := gzip.NewReader(bytes.NewReader([]byte(objects[0])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[key] = string(data)
+	}
+	assert.Equal(map[string]string{
+		"2023/12/31/23/ID.ndjson.gz": "Hello S3!!\nHello S3!!\n",
+		"2024/01/01/00/ID.ndjson.gz": "Goodbye S3!!\n",
+	}, bodies)
+}
+
+func TestS3Target_WriteFlushInBackground(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockS3Client{}
+	target, err := newS3TargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "bucket", "{{ .ID }}", "", 1048576, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var now int64
+	target.now = func() time.Time { return time.Unix(atomic.LoadInt64(&now), 0) }
+	target.checkInterval = 10 * time.Millisecond
+	target.Open()
+	defer target.Close()
+	assert.Equal(60*time.Second+10*time.Millisecond, target.MaximumAckDelay())
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	writeResult, err := target.Write(testutil.GetTestMessages(3, "Hello S3!!", ackFunc))
+	assert.Nil(err)
+	assert.Equal(0, len(writeResult.Sent))
+
+	// Objects are uploaded once they are due without any further writes
+	atomic.StoreInt64(&now, 60)
+	assert.Eventually(func() bool { return atomic.LoadInt64(&ackOps) == 3 }, time.Second, 10*time.Millisecond)
+
+	// The messages uploaded in the background are reported by the next write
+	writeResult2, err2 := target.Write(nil)
+	assert.Nil(err2)
+	assert.Equal(3, len(writeResult2.Sent))
+}
+
+func TestS3Target_WriteUploadFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockS3Client{failures: 1}
+	target, err := newS3TargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "bucket", "{{ .ID }}", "", 10, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	writeResult, err := target.Write(testutil.GetTestMessages(2, "Hello S3!!", ackFunc))
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("(?s)Error uploading objects to S3: .*Failed to upload object .*: ServiceUnavailable", err.Error())
+	}
+	assert.Equal(0, len(writeResult.Sent))
+	assert.Equal(1, len(writeResult.Failed))
+	assert.Equal(int64(0), ackOps)
+
+	// The messages which failed to upload are written again, and the full object they join is uploaded
+	writeResult2, err2 := target.Write(writeResult.Failed)
+	assert.Nil(err2)
+	assert.Equal(1, len(writeResult2.Sent))
+	assert.Equal(0, len(writeResult2.Failed))
+	assert.Equal(int64(1), ackOps)
+
+	target.Close()
+	assert.Equal(int64(2), ackOps)
+	assert.Equal(map[string][]string{"ID": {"Hello S3!!\n", "Hello S3!!\n"}}, client.bodies())
+}
+
+func TestS3Target_WriteKeyTemplateData(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockS3Client{}
+	target, err := newS3TargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "bucket", "{{ .Data.app_id }}/{{ .ID }}", "", 1048576, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte(`{"app_id":"app1","n":1}`)},
+		{Data: []byte(`{"app_id":"app2","n":2}`)},
+		{Data: []byte(`{"app_id":"app1","n":3}`)},
+		{Data: []byte(`{"n":4}`)},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(1, len(writeResult.Invalid))
+	assert.Regexp("Error rendering key template: .*", writeResult.Invalid[0].GetError().Error())
+	target.Close()
+
+	assert.Equal(map[string][]string{
+		"app1/ID": {"{\"app_id\":\"app1\",\"n\":1}\n{\"app_id\":\"app1\",\"n\":3}\n"},
+		"app2/ID": {"{\"app_id\":\"app2\",\"n\":2}\n"},
+	}, client.bodies())
+}
+
+func TestNewS3Target_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newS3TargetWithInterfaces(&mockS3Client{}, "00000000000", testutil.AWSLocalstackRegion, "bucket", "{{ .Year }}/events.ndjson", "", 1048576, 60)
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("The key template must include {{ .ID }}, so that every object has a unique key", err.Error())
+	}
+
+	target2, err2 := newS3TargetWithInterfaces(&mockS3Client{}, "00000000000", testutil.AWSLocalstackRegion, "bucket", "{{ .ID }", "", 1048576, 60)
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Regexp("Error parsing key template: .*", err2.Error())
+	}
+
+	target3, err3 := newS3TargetWithInterfaces(&mockS3Client{}, "00000000000", testutil.AWSLocalstackRegion, "bucket", "", "lz4", 1048576, 60)
+	assert.Nil(target3)
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Equal("Invalid compression 'lz4', must be one of 'none', 'gzip' or 'zstd'", err3.Error())
+	}
+
+	target4, err4 := newS3TargetWithInterfaces(&mockS3Client{}, "00000000000", testutil.AWSLocalstackRegion, "bucket", "", "", 1048576, 0)
+	assert.Nil(target4)
+	assert.NotNil(err4)
+	if err4 != nil {
+		assert.Equal("max_object_size_bytes and flush_interval_in_seconds must be greater than 0", err4.Error())
+	}
+}
+
+func TestS3Target_WriteSuccess(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	assert := assert.New(t)
+
+	client := testutil.GetAWSLocalstackS3Client()
+
+	bucketName := "s3-target-1"
+	_, err := testutil.CreateAWSLocalstackS3Bucket(client, bucketName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testutil.DeleteAWSLocalstackS3Bucket(client, bucketName)
+
+	target, err := newS3TargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, bucketName, "", "zstd", 1048576, 60)
+	assert.Nil(err)
+	assert.NotNil(target)
+	assert.Equal("arn:aws:s3:::s3-target-1", target.GetID())
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := testutil.GetTestMessages(100, "Hello S3!!", ackFunc)
+
+	writeRes, err := target.Write(messages)
+	assert.Nil(err)
+	assert.NotNil(writeRes)
+	assert.Equal(int64(0), ackOps)
+
+	target.Close()
+	assert.Equal(int64(100), ackOps)
+
+	res, err := client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucketName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, obj := range res.Contents {
+		keys = append(keys, *obj.Key)
+	}
+	sort.Strings(keys)
+	assert.Equal(1, len(keys))
+	assert.Regexp(`^\d{4}/\d{2}/\d{2}/\d{2}/.*\.ndjson\.zst$`, keys[0])
+}
@@ -0,0 +1,474 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/snowplow/snowbridge/pkg/common"
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+const (
+	hecEventEndpoint           = "/services/collector/event"
+	hecIndexerAckEndpoint      = "/services/collector/ack"
+	hecIndexerAckChannelHeader = "X-Splunk-Request-Channel"
+	hecIndexerAckPollInterval  = time.Second
+)
+
+// The HEC response codes for a request rejected because of one of its events, which are sent
+// with the number of that event. API Documentation:
+// https://docs.splunk.com/Documentation/Splunk/latest/Data/TroubleshootHTTPEventCollector
+const (
+	hecCodeInvalidDataFormat  = 6
+	hecCodeEventFieldRequired = 12
+	hecCodeEventFieldBlank    = 13
+	hecCodeIndexedFieldsError = 15
+)
+
+// SplunkHECTargetConfig configures the destination for records consumed
+type SplunkHECTargetConfig struct {
+	URL                     string `hcl:"url" env:"TARGET_SPLUNK_HEC_URL"`
+	Token                   string `hcl:"token" env:"TARGET_SPLUNK_HEC_TOKEN"`
+	SourceType              string `hcl:"sourcetype,optional" env:"TARGET_SPLUNK_HEC_SOURCETYPE"`
+	Source                  string `hcl:"source,optional" env:"TARGET_SPLUNK_HEC_SOURCE"`
+	Index                   string `hcl:"index,optional" env:"TARGET_SPLUNK_HEC_INDEX"`
+	RequestTimeoutInSeconds int    `hcl:"request_timeout_in_seconds,optional" env:"TARGET_SPLUNK_HEC_TIMEOUT_IN_SECONDS"`
+	BatchMaxMessages        int    `hcl:"batch_max_messages,optional" env:"TARGET_SPLUNK_HEC_BATCH_MAX_MESSAGES"`
+	BatchByteLimit          int    `hcl:"batch_byte_limit,optional" env:"TARGET_SPLUNK_HEC_BATCH_BYTE_LIMIT"`
+	CertFile                string `hcl:"cert_file,optional" env:"TARGET_SPLUNK_HEC_TLS_CERT_FILE"`
+	KeyFile                 string `hcl:"key_file,optional" env:"TARGET_SPLUNK_HEC_TLS_KEY_FILE"`
+	CaFile                  string `hcl:"ca_file,optional" env:"TARGET_SPLUNK_HEC_TLS_CA_FILE"`
+	SkipVerifyTLS           bool   `hcl:"skip_verify_tls,optional" env:"TARGET_SPLUNK_HEC_TLS_SKIP_VERIFY_TLS"` // false
+
+	IndexerAckChannel          string `hcl:"indexer_ack_channel,optional" env:"TARGET_SPLUNK_HEC_INDEXER_ACK_CHANNEL"`
+	IndexerAckTimeoutInSeconds int    `hcl:"indexer_ack_timeout_in_seconds,optional" env:"TARGET_SPLUNK_HEC_INDEXER_ACK_TIMEOUT_IN_SECONDS"`
+}
+
+// SplunkHECTarget holds a new client for sending messages to a Splunk HTTP Event Collector
+type SplunkHECTarget struct {
+	client           *http.Client
+	url              string
+	eventURL         string
+	ackURL           string
+	token            string
+	sourceType       string
+	source           string
+	index            string
+	batchMaxMessages int
+	batchByteLimit   int
+	// envelopeBytes is the size an event adds to a message, besides the escaping of its data
+	envelopeBytes int
+
+	// When an indexer acknowledgement channel is set, messages are only acked once HEC
+	// confirms that their events have been indexed
+	ackChannel      string
+	ackTimeout      time.Duration
+	ackPollInterval time.Duration
+
+	log *log.Entry
+}
+
+// hecEvent is the envelope each message is sent in
+type hecEvent struct {
+	Time       json.Number     `json:"time,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	SourceType string          `json:"sourcetype,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Event      json.RawMessage `json:"event"`
+}
+
+// hecResponse is the response to a request to HEC
+type hecResponse struct {
+	Text               string `json:"text"`
+	Code               int    `json:"code"`
+	InvalidEventNumber *int   `json:"invalid-event-number"`
+	AckID              *int64 `json:"ackId"`
+}
+
+// hecAckResponse is the response to a query for the status of indexer acknowledgements
+type hecAckResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// newSplunkHECTarget creates a client for sending messages to a Splunk HTTP Event Collector
+func newSplunkHECTarget(hecURL string, token string, sourceType string, source string, index string, requestTimeout int, batchMaxMessages int, batchByteLimit int,
+	certFile string, keyFile string, caFile string, skipVerifyTLS bool,
+	indexerAckChannel string, indexerAckTimeout int) (*SplunkHECTarget, error) {
+	if err := checkURL(hecURL); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, errors.New("A token must be set for the Splunk HEC target")
+	}
+	if batchMaxMessages < 1 {
+		batchMaxMessages = 1
+	}
+
+	transport := &http.Transport{}
+	tlsConfig, err := common.CreateTLSConfiguration(certFile, keyFile, caFile, skipVerifyTLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	// The envelope is measured around an empty string event with the longest time
+	envelope, err := json.Marshal(hecEvent{
+		Time:       json.Number("9999999999.999"),
+		Source:     source,
+		SourceType: sourceType,
+		Index:      index,
+		Event:      json.RawMessage(`""`),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding event envelope")
+	}
+
+	base := strings.TrimSuffix(hecURL, "/")
+	return &SplunkHECTarget{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(requestTimeout) * time.Second,
+		},
+		url:              hecURL,
+		eventURL:         base + hecEventEndpoint,
+		ackURL:           base + hecIndexerAckEndpoint + "?channel=" + url.QueryEscape(indexerAckChannel),
+		token:            token,
+		sourceType:       sourceType,
+		source:           source,
+		index:            index,
+		batchMaxMessages: batchMaxMessages,
+		batchByteLimit:   batchByteLimit,
+		envelopeBytes:    len(envelope) + 1,
+		ackChannel:       indexerAckChannel,
+		ackTimeout:       time.Duration(indexerAckTimeout) * time.Second,
+		ackPollInterval:  hecIndexerAckPollInterval,
+		log:              log.WithFields(log.Fields{"target": "splunk_hec", "url": hecURL}),
+	}, nil
+}
+
+// SplunkHECTargetConfigFunction creates SplunkHECTarget from SplunkHECTargetConfig
+func SplunkHECTargetConfigFunction(c *SplunkHECTargetConfig) (*SplunkHECTarget, error) {
+	return newSplunkHECTarget(
+		c.URL,
+		c.Token,
+		c.SourceType,
+		c.Source,
+		c.Index,
+		c.RequestTimeoutInSeconds,
+		c.BatchMaxMessages,
+		c.BatchByteLimit,
+		c.CertFile,
+		c.KeyFile,
+		c.CaFile,
+		c.SkipVerifyTLS,
+		c.IndexerAckChannel,
+		c.IndexerAckTimeoutInSeconds,
+	)
+}
+
+// The SplunkHECTargetAdapter type is an adapter for functions to be used as
+// pluggable components for Splunk HEC Target. It implements the Pluggable interface.
+type SplunkHECTargetAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f SplunkHECTargetAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f SplunkHECTargetAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults for the optional parameters
+	// whose default is not their zero value.
+	cfg := &SplunkHECTargetConfig{
+		RequestTimeoutInSeconds:    5,
+		BatchMaxMessages:           100,
+		BatchByteLimit:             1048576,
+		IndexerAckTimeoutInSeconds: 60,
+	}
+
+	return cfg, nil
+}
+
+// AdaptSplunkHECTargetFunc returns a SplunkHECTargetAdapter.
+func AdaptSplunkHECTargetFunc(f func(c *SplunkHECTargetConfig) (*SplunkHECTarget, error)) SplunkHECTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*SplunkHECTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected SplunkHECTargetConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// Write sends the messages to HEC with a request per chunk. Messages are chunked by the size of their
+// events, so those whose event doesn't fit in a request on its own are oversized.
+func (st *SplunkHECTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	st.log.Debugf("Writing %d messages to Splunk HEC ...", len(messages))
+
+	events := make(map[*models.Message][]byte, len(messages))
+	var safe, oversized, invalid []*models.Message
+	for _, msg := range messages {
+		event, err := st.encodeEvent(msg)
+		if err != nil {
+			msg.SetError(err)
+			invalid = append(invalid, msg)
+			continue
+		}
+		if len(event)+1 > st.batchByteLimit {
+			oversized = append(oversized, msg)
+			continue
+		}
+		events[msg] = event
+		safe = append(safe, msg)
+	}
+
+	writeResult := &models.TargetWriteResult{
+		Oversized: oversized,
+		Invalid:   invalid,
+	}
+
+	var errResult error
+
+	for _, chunk := range st.chunkEvents(safe, events) {
+		res, err := st.process(chunk, events)
+		writeResult = writeResult.Append(res)
+
+		if err != nil {
+			errResult = multierror.Append(errResult, err)
+		}
+	}
+
+	if errResult != nil {
+		errResult = errors.Wrap(errResult, "Error writing messages to Splunk HEC")
+	}
+
+	st.log.Debugf("Successfully wrote %d/%d messages", len(writeResult.Sent), len(messages))
+	return writeResult, errResult
+}
+
+// chunkEvents divides the messages into chunks which fit in a single request, by the size of their events
+func (st *SplunkHECTarget) chunkEvents(messages []*models.Message, events map[*models.Message][]byte) [][]*models.Message {
+	var chunks [][]*models.Message
+	var chunk []*models.Message
+	var chunkBytes int
+
+	for _, msg := range messages {
+		size := len(events[msg]) + 1
+		if len(chunk) == st.batchMaxMessages || (len(chunk) > 0 && chunkBytes+size > st.batchByteLimit) {
+			chunks = append(chunks, chunk)
+			chunk = nil
+			chunkBytes = 0
+		}
+		chunk = append(chunk, msg)
+		chunkBytes += size
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// process sends a chunk of messages in a single request, splitting them by the response. The events
+// are concatenated into the body, separated by newlines.
+func (st *SplunkHECTarget) process(messages []*models.Message, events map[*models.Message][]byte) (*models.TargetWriteResult, error) {
+	var body bytes.Buffer
+	for _, msg := range messages {
+		body.Write(events[msg])
+		body.WriteByte('\n')
+	}
+
+	requestStarted := time.Now()
+	resp, err := st.send(body.Bytes())
+	if err == nil && resp.Code == 0 && st.ackChannel != "" {
+		err = st.waitForIndexerAck(resp.AckID)
+	}
+	requestFinished := time.Now()
+
+	for _, msg := range messages {
+		msg.TimeRequestStarted = requestStarted
+		msg.TimeRequestFinished = requestFinished
+	}
+
+	if err != nil {
+		return models.NewTargetWriteResult(nil, messages, nil, nil), err
+	}
+
+	switch resp.Code {
+	case 0:
+		for _, msg := range messages {
+			if msg.AckFunc != nil {
+				msg.AckFunc()
+			}
+		}
+		return models.NewTargetWriteResult(messages, nil, nil, nil), nil
+	case hecCodeInvalidDataFormat, hecCodeEventFieldRequired, hecCodeEventFieldBlank, hecCodeIndexedFieldsError:
+		// HEC rejects the whole request because of a single event, which will never be accepted. The
+		// other events are retried without it.
+		if n := resp.InvalidEventNumber; n != nil && *n >= 0 && *n < len(messages) {
+			invalid := messages[*n]
+			invalid.SetError(errors.New(fmt.Sprintf("Event rejected by Splunk HEC with code %d: %s", resp.Code, resp.Text)))
+
+			failed := make([]*models.Message, 0, len(messages)-1)
+			failed = append(failed, messages[:*n]...)
+			failed = append(failed, messages[*n+1:]...)
+			return models.NewTargetWriteResult(nil, failed, nil, []*models.Message{invalid}),
+				errors.New(fmt.Sprintf("Got HEC response code %d for event %d: %s", resp.Code, *n, resp.Text))
+		}
+	}
+
+	return models.NewTargetWriteResult(nil, messages, nil, nil), errors.New(fmt.Sprintf("Got HEC response code %d: %s", resp.Code, resp.Text))
+}
+
+// encodeEvent wraps a message in the event envelope
+func (st *SplunkHECTarget) encodeEvent(msg *models.Message) ([]byte, error) {
+	event := hecEvent{
+		Source:     st.source,
+		SourceType: st.sourceType,
+		Index:      st.index,
+	}
+	if !msg.TimeCreated.IsZero() {
+		event.Time = hecTime(msg.TimeCreated)
+	}
+
+	// Messages which are JSON are sent as JSON events, and anything else as a string
+	if json.Valid(msg.Data) {
+		event.Event = msg.Data
+	} else {
+		s, err := json.Marshal(string(msg.Data))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error encoding event")
+		}
+		event.Event = s
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error encoding event")
+	}
+	return b, nil
+}
+
+// hecTime formats a time as seconds since the epoch, with millisecond precision
+func hecTime(t time.Time) json.Number {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	return json.Number(fmt.Sprintf("%d.%03d", ms/1000, ms%1000))
+}
+
+// send makes a request to HEC, returning the response. Only responses which fail without a HEC
+// response code are returned as an error.
+func (st *SplunkHECTarget) send(body []byte) (*hecResponse, error) {
+	resp, err := st.post(st.eventURL, body)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+	var parsed hecResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil || (parsed.Code == 0 && resp.StatusCode != http.StatusOK) {
+		return nil, errors.New(fmt.Sprintf("Got response status: %s, body: %s", resp.Status, string(respBody)))
+	}
+	return &parsed, nil
+}
+
+// waitForIndexerAck polls HEC until it acknowledges that the events of a request have been indexed
+func (st *SplunkHECTarget) waitForIndexerAck(ackID *int64) error {
+	if ackID == nil {
+		return errors.New("Got no ackId from HEC, check that indexer acknowledgement is enabled for the token")
+	}
+	id := strconv.FormatInt(*ackID, 10)
+	body := []byte(fmt.Sprintf(`{"acks":[%s]}`, id))
+
+	deadline := time.Now().Add(st.ackTimeout)
+	for {
+		acked, err := st.queryIndexerAck(body, id)
+		if err != nil {
+			return err
+		}
+		if acked {
+			return nil
+		}
+		if time.Now().Add(st.ackPollInterval).After(deadline) {
+			return errors.New(fmt.Sprintf("Timed out waiting for HEC to acknowledge ackId %s", id))
+		}
+		time.Sleep(st.ackPollInterval)
+	}
+}
+
+// queryIndexerAck reports whether HEC has acknowledged an ackId
+func (st *SplunkHECTarget) queryIndexerAck(body []byte, id string) (bool, error) {
+	resp, err := st.post(st.ackURL, body)
+	if err != nil {
+		return false, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+		return false, errors.New(fmt.Sprintf("Got response status querying indexer acknowledgement: %s, body: %s", resp.Status, string(respBody)))
+	}
+
+	var parsed hecAckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return false, errors.Wrap(err, "Error parsing indexer acknowledgement response")
+	}
+	return parsed.Acks[id], nil
+}
+
+// post makes an authenticated request to HEC
+func (st *SplunkHECTarget) post(endpoint string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Splunk "+st.token)
+	if st.ackChannel != "" {
+		request.Header.Add(hecIndexerAckChannelHeader, st.ackChannel)
+	}
+
+	return st.client.Do(request)
+}
+
+// Open does nothing for this target
+func (st *SplunkHECTarget) Open() {}
+
+// Close does nothing for this target
+func (st *SplunkHECTarget) Close() {}
+
+// MaximumAllowedMessageSizeBytes returns the max number of bytes that can be sent
+// per message for this target
+//
+// Note: This leaves room for the event envelope, but messages whose data grows when escaped
+// may still be oversized once encoded
+func (st *SplunkHECTarget) MaximumAllowedMessageSizeBytes() int {
+	return st.batchByteLimit - st.envelopeBytes
+}
+
+// GetID returns an identifier for this target
+func (st *SplunkHECTarget) GetID() string {
+	return st.url
+}
@@ -0,0 +1,313 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// hecTestServer stands in for HEC, responding to event requests with the responses given in turn,
+// and acknowledging an ackId once it has been queried the given number of times
+type hecTestServer struct {
+	*httptest.Server
+
+	requests      []string
+	authorization []string
+	channels      []string
+	ackQueries    int
+	mutex         sync.Mutex
+}
+
+func newHECTestServer(t *testing.T, ackAfterQueries int, responses ...string) *hecTestServer {
+	s := &hecTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			panic(err)
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		switch req.URL.Path {
+		case "/services/collector/event":
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+			s.requests = append(s.requests, string(body))
+			s.authorization = append(s.authorization, req.Header.Get("Authorization"))
+			s.channels = append(s.channels, req.Header.Get("X-Splunk-Request-Channel"))
+
+			response := `{"text":"Success","code":0}`
+			if len(responses) > 0 {
+				response, responses = responses[0], responses[1:]
+			}
+			var status int
+			fmt.Sscanf(response, "%d ", &status)
+			if status != 0 {
+				w.WriteHeader(status)
+				response = response[4:]
+			}
+			w.Write([]byte(response))
+		case "/services/collector/ack":
+			assert.Equal(t, "ch-1", req.URL.Query().Get("channel"))
+			assert.Equal(t, `{"acks":[7]}`, string(body))
+			s.ackQueries++
+			fmt.Fprintf(w, `{"acks":{"7":%t}}`, s.ackQueries >= ackAfterQueries)
+		default:
+			t.Errorf("Unexpected request path %s", req.URL.Path)
+		}
+	}))
+	return s
+}
+
+func TestSplunkHECTarget_WriteEnvelope(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newHECTestServer(t, 0)
+	defer server.Close()
+
+	target, err := newSplunkHECTarget(server.URL+"/", "token", "snowplow:enriched", "snowbridge", "events", 5, 2, 1048576, "", "", "", false, "", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 6007000, time.UTC)
+	messages := []*models.Message{
+		{Data: []byte(`{"app_id":"app1"}`), TimeCreated: created, AckFunc: ackFunc},
+		{Data: []byte("not\t\"json\""), TimeCreated: created, AckFunc: ackFunc},
+		{Data: []byte(`["an","array"]`), AckFunc: ackFunc},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(3, len(writeResult.Sent))
+	assert.Equal(int64(3), ackOps)
+	assert.Equal("http://"+server.Listener.Addr().String()+"/", target.GetID())
+
+	// Every chunk is sent in its own request
+	assert.Equal([]string{
+		`{"time":1704164645.006,"source":"snowbridge","sourcetype":"snowplow:enriched","index":"events","event":{"app_id":"app1"}}` + "\n" +
+			`{"time":1704164645.006,"source":"snowbridge","sourcetype":"snowplow:enriched","index":"events","event":"not\t\"json\""}` + "\n",
+		`{"source":"snowbridge","sourcetype":"snowplow:enriched","index":"events","event":["an","array"]}` + "\n",
+	}, server.requests)
+	assert.Equal([]string{"Splunk token", "Splunk token"}, server.authorization)
+	assert.Equal([]string{"", ""}, server.channels)
+}
+
+func TestSplunkHECTarget_WriteOversized(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newHECTestServer(t, 0)
+	defer server.Close()
+
+	target, err := newSplunkHECTarget(server.URL, "token", "snowplow:enriched", "snowbridge", "events", 5, 2, 200, "", "", "", false, "", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The maximum message size leaves room for the envelope
+	envelope := `{"time":9999999999.999,"source":"snowbridge","sourcetype":"snowplow:enriched","index":"events","event":""}` + "\n"
+	maxSize := 200 - len(envelope)
+	assert.Equal(maxSize, target.MaximumAllowedMessageSizeBytes())
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 6007000, time.UTC)
+	messages := []*models.Message{
+		{Data: []byte(strings.Repeat("a", maxSize)), TimeCreated: created, AckFunc: ackFunc},
+		{Data: []byte(strings.Repeat(`"`, maxSize)), TimeCreated: created, AckFunc: ackFunc},
+		{Data: []byte(strings.Repeat("b", maxSize)), TimeCreated: created, AckFunc: ackFunc},
+	}
+
+	// Messages whose data grows too large once escaped are oversized, and chunks are limited by the size of their events
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal([]*models.Message{messages[0], messages[2]}, writeResult.Sent)
+	assert.Equal([]*models.Message{messages[1]}, writeResult.Oversized)
+	assert.Equal(int64(2), ackOps)
+	assert.Equal(2, len(server.requests))
+	for _, request := range server.requests {
+		assert.Equal(200, len(request))
+	}
+}
+
+func TestSplunkHECTarget_WriteInvalidEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newHECTestServer(t, 0, `400 {"text":"Event field cannot be blank","code":13,"invalid-event-number":1}`)
+	defer server.Close()
+
+	target, err := newSplunkHECTarget(server.URL, "token", "", "", "", 5, 10, 1048576, "", "", "", false, "", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte(`{"n":1}`), AckFunc: ackFunc},
+		{Data: []byte(``), AckFunc: ackFunc},
+		{Data: []byte(`{"n":3}`), AckFunc: ackFunc},
+	}
+
+	// The invalid event is rejected, and the rest of the request is retried without it
+	writeResult, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Got HEC response code 13 for event 1: Event field cannot be blank", err.Error())
+	}
+	assert.Equal(0, len(writeResult.Sent))
+	assert.Equal([]*models.Message{messages[0], messages[2]}, writeResult.Failed)
+	assert.Equal([]*models.Message{messages[1]}, writeResult.Invalid)
+	assert.Equal("Event rejected by Splunk HEC with code 13: Event field cannot be blank", messages[1].GetError().Error())
+	assert.Equal(int64(0), ackOps)
+
+	writeResult2, err2 := target.Write(writeResult.Failed)
+	assert.Nil(err2)
+	assert.Equal(2, len(writeResult2.Sent))
+	assert.Equal(int64(2), ackOps)
+}
+
+func TestSplunkHECTarget_WriteFailure(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Response string
+		Error    string
+	}{
+		{"ServerBusy", `503 {"text":"Server is busy","code":9}`, "Got HEC response code 9: Server is busy"},
+		{"InvalidToken", `403 {"text":"Invalid token","code":4}`, "Got HEC response code 4: Invalid token"},
+		{"IncorrectIndex", `400 {"text":"Incorrect index","code":7,"invalid-event-number":0}`, "Got HEC response code 7: Incorrect index"},
+		{"NotHEC", `502 Bad Gateway`, "Got response status: 502 Bad Gateway, body: Bad Gateway"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			server := newHECTestServer(t, 0, tt.Response)
+			defer server.Close()
+
+			target, err := newSplunkHECTarget(server.URL, "token", "", "", "", 5, 10, 1048576, "", "", "", false, "", 60)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ackOps int64
+			ackFunc := func() {
+				atomic.AddInt64(&ackOps, 1)
+			}
+
+			writeResult, err := target.Write([]*models.Message{{Data: []byte(`{}`), AckFunc: ackFunc}, {Data: []byte(`{}`), AckFunc: ackFunc}})
+			assert.NotNil(err)
+			if err != nil {
+				assert.Regexp(tt.Error, err.Error())
+			}
+			assert.Equal(2, len(writeResult.Failed))
+			assert.Equal(0, len(writeResult.Invalid))
+			assert.Equal(int64(0), ackOps)
+		})
+	}
+}
+
+func TestSplunkHECTarget_WriteIndexerAck(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newHECTestServer(t, 3, `{"text":"Success","code":0,"ackId":7}`)
+	defer server.Close()
+
+	target, err := newSplunkHECTarget(server.URL, "token", "", "", "", 5, 10, 1048576, "", "", "", false, "ch-1", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.ackPollInterval = 10 * time.Millisecond
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	// Messages are only acked once HEC acknowledges that their events are indexed
+	writeResult, err := target.Write([]*models.Message{{Data: []byte(`{}`), AckFunc: ackFunc}})
+	assert.Nil(err)
+	assert.Equal(1, len(writeResult.Sent))
+	assert.Equal(int64(1), ackOps)
+	assert.Equal(3, server.ackQueries)
+	assert.Equal([]string{"ch-1"}, server.channels)
+}
+
+func TestSplunkHECTarget_WriteIndexerAckTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newHECTestServer(t, 1000, `{"text":"Success","code":0,"ackId":7}`, `{"text":"Success","code":0}`)
+	defer server.Close()
+
+	target, err := newSplunkHECTarget(server.URL, "token", "", "", "", 5, 10, 1048576, "", "", "", false, "ch-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	writeResult, err := target.Write([]*models.Message{{Data: []byte(`{}`), AckFunc: ackFunc}})
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Timed out waiting for HEC to acknowledge ackId 7", err.Error())
+	}
+	assert.Equal(1, len(writeResult.Failed))
+
+	writeResult2, err2 := target.Write([]*models.Message{{Data: []byte(`{}`), AckFunc: ackFunc}})
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Regexp("Got no ackId from HEC, check that indexer acknowledgement is enabled for the token", err2.Error())
+	}
+	assert.Equal(1, len(writeResult2.Failed))
+	assert.Equal(int64(0), ackOps)
+}
+
+func TestNewSplunkHECTarget_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newSplunkHECTarget("localhost:8088", "token", "", "", "", 5, 10, 1048576, "", "", "", false, "", 60)
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("Invalid url for HTTP target: 'localhost:8088'", err.Error())
+	}
+
+	target2, err2 := newSplunkHECTarget("https://localhost:8088", "", "", "", "", 5, 10, 1048576, "", "", "", false, "", 60)
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("A token must be set for the Splunk HEC target", err2.Error())
+	}
+}
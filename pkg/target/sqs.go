@@ -8,8 +8,12 @@
 package target
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -32,6 +36,14 @@ const (
 	sqsSendMessageByteLimit = 262144
 	// Each request can be a maximum of 256 KB in size total
 	sqsSendMessageBatchByteLimit = 262144
+	// Messages can be delayed by up to 15 minutes
+	sqsMaxDelaySeconds = 900
+	// Each message can have up to 10 attributes
+	sqsMaxMessageAttributes = 10
+	// Message group and deduplication IDs can be up to 128 characters long
+	sqsMaxFIFOIDLength = 128
+	// FIFO queue names must end with this suffix
+	sqsFIFOQueueSuffix = ".fifo"
 )
 
 // SQSTargetConfig configures the destination for records consumed
@@ -40,6 +52,10 @@ type SQSTargetConfig struct {
 	Region            string `hcl:"region" env:"TARGET_SQS_REGION"`
 	RoleARN           string `hcl:"role_arn,optional" env:"TARGET_SQS_ROLE_ARN"`
 	CustomAWSEndpoint string `hcl:"custom_aws_endpoint,optional" env:"SOURCE_CUSTOM_AWS_ENDPOINT"`
+
+	DelaySeconds          int    `hcl:"delay_seconds,optional" env:"TARGET_SQS_DELAY_SECONDS"`
+	MessageAttributes     string `hcl:"message_attributes,optional" env:"TARGET_SQS_MESSAGE_ATTRIBUTES"`
+	DeduplicationIDSource string `hcl:"deduplication_id_source,optional" env:"TARGET_SQS_DEDUPLICATION_ID_SOURCE"`
 }
 
 // SQSTarget holds a new client for writing messages to sqs
@@ -50,35 +66,101 @@ type SQSTarget struct {
 	region    string
 	accountID string
 
+	delaySeconds          int64
+	messageAttributes     map[string]*sqs.MessageAttributeValue
+	attributeBytes        int
+	fifo                  bool
+	deduplicationIDSource string
+
 	log *log.Entry
 }
 
 // newSQSTarget creates a new client for writing messages to sqs
-func newSQSTarget(region string, queueName string, roleARN string, customAWSendpoint string) (*SQSTarget, error) {
+func newSQSTarget(region string, queueName string, roleARN string, customAWSendpoint string, delaySeconds int, messageAttributes string, deduplicationIDSource string) (*SQSTarget, error) {
+	attributes, err := getMessageAttributes(messageAttributes)
+	if err != nil {
+		return nil, err
+	}
+
 	awsSession, awsConfig, awsAccountID, err := common.GetAWSSession(region, roleARN, customAWSendpoint)
 	if err != nil {
 		return nil, err
 	}
 	sqsClient := sqs.New(awsSession, awsConfig)
 
-	return newSQSTargetWithInterfaces(sqsClient, *awsAccountID, region, queueName)
+	return newSQSTargetWithInterfaces(sqsClient, *awsAccountID, region, queueName, delaySeconds, attributes, deduplicationIDSource)
 }
 
 // newSQSTargetWithInterfaces allows you to provide an SQS client directly to allow
 // for mocking and localstack usage
-func newSQSTargetWithInterfaces(client sqsiface.SQSAPI, awsAccountID string, region string, queueName string) (*SQSTarget, error) {
+func newSQSTargetWithInterfaces(client sqsiface.SQSAPI, awsAccountID string, region string, queueName string, delaySeconds int, messageAttributes map[string]string, deduplicationIDSource string) (*SQSTarget, error) {
+	fifo := strings.HasSuffix(queueName, sqsFIFOQueueSuffix)
+
+	if delaySeconds < 0 || delaySeconds > sqsMaxDelaySeconds {
+		return nil, errors.New(fmt.Sprintf("Invalid delay_seconds %d, must be between 0 and %d", delaySeconds, sqsMaxDelaySeconds))
+	}
+	if fifo && delaySeconds > 0 {
+		return nil, errors.New("delay_seconds cannot be used with FIFO queues, set a delay on the queue itself instead")
+	}
+	if len(messageAttributes) > sqsMaxMessageAttributes {
+		return nil, errors.New(fmt.Sprintf("Too many message attributes, SQS allows at most %d", sqsMaxMessageAttributes))
+	}
+
+	switch deduplicationIDSource {
+	case "", "content", "partition_key", "none":
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid deduplication_id_source '%s', must be one of 'content', 'partition_key' or 'none'", deduplicationIDSource))
+	}
+
+	// Message attributes count towards the size limits, so the bytes they take up are kept aside
+	var attributes map[string]*sqs.MessageAttributeValue
+	attributeBytes := 0
+	if len(messageAttributes) > 0 {
+		attributes = make(map[string]*sqs.MessageAttributeValue, len(messageAttributes))
+		for name, value := range messageAttributes {
+			attributes[name] = &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+			attributeBytes += len(name) + len("String") + len(value)
+		}
+	}
+	if sqsSendMessageBatchChunkSize*attributeBytes >= sqsSendMessageBatchByteLimit {
+		return nil, errors.New(fmt.Sprintf("Message attributes take up %d bytes per message, which leaves no room for message data within the %d byte limit of a batch of %d messages", attributeBytes, sqsSendMessageBatchByteLimit, sqsSendMessageBatchChunkSize))
+	}
+
 	return &SQSTarget{
-		client:    client,
-		queueName: queueName,
-		region:    region,
-		accountID: awsAccountID,
-		log:       log.WithFields(log.Fields{"target": "sqs", "cloud": "AWS", "region": region, "queue": queueName}),
+		client:                client,
+		queueName:             queueName,
+		region:                region,
+		accountID:             awsAccountID,
+		delaySeconds:          int64(delaySeconds),
+		messageAttributes:     attributes,
+		attributeBytes:        attributeBytes,
+		fifo:                  fifo,
+		deduplicationIDSource: deduplicationIDSource,
+		log:                   log.WithFields(log.Fields{"target": "sqs", "cloud": "AWS", "region": region, "queue": queueName}),
 	}, nil
 }
 
 // SQSTargetConfigFunction creates an SQSTarget from an SQSTargetConfig
 func SQSTargetConfigFunction(c *SQSTargetConfig) (*SQSTarget, error) {
-	return newSQSTarget(c.Region, c.QueueName, c.RoleARN, c.CustomAWSEndpoint)
+	return newSQSTarget(c.Region, c.QueueName, c.RoleARN, c.CustomAWSEndpoint, c.DelaySeconds, c.MessageAttributes, c.DeduplicationIDSource)
+}
+
+// getMessageAttributes parses the message attributes, which are provided as a JSON object of string values
+func getMessageAttributes(messageAttributes string) (map[string]string, error) {
+	if messageAttributes == "" {
+		return nil, nil
+	}
+	var parsed map[string]string
+
+	err := json.Unmarshal([]byte(messageAttributes), &parsed)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing message attributes. Ensure that message attributes are provided as a JSON of string key-value pairs")
+	}
+
+	return parsed, nil
 }
 
 // The SQSTargetAdapter type is an adapter for functions to be used as
@@ -93,7 +175,9 @@ func (f SQSTargetAdapter) Create(i interface{}) (interface{}, error) {
 // ProvideDefault implements the ComponentConfigurable interface.
 func (f SQSTargetAdapter) ProvideDefault() (interface{}, error) {
 	// Provide defaults if any
-	cfg := &SQSTargetConfig{}
+	cfg := &SQSTargetConfig{
+		DeduplicationIDSource: "content",
+	}
 
 	return cfg, nil
 }
@@ -119,7 +203,7 @@ func (st *SQSTarget) Write(messages []*models.Message) (*models.TargetWriteResul
 		messages,
 		sqsSendMessageBatchChunkSize,
 		st.MaximumAllowedMessageSizeBytes(),
-		sqsSendMessageBatchByteLimit,
+		sqsSendMessageBatchByteLimit-sqsSendMessageBatchChunkSize*st.attributeBytes,
 	)
 
 	writeResult := &models.TargetWriteResult{
@@ -149,21 +233,42 @@ func (st *SQSTarget) process(messages []*models.Message) (*models.TargetWriteRes
 	messageCount := int64(len(messages))
 	st.log.Debugf("Writing chunk of %d messages to target queue ...", messageCount)
 
+	// Entry IDs are the index of the message in the chunk, so that each result maps back to exactly one message
 	lookup := make(map[string]*models.Message)
 
-	entries := make([]*sqs.SendMessageBatchRequestEntry, messageCount)
-	for i := 0; i < len(entries); i++ {
-		msg := messages[i]
+	var entries []*sqs.SendMessageBatchRequestEntry
+	var invalid []*models.Message
+	for i, msg := range messages {
 		msgID := strconv.Itoa(i)
 
-		entries[i] = &sqs.SendMessageBatchRequestEntry{
-			DelaySeconds: aws.Int64(0),
-			MessageBody:  aws.String(string(msg.Data)),
-			Id:           aws.String(msgID),
+		entry := &sqs.SendMessageBatchRequestEntry{
+			MessageBody:       aws.String(string(msg.Data)),
+			MessageAttributes: st.messageAttributes,
+			Id:                aws.String(msgID),
+		}
+		if st.fifo {
+			if err := st.setFIFOFields(entry, msg); err != nil {
+				msg.SetError(err)
+				invalid = append(invalid, msg)
+				continue
+			}
+		} else {
+			entry.DelaySeconds = aws.Int64(st.delaySeconds)
 		}
+
+		entries = append(entries, entry)
 		lookup[msgID] = msg
 	}
 
+	if len(entries) == 0 {
+		return models.NewTargetWriteResult(
+			nil,
+			nil,
+			nil,
+			invalid,
+		), nil
+	}
+
 	requestStarted := time.Now()
 	res, err := st.client.SendMessageBatch(&sqs.SendMessageBatchInput{
 		Entries:  entries,
@@ -171,32 +276,38 @@ func (st *SQSTarget) process(messages []*models.Message) (*models.TargetWriteRes
 	})
 	requestFinished := time.Now()
 
-	for _, msg := range messages {
+	for _, msg := range lookup {
 		msg.TimeRequestStarted = requestStarted
 		msg.TimeRequestFinished = requestFinished
 	}
 
 	if err != nil {
-		failed := messages
+		failed := make([]*models.Message, 0, len(entries))
+		for _, entry := range entries {
+			failed = append(failed, lookup[*entry.Id])
+		}
 
 		return models.NewTargetWriteResult(
 			nil,
 			failed,
 			nil,
-			nil,
+			invalid,
 		), errors.Wrap(err, "Failed to send message batch to SQS queue")
 	}
 
 	var sent []*models.Message
 	var failed []*models.Message
-	var invalid []*models.Message
 	var errResult error
 
 	for _, f := range res.Failed {
-		msg := lookup[*f.Id]
-		fErr := errors.New(fmt.Sprintf("%s: %s", *f.Code, *f.Message))
+		msg, ok := lookup[aws.StringValue(f.Id)]
+		if !ok {
+			st.log.Warnf("Got failed result for unknown entry ID '%s' in sent batch results", aws.StringValue(f.Id))
+			continue
+		}
+		fErr := errors.New(fmt.Sprintf("%s: %s", aws.StringValue(f.Code), aws.StringValue(f.Message)))
 
-		if *f.Code == sqs.ErrCodeInvalidMessageContents {
+		if aws.StringValue(f.Code) == sqs.ErrCodeInvalidMessageContents {
 			st.log.Warnf(fErr.Error())
 
 			// Append error to message
@@ -207,23 +318,29 @@ func (st *SQSTarget) process(messages []*models.Message) (*models.TargetWriteRes
 			failed = append(failed, msg)
 		}
 
-		delete(lookup, *f.Id)
+		delete(lookup, aws.StringValue(f.Id))
 	}
 
 	for _, s := range res.Successful {
-		msg := lookup[*s.Id]
+		msg, ok := lookup[aws.StringValue(s.Id)]
+		if !ok {
+			st.log.Warnf("Got successful result for unknown entry ID '%s' in sent batch results", aws.StringValue(s.Id))
+			continue
+		}
 		if msg.AckFunc != nil {
 			msg.AckFunc()
 		}
 		sent = append(sent, msg)
 
-		delete(lookup, *s.Id)
+		delete(lookup, aws.StringValue(s.Id))
 	}
 
 	if len(lookup) != 0 {
 		st.log.Warnf("Not all messages found in sent batch results; will re-send...")
-		for _, msg := range lookup {
-			failed = append(failed, msg)
+		for _, entry := range entries {
+			if msg, ok := lookup[*entry.Id]; ok {
+				failed = append(failed, msg)
+			}
 		}
 	}
 
@@ -236,6 +353,30 @@ func (st *SQSTarget) process(messages []*models.Message) (*models.TargetWriteRes
 	), errResult
 }
 
+// setFIFOFields sets the message group ID of an entry from the partition key of the message,
+// and the deduplication ID from the configured source
+func (st *SQSTarget) setFIFOFields(entry *sqs.SendMessageBatchRequestEntry, msg *models.Message) error {
+	if msg.PartitionKey == "" {
+		return errors.New("Messages sent to a FIFO queue must have a partition key to use as the message group ID")
+	}
+	if len(msg.PartitionKey) > sqsMaxFIFOIDLength {
+		return errors.New(fmt.Sprintf("Partition key is %d characters long, but message group IDs can be at most %d", len(msg.PartitionKey), sqsMaxFIFOIDLength))
+	}
+	entry.MessageGroupId = aws.String(msg.PartitionKey)
+
+	switch st.deduplicationIDSource {
+	case "", "content":
+		hash := sha256.Sum256(msg.Data)
+		entry.MessageDeduplicationId = aws.String(hex.EncodeToString(hash[:]))
+	case "partition_key":
+		entry.MessageDeduplicationId = aws.String(msg.PartitionKey)
+	case "none":
+		// The queue must have content-based deduplication enabled
+	}
+
+	return nil
+}
+
 // Open fetches the queue URL for this target
 func (st *SQSTarget) Open() {
 	urlResult, err := st.client.GetQueueUrl(&sqs.GetQueueUrlInput{
@@ -257,7 +398,7 @@ func (st *SQSTarget) Close() {
 // MaximumAllowedMessageSizeBytes returns the max number of bytes that can be sent
 // per message for this target
 func (st *SQSTarget) MaximumAllowedMessageSizeBytes() int {
-	return sqsSendMessageByteLimit
+	return sqsSendMessageByteLimit - st.attributeBytes
 }
 
 // GetID returns the identifier for this target
@@ -8,14 +8,56 @@
 package target
 
 import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/statsreceiver"
 	"github.com/snowplow/snowbridge/pkg/testutil"
 )
 
+// mockSQSClient records the entries it is sent, and fails those whose body is in failures with the mapped error code
+type mockSQSClient struct {
+	sqsiface.SQSAPI
+	failures map[string]string
+	entries  []*sqs.SendMessageBatchRequestEntry
+}
+
+func (m *mockSQSClient) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	m.entries = append(m.entries, input.Entries...)
+
+	// Results aren't in the same order as the entries, and are only matched up by ID
+	output := &sqs.SendMessageBatchOutput{}
+	for i := len(input.Entries) - 1; i >= 0; i-- {
+		entry := input.Entries[i]
+		if code, ok := m.failures[*entry.MessageBody]; ok {
+			output.Failed = append(output.Failed, &sqs.BatchResultErrorEntry{
+				Id:          entry.Id,
+				Code:        aws.String(code),
+				Message:     aws.String("failed"),
+				SenderFault: aws.Bool(true),
+			})
+			continue
+		}
+		output.Successful = append(output.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:        entry.Id,
+			MessageId: aws.String("id"),
+		})
+	}
+	return output, nil
+}
+
 func TestSQSTarget_WriteFailure(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -25,7 +67,7 @@ func TestSQSTarget_WriteFailure(t *testing.T) {
 
 	client := testutil.GetAWSLocalstackSQSClient()
 
-	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "not-exists")
+	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "not-exists", 0, nil, "content")
 	assert.Nil(err)
 	assert.NotNil(target)
 	assert.Equal("arn:aws:sqs:us-east-1:00000000000:not-exists", target.GetID())
@@ -52,7 +94,7 @@ func TestSQSTarget_WriteSuccess(t *testing.T) {
 	queueURL := queueRes.QueueUrl
 	defer testutil.DeleteAWSLocalstackSQSQueue(client, queueURL)
 
-	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, queueName)
+	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, queueName, 0, nil, "content")
 	assert.Nil(err)
 	assert.NotNil(target)
 
@@ -95,7 +137,7 @@ func TestSQSTarget_WritePartialFailure_OversizeRecord(t *testing.T) {
 	queueURL := queueRes.QueueUrl
 	defer testutil.DeleteAWSLocalstackSQSQueue(client, queueURL)
 
-	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, queueName)
+	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, queueName, 0, nil, "content")
 	assert.Nil(err)
 	assert.NotNil(target)
 
@@ -122,3 +164,180 @@ func TestSQSTarget_WritePartialFailure_OversizeRecord(t *testing.T) {
 	assert.Equal(int64(0), writeRes.FailedCount)
 	assert.Equal(1, len(writeRes.Oversized))
 }
+
+func TestNewSQSTarget_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockSQSClient{}
+
+	_, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "queue", 901, nil, "content")
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("Invalid delay_seconds 901, must be between 0 and 900", err.Error())
+	}
+
+	_, err2 := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "queue.fifo", 10, nil, "content")
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("delay_seconds cannot be used with FIFO queues, set a delay on the queue itself instead", err2.Error())
+	}
+
+	_, err3 := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "queue.fifo", 0, nil, "event_id")
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Equal("Invalid deduplication_id_source 'event_id', must be one of 'content', 'partition_key' or 'none'", err3.Error())
+	}
+
+	_, err4 := getMessageAttributes(`{"app":1}`)
+	assert.NotNil(err4)
+	if err4 != nil {
+		assert.Regexp("Error parsing message attributes.*", err4.Error())
+	}
+
+	largeAttributes := map[string]string{"large": strings.Repeat("a", 26204)}
+	_, err5 := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "queue", 0, largeAttributes, "content")
+	assert.NotNil(err5)
+	if err5 != nil {
+		assert.Equal("Message attributes take up 26215 bytes per message, which leaves no room for message data within the 262144 byte limit of a batch of 10 messages", err5.Error())
+	}
+}
+
+func TestSQSTarget_WriteFailedEntries(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockSQSClient{failures: map[string]string{
+		"1": "InternalError",
+		"3": sqs.ErrCodeInvalidMessageContents,
+		"4": "InternalError",
+	}}
+	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "queue", 30, map[string]string{"source": "snowbridge"}, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var acked []string
+	messages := testutil.GetSequentialTestMessages(6, nil)
+	for _, msg := range messages {
+		data := string(msg.Data)
+		msg.AckFunc = func() { acked = append(acked, data) }
+	}
+
+	writeRes, err := target.Write(messages)
+	assert.NotNil(err)
+
+	dataOf := func(msgs []*models.Message) []string {
+		var data []string
+		for _, msg := range msgs {
+			data = append(data, string(msg.Data))
+		}
+		return data
+	}
+	assert.ElementsMatch([]string{"0", "2", "5"}, acked)
+	assert.ElementsMatch([]string{"0", "2", "5"}, dataOf(writeRes.Sent))
+	assert.ElementsMatch([]string{"1", "4"}, dataOf(writeRes.Failed))
+	assert.Equal([]string{"3"}, dataOf(writeRes.Invalid))
+
+	for _, entry := range client.entries {
+		assert.Equal(int64(30), *entry.DelaySeconds)
+		assert.Equal("snowbridge", *entry.MessageAttributes["source"].StringValue)
+		assert.Nil(entry.MessageGroupId)
+		assert.Nil(entry.MessageDeduplicationId)
+	}
+}
+
+func TestSQSTarget_WriteFIFO(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockSQSClient{}
+	target, err := newSQSTargetWithInterfaces(client, "00000000000", testutil.AWSLocalstackRegion, "queue.fifo", 0, nil, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("Hello SQS!!"), PartitionKey: "group-1"},
+		{Data: []byte("Hello SQS!!"), PartitionKey: "group-2"},
+		{Data: []byte("No group")},
+	}
+
+	writeRes, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(int64(2), writeRes.SentCount)
+	assert.Equal(1, len(writeRes.Invalid))
+	assert.Equal("Messages sent to a FIFO queue must have a partition key to use as the message group ID", writeRes.Invalid[0].GetError().Error())
+
+	assert.Equal(2, len(client.entries))
+	assert.Equal("group-1", *client.entries[0].MessageGroupId)
+	assert.Equal("group-2", *client.entries[1].MessageGroupId)
+	assert.Nil(client.entries[0].DelaySeconds)
+
+	// The same content gets the same deduplication ID
+	assert.Equal("dc3d60da6217ff79ef44ff9a4c4f2e40fdace779a8df603ae8edb8ae364f7fe7", *client.entries[0].MessageDeduplicationId)
+	assert.Equal(*client.entries[0].MessageDeduplicationId, *client.entries[1].MessageDeduplicationId)
+
+	client2 := &mockSQSClient{}
+	target2, err := newSQSTargetWithInterfaces(client2, "00000000000", testutil.AWSLocalstackRegion, "queue.fifo", 0, nil, "partition_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err2 := target2.Write(messages[:1])
+	assert.Nil(err2)
+	assert.Equal("group-1", *client2.entries[0].MessageDeduplicationId)
+}
+
+// TestSQSTarget_WriteLatencies tests that a write split into several batches reports positive latencies
+// to the Prometheus stats receiver
+func TestSQSTarget_WriteLatencies(t *testing.T) {
+	assert := assert.New(t)
+
+	target, err := newSQSTargetWithInterfaces(&mockSQSClient{}, "00000000000", testutil.AWSLocalstackRegion, "queue", 0, nil, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pulled := time.Now().UTC().Add(-time.Second)
+	messages := testutil.GetSequentialTestMessages(25, nil)
+	for _, msg := range messages {
+		msg.TimePulled = pulled
+	}
+
+	writeRes, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(int64(25), writeRes.SentCount)
+	assert.True(writeRes.WriteTime.After(pulled))
+
+	// Find a free address to serve the metrics on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	r, err := statsreceiver.NewPrometheusReceiverWithTags(nil)(&statsreceiver.PrometheusStatsReceiverConfig{
+		Address: address,
+		Path:    "/metrics",
+		Prefix:  "snowplow_test",
+		Tags:    "{}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.ReceiveWrite(writeRes)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every latency is around a second, rather than measured from a zero write time
+	metrics := string(body)
+	assert.Contains(metrics, `snowplow_test_processing_latency_seconds_count{failure_type=""} 25`)
+	assert.Contains(metrics, `snowplow_test_processing_latency_seconds_bucket{failure_type="",le="0.512"} 0`)
+}
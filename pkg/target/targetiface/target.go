@@ -8,6 +8,8 @@
 package targetiface
 
 import (
+	"time"
+
 	"github.com/snowplow/snowbridge/pkg/models"
 )
 
@@ -19,3 +21,18 @@ type Target interface {
 	MaximumAllowedMessageSizeBytes() int
 	GetID() string
 }
+
+// AckDelayer is implemented by targets which buffer messages, and so may ack them some time after
+// they were written. Until then, they are reported as neither sent nor failed.
+type AckDelayer interface {
+	MaximumAckDelay() time.Duration
+}
+
+// MaximumAckDelay returns how long the target may take to ack the messages written to it,
+// which is 0 for targets which ack messages as they are written
+func MaximumAckDelay(t Target) time.Duration {
+	if d, ok := t.(AckDelayer); ok {
+		return d.MaximumAckDelay()
+	}
+	return 0
+}
@@ -0,0 +1,394 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/target/targetiface"
+)
+
+const (
+	teeAckModeAll     = "all"
+	teeAckModePrimary = "primary"
+)
+
+// TeeTargetConfig configures the targets every message is written to
+type TeeTargetConfig struct {
+	AckMode string             `hcl:"ack_mode,optional"`
+	Targets []*NestedComponent `hcl:"target,block"`
+}
+
+// TeeTarget writes every message to all of its targets. Messages are acked once they have been accepted
+// by every target, or only by the first target when it is the primary.
+type TeeTarget struct {
+	targets []targetiface.Target
+
+	// required is the number of targets, from the first, which must accept a message before it is acked.
+	// The other targets are written to on a best-effort basis.
+	required int
+
+	// pending holds the messages which are yet to be accepted by the targets required, and deferred the
+	// messages accepted after the writes of them returned, which are reported by the next write
+	pending  map[*models.Message]*teeMessage
+	deferred []*teeMessage
+	mutex    sync.Mutex
+
+	log *log.Entry
+}
+
+// teeMessage tracks the targets which have accepted a message, and the writes of it in progress
+type teeMessage struct {
+	message   *models.Message
+	accepted  []bool
+	remaining int
+	resolved  bool
+	sent      bool
+	reported  bool
+	writing   int
+}
+
+// teeWrite is a write to one of the targets, with the messages written by their copy
+type teeWrite struct {
+	batch     []*models.Message
+	originals map[*models.Message]*teeMessage
+	res       *models.TargetWriteResult
+	err       error
+}
+
+// newTeeTarget creates a target which writes every message to all the given targets
+func newTeeTarget(targets []targetiface.Target, ackMode string) (*TeeTarget, error) {
+	if len(targets) < 2 {
+		return nil, errors.New("The tee target must have at least two targets")
+	}
+
+	var required int
+	switch ackMode {
+	case teeAckModeAll:
+		required = len(targets)
+	case teeAckModePrimary:
+		required = 1
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid ack mode '%s', must be one of '%s' or '%s'", ackMode, teeAckModeAll, teeAckModePrimary))
+	}
+
+	return &TeeTarget{
+		targets:  targets,
+		required: required,
+		pending:  make(map[*models.Message]*teeMessage),
+		log:      log.WithFields(log.Fields{"target": "tee", "ack_mode": ackMode}),
+	}, nil
+}
+
+// TeeTargetConfigFunction returns a function creating a TeeTarget from a TeeTargetConfig,
+// which uses the given builder for its targets
+func TeeTargetConfigFunction(newTarget NestedTargetBuilder) func(c *TeeTargetConfig) (*TeeTarget, error) {
+	return func(c *TeeTargetConfig) (*TeeTarget, error) {
+		targets := make([]targetiface.Target, 0, len(c.Targets))
+		for i, tc := range c.Targets {
+			if tc.Use == nil {
+				return nil, errors.New(fmt.Sprintf("Target %d of the tee target has no use block", i))
+			}
+			t, err := newTarget(tc.Use.Name, tc.Use.Body)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Error creating target %d", i))
+			}
+			targets = append(targets, t)
+		}
+
+		return newTeeTarget(targets, c.AckMode)
+	}
+}
+
+// The TeeTargetAdapter type is an adapter for functions to be used as
+// pluggable components for Tee Target. It implements the Pluggable interface.
+type TeeTargetAdapter func(i interface{}) (interface{}, error)
+
+// Create implements the ComponentCreator interface.
+func (f TeeTargetAdapter) Create(i interface{}) (interface{}, error) {
+	return f(i)
+}
+
+// ProvideDefault implements the ComponentConfigurable interface.
+func (f TeeTargetAdapter) ProvideDefault() (interface{}, error) {
+	// Provide defaults for the optional parameters
+	// whose default is not their zero value.
+	cfg := &TeeTargetConfig{
+		AckMode: teeAckModeAll,
+	}
+
+	return cfg, nil
+}
+
+// AdaptTeeTargetFunc returns a TeeTargetAdapter.
+func AdaptTeeTargetFunc(f func(c *TeeTargetConfig) (*TeeTarget, error)) TeeTargetAdapter {
+	return func(i interface{}) (interface{}, error) {
+		cfg, ok := i.(*TeeTargetConfig)
+		if !ok {
+			return nil, errors.New("invalid input, expected TeeTargetConfig")
+		}
+
+		return f(cfg)
+	}
+}
+
+// Write writes the messages to each target concurrently. Messages retried after a failed write are
+// only written to the targets which haven't accepted them yet.
+//
+// Only the targets required to accept a message decide whether it is failed, oversized or invalid. Messages
+// are sent once they are accepted by all of them, which for targets which buffer messages can be reported
+// by a later write. The result of the write to each target is reported in the destinations of the result.
+func (tt *TeeTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	tt.log.Debugf("Writing %d messages to %d targets ...", len(messages), len(tt.targets))
+
+	writes, states := tt.prepare(messages)
+
+	var wg sync.WaitGroup
+	for i, w := range writes {
+		if len(w.batch) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(t targetiface.Target, w *teeWrite) {
+			defer wg.Done()
+
+			w.res, w.err = t.Write(w.batch)
+			if w.res == nil {
+				w.res = models.NewTargetWriteResult(nil, w.batch, nil, nil)
+			}
+		}(tt.targets[i], w)
+	}
+	wg.Wait()
+
+	failed := make(map[*teeMessage]bool)
+	oversized := make(map[*teeMessage]error)
+	invalid := make(map[*teeMessage]error)
+	var destinations []*models.DestinationWriteResult
+	var errResult error
+
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+
+	for i, w := range writes {
+		if w.res == nil {
+			continue
+		}
+		id := tt.targets[i].GetID()
+		destinations = append(destinations, models.NewDestinationWriteResult(id, w.res))
+
+		if i >= tt.required {
+			// Messages which can never be written to a best-effort target are given up on
+			for _, unsendable := range [][]*models.Message{w.res.Oversized, w.res.Invalid} {
+				for _, msg := range unsendable {
+					if state, ok := w.originals[msg]; ok {
+						state.accepted[i] = true
+						tt.log.WithFields(log.Fields{"error": msg.GetError()}).Warnf("Giving up on writing message to best-effort target %s", id)
+					}
+				}
+			}
+			if w.err != nil {
+				tt.log.WithFields(log.Fields{"error": w.err}).Warnf("Error writing to best-effort target %s", id)
+			}
+			continue
+		}
+
+		for _, msg := range w.res.Failed {
+			if state, ok := w.originals[msg]; ok {
+				failed[state] = true
+			}
+		}
+		for _, msg := range w.res.Oversized {
+			if state, ok := w.originals[msg]; ok {
+				oversized[state] = msg.GetError()
+			}
+		}
+		for _, msg := range w.res.Invalid {
+			if state, ok := w.originals[msg]; ok {
+				invalid[state] = msg.GetError()
+			}
+		}
+		if w.err != nil {
+			errResult = multierror.Append(errResult, errors.Wrap(w.err, fmt.Sprintf("Error writing to target %s", id)))
+		}
+	}
+
+	// Only the messages of this write are reported, along with those accepted after their write returned
+	var sentMessages, failedMessages, oversizedMessages, invalidMessages []*models.Message
+	for j, msg := range messages {
+		state := states[j]
+		state.writing--
+
+		if state.sent {
+			if !state.reported {
+				state.reported = true
+				sentMessages = append(sentMessages, msg)
+			}
+			continue
+		}
+		if state.resolved {
+			continue
+		}
+
+		if err, ok := invalid[state]; ok {
+			tt.resolve(state)
+			msg.SetError(err)
+			invalidMessages = append(invalidMessages, msg)
+		} else if err, ok := oversized[state]; ok {
+			tt.resolve(state)
+			msg.SetError(err)
+			oversizedMessages = append(oversizedMessages, msg)
+		} else if failed[state] {
+			failedMessages = append(failedMessages, msg)
+		}
+	}
+
+	for _, state := range tt.deferred {
+		if !state.reported {
+			state.reported = true
+			sentMessages = append(sentMessages, state.message)
+		}
+	}
+	tt.deferred = nil
+
+	writeResult := models.NewTargetWriteResult(sentMessages, failedMessages, oversizedMessages, invalidMessages)
+	writeResult.Destinations = destinations
+
+	tt.log.Debugf("Successfully wrote %d/%d messages", len(writeResult.Sent), len(messages))
+	return writeResult, errResult
+}
+
+// prepare returns the writes to each target, of copies of the messages which it hasn't accepted yet,
+// and the state of each message
+func (tt *TeeTarget) prepare(messages []*models.Message) ([]*teeWrite, []*teeMessage) {
+	tt.mutex.Lock()
+	defer tt.mutex.Unlock()
+
+	writes := make([]*teeWrite, len(tt.targets))
+	for i := range writes {
+		writes[i] = &teeWrite{
+			batch:     make([]*models.Message, 0, len(messages)),
+			originals: make(map[*models.Message]*teeMessage, len(messages)),
+		}
+	}
+
+	states := make([]*teeMessage, len(messages))
+	for j, msg := range messages {
+		state, ok := tt.pending[msg]
+		if !ok {
+			state = &teeMessage{
+				message:   msg,
+				accepted:  make([]bool, len(tt.targets)),
+				remaining: tt.required,
+			}
+			tt.pending[msg] = state
+		}
+		state.writing++
+		states[j] = state
+
+		for i, w := range writes {
+			if state.accepted[i] {
+				continue
+			}
+			c := *msg
+			c.AckFunc = tt.ackFunc(state, i)
+			w.batch = append(w.batch, &c)
+			w.originals[&c] = state
+		}
+	}
+	return writes, states
+}
+
+// ackFunc returns the function acking a copy of a message written to a target. The message
+// itself is acked once all the targets required have accepted it, and is reported as sent by
+// the write of it, or by the next write if it was accepted after that returned.
+func (tt *TeeTarget) ackFunc(state *teeMessage, i int) func() {
+	return func() {
+		tt.mutex.Lock()
+		defer tt.mutex.Unlock()
+
+		if state.resolved || state.accepted[i] {
+			return
+		}
+		state.accepted[i] = true
+
+		if i < tt.required {
+			state.remaining--
+			if state.remaining == 0 {
+				tt.resolve(state)
+				state.sent = true
+				if state.writing == 0 {
+					tt.deferred = append(tt.deferred, state)
+				}
+				if state.message.AckFunc != nil {
+					state.message.AckFunc()
+				}
+			}
+		}
+	}
+}
+
+// resolve stops tracking a message, once it has been sent or can't be sent
+func (tt *TeeTarget) resolve(state *teeMessage) {
+	state.resolved = true
+	delete(tt.pending, state.message)
+}
+
+// Open opens all the targets
+func (tt *TeeTarget) Open() {
+	for _, t := range tt.targets {
+		t.Open()
+	}
+}
+
+// Close closes all the targets
+func (tt *TeeTarget) Close() {
+	for _, t := range tt.targets {
+		t.Close()
+	}
+}
+
+// MaximumAllowedMessageSizeBytes returns the smallest of the maximum message sizes of the
+// targets required to accept messages
+func (tt *TeeTarget) MaximumAllowedMessageSizeBytes() int {
+	min := tt.targets[0].MaximumAllowedMessageSizeBytes()
+	for _, t := range tt.targets[1:tt.required] {
+		if size := t.MaximumAllowedMessageSizeBytes(); size < min {
+			min = size
+		}
+	}
+	return min
+}
+
+// MaximumAckDelay returns the longest of the delays before the targets required to accept messages ack them
+func (tt *TeeTarget) MaximumAckDelay() time.Duration {
+	var max time.Duration
+	for _, t := range tt.targets[:tt.required] {
+		if delay := targetiface.MaximumAckDelay(t); delay > max {
+			max = delay
+		}
+	}
+	return max
+}
+
+// GetID returns an identifier for this target, made of the identifiers of the targets written to
+func (tt *TeeTarget) GetID() string {
+	ids := make([]string, 0, len(tt.targets))
+	for _, t := range tt.targets {
+		ids = append(ids, t.GetID())
+	}
+	return fmt.Sprintf("tee(%s)", strings.Join(ids, ","))
+}
@@ -0,0 +1,355 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/target/targetiface"
+)
+
+// teeTestTarget keeps the data of the messages written to it. It fails the given number of writes first,
+// rejects messages with the invalid data, and when buffering only acks messages once flushed.
+type teeTestTarget struct {
+	id        string
+	failures  int
+	invalid   string
+	buffering bool
+
+	written  []string
+	buffered []*models.Message
+	mutex    sync.Mutex
+}
+
+func (t *teeTestTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, msg := range messages {
+		t.written = append(t.written, string(msg.Data))
+	}
+	if t.failures > 0 {
+		t.failures--
+		return models.NewTargetWriteResult(nil, messages, nil, nil), errors.New("write failed")
+	}
+
+	var sent, invalid []*models.Message
+	for _, msg := range messages {
+		switch {
+		case string(msg.Data) == t.invalid:
+			msg.SetError(errors.New("invalid data"))
+			invalid = append(invalid, msg)
+		case t.buffering:
+			t.buffered = append(t.buffered, msg)
+		default:
+			msg.AckFunc()
+			sent = append(sent, msg)
+		}
+	}
+	return models.NewTargetWriteResult(sent, nil, nil, invalid), nil
+}
+
+func (t *teeTestTarget) flush() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, msg := range t.buffered {
+		msg.AckFunc()
+	}
+	t.buffered = nil
+}
+
+func (t *teeTestTarget) Open() {}
+
+func (t *teeTestTarget) Close() {}
+
+func (t *teeTestTarget) MaximumAllowedMessageSizeBytes() int { return len(t.id) }
+
+func (t *teeTestTarget) GetID() string { return t.id }
+
+func TestTeeTarget_WriteAll(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := &teeTestTarget{id: "primary", failures: 1}
+	archive := &teeTestTarget{id: "archive"}
+	target, err := newTeeTarget([]targetiface.Target{primary, archive}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("tee(primary,archive)", target.GetID())
+	assert.Equal(7, target.MaximumAllowedMessageSizeBytes())
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("one"), AckFunc: ackFunc},
+		{Data: []byte("two"), AckFunc: ackFunc},
+	}
+
+	// Messages are only acked once every target has accepted them
+	writeResult, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Error writing to target primary: write failed", err.Error())
+	}
+	assert.Equal(0, len(writeResult.Sent))
+	assert.Equal(messages, writeResult.Failed)
+	assert.Equal(int64(0), ackOps)
+	assert.Equal([]*models.DestinationWriteResult{
+		{ID: "primary", FailedCount: 2},
+		{ID: "archive", SentCount: 2},
+	}, writeResult.Destinations)
+
+	// The failed messages are retried only on the target which didn't accept them
+	writeResult2, err2 := target.Write(writeResult.Failed)
+	assert.Nil(err2)
+	assert.Equal(messages, writeResult2.Sent)
+	assert.Equal(int64(2), ackOps)
+	assert.Equal([]*models.DestinationWriteResult{{ID: "primary", SentCount: 2}}, writeResult2.Destinations)
+
+	assert.Equal([]string{"one", "two", "one", "two"}, primary.written)
+	assert.Equal([]string{"one", "two"}, archive.written)
+}
+
+func TestTeeTarget_WritePrimary(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := &teeTestTarget{id: "primary", failures: 1}
+	archive := &teeTestTarget{id: "archive", failures: 2, invalid: "two"}
+	target, err := newTeeTarget([]targetiface.Target{primary, archive}, "primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(7, target.MaximumAllowedMessageSizeBytes())
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("one"), AckFunc: ackFunc},
+		{Data: []byte("two"), AckFunc: ackFunc},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Regexp("Error writing to target primary: write failed", err.Error())
+	}
+	assert.Equal(messages, writeResult.Failed)
+
+	// Failures of the other targets are reported, but don't prevent messages being acked once
+	// the primary target accepts them
+	writeResult2, err2 := target.Write(writeResult.Failed)
+	assert.Nil(err2)
+	assert.Equal(messages, writeResult2.Sent)
+	assert.Equal(0, len(writeResult2.Failed))
+	assert.Equal(int64(2), ackOps)
+	assert.Equal([]*models.DestinationWriteResult{
+		{ID: "primary", SentCount: 2},
+		{ID: "archive", FailedCount: 2},
+	}, writeResult2.Destinations)
+
+	// Messages which the other targets reject are not written to them again, but are reported
+	logger, hook := test.NewNullLogger()
+	target.log = logger.WithFields(log.Fields{"target": "tee"})
+
+	writeResult3, err3 := target.Write([]*models.Message{{Data: []byte("two"), AckFunc: ackFunc}})
+	assert.Nil(err3)
+	assert.Equal(1, len(writeResult3.Sent))
+	assert.Equal(0, len(writeResult3.Invalid))
+	assert.Equal([]*models.DestinationWriteResult{
+		{ID: "primary", SentCount: 1},
+		{ID: "archive", InvalidCount: 1},
+	}, writeResult3.Destinations)
+
+	if assert.Equal(1, len(hook.Entries)) {
+		assert.Equal(log.WarnLevel, hook.LastEntry().Level)
+		assert.Equal("Giving up on writing message to best-effort target archive", hook.LastEntry().Message)
+		assert.Equal("invalid data", hook.LastEntry().Data["error"].(error).Error())
+	}
+}
+
+func TestTeeTarget_WriteInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := &teeTestTarget{id: "primary"}
+	archive := &teeTestTarget{id: "archive", invalid: "two"}
+	target, err := newTeeTarget([]targetiface.Target{primary, archive}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("one"), AckFunc: ackFunc},
+		{Data: []byte("two"), AckFunc: ackFunc},
+	}
+
+	// Messages which any of the targets rejects are invalid
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal([]*models.Message{messages[0]}, writeResult.Sent)
+	assert.Equal([]*models.Message{messages[1]}, writeResult.Invalid)
+	assert.Equal("invalid data", messages[1].GetError().Error())
+	assert.Equal(int64(1), ackOps)
+}
+
+func TestTeeTarget_WriteBuffering(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := &teeTestTarget{id: "primary"}
+	archive := &teeTestTarget{id: "archive", buffering: true}
+	target, err := newTeeTarget([]targetiface.Target{primary, archive}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ackOps int64
+	ackFunc := func() {
+		atomic.AddInt64(&ackOps, 1)
+	}
+
+	messages := []*models.Message{
+		{Data: []byte("one"), AckFunc: ackFunc},
+	}
+
+	writeResult, err := target.Write(messages)
+	assert.Nil(err)
+	assert.Equal(0, len(writeResult.Sent))
+	assert.Equal(0, len(writeResult.Failed))
+	assert.Equal(int64(0), ackOps)
+
+	// Messages accepted once a target flushes them are reported by the next write
+	archive.flush()
+	assert.Equal(int64(1), ackOps)
+
+	writeResult2, err2 := target.Write(nil)
+	assert.Nil(err2)
+	assert.Equal(messages, writeResult2.Sent)
+}
+
+// teeDelayedTarget is a target which may take the given delay to ack the messages written to it
+type teeDelayedTarget struct {
+	teeTestTarget
+	delay time.Duration
+}
+
+func (t *teeDelayedTarget) MaximumAckDelay() time.Duration { return t.delay }
+
+func TestTeeTarget_MaximumAckDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := &teeTestTarget{id: "primary"}
+	archive := &teeDelayedTarget{teeTestTarget: teeTestTarget{id: "archive"}, delay: time.Minute}
+
+	// Only the targets required to accept messages delay their acks
+	target, err := newTeeTarget([]targetiface.Target{primary, archive}, "primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(time.Duration(0), target.MaximumAckDelay())
+
+	target, err = newTeeTarget([]targetiface.Target{primary, archive}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(time.Minute, target.MaximumAckDelay())
+}
+
+// teeBlockingTarget acks every message written to it, then blocks writes of the blocking data until released
+type teeBlockingTarget struct {
+	teeTestTarget
+	blocking string
+	release  chan struct{}
+}
+
+func (t *teeBlockingTarget) Write(messages []*models.Message) (*models.TargetWriteResult, error) {
+	for _, msg := range messages {
+		msg.AckFunc()
+	}
+	if len(messages) > 0 && string(messages[0].Data) == t.blocking {
+		<-t.release
+	}
+	return models.NewTargetWriteResult(messages, nil, nil, nil), nil
+}
+
+func TestTeeTarget_WriteConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := &teeTestTarget{id: "primary"}
+	archive := &teeBlockingTarget{teeTestTarget: teeTestTarget{id: "archive"}, blocking: "one", release: make(chan struct{})}
+	target, err := newTeeTarget([]targetiface.Target{primary, archive}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acked := make(chan struct{})
+	first := []*models.Message{{Data: []byte("one"), AckFunc: func() { close(acked) }}}
+	second := []*models.Message{{Data: []byte("two"), AckFunc: func() {}}}
+
+	// The first message is accepted by both targets while its write is still in progress
+	done := make(chan *models.TargetWriteResult)
+	go func() {
+		res, _ := target.Write(first)
+		done <- res
+	}()
+	<-acked
+
+	// Each write only reports its own messages as sent
+	writeResult, err := target.Write(second)
+	assert.Nil(err)
+	assert.Equal(second, writeResult.Sent)
+
+	close(archive.release)
+	assert.Equal(first, (<-done).Sent)
+}
+
+func TestTeeTargetConfigFunction_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, newTarget := routerTestTargets("a", "b")
+
+	target, err := TeeTargetConfigFunction(newTarget)(&TeeTargetConfig{AckMode: "all", Targets: []*NestedComponent{routerTestUse("a")}})
+	assert.Nil(target)
+	assert.NotNil(err)
+	if err != nil {
+		assert.Equal("The tee target must have at least two targets", err.Error())
+	}
+
+	target2, err2 := TeeTargetConfigFunction(newTarget)(&TeeTargetConfig{AckMode: "any", Targets: []*NestedComponent{routerTestUse("a"), routerTestUse("b")}})
+	assert.Nil(target2)
+	assert.NotNil(err2)
+	if err2 != nil {
+		assert.Equal("Invalid ack mode 'any', must be one of 'all' or 'primary'", err2.Error())
+	}
+
+	target3, err3 := TeeTargetConfigFunction(newTarget)(&TeeTargetConfig{AckMode: "all", Targets: []*NestedComponent{routerTestUse("a"), routerTestUse("kafka")}})
+	assert.Nil(target3)
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Equal("Error creating target 1: unknown target kafka", err3.Error())
+	}
+}
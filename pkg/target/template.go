@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+// templateFuncs are the helper functions available to target templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, eg. to embed an object from the message data in a body
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// base64 encodes a value with standard base64 encoding
+	"base64": func(v interface{}) string {
+		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+	},
+	// env returns the value of an environment variable
+	"env": os.Getenv,
+}
+
+// templateData is what target templates are rendered against
+type templateData struct {
+	// Data is the message data parsed as JSON, or nil if it isn't valid JSON
+	Data interface{}
+
+	// PartitionKey is the partition key of the message
+	PartitionKey string
+}
+
+// hasTemplateActions reports whether a configured value should be treated as a template
+func hasTemplateActions(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// parseTemplate parses a template for a target. Referencing a field which is missing from
+// the message data is an error when rendering, rather than rendering "<no value>".
+func parseTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error parsing %s template", name))
+	}
+	return tmpl, nil
+}
+
+// newTemplateData parses the message data for use in templates. Numbers are kept as they
+// appear in the data, rather than converted to floats.
+func newTemplateData(msg *models.Message) *templateData {
+	td := &templateData{PartitionKey: msg.PartitionKey}
+	if !json.Valid(msg.Data) {
+		return td
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(msg.Data))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return td
+	}
+	td.Data = data
+	return td
+}
+
+// renderTemplate renders a template against its data, which is usually a message's templateData
+func renderTemplate(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error rendering %s template", tmpl.Name()))
+	}
+	return buf.Bytes(), nil
+}
+
+// lazyTemplateData returns a function which parses the message data for use in templates the first
+// time it's called, so that messages are only parsed when a template is rendered for them
+func lazyTemplateData(msg *models.Message) func() *templateData {
+	var td *templateData
+	return func() *templateData {
+		if td == nil {
+			td = newTemplateData(msg)
+		}
+		return td
+	}
+}
+
+// templatedValue is a named value set for every message, such as a header, which is either static
+// or rendered from a template
+type templatedValue struct {
+	name     string
+	value    []byte
+	template *template.Template
+}
+
+// parseTemplatedValues parses named values, treating those with template actions as templates.
+// The values are sorted by name, so that they are always set in the same order. The kind of value
+// is used to name the templates in errors.
+func parseTemplatedValues(kind string, values map[string]string) ([]*templatedValue, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parsed []*templatedValue
+	for _, name := range names {
+		v := &templatedValue{name: name}
+		if hasTemplateActions(values[name]) {
+			tmpl, err := parseTemplate(fmt.Sprintf("%s %s", name, kind), values[name])
+			if err != nil {
+				return nil, err
+			}
+			v.template = tmpl
+		} else {
+			v.value = []byte(values[name])
+		}
+		parsed = append(parsed, v)
+	}
+
+	return parsed, nil
+}
+
+// render returns the value for a message, rendering the template if there is one
+func (v *templatedValue) render(data func() *templateData) ([]byte, error) {
+	if v.template == nil {
+		return v.value, nil
+	}
+	return renderTemplate(v.template, data())
+}
@@ -0,0 +1,44 @@
+//
+// Copyright (c) 2020-present Snowplow Analytics Ltd. All rights reserved.
+//
+// This program is licensed to you under the Snowplow Community License Version 1.0,
+// and you may not use this file except in compliance with the Snowplow Community License Version 1.0.
+// You may obtain a copy of the Snowplow Community License Version 1.0 at https://docs.snowplow.io/community-license-1.0
+
+package target
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/snowplow/snowbridge/pkg/models"
+)
+
+func TestNewTemplateData(t *testing.T) {
+	assert := assert.New(t)
+
+	td := newTemplateData(&models.Message{Data: []byte(`{"id":12345678901234567890,"app_id":"test"}`), PartitionKey: "pk"})
+	assert.Equal("pk", td.PartitionKey)
+
+	tmpl, err := parseTemplate("test", `{{ .Data.id }} {{ .Data.app_id }} {{ json .Data }} {{ base64 .Data.app_id }} {{ .PartitionKey }}`)
+	assert.Nil(err)
+	rendered, err1 := renderTemplate(tmpl, td)
+	assert.Nil(err1)
+	assert.Equal(`12345678901234567890 test {"app_id":"test","id":12345678901234567890} dGVzdA== pk`, string(rendered))
+
+	// Data which isn't JSON is left out, and referencing it is an error
+	td2 := newTemplateData(&models.Message{Data: []byte("app\tevent"), PartitionKey: "pk"})
+	assert.Nil(td2.Data)
+	_, err2 := renderTemplate(tmpl, td2)
+	assert.NotNil(err2)
+
+	// So is referencing a field which doesn't exist
+	tmpl3, err := parseTemplate("test", `{{ .Data.missing }}`)
+	assert.Nil(err)
+	_, err3 := renderTemplate(tmpl3, td)
+	assert.NotNil(err3)
+	if err3 != nil {
+		assert.Regexp("Error rendering test template: .*map has no entry for key \"missing\"", err3.Error())
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 )
@@ -206,6 +208,43 @@ func DeleteAWSLocalstackSQSQueue(client sqsiface.SQSAPI, queueURL *string) (*sqs
 	})
 }
 
+// --- S3 Testing
+
+// GetAWSLocalstackS3Client returns an S3 client
+func GetAWSLocalstackS3Client() s3iface.S3API {
+	return s3.New(GetAWSLocalstackSession())
+}
+
+// CreateAWSLocalstackS3Bucket creates a new S3 bucket
+func CreateAWSLocalstackS3Bucket(client s3iface.S3API, bucketName string) (*s3.CreateBucketOutput, error) {
+	return client.CreateBucket(&s3.CreateBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+}
+
+// DeleteAWSLocalstackS3Bucket deletes an existing S3 bucket, along with every object in it
+func DeleteAWSLocalstackS3Bucket(client s3iface.S3API, bucketName string) (*s3.DeleteBucketOutput, error) {
+	res, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range res.Contents {
+		_, err := client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    obj.Key,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return client.DeleteBucket(&s3.DeleteBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+}
+
 // PutNRecordsIntoKinesis puts n records into a kinesis stream. The records will contain `{dataPrefix} {n}` as their data.
 func PutNRecordsIntoKinesis(kinesisClient kinesisiface.KinesisAPI, n int, streamName string, dataPrefix string) error {
 	// Put N records into kinesis stream
@@ -10,7 +10,11 @@ package transformconfig
 import (
 	"fmt"
 
+	"github.com/hashicorp/hcl/v2"
+
 	"github.com/snowplow/snowbridge/config"
+	"github.com/snowplow/snowbridge/pkg/models"
+	"github.com/snowplow/snowbridge/pkg/target"
 	"github.com/snowplow/snowbridge/pkg/transform"
 	"github.com/snowplow/snowbridge/pkg/transform/engine"
 	"github.com/snowplow/snowbridge/pkg/transform/filter"
@@ -60,3 +64,41 @@ func GetTransformations(c *config.Config, supportedTransformations []config.Conf
 
 	return transform.NewTransformation(funcs...), nil
 }
+
+// RoutePredicateBuilder returns a builder for the predicates of the routes of the router target, from the
+// transformations supported. A route is matched by the messages which its transformation keeps.
+func RoutePredicateBuilder(c *config.Config, supportedTransformations []config.ConfigurationPair) target.RoutePredicateBuilder {
+	return func(name string, body hcl.Body) (target.RouteMatcher, error) {
+		decoderOpts := &config.DecoderOptions{
+			Input: body,
+		}
+
+		var component interface{}
+		var err error
+		for _, pair := range supportedTransformations {
+			if pair.Name == name {
+				component, err = c.CreateComponent(pair.Handle, decoderOpts)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		f, ok := component.(transform.TransformationFunction)
+		if !ok {
+			return nil, fmt.Errorf("could not interpret route predicate configuration for %q", name)
+		}
+
+		return func(message *models.Message) (bool, error) {
+			// The transformation runs on a copy, so that the message written is unchanged
+			msg := *message
+			msg.Data = append([]byte(nil), message.Data...)
+
+			success, _, failure, _ := f(&msg, nil)
+			if failure != nil {
+				return false, failure.GetError()
+			}
+			return success != nil, nil
+		}, nil
+	}
+}
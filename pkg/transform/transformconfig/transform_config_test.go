@@ -15,6 +15,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/snowplow/snowbridge/assets"
@@ -244,6 +245,68 @@ func TestEnginesAndTransformations(t *testing.T) {
 	}
 }
 
+func TestRoutePredicateBuilder(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(assets.AssetsRootDir, "test", "transformconfig", "TestGetTransformations", "configs", "atomic-filter.hcl")
+	t.Setenv("SNOWBRIDGE_CONFIG_FILE", filename)
+
+	c, err := config.NewConfig()
+	assert.NotNil(c)
+	if err != nil {
+		t.Fatalf("function NewConfig failed with error: %q", err.Error())
+	}
+
+	newPredicate := RoutePredicateBuilder(c, SupportedTransformations)
+
+	parser := hclparse.NewParser()
+	filterFile, diags := parser.ParseHCL([]byte(`
+atomic_field  = "app_id"
+regex         = "test-data1"
+filter_action = "keep"
+`), "filter.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	jsFile, diags := parser.ParseHCL([]byte(fmt.Sprintf(`script_path = %q`,
+		filepath.Join(assets.AssetsRootDir, "test", "transformconfig", "TestEnginesAndTransformations", "scripts", "js-alter-aid-1.js"))), "js.hcl")
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	filter, err := newPredicate("spEnrichedFilter", filterFile.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched, err := filter(&models.Message{Data: snowplowTsv1})
+	assert.Nil(err)
+	assert.True(matched)
+	matched2, err2 := filter(&models.Message{Data: snowplowTsv2})
+	assert.Nil(err2)
+	assert.False(matched2)
+	_, err3 := filter(&models.Message{Data: nonSnowplowString})
+	assert.NotNil(err3)
+
+	// Messages are matched unchanged by transformations which alter them
+	js, err := newPredicate("js", jsFile.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &models.Message{Data: snowplowJSON1}
+	matched4, err4 := js(message)
+	assert.Nil(err4)
+	assert.True(matched4)
+	assert.Equal(snowplowJSON1, message.Data)
+
+	_, err5 := newPredicate("fake", filterFile.Body)
+	assert.NotNil(err5)
+	if err5 != nil {
+		assert.Equal(`could not interpret route predicate configuration for "fake"`, err5.Error())
+	}
+}
+
 type expectedMessages struct {
 	Before []*models.Message
 	After  []*models.Message